@@ -0,0 +1,30 @@
+package fsdedupe
+
+// AlertPolicy defines thresholds for flagging duplicate groups as alerts,
+// so systemic duplication sources get noticed.
+// Zero thresholds are disabled.
+type AlertPolicy struct {
+	// MaxCount is a max number of same-content files (including the canonical one).
+	MaxCount int
+	// MaxTotalSize is a max total size of same-content files (including the canonical one).
+	MaxTotalSize int64
+}
+
+func (p AlertPolicy) matches(a Alert) bool {
+	return (p.MaxCount > 0 && a.Count > p.MaxCount) ||
+		(p.MaxTotalSize > 0 && a.TotalSize > p.MaxTotalSize)
+}
+
+// Alert describes a duplicate group exceeding AlertPolicy thresholds.
+type Alert struct {
+	// Hash is a hex-encoded content hash.
+	Hash string `json:"hash"`
+	// Canonical is a (first-seen) filename other duplicates point to.
+	Canonical string `json:"canonical"`
+	// Count is a number of same-content files (including the canonical one).
+	Count int `json:"count"`
+	// Size is a single file size.
+	Size int64 `json:"size"`
+	// TotalSize is a total size of all same-content files (including the canonical one).
+	TotalSize int64 `json:"total_size"`
+}
@@ -0,0 +1,271 @@
+// Package artifact defines the versioned file format of fsdedupe long-running operation artifacts:
+// checkpoints (resume), journals (rollback) and plans (apply).
+// It has no dependencies on fsdedupe itself, so third-party tools can read, write and validate the artifacts.
+//
+// An artifact is JSON lines: a Header line, followed by Record lines:
+//
+//	{"format":"fsdedupe","kind":"checkpoint","version":1}
+//	{"type":"remaining","filename":"/data/b.txt"}
+//	{"type":"index","hash":"...","canonical":"/data/a.txt","size":4,"count":1}
+//
+// Record types allowed per kind:
+//
+//	checkpoint - remaining (filename), index (hash, canonical, size, count, links)
+//	journal    - link (filename, target, backup)
+//	plan       - action (filename, target, size, hash), review (target, status, reviewer, note)
+//
+// Fields in parentheses are the ones used by a record type, unused ones are omitted.
+// Readers reject artifacts of newer versions (see Version), which may change meaning of records,
+// but ignore unknown record fields, which newer versions of the same major version may add.
+package artifact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format is a Header format of all fsdedupe artifacts.
+const Format = "fsdedupe"
+
+// Version is the current format version, written by Writer and the newest one accepted by Reader.
+const Version = 1
+
+// ErrNoHeader is returned by NewReader for inputs not starting with a Header,
+// like artifacts written by fsdedupe versions preceding this format.
+var ErrNoHeader = errors.New("no artifact header")
+
+// Kind is an artifact kind.
+type Kind string
+
+const (
+	// KindCheckpoint is an interrupted run state.
+	KindCheckpoint Kind = "checkpoint"
+	// KindJournal is an in-flight link action journal.
+	KindJournal Kind = "journal"
+	// KindPlan is a (reviewed) deduplication plan.
+	KindPlan Kind = "plan"
+)
+
+// Header is the first line of an artifact.
+type Header struct {
+	Format  string `json:"format"`
+	Kind    Kind   `json:"kind"`
+	Version int    `json:"version"`
+}
+
+// RecordType is a record type.
+type RecordType string
+
+const (
+	// TypeRemaining is a not yet processed input filename of a checkpoint.
+	TypeRemaining RecordType = "remaining"
+	// TypeIndex is a hash index entry (duplicate group) of a checkpoint.
+	TypeIndex RecordType = "index"
+	// TypeLink is an in-flight link action of a journal.
+	TypeLink RecordType = "link"
+	// TypeAction is a planned replacement of a duplicate with a link.
+	TypeAction RecordType = "action"
+	// TypeReview is a duplicate group review of a plan.
+	TypeReview RecordType = "review"
+)
+
+// Record is an artifact line following the Header.
+type Record struct {
+	Type RecordType `json:"type"`
+
+	// Filename is an input file (remaining), a duplicate being replaced (link) or to be replaced (action).
+	Filename string `json:"filename,omitempty"`
+	// Target is a (canonical) file a link points to (link, action) or a duplicate group target (review).
+	Target string `json:"target,omitempty"`
+	// Backup is where the duplicate is moved aside until the link is in place (link).
+	Backup string `json:"backup,omitempty"`
+
+	// Hash is a hex-encoded content hash (index, action).
+	Hash string `json:"hash,omitempty"`
+	// Canonical is a (first-seen) filename other duplicates point to (index).
+	Canonical string `json:"canonical,omitempty"`
+	// Size is a single file size (index, action).
+	Size int64 `json:"size,omitempty"`
+	// Count is a number of same-content files seen so far (index).
+	Count int `json:"count,omitempty"`
+	// Links is a number of duplicates linked to the canonical file so far (index).
+	Links int `json:"links,omitempty"`
+
+	// Status is a review status: approved, rejected or deferred (review).
+	Status string `json:"status,omitempty"`
+	// Reviewer is who reviewed the group (review).
+	Reviewer string `json:"reviewer,omitempty"`
+	// Note is a free-form annotation (review).
+	Note string `json:"note,omitempty"`
+}
+
+// record types allowed per kind
+var kindTypes = map[Kind][]RecordType{
+	KindCheckpoint: {TypeRemaining, TypeIndex},
+	KindJournal:    {TypeLink},
+	KindPlan:       {TypeAction, TypeReview},
+}
+
+// Validate checks header is a known artifact format, kind and (not newer) version.
+func (h Header) Validate() error {
+	if h.Format != Format {
+		return fmt.Errorf("unsupported format %q, expected %q", h.Format, Format)
+	}
+	if _, ok := kindTypes[h.Kind]; !ok {
+		return fmt.Errorf("unsupported kind %q", h.Kind)
+	}
+	if h.Version < 1 || h.Version > Version {
+		return fmt.Errorf("unsupported version %d, expected 1..%d", h.Version, Version)
+	}
+	return nil
+}
+
+// Validate checks record type is allowed for kind and its required fields are set.
+func (r Record) Validate(kind Kind) error {
+	allowed := false
+	for _, t := range kindTypes[kind] {
+		if t == r.Type {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("unsupported %s record type %q", kind, r.Type)
+	}
+
+	var missing string
+	switch r.Type {
+	case TypeRemaining:
+		if r.Filename == "" {
+			missing = "filename"
+		}
+	case TypeIndex:
+		if r.Hash == "" {
+			missing = "hash"
+		} else if r.Canonical == "" {
+			missing = "canonical"
+		}
+	case TypeLink:
+		if r.Filename == "" {
+			missing = "filename"
+		} else if r.Target == "" {
+			missing = "target"
+		} else if r.Backup == "" {
+			missing = "backup"
+		}
+	case TypeAction:
+		if r.Filename == "" {
+			missing = "filename"
+		} else if r.Target == "" {
+			missing = "target"
+		}
+	case TypeReview:
+		if r.Target == "" {
+			missing = "target"
+		}
+	}
+	if missing != "" {
+		return fmt.Errorf("%s record has no %s", r.Type, missing)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Writer writes an artifact.
+type Writer struct {
+	enc  *json.Encoder
+	kind Kind
+}
+
+// NewWriter writes a Header of kind (of the current Version) to w.
+func NewWriter(w io.Writer, kind Kind) (*Writer, error) {
+	header := Header{Format: Format, Kind: kind, Version: Version}
+	if err := header.Validate(); err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("encode header: %w", err)
+	}
+	return &Writer{enc: enc, kind: kind}, nil
+}
+
+// Write validates and writes a record.
+func (w *Writer) Write(r Record) error {
+	if err := r.Validate(w.kind); err != nil {
+		return err
+	}
+	if err := w.enc.Encode(r); err != nil {
+		return fmt.Errorf("encode %s record: %w", r.Type, err)
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Reader reads an artifact.
+type Reader struct {
+	dec    *json.Decoder
+	header Header
+	n      int // records read
+}
+
+// NewReader reads and validates a Header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	dec := json.NewDecoder(r)
+
+	var header Header
+	if err := dec.Decode(&header); errors.Is(err, io.EOF) {
+		return nil, ErrNoHeader
+	} else if err != nil {
+		return nil, fmt.Errorf("decode header: %w", err)
+	}
+	if header.Format == "" && header.Kind == "" && header.Version == 0 {
+		return nil, ErrNoHeader
+	}
+	if err := header.Validate(); err != nil {
+		return nil, err
+	}
+	return &Reader{dec: dec, header: header}, nil
+}
+
+// Header returns artifact header.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Read reads and validates the next record, returning io.EOF after the last one.
+func (r *Reader) Read() (Record, error) {
+	var rec Record
+	if err := r.dec.Decode(&rec); errors.Is(err, io.EOF) {
+		return rec, io.EOF
+	} else if err != nil {
+		return rec, fmt.Errorf("decode record %d: %w", r.n+1, err)
+	}
+	r.n++
+
+	if err := rec.Validate(r.header.Kind); err != nil {
+		return rec, fmt.Errorf("record %d: %w", r.n, err)
+	}
+	return rec, nil
+}
+
+// Validate reads a whole artifact, checking its header and every record,
+// returning its header and a number of records.
+func Validate(r io.Reader) (Header, int, error) {
+	ar, err := NewReader(r)
+	if err != nil {
+		return Header{}, 0, err
+	}
+	for {
+		if _, err := ar.Read(); errors.Is(err, io.EOF) {
+			return ar.header, ar.n, nil
+		} else if err != nil {
+			return ar.header, ar.n, err
+		}
+	}
+}
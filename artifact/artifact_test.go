@@ -0,0 +1,112 @@
+package artifact_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe/artifact"
+)
+
+func TestWriter(t *testing.T) {
+	records := []artifact.Record{
+		{Type: artifact.TypeAction, Filename: "/a/file2", Target: "/a/file1", Size: 4},
+		{Type: artifact.TypeReview, Target: "/a/file1", Status: "approved", Reviewer: "bob"},
+	}
+
+	var buf bytes.Buffer
+	w, err := artifact.NewWriter(&buf, artifact.KindPlan)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+	if err := w.Write(artifact.Record{Type: artifact.TypeRemaining, Filename: "/a/file3"}); err == nil {
+		t.Fatalf("expected checkpoint record not to be written to a plan")
+	}
+
+	if actual, expected := buf.String(), `{"format":"fsdedupe","kind":"plan","version":1}
+{"type":"action","filename":"/a/file2","target":"/a/file1","size":4}
+{"type":"review","target":"/a/file1","status":"approved","reviewer":"bob"}
+`; actual != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+
+	r, err := artifact.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := r.Header(), (artifact.Header{Format: artifact.Format, Kind: artifact.KindPlan, Version: artifact.Version}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	var read []artifact.Record
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		read = append(read, rec)
+	}
+	if !reflect.DeepEqual(read, records) {
+		t.Fatalf("expected %+v, got %+v", records, read)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{
+			name:  "valid",
+			input: `{"format":"fsdedupe","kind":"journal","version":1}` + "\n" + `{"type":"link","filename":"/a","target":"/b","backup":"/.a","extra":true}`,
+		},
+		{
+			name:  "legacy",
+			input: `{"filename":"/a","target":"/b","backup":"/.a"}`,
+			err:   artifact.ErrNoHeader.Error(),
+		},
+		{
+			name:  "newer version",
+			input: `{"format":"fsdedupe","kind":"journal","version":2}`,
+			err:   "unsupported version 2",
+		},
+		{
+			name:  "unknown kind",
+			input: `{"format":"fsdedupe","kind":"snapshot","version":1}`,
+			err:   `unsupported kind "snapshot"`,
+		},
+		{
+			name:  "foreign record type",
+			input: `{"format":"fsdedupe","kind":"journal","version":1}` + "\n" + `{"type":"action","filename":"/a","target":"/b"}`,
+			err:   `record 1: unsupported journal record type "action"`,
+		},
+		{
+			name:  "missing field",
+			input: `{"format":"fsdedupe","kind":"checkpoint","version":1}` + "\n" + `{"type":"index","hash":"abc"}`,
+			err:   "record 1: index record has no canonical",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := artifact.Validate(strings.NewReader(tc.input))
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got: %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package fsdedupe
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// WithImportNames maps Import source paths (relative to source dir) to link names (relative to link dir prefix),
+// skipping files fn reports false for, like BackupPCName.
+func WithImportNames(fn func(rel string) (string, bool)) Option {
+	return func(o *options) {
+		o.importNames = fn
+	}
+}
+
+// BackupPCName maps a (relative) path of a BackupPC (v3) pc dir tree ("<HOST>/<NUMBER>/f%2fhome/fuser/ffile.txt")
+// to its original one ("<HOST>/<NUMBER>/_home/user/file.txt"), to be used with WithImportNames:
+// "f"-prefixed names are unmangled (slashes of share names becoming "_"),
+// and BackupPC metadata files (attrib, backupInfo, logs etc., not "f"-prefixed) are skipped.
+// Compressed pools are not supported: files are imported as stored.
+func BackupPCName(rel string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 3 {
+		return "", false // host or backup metadata file
+	}
+	for i, part := range parts[2:] {
+		if !strings.HasPrefix(part, "f") {
+			return "", false // metadata file
+		}
+		name, err := url.PathUnescape(part[1:])
+		if err != nil || name == "" || name == "." || name == ".." {
+			return "", false
+		}
+		parts[i+2] = strings.ReplaceAll(name, "/", "_")
+	}
+	return filepath.FromSlash(strings.Join(parts, "/")), true
+}
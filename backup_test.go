@@ -0,0 +1,81 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_Import_hardlinks(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("file identities are not reported on", runtime.GOOS)
+	}
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	src := filepath.Join(tmp, "rsnapshot")
+	writeFile(t, filepath.Join(src, "daily.1", "etc", "hosts"), "HOSTS")
+	writeFile(t, filepath.Join(src, "daily.0", "etc", "passwd"), "PASSWD")
+	if err := os.Link(filepath.Join(src, "daily.1", "etc", "hosts"), filepath.Join(src, "daily.0", "etc", "hosts")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	report, err := subject.Import(context.Background(), src, "/backups")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.CopyReport{Copied: 2, CopiedBytes: 11, Linked: 1, LinkedBytes: 5, Hardlinked: 1}); report != expected {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+	assertDedupeFSContents(t, subject, "/backups/daily.0/etc/hosts", "HOSTS")
+	assertDedupeFSContents(t, subject, "/backups/daily.1/etc/hosts", "HOSTS")
+	assertDedupeFSContents(t, subject, "/backups/daily.0/etc/passwd", "PASSWD")
+}
+
+func TestDedupeFS_Import_backupPC(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	src := filepath.Join(tmp, "pc")
+	writeFile(t, filepath.Join(src, "fhost", "backups"), "METADATA")
+	writeFile(t, filepath.Join(src, "fhost", "0", "backupInfo"), "METADATA")
+	writeFile(t, filepath.Join(src, "fhost", "0", "f%2f", "attrib"), "METADATA")
+	writeFile(t, filepath.Join(src, "fhost", "0", "f%2f", "fetc", "fmy%25file"), "FILE")
+
+	if _, err := subject.Import(context.Background(), src, "/", fsdedupe.WithImportNames(fsdedupe.BackupPCName)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	assertDedupeFSContents(t, subject, "/fhost/0/_/etc/my%file", "FILE")
+
+	var links []string
+	if err := filepath.WalkDir(filepath.Join(tmp, "link"), func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			links = append(links, path)
+		}
+		return err
+	}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(links), 1; actual != expected {
+		t.Errorf("expected %d link (metadata skipped), got %v", expected, links)
+	}
+}
+
+func TestBackupPCName(t *testing.T) {
+	for rel, expected := range map[string]string{
+		"host/12/f%2fhome/fuser/ffile.txt": "host/12/_home/user/file.txt",
+		"host/12/fdocs/f%2e%2e":            "",
+		"host/12/fdocs/attrib":             "",
+		"host/12/backupInfo":               "",
+		"host/LOG":                         "",
+	} {
+		actual, ok := fsdedupe.BackupPCName(filepath.FromSlash(rel))
+		if ok != (expected != "") || actual != filepath.FromSlash(expected) {
+			t.Errorf("expected %q to map to %q, got %q (%v)", rel, expected, actual, ok)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache is a read-through content-addressed cache backed by DedupeFS:
+// Open serves files from the store, populating it on miss with a fetch function.
+// Same-content files are stored once. It is safe for concurrent use.
+type Cache struct {
+	store *DedupeFS
+	fetch func(name string) (io.ReadCloser, error)
+
+	ttl      time.Duration
+	maxBytes int64
+
+	mu       sync.Mutex
+	accessed map[string]time.Time     // link name -> last access
+	inflight map[string]chan struct{} // link name -> fetch done
+}
+
+// CacheOption configures Cache.
+type CacheOption func(*Cache)
+
+// WithCacheTTL sets max age of cached files: older ones are re-fetched on Open and removed by Evict.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithCacheMaxBytes sets cache size limit (counting same-content files once),
+// Evict removes least recently used files above it.
+func WithCacheMaxBytes(n int64) CacheOption {
+	return func(c *Cache) {
+		c.maxBytes = n
+	}
+}
+
+// NewCache constructs a new Cache, fetching missing files with fetch function.
+func NewCache(store *DedupeFS, fetch func(name string) (io.ReadCloser, error), opts ...CacheOption) *Cache {
+	c := &Cache{
+		store:    store,
+		fetch:    fetch,
+		accessed: make(map[string]time.Time),
+		inflight: make(map[string]chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Open opens a cached file, fetching it first if missing or expired (see WithCacheTTL).
+// Concurrent misses of the same file are fetched once.
+func (c *Cache) Open(name string) (io.ReadCloser, error) {
+	cleanName, absLinkName, err := c.store.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if fresh, err := c.fresh(absLinkName); err != nil {
+			return nil, err
+		} else if fresh {
+			c.touch(cleanName)
+			return c.store.Open(cleanName)
+		}
+
+		c.mu.Lock()
+		done, busy := c.inflight[cleanName]
+		if busy {
+			c.mu.Unlock()
+			<-done
+			continue
+		}
+		done = make(chan struct{})
+		c.inflight[cleanName] = done
+		c.mu.Unlock()
+
+		err := c.populate(cleanName)
+
+		c.mu.Lock()
+		delete(c.inflight, cleanName)
+		close(done)
+		c.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+		c.touch(cleanName)
+		return c.store.Open(cleanName)
+	}
+}
+
+// Evict removes expired files (see WithCacheTTL) and least recently used ones above size limit
+// (see WithCacheMaxBytes), reaping unreferenced data files.
+// Access times are tracked in memory, files not accessed since Cache construction are ordered by fetch time.
+func (c *Cache) Evict() error {
+	type entry struct {
+		name       string
+		target     string
+		fetched    time.Time
+		lastAccess time.Time
+	}
+	var entries []entry
+
+	c.mu.Lock()
+	accessed := make(map[string]time.Time, len(c.accessed))
+	for name, at := range c.accessed {
+		accessed[name] = at
+	}
+	c.mu.Unlock()
+
+	onLink := func(path string, d os.DirEntry) error {
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("lstat %q: %w", path, err)
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", path, err)
+		}
+		rel, err := filepath.Rel(c.store.linkDir, path)
+		if err != nil {
+			return fmt.Errorf("link name of %q: %w", path, err)
+		}
+
+		e := entry{
+			name:       filepath.Join(string(filepath.Separator), rel),
+			target:     target,
+			fetched:    info.ModTime(),
+			lastAccess: info.ModTime(),
+		}
+		if at, ok := accessed[e.name]; ok && at.After(e.lastAccess) {
+			e.lastAccess = at
+		}
+		entries = append(entries, e)
+		return nil
+	}
+	if err := walk(c.store.linkDir, onLink); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("walk %q: %w", c.store.linkDir, err)
+	}
+
+	remove := func(name string) error {
+		if err := c.store.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		c.mu.Lock()
+		delete(c.accessed, name)
+		c.mu.Unlock()
+		return nil
+	}
+
+	kept := entries[:0]
+	for _, e := range entries {
+		if c.ttl > 0 && time.Since(e.fetched) >= c.ttl {
+			if err := remove(e.name); err != nil {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, e)
+	}
+	entries = kept
+
+	if c.maxBytes > 0 {
+		inline, err := c.store.inlineSizes()
+		if err != nil {
+			return err
+		}
+
+		refs := make(map[string]int)
+		sizes := make(map[string]int64)
+		var total int64
+		for _, e := range entries {
+			refs[e.target]++
+			if refs[e.target] > 1 {
+				continue
+			}
+			// links to inline contents (see WithInlineBlobs) are dangling
+			size, ok := inline[targetHash(e.target)]
+			if info, err := os.Stat(e.target); err == nil {
+				size = info.Size()
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("stat %q: %w", e.target, err)
+			} else if !ok {
+				continue // data file is missing, see Scrub
+			}
+			sizes[e.target] = size
+			total += size
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].lastAccess.Before(entries[j].lastAccess)
+		})
+		for _, e := range entries {
+			if total <= c.maxBytes {
+				break
+			}
+			if err := remove(e.name); err != nil {
+				return err
+			}
+			if refs[e.target]--; refs[e.target] == 0 {
+				total -= sizes[e.target]
+			}
+		}
+	}
+
+	_, err := c.store.GC()
+	return err
+}
+
+// fresh reports if a link exists and is not expired.
+func (c *Cache) fresh(absLinkName string) (bool, error) {
+	info, err := os.Lstat(absLinkName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("lstat %q: %w", absLinkName, err)
+	}
+	return c.ttl <= 0 || time.Since(info.ModTime()) < c.ttl, nil
+}
+
+func (c *Cache) populate(name string) error {
+	r, err := c.fetch(name)
+	if err != nil {
+		return fmt.Errorf("fetch %q: %w", name, err)
+	}
+	defer r.Close()
+
+	if _, err := c.store.WriteFile(name, r, WithOverwrite(OverwriteReplace)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Cache) touch(name string) {
+	c.mu.Lock()
+	c.accessed[name] = time.Now()
+	c.mu.Unlock()
+}
@@ -0,0 +1,128 @@
+package fsdedupe_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestCache_Open(t *testing.T) {
+	tmp := t.TempDir()
+	store := setupDedupeFS(t, tmp)
+
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	subject := fsdedupe.NewCache(store, func(name string) (io.ReadCloser, error) {
+		mu.Lock()
+		fetched[name]++
+		mu.Unlock()
+		return io.NopCloser(strings.NewReader("CONTENTS OF " + name)), nil
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assertCacheOpen(t, subject, "/a.txt", "CONTENTS OF /a.txt")
+		}()
+	}
+	wg.Wait()
+	assertCacheOpen(t, subject, "b.txt", "CONTENTS OF /b.txt")
+
+	if actual, expected := fetched["/a.txt"], 1; actual != expected {
+		t.Errorf("expected %d fetches, got %d", expected, actual)
+	}
+	if actual, expected := fetched["/b.txt"], 1; actual != expected {
+		t.Errorf("expected %d fetches, got %d", expected, actual)
+	}
+}
+
+func TestCache_Evict(t *testing.T) {
+	tmp := t.TempDir()
+	store := setupDedupeFS(t, tmp)
+
+	subject := fsdedupe.NewCache(store, func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(strings.Repeat("x", 10) + name)), nil
+	}, fsdedupe.WithCacheMaxBytes(40))
+
+	for _, name := range []string{"/a", "/b", "/c", "/d"} {
+		assertCacheOpen(t, subject, name, strings.Repeat("x", 10)+name)
+		time.Sleep(10 * time.Millisecond) // distinct access times
+	}
+	assertCacheOpen(t, subject, "/a", strings.Repeat("x", 10)+"/a") // a is now the most recently used one
+
+	// 4 files of 12 bytes, limit 40 - least recently used one (b) is evicted
+	if err := subject.Evict(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for name, expected := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		_, err := os.Lstat(filepath.Join(tmp, "link", name))
+		if actual := err == nil; actual != expected {
+			t.Errorf("expected %q to be kept=%v, got: %v", name, expected, err)
+		}
+	}
+
+	entries, err := filepath.Glob(filepath.Join(tmp, "data", "*.bin"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(entries), 3; actual != expected {
+		t.Errorf("expected %d data files, got %d", expected, actual)
+	}
+}
+
+func assertCacheOpen(t *testing.T, c *fsdedupe.Cache, name, expected string) {
+	t.Helper()
+
+	f, err := c.Open(name)
+	if err != nil {
+		t.Errorf("expected no error, got: %s", err)
+		return
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Errorf("expected no error, got: %s", err)
+	}
+	if actual := string(b); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestCache_Evict_inline(t *testing.T) {
+	tmp := t.TempDir()
+	store, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithInlineBlobs(filepath.Join(tmp, "inline"), 16))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	subject := fsdedupe.NewCache(store, func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(strings.Repeat("x", 10) + name)), nil
+	}, fsdedupe.WithCacheMaxBytes(40))
+
+	for _, name := range []string{"/a", "/b", "/c", "/d"} {
+		assertCacheOpen(t, subject, name, strings.Repeat("x", 10)+name)
+		time.Sleep(10 * time.Millisecond) // distinct access times
+	}
+
+	// 4 inline contents of 12 bytes (dangling links), limit 40 - least recently used one (a) is evicted
+	if err := subject.Evict(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for name, expected := range map[string]bool{"a": false, "b": true, "c": true, "d": true} {
+		_, err := os.Lstat(filepath.Join(tmp, "link", name))
+		if actual := err == nil; actual != expected {
+			t.Errorf("expected %q to be kept=%v, got: %v", name, expected, err)
+		}
+	}
+	assertCacheOpen(t, subject, "/b", strings.Repeat("x", 10)+"/b")
+}
@@ -0,0 +1,160 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// caseFolder canonicalizes paths, so the same file listed under different names
+// (via symlinked dirs, or differently-cased on a case-insensitive volume, like macOS or Windows)
+// is recognized as such.
+// Case sensitivity is detected per volume (device), by looking up a case-swapped path.
+type caseFolder struct {
+	resolved    map[string]string // dir -> dir with symlinks resolved
+	devByDir    map[string]uint64
+	insensitive map[uint64]bool
+}
+
+// path returns canonical path of filename: absolute, clean, with parent dir symlinks resolved
+// (filename itself may be a symlink, which is a distinct file).
+func (c *caseFolder) path(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", fmt.Errorf("absolute path of %q: %w", filename, err)
+	}
+	if c.resolved == nil {
+		c.resolved = make(map[string]string)
+	}
+
+	dir, ok := c.resolved[filepath.Dir(abs)]
+	if !ok {
+		if dir, err = filepath.EvalSymlinks(filepath.Dir(abs)); err != nil {
+			return "", fmt.Errorf("resolve dir of %q: %w", filename, err)
+		}
+		c.resolved[filepath.Dir(abs)] = dir
+	}
+	return filepath.Join(dir, filepath.Base(abs)), nil
+}
+
+// key returns canonical path of filename (see path), lower-cased on case-insensitive volumes.
+func (c *caseFolder) key(filename string) (string, error) {
+	abs, err := c.path(filename)
+	if err != nil {
+		return "", err
+	}
+	if c.devByDir == nil {
+		c.devByDir = make(map[string]uint64)
+		c.insensitive = make(map[uint64]bool)
+	}
+
+	dir := filepath.Dir(abs)
+	dev, ok := c.devByDir[dir]
+	if !ok {
+		if dev, err = deviceID(dir); err != nil {
+			return "", fmt.Errorf("stat %q: %w", dir, err)
+		}
+		c.devByDir[dir] = dev
+	}
+
+	insensitive, ok := c.insensitive[dev]
+	if !ok {
+		// undetermined paths (having no cased letters) are never aliased by case anyway
+		if insensitive, ok, err = caseInsensitive(abs); err != nil {
+			return "", err
+		} else if ok {
+			c.insensitive[dev] = insensitive
+		}
+	}
+
+	if insensitive {
+		return strings.ToLower(abs), nil
+	}
+	return abs, nil
+}
+
+// same reports if both filenames are the same path (see key).
+func (c *caseFolder) same(filename1, filename2 string) (bool, error) {
+	key1, err := c.key(filename1)
+	if err != nil {
+		return false, err
+	}
+	key2, err := c.key(filename2)
+	if err != nil {
+		return false, err
+	}
+	return key1 == key2, nil
+}
+
+// uniqueFilter is an Iterator normalizing filenames to canonical paths (see caseFolder.path),
+// so groups, links and reports never depend on how input is spelled (like ./a/b, a//b or /abs/a/b),
+// and dropping repeated ones (see caseFolder.key),
+// as overlapping inputs (like multiple find invocations) would make a file a duplicate of itself.
+// Filenames failing to canonicalize (like missing ones) are passed as is, left to fail as usual.
+type uniqueFilter struct {
+	filenames Iterator
+	logger    *log.Logger
+	folder    caseFolder
+	seen      map[string]struct{}
+}
+
+func (f *uniqueFilter) Next() (string, error) {
+	if f.seen == nil {
+		f.seen = make(map[string]struct{})
+	}
+	for {
+		filename, err := f.filenames.Next()
+		if err != nil {
+			return filename, err
+		}
+		path, err := f.folder.path(filename)
+		if err != nil {
+			return filename, nil
+		}
+		key, err := f.folder.key(path)
+		if err != nil {
+			return filename, nil
+		}
+		if _, ok := f.seen[key]; ok {
+			f.logger.Printf("%q is listed twice (or under another name), processing it once", filename)
+			continue
+		}
+		f.seen[key] = struct{}{}
+		return path, nil
+	}
+}
+
+// caseInsensitive detects if (existing) path is on a case-insensitive volume,
+// ok is false if path has no cased letters to detect it by.
+func caseInsensitive(path string) (insensitive, ok bool, err error) {
+	swapped := swapCase(path)
+	if swapped == path {
+		return false, false, nil
+	}
+
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return false, false, fmt.Errorf("lstat %q: %w", path, err)
+	}
+	swappedStat, err := os.Lstat(swapped)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, true, nil
+	} else if err != nil {
+		return false, false, fmt.Errorf("lstat %q: %w", swapped, err)
+	}
+	return os.SameFile(stat, swappedStat), true, nil
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
@@ -0,0 +1,112 @@
+package fsdedupe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mxmCherry/fsdedupe/artifact"
+)
+
+// Checkpoint holds the state of an interrupted run.
+type Checkpoint struct {
+	// Remaining is not yet processed input.
+	Remaining []string `json:"remaining"`
+	// Index is a hash index of already processed files.
+	Index []CheckpointEntry `json:"index"`
+}
+
+// CheckpointEntry is a hash index entry (duplicate group) of a Checkpoint.
+type CheckpointEntry struct {
+	// Hash is a hex-encoded content hash.
+	Hash string `json:"hash"`
+	// Canonical is a (first-seen) filename other duplicates point to.
+	Canonical string `json:"canonical"`
+	// Size is a single file size.
+	Size int64 `json:"size"`
+	// Count is a number of same-content files seen so far (including the canonical one).
+	Count int `json:"count"`
+	// Links is a number of duplicates linked to the canonical file so far (see WithMaxLinks).
+	Links int `json:"links,omitempty"`
+}
+
+// WriteCheckpoint writes checkpoint as an artifact (see package artifact).
+func WriteCheckpoint(w io.Writer, cp Checkpoint) error {
+	aw, err := artifact.NewWriter(w, artifact.KindCheckpoint)
+	if err != nil {
+		return err
+	}
+	for _, filename := range cp.Remaining {
+		if err := aw.Write(artifact.Record{Type: artifact.TypeRemaining, Filename: filename}); err != nil {
+			return err
+		}
+	}
+	for _, e := range cp.Index {
+		if err := aw.Write(artifact.Record{
+			Type:      artifact.TypeIndex,
+			Hash:      e.Hash,
+			Canonical: e.Canonical,
+			Size:      e.Size,
+			Count:     e.Count,
+			Links:     e.Links,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCheckpoint reads checkpoint written by WriteCheckpoint
+// (or a single JSON object by fsdedupe versions preceding artifacts).
+func ReadCheckpoint(r io.Reader) (Checkpoint, error) {
+	var cp Checkpoint
+	err := readArtifact(r, artifact.KindCheckpoint, &cp, func(rec artifact.Record) {
+		switch rec.Type {
+		case artifact.TypeRemaining:
+			cp.Remaining = append(cp.Remaining, rec.Filename)
+		case artifact.TypeIndex:
+			cp.Index = append(cp.Index, CheckpointEntry{
+				Hash:      rec.Hash,
+				Canonical: rec.Canonical,
+				Size:      rec.Size,
+				Count:     rec.Count,
+				Links:     rec.Links,
+			})
+		}
+	})
+	return cp, err
+}
+
+// readArtifact reads an artifact of kind, passing its records to fn,
+// or decodes a legacy (pre-artifact) single JSON object into legacy.
+func readArtifact(r io.Reader, kind artifact.Kind, legacy any, fn func(artifact.Record)) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	ar, err := artifact.NewReader(bytes.NewReader(b))
+	if errors.Is(err, artifact.ErrNoHeader) {
+		if err := json.Unmarshal(b, legacy); err != nil {
+			return fmt.Errorf("decode: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if actual := ar.Header().Kind; actual != kind {
+		return fmt.Errorf("expected %s artifact, got %s", kind, actual)
+	}
+
+	for {
+		rec, err := ar.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fn(rec)
+	}
+}
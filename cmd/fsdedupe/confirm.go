@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// forceUsage is -force flag usage of destructive subcommands.
+const forceUsage = "actually replace duplicates without asking (otherwise it is a dry run, asking for confirmation when attached to a terminal)"
+
+// resolverUsage is -resolver flag usage of planning subcommands.
+const resolverUsage = "run this program per duplicate group (filenames on STDIN, planned canonical first), " +
+	`deciding by the first STDOUT line: "keep" (as planned), "keep <FILE>" (this one instead) or "skip [NOTE]"`
+
+// openTTY opens controlling terminal for confirmation prompts (STDIN may be input filenames),
+// nil if not attached to any (cron, CI etc).
+func openTTY() *os.File {
+	for _, name := range []string{"/dev/tty", "CONIN$"} {
+		if tty, err := os.OpenFile(name, os.O_RDWR, 0); err == nil {
+			return tty
+		}
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on tty, defaulting to no.
+func confirm(tty *os.File, question string) bool {
+	fmt.Fprintf(tty, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// planTotals returns a number and a total size of plan actions ApplyPlan would apply.
+func planTotals(dp fsdedupe.DedupePlan, approvedOnly bool) (int, int64) {
+	var n int
+	var size int64
+	for _, action := range dp.Actions {
+		status := dp.Reviews[action.Target].Status
+		if status == fsdedupe.ReviewRejected || status == fsdedupe.ReviewDeferred || (approvedOnly && status != fsdedupe.ReviewApproved) {
+			continue
+		}
+		n++
+		size += action.Size
+	}
+	return n, size
+}
+
+// confirmPlan prints what applying plan would do to w and asks for a confirmation, if attached to a terminal.
+// Without a terminal (or if confirmation is not possible), it reports a dry run.
+func confirmPlan(w io.Writer, dp fsdedupe.DedupePlan, approvedOnly, canApply bool) bool {
+	n, size := planTotals(dp, approvedOnly)
+	fmt.Fprintf(w, "%s: %d duplicates (%s) would be replaced\n", selfCmd, n, fsdedupe.FormatSize(size))
+	if n == 0 {
+		return false
+	}
+
+	if tty := openTTY(); tty != nil && canApply {
+		defer tty.Close()
+		if confirm(tty, fmt.Sprintf("Replace %d duplicates (%s)?", n, fsdedupe.FormatSize(size))) {
+			return true
+		}
+	}
+	fmt.Fprintf(w, "%s: dry run, nothing is modified; re-run with -force to replace duplicates\n", selfCmd)
+	return false
+}
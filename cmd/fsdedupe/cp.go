@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type cp struct {
+	tempDir   string
+	dataDir   string
+	bwlimit   int64
+	hashCache string
+	backupPC  bool
+}
+
+func (*cp) Name() string { return "cp" }
+func (*cp) Synopsis() string {
+	return "Copy a tree, linking content already existing in destination instead of copying it"
+}
+func (*cp) Usage() string {
+	return selfCmd + ` cp [-temp <TEMPDIR> -data <DATADIR> [-hash-cache <FILE>] [-backuppc]] <SRCDIR> <DSTDIR>
+	Copy SRCDIR tree into DSTDIR, hardlinking files to same-content files already existing anywhere in DSTDIR
+	instead of copying them (like a local, content-aware rsync). Existing DSTDIR files are replaced.
+	If -temp and -data are given, DSTDIR is a DedupeFS link dir, and files are symlinked to already stored data files,
+	hardlinked source files (like of rsnapshot or BackupPC backups) being read once.
+`
+}
+
+func (c *cp) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.tempDir, "temp", "", "DedupeFS temp dir (DSTDIR is DedupeFS link dir)")
+	f.StringVar(&c.dataDir, "data", "", "DedupeFS data dir (DSTDIR is DedupeFS link dir)")
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+	f.BoolVar(&c.backupPC, "backuppc", false, "with -temp and -data, SRCDIR is a BackupPC (v3, uncompressed) pc dir: unmangle names, skip metadata files")
+	f.StringVar(&c.hashCache, "hash-cache", "", "with -temp and -data, reuse hashes of files unchanged (size, mtime) since cached in this file (shared with symlink), updating it")
+}
+
+func (c *cp) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 || (c.tempDir == "") != (c.dataDir == "") || ((c.hashCache != "" || c.backupPC) && c.dataDir == "") {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	srcDir, dstDir := f.Arg(0), f.Arg(1)
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+
+	if c.backupPC {
+		opts = append(opts, fsdedupe.WithImportNames(fsdedupe.BackupPCName))
+	}
+
+	var err error
+	var hashCache *fsdedupe.HashCache
+	if c.hashCache != "" {
+		if hashCache, err = readHashCache(c.hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		opts = append(opts, fsdedupe.WithHashCache(hashCache))
+	}
+
+	var report fsdedupe.CopyReport
+	if c.dataDir != "" {
+		var store *fsdedupe.DedupeFS
+		if store, err = fsdedupe.NewDedupeFS(c.tempDir, c.dataDir, dstDir); err == nil {
+			report, err = store.Import(ctx, srcDir, "/", opts...)
+		}
+	} else {
+		report, err = fsdedupe.CopyTree(ctx, srcDir, dstDir, opts...)
+	}
+
+	status := subcommands.ExitSuccess
+	if hashCache != nil {
+		if err := writeHashCache(c.hashCache, hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	printCopyReport(report, c.dataDir != "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return status
+}
+
+// printCopyReport prints a CopyReport, with hardlinked (once read) source files of DedupeFS imports.
+func printCopyReport(report fsdedupe.CopyReport, imported bool) {
+	fmt.Printf("copied:       %d\n", report.Copied)
+	fmt.Printf("copied size:  %s\n", fsdedupe.FormatSize(report.CopiedBytes))
+	fmt.Printf("linked:       %d\n", report.Linked)
+	fmt.Printf("linked size:  %s\n", fsdedupe.FormatSize(report.LinkedBytes))
+	if imported {
+		fmt.Printf("hardlinked:   %d\n", report.Hardlinked)
+	}
+}
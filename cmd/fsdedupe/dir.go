@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type dir struct {
+	scope       string
+	force       bool
+	concurrency int
+	scheduling  fsdedupe.Scheduling
+	maxDepth    int
+	empty       string
+	link        string
+	fsLinks     listValue
+	compatRules string
+}
+
+func (*dir) Name() string { return "dir" }
+func (*dir) Synopsis() string {
+	return "Deduplicate regular files of multiple dirs, each one independently or all of them jointly"
+}
+func (*dir) Usage() string {
+	return selfCmd + ` dir [-scope per-root|global] [-force] <DIR>...
+	Deduplicate regular files of DIR trees, printing a summary per DIR.
+	With -scope per-root (default), DIRs are processed in parallel, each one having its own duplicates only
+	(never linked to files of other DIRs). With -scope global, duplicates are linked across all DIRs.
+	Without -force, it is a dry run: duplicates are only reported, and replaced if confirmed on a terminal.
+`
+}
+
+func (c *dir) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.scope, "scope", "per-root", "deduplication scope: per-root (independently, in parallel) or global (across all DIRs)")
+	f.BoolVar(&c.force, "force", false, forceUsage)
+	f.IntVar(&c.concurrency, "concurrency", 1, "number of files hashed in parallel (per DIR with -scope per-root)")
+	schedulingVars(f, &c.scheduling)
+	f.IntVar(&c.maxDepth, "max-depth", 0, "walk at most this number of dir levels, DIR being level 1 (0 - unlimited)")
+	f.StringVar(&c.empty, "empty", "skip", "zero-byte files policy: skip, link or report (only)")
+	f.StringVar(&c.link, "link", "symlink", linkUsage)
+	f.Var(&c.fsLinks, "fs-link", fsLinkUsage)
+	f.StringVar(&c.compatRules, "compat-rules", "", compatUsage)
+}
+
+func (c *dir) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 || (c.scope != "per-root" && c.scope != "global") {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	emptyPolicy, err := parseEmptyPolicy(c.empty)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+	linkOpts, err := linkStrategyOptions(c.link, c.fsLinks, c.compatRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+	roots, err := absRoots(f.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithConcurrency(c.concurrency),
+		fsdedupe.WithScheduling(c.scheduling),
+		fsdedupe.WithEmptyPolicy(emptyPolicy),
+		fsdedupe.WithAbort(abortContext(args)),
+	}
+	opts = append(opts, linkOpts...)
+
+	walkOpts := []fsdedupe.WalkOption{fsdedupe.WithMaxDepth(c.maxDepth)}
+
+	start := time.Now()
+	summaries := make([]fsdedupe.Summary, len(roots))
+	var plans []fsdedupe.DedupePlan
+	if c.scope == "global" {
+		var dp fsdedupe.DedupePlan
+		dp, err = planGlobal(ctx, roots, walkOpts, summaries, opts)
+		plans = splitPlan(dp, roots)
+	} else {
+		plans, err = planPerRoot(ctx, roots, walkOpts, summaries, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	applied := c.force
+	if !applied {
+		var all fsdedupe.DedupePlan
+		for _, dp := range plans {
+			all.Actions = append(all.Actions, dp.Actions...)
+		}
+		applied = confirmPlan(os.Stderr, all, false, true)
+	}
+	if applied {
+		err = applyPerRoot(ctx, roots, plans, summaries, opts)
+	}
+
+	var total fsdedupe.Summary
+	for i, root := range roots {
+		printRootSummary(os.Stderr, root, summaries[i])
+		total = addSummary(total, summaries[i])
+	}
+	printSummary(os.Stderr, total, time.Since(start))
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// absRoots makes roots absolute, rejecting nested ones (a file must belong to a single root).
+func absRoots(dirs []string) ([]string, error) {
+	roots := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("resolve dir %q: %w", dir, err)
+		}
+		for _, other := range roots {
+			if within(root, other) || within(other, root) {
+				return nil, fmt.Errorf("dirs %q and %q overlap", other, root)
+			}
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+func within(filename, root string) bool {
+	return filename == root || strings.HasPrefix(filename, root+string(filepath.Separator))
+}
+
+// rootOf returns an index of the root filename is within, -1 if none.
+func rootOf(filename string, roots []string) int {
+	for i, root := range roots {
+		if within(filename, root) {
+			return i
+		}
+	}
+	return -1
+}
+
+// rootLogger prefixes log lines with a root, as roots are processed in parallel.
+func rootLogger(root string) *log.Logger {
+	return log.New(os.Stderr, selfCmd+": "+root+": ", 0)
+}
+
+// planPerRoot plans every root independently, in parallel.
+func planPerRoot(ctx context.Context, roots []string, walkOpts []fsdedupe.WalkOption, summaries []fsdedupe.Summary, opts []fsdedupe.Option) ([]fsdedupe.DedupePlan, error) {
+	plans := make([]fsdedupe.DedupePlan, len(roots))
+	errs := make([]error, len(roots))
+
+	var wg sync.WaitGroup
+	for i, root := range roots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rootOpts := append(opts[:len(opts):len(opts)], fsdedupe.WithLogger(rootLogger(root)), fsdedupe.WithSummary(&summaries[i]))
+			if plans[i], errs[i] = fsdedupe.PlanSymlink(ctx, fsdedupe.WalkDir(root, nil, walkOpts...), rootOpts...); errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", root, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return plans, errors.Join(errs...)
+}
+
+// planGlobal plans all roots jointly, attributing processed, duplicate and skipped files to their roots.
+func planGlobal(ctx context.Context, roots []string, walkOpts []fsdedupe.WalkOption, summaries []fsdedupe.Summary, opts []fsdedupe.Option) (fsdedupe.DedupePlan, error) {
+	var summary fsdedupe.Summary
+	dp, err := fsdedupe.PlanSymlink(ctx, &rootsIterator{roots: roots, walkOpts: walkOpts, summaries: summaries}, append(opts[:len(opts):len(opts)],
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+		fsdedupe.WithSummary(&summary),
+		fsdedupe.WithOnSkipped(func(filename string, _ fsdedupe.SkipReason, _ string) error {
+			if i := rootOf(filename, roots); i >= 0 {
+				summaries[i].Skipped++
+			}
+			return nil
+		}),
+	)...)
+	for _, action := range dp.Actions {
+		if i := rootOf(action.Filename, roots); i >= 0 {
+			summaries[i].Duplicates++
+		}
+	}
+	return dp, err
+}
+
+// splitPlan splits plan actions by roots of duplicates.
+func splitPlan(dp fsdedupe.DedupePlan, roots []string) []fsdedupe.DedupePlan {
+	plans := make([]fsdedupe.DedupePlan, len(roots))
+	for _, action := range dp.Actions {
+		if i := rootOf(action.Filename, roots); i >= 0 {
+			plans[i].Actions = append(plans[i].Actions, action)
+		}
+	}
+	return plans
+}
+
+// applyPerRoot applies root plans in parallel.
+func applyPerRoot(ctx context.Context, roots []string, plans []fsdedupe.DedupePlan, summaries []fsdedupe.Summary, opts []fsdedupe.Option) error {
+	errs := make([]error, len(roots))
+
+	var wg sync.WaitGroup
+	for i, root := range roots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rootOpts := append(opts[:len(opts):len(opts)], fsdedupe.WithLogger(rootLogger(root)), fsdedupe.WithSummary(&summaries[i]))
+			if err := fsdedupe.ApplyPlan(ctx, plans[i], rootOpts...); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", root, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// rootsIterator walks roots one by one, counting files of each into summaries.
+type rootsIterator struct {
+	roots     []string
+	walkOpts  []fsdedupe.WalkOption
+	summaries []fsdedupe.Summary
+	i         int
+	walk      fsdedupe.Iterator
+}
+
+func (it *rootsIterator) Next() (string, error) {
+	for it.i < len(it.roots) {
+		if it.walk == nil {
+			it.walk = fsdedupe.WalkDir(it.roots[it.i], nil, it.walkOpts...)
+		}
+		filename, err := it.walk.Next()
+		if errors.Is(err, io.EOF) {
+			it.i, it.walk = it.i+1, nil
+			continue
+		} else if err == nil {
+			it.summaries[it.i].Files++
+		}
+		return filename, err
+	}
+	return "", io.EOF
+}
+
+func printRootSummary(w io.Writer, root string, s fsdedupe.Summary) {
+	fmt.Fprintf(w, "%s: %s: %d files processed, %d duplicates, %d linked, %d skipped, %s saved (%s on disk), %d inodes used; already deduplicated: %d files, %s\n",
+		selfCmd, root, s.Files, s.Duplicates, s.Linked, s.Skipped,
+		fsdedupe.FormatSize(s.BytesSaved), fsdedupe.FormatSize(s.DiskBytesSaved), s.InodesUsed,
+		s.AlreadyDeduped, fsdedupe.FormatSize(s.AlreadyDedupedBytes))
+}
+
+func addSummary(a, b fsdedupe.Summary) fsdedupe.Summary {
+	a.Files += b.Files
+	a.Duplicates += b.Duplicates
+	a.Linked += b.Linked
+	a.BytesSaved += b.BytesSaved
+	a.DiskBytesSaved += b.DiskBytesSaved
+	a.PermissionDenied += b.PermissionDenied
+	a.InodesUsed += b.InodesUsed
+	a.Skipped += b.Skipped
+	a.AlreadyDeduped += b.AlreadyDeduped
+	a.AlreadyDedupedBytes += b.AlreadyDedupedBytes
+	return a
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+const (
+	doctorMinFreeBytes  = 1 << 30 // 1GiB
+	doctorMinFreeInodes = 100_000
+)
+
+type doctor struct {
+	tempDir string
+	dataDir string
+}
+
+func (*doctor) Name() string { return "doctor" }
+func (*doctor) Synopsis() string {
+	return "Run pre-flight checks of target dirs"
+}
+func (*doctor) Usage() string {
+	return selfCmd + ` doctor [-temp <TEMPDIR> -data <DATADIR>] <DIR>...
+	Check symlink and rename support, write permission, filesystem type, free space and inodes of given dirs
+	(and that temp/data dirs are on the same device, if given), printing warnings for anything that may fail a long run.
+	Exits with non-zero status if there are any warnings.
+`
+}
+
+func (c *doctor) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.tempDir, "temp", "", "DedupeFS temp dir to check")
+	f.StringVar(&c.dataDir, "data", "", "DedupeFS data dir to check")
+}
+
+func (c *doctor) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	dirs := f.Args()
+	if c.tempDir != "" {
+		dirs = append(dirs, c.tempDir)
+	}
+	if c.dataDir != "" {
+		dirs = append(dirs, c.dataDir)
+	}
+	if len(dirs) == 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	warnings := 0
+	warnf := func(format string, args ...interface{}) {
+		warnings++
+		fmt.Printf("warning: "+format+"\n", args...)
+	}
+	okf := func(format string, args ...interface{}) {
+		fmt.Printf("ok: "+format+"\n", args...)
+	}
+
+	for _, dir := range dirs {
+		st, err := fsdedupe.StatFS(dir)
+		if err != nil {
+			warnf("%s", err)
+			continue
+		}
+
+		if st.Type == "" {
+			warnf("%q: unknown filesystem type", dir)
+		} else if st.Network {
+			warnf("%q: network filesystem (%s), consider -network-safe mode", dir, st.Type)
+		} else {
+			okf("%q: filesystem type %s", dir, st.Type)
+		}
+
+		if st.Type != "" && st.FreeBytes < doctorMinFreeBytes {
+			warnf("%q: only %s free", dir, fsdedupe.FormatSize(int64(st.FreeBytes)))
+		}
+		if st.Type != "" && st.FreeInodes < doctorMinFreeInodes {
+			warnf("%q: only %d inodes free, every symlink consumes one", dir, st.FreeInodes)
+		}
+
+		info, err := fsdedupe.ProbeFS(dir)
+		if err != nil {
+			warnf("%q: not writable: %s", dir, err)
+			continue
+		}
+		okf("%q: writable", dir)
+
+		if info.Symlinks {
+			okf("%q: symlinks supported", dir)
+		} else {
+			warnf("%q: symlinks not supported, duplicates can only be reported", dir)
+		}
+		if info.AtomicRename {
+			okf("%q: atomic rename supported", dir)
+		} else {
+			warnf("%q: atomic rename not supported", dir)
+		}
+		if info.CaseInsensitive {
+			okf("%q: case-insensitive names, differently-cased paths of the same file are recognized", dir)
+		}
+		if info.RootSquash {
+			warnf("%q: root-squashed (running as root, but files are created as another user), duplicates can only be reported", dir)
+		}
+	}
+
+	if c.tempDir != "" && c.dataDir != "" {
+		same, err := fsdedupe.SameDevice(c.tempDir, c.dataDir)
+		if err != nil {
+			warnf("%s", err)
+		} else if !same {
+			warnf("temp dir %q and data dir %q are on different devices, files will be copied instead of renamed", c.tempDir, c.dataDir)
+		} else {
+			okf("temp dir %q and data dir %q are on the same device", c.tempDir, c.dataDir)
+		}
+	}
+
+	if warnings != 0 {
+		fmt.Fprintf(os.Stderr, "%d warning(s)\n", warnings)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
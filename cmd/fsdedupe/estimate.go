@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type estimate struct {
+	sample  float64
+	bwlimit int64
+	empty   string
+	input   lineInput
+}
+
+func (*estimate) Name() string { return "estimate" }
+func (*estimate) Synopsis() string {
+	return "Estimate duplicate bytes of STDIN filenames by sampling (read-only)"
+}
+func (*estimate) Usage() string {
+	return `find <SOMEDIR> -type f -not -path '*/.*' | ` + selfCmd + ` estimate [-sample 0.01]
+	Estimate total duplicate bytes by hashing a random subset of same-size file groups.
+	Nothing is modified.
+`
+}
+
+func (c *estimate) SetFlags(f *flag.FlagSet) {
+	f.Float64Var(&c.sample, "sample", 0.01, "ratio (0..1) of same-size file groups to hash")
+	f.StringVar(&c.empty, "empty", "skip", "zero-byte files policy: skip, link or report (only)")
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+	lineInputVars(f, &c.input)
+}
+
+func (c *estimate) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	emptyPolicy, err := parseEmptyPolicy(c.empty)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+		fsdedupe.WithEmptyPolicy(emptyPolicy),
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+
+	est, err := fsdedupe.EstimateDuplicates(ctx, c.input.lines(os.Stdin), c.sample, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Printf("files:                   %d\n", est.Files)
+	fmt.Printf("same-size groups:        %d (%d sampled)\n", est.Groups, est.SampledGroups)
+	fmt.Printf("potential duplicates:    %s (upper bound)\n", fsdedupe.FormatSize(est.PotentialBytes))
+	fmt.Printf("sampled duplicates:      %s of %s\n", fsdedupe.FormatSize(est.SampledDuplicateBytes), fsdedupe.FormatSize(est.SampledPotentialBytes))
+	fmt.Printf("estimated duplicates:    %s\n", fsdedupe.FormatSize(est.DuplicateBytes))
+	return subcommands.ExitSuccess
+}
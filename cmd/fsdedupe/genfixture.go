@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+	"github.com/mxmCherry/fsdedupe/fsdedupetest"
+)
+
+type genFixture struct {
+	files   int
+	dupes   string
+	sizes   string
+	maxSize int64
+	dirs    int
+	seed    int64
+}
+
+func (*genFixture) Name() string { return "gen-fixture" }
+func (*genFixture) Synopsis() string {
+	return "Generate a synthetic tree with controllable duplication"
+}
+func (*genFixture) Usage() string {
+	return selfCmd + ` gen-fixture [-files 1000 -dupes 30% -sizes zipf] <DIR>
+	Generate a synthetic tree (for benchmarking and reproducing bug reports) in DIR.
+	The same flags (and -seed) generate the same tree.
+`
+}
+
+func (c *genFixture) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.files, "files", 1000, "number of files")
+	f.StringVar(&c.dupes, "dupes", "30%", "ratio of duplicate files, percent (30%) or fraction (0.3)")
+	f.StringVar(&c.sizes, "sizes", "zipf", "size distribution: zipf or uniform")
+	sizeVar(f, &c.maxSize, "max-size", 64<<10, "max file size, like 64K")
+	f.IntVar(&c.dirs, "dirs", 10, "number of subdirs to spread files over (0 - all in DIR)")
+	f.Int64Var(&c.seed, "seed", 1, "generator seed")
+}
+
+func (c *genFixture) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	spec := fsdedupetest.FixtureSpec{
+		Files:   c.files,
+		MaxSize: c.maxSize,
+		Dirs:    c.dirs,
+		Seed:    c.seed,
+	}
+
+	var err error
+	if spec.DupeRatio, err = parseRatio(c.dupes); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -dupes %q: %s\n", c.dupes, err)
+		return subcommands.ExitUsageError
+	}
+	switch c.sizes {
+	case "zipf":
+		spec.Sizes = fsdedupetest.Zipf
+	case "uniform":
+		spec.Sizes = fsdedupetest.Uniform
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported -sizes %q, expected zipf or uniform\n", c.sizes)
+		return subcommands.ExitUsageError
+	}
+
+	fixture, err := fsdedupetest.Generate(f.Arg(0), spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Printf("files:           %d\n", len(fixture.Files))
+	fmt.Printf("duplicates:      %d\n", fixture.Duplicates)
+	fmt.Printf("duplicate size:  %s\n", fsdedupe.FormatSize(fixture.DuplicateBytes))
+	return subcommands.ExitSuccess
+}
+
+// parseRatio parses a percent (30%) or a fraction (0.3).
+func parseRatio(s string) (float64, error) {
+	percent := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if percent {
+		v /= 100
+	}
+	if v < 0 || v > 1 {
+		return 0, fmt.Errorf("out of 0..100%% range")
+	}
+	return v, nil
+}
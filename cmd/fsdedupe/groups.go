@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type groups struct {
+	concurrency int
+	scheduling  fsdedupe.Scheduling
+	empty       string
+	streaming   bool
+	input       lineInput
+}
+
+func (*groups) Name() string { return "groups" }
+func (*groups) Synopsis() string {
+	return "Report duplicate groups of STDIN filenames as JSON lines (read-only)"
+}
+func (*groups) Usage() string {
+	return `find <SOMEDIR> -type f -not -path '*/.*' | ` + selfCmd + ` groups [-streaming=false] > <GROUPSFILE>
+	Write same-content file groups as JSON lines ({"hash":"...","size":N,"canonical":"...","count":N,"filenames":[...]}) to STDOUT,
+	each one as soon as it is finalized. Nothing is modified.
+`
+}
+
+func (c *groups) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.concurrency, "concurrency", 1, "number of files hashed in parallel")
+	schedulingVars(f, &c.scheduling)
+	f.StringVar(&c.empty, "empty", "skip", "zero-byte files policy: skip or report")
+	f.BoolVar(&c.streaming, "streaming", true, "read and stat all input first, processing it by size, so groups of each size are written (and forgotten) once done with it; otherwise all groups are written at the end of input")
+	lineInputVars(f, &c.input)
+}
+
+func (c *groups) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	emptyPolicy, err := parseEmptyPolicy(c.empty)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+		fsdedupe.WithConcurrency(c.concurrency),
+		fsdedupe.WithScheduling(c.scheduling),
+		fsdedupe.WithEmptyPolicy(emptyPolicy),
+	}
+	if c.streaming {
+		opts = append(opts, fsdedupe.WithLargestFirst())
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	enc := json.NewEncoder(w)
+	_, err = fsdedupe.ScanGroups(ctx, c.input.lines(os.Stdin), func(g fsdedupe.DuplicateGroup) error {
+		if err := enc.Encode(struct {
+			Hash      string   `json:"hash"`
+			Size      int64    `json:"size"`
+			Canonical string   `json:"canonical"`
+			Count     int      `json:"count"`
+			Filenames []string `json:"filenames"`
+		}{g.Hash, g.Size, g.Canonical, g.Count, g.Filenames}); err != nil {
+			return err
+		}
+		// streamed, not buffered until the end of input
+		return w.Flush()
+	}, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type indexServe struct {
+	listen string
+}
+
+func (*indexServe) Name() string { return "index-serve" }
+func (*indexServe) Synopsis() string {
+	return "Serve a shared (in-memory) hash index for multiple hosts"
+}
+func (*indexServe) Usage() string {
+	return selfCmd + ` index-serve [-listen <ADDR>]
+	Serve a shared hash index (hash -> host/path), fed by "symlink -index-url" runs on multiple hosts.
+	Endpoints: POST /entries, GET /hashes/{hash}, GET /report (fleet-wide savings).
+`
+}
+
+func (c *indexServe) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.listen, "listen", "127.0.0.1:7780", "address to listen on")
+}
+
+func (c *indexServe) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	logger := log.New(os.Stderr, selfCmd+": ", 0)
+	srv := &http.Server{
+		Addr:    c.listen,
+		Handler: fsdedupe.NewIndexServer(),
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Printf("serving hash index on %s", c.listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// ----------------------------------------------------------------------------
+
+const indexBatchSize = 1000
+
+// indexPublisher publishes hashed files to a shared hash index in batches.
+type indexPublisher struct {
+	client  *fsdedupe.IndexClient
+	host    string
+	pending []fsdedupe.IndexEntry
+}
+
+func (p *indexPublisher) add(ctx context.Context, filename, hash string, size int64) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return fmt.Errorf("absolute path: %w", err)
+	}
+
+	p.pending = append(p.pending, fsdedupe.IndexEntry{
+		Hash: hash,
+		Host: p.host,
+		Path: abs,
+		Size: size,
+	})
+	if len(p.pending) < indexBatchSize {
+		return nil
+	}
+	return p.flush(ctx)
+}
+
+func (p *indexPublisher) flush(ctx context.Context) error {
+	if len(p.pending) == 0 {
+		return nil
+	}
+	if err := p.client.Add(ctx, p.pending); err != nil {
+		return fmt.Errorf("publish to hash index: %w", err)
+	}
+	p.pending = p.pending[:0]
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// logInodes logs inode usage of filesystems of dirs,
+// skipping missing dirs and filesystems allocating inodes dynamically.
+func logInodes(logger *log.Logger, when string, dirs ...string) {
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		st, err := fsdedupe.StatFS(dir)
+		if err != nil || st.TotalInodes == 0 {
+			continue
+		}
+		logger.Printf("inodes used %s in %q: %d of %d (%d free)", when, dir, st.TotalInodes-st.FreeInodes, st.TotalInodes, st.FreeInodes)
+	}
+}
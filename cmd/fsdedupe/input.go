@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"io"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// lineInput configures reading filenames from STDIN lines (see fsdedupe.Lines).
+type lineInput struct {
+	maxLineLength int64
+	comments      bool
+}
+
+// lineInputVars defines -max-line-length and -comments flags of STDIN filenames input.
+func lineInputVars(f *flag.FlagSet, p *lineInput) {
+	sizeVar(f, &p.maxLineLength, "max-line-length", 64<<10, "max STDIN line length, like 1M")
+	f.BoolVar(&p.comments, "comments", false, `skip "#"-prefixed STDIN comment lines`)
+}
+
+// lines returns an Iterator of r lines.
+func (p lineInput) lines(r io.Reader) fsdedupe.Iterator {
+	opts := []fsdedupe.LinesOption{
+		fsdedupe.WithMaxLineLength(int(p.maxLineLength)),
+	}
+	if p.comments {
+		opts = append(opts, fsdedupe.WithComments())
+	}
+	return fsdedupe.Lines(r, opts...)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type layers struct {
+	top     int
+	bwlimit int64
+	empty   string
+}
+
+func (*layers) Name() string { return "layers" }
+func (*layers) Synopsis() string {
+	return "Report duplicate files across container image layers (read-only)"
+}
+func (*layers) Usage() string {
+	return selfCmd + ` layers [-top 20] <DIR>...
+	Report same-content files found in multiple layers of container images, with wasted size.
+	DIR is an OCI image layout dir (having index.json, like extracted "docker save" output)
+	or a docker overlay2 storage dir (like /var/lib/docker/overlay2). Nothing is modified.
+`
+}
+
+func (c *layers) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.top, "top", 20, "print this number of groups wasting the most (0 - all)")
+	f.StringVar(&c.empty, "empty", "skip", "zero-byte files policy: skip or report")
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+}
+
+func (c *layers) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	emptyPolicy, err := parseEmptyPolicy(c.empty)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	var all []fsdedupe.Layer
+	for _, dir := range f.Args() {
+		found, err := findLayers(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		all = append(all, found...)
+	}
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+		fsdedupe.WithEmptyPolicy(emptyPolicy),
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+
+	report, err := fsdedupe.ScanLayers(ctx, all, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	for i, g := range report.Groups {
+		if c.top > 0 && i == c.top {
+			fmt.Printf("... %d more groups\n", len(report.Groups)-c.top)
+			break
+		}
+		fmt.Printf("%s wasted: %d copies of %s\n", fsdedupe.FormatSize(g.WastedBytes()), len(g.Files), fsdedupe.FormatSize(g.Size))
+		for _, file := range g.Files {
+			fmt.Printf("\t%s %s\n", file.Layer, file.Path)
+		}
+	}
+	fmt.Printf("layers:  %d\n", report.Layers)
+	fmt.Printf("files:   %d (%s)\n", report.Files, fsdedupe.FormatSize(report.Bytes))
+	fmt.Printf("groups:  %d\n", len(report.Groups))
+	fmt.Printf("wasted:  %s\n", fsdedupe.FormatSize(report.WastedBytes))
+	return subcommands.ExitSuccess
+}
+
+// findLayers lists layers of an OCI image layout or a docker overlay2 dir.
+func findLayers(dir string) ([]fsdedupe.Layer, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return fsdedupe.OCILayers(dir)
+	}
+	found, err := fsdedupe.Overlay2Layers(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%q is neither an OCI image layout (no index.json) nor an overlay2 dir (no <ID>/diff dirs)", dir)
+	}
+	return found, nil
+}
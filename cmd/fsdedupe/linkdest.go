@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type linkDest struct {
+	links   string
+	print0  bool
+	bwlimit int64
+}
+
+func (*linkDest) Name() string { return "link-dest" }
+func (*linkDest) Synopsis() string {
+	return "Plan an rsync-style incremental snapshot, hardlinking same-content files from the previous one"
+}
+func (*linkDest) Usage() string {
+	return selfCmd + ` link-dest -links <LINKSFILE> <PREVDIR> <SRCDIR> > <FILESFROM>
+	Compare SRCDIR with the previous snapshot PREVDIR by content (renamed/moved files match too),
+	print SRCDIR-relative files to copy to STDOUT (for rsync --files-from)
+	and write tab-separated "<PREVFILE>	<PATH>" hardlink mapping to LINKSFILE.
+	Nothing is modified.
+`
+}
+
+func (c *linkDest) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.links, "links", "", "write hardlink mapping to this file (required)")
+	f.BoolVar(&c.print0, "print0", false, "delimit output with NUL instead of newline (rsync --from0)")
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+}
+
+func (c *linkDest) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 || c.links == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+
+	plan, err := fsdedupe.PlanLinkDest(ctx, f.Arg(0), f.Arg(1), opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	delim := "\n"
+	if c.print0 {
+		delim = "\x00"
+	}
+
+	if err := writeLinkDestLinks(c.links, plan.Links, delim); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	for _, path := range plan.Copy {
+		fmt.Fprint(w, path+delim)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+func writeLinkDestLinks(name string, links []fsdedupe.LinkDestLink, delim string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("create links file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, link := range links {
+		fmt.Fprint(w, link.Source+"\t"+link.Path+delim)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write links file %q: %w", name, err)
+	}
+	return f.Close()
+}
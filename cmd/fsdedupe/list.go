@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+)
+
+// listValue is a repeatable string flag.Value.
+type listValue []string
+
+func (v *listValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+func (v *listValue) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
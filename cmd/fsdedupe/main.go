@@ -2,12 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/google/subcommands"
 	"github.com/mxmCherry/fsdedupe"
@@ -16,21 +25,131 @@ import (
 var selfCmd = filepath.Base(os.Args[0])
 
 func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM)
-	defer cancel()
+	ctx, abort := handleSignals()
 
 	subcommands.Register(subcommands.HelpCommand(), "")
 	subcommands.Register(subcommands.FlagsCommand(), "")
 	subcommands.Register(subcommands.CommandsCommand(), "")
 	subcommands.Register(&symlink{}, "")
+	subcommands.Register(&dir{}, "")
+	subcommands.Register(&doctor{}, "")
+	subcommands.Register(&estimate{}, "")
+	subcommands.Register(&layers{}, "")
+	subcommands.Register(&groups{}, "")
+	subcommands.Register(&indexServe{}, "")
+	subcommands.Register(&linkDest{}, "")
+	subcommands.Register(&genFixture{}, "")
+	subcommands.Register(&tierRebalance{}, "")
+	subcommands.Register(&cp{}, "")
+	subcommands.Register(&snapshotDiff{}, "")
+	subcommands.Register(&usage{}, "")
+	subcommands.Register(&store{}, "")
+	subcommands.Register(&statsRecord{}, "")
+	subcommands.Register(&statsHistory{}, "")
+	subcommands.Register(&restore{}, "")
+	subcommands.Register(&relink{}, "")
+	subcommands.Register(&plan{}, "")
+	subcommands.Register(&review{}, "")
+	subcommands.Register(&apply{}, "")
+	subcommands.Register(&treeHash{}, "")
+	subcommands.Register(&treeEqual{}, "")
+	subcommands.Register(&version{}, "")
 
 	flag.Parse()
-	os.Exit(int(subcommands.Execute(ctx)))
+	os.Exit(int(subcommands.Execute(ctx, abort)))
+}
+
+// handleSignals implements two-level cancellation on SIGINT/SIGTERM:
+// first signal cancels ctx (finish in-flight files, write checkpoints),
+// second one cancels abort (abort immediately, rolling back in-flight actions).
+// Further signals are handled by default (terminating the process).
+func handleSignals() (ctx, abort context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	abort, cancelAbort := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Fprintf(os.Stderr, "%s: %s, finishing in-flight files (send again to abort)\n", selfCmd, sig)
+		cancel()
+
+		sig = <-signals
+		fmt.Fprintf(os.Stderr, "%s: %s, aborting\n", selfCmd, sig)
+		signal.Stop(signals)
+		cancelAbort()
+	}()
+	return ctx, abort
+}
+
+// abortContext extracts abort context (see handleSignals) from subcommand args.
+func abortContext(args []interface{}) context.Context {
+	for _, arg := range args {
+		if abort, ok := arg.(context.Context); ok {
+			return abort
+		}
+	}
+	return context.Background()
 }
 
 // ----------------------------------------------------------------------------
 
-type symlink struct{}
+type symlink struct {
+	networkSafe  bool
+	largestFirst bool
+	printLinked  bool
+	print0       bool
+	bwlimit      int64
+	alertCount   int
+	alertSize    int64
+	alertWebhook string
+	notifyURL    string
+	notifySlack  string
+	maxDuration  time.Duration
+	checkpoint   string
+	resume       string
+
+	concurrency    int
+	scheduling     fsdedupe.Scheduling
+	maxOpenFiles   int
+	maxIndexMemory int64
+	maxLinks       int
+	empty          string
+	minSize        int64
+	excludes       listValue
+	profile        string
+	forks          string
+	identity       string
+	mediaReport    bool
+	indexURL       string
+	indexHost      string
+	ignorePerm     bool
+	journal        string
+	progress       time.Duration
+	prescan        bool
+	dir            string
+	maxDepth       int
+	git            bool
+	gitUntracked   bool
+	scanCache      string
+	reportHTML     string
+	allowedRoots   listValue
+	skipSymlinks   bool
+	hashCache      string
+	treeHash       bool
+	skippedFile    string
+	sameDevice     bool
+	originalsDir   string
+	force          bool
+	diff           string
+	link           string
+	fsLinks        listValue
+	compatRules    string
+	shadowDir      string
+	shadowRoot     string
+	resolver       string
+	input          lineInput
+}
 
 func (*symlink) Name() string { return "symlink" }
 func (*symlink) Synopsis() string {
@@ -40,16 +159,660 @@ func (*symlink) Usage() string {
 	return `find <SOMEDIR> -type f -not -path '*/.*' | ` + selfCmd + ` symlink
 	Deduplicate STDIN-provided filenames by symlinking same-content ones (SHA512) to the first-seen one.
 	Provided "find ..." snippet excludes UNIX hidden files (dot-prefixed).
+	Without -force, it is a dry run: duplicates are only reported, and replaced if confirmed on a terminal.
 `
 }
 
-func (c *symlink) SetFlags(f *flag.FlagSet) {}
+func (c *symlink) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&c.networkSafe, "network-safe", false, "probe target dirs first (NFS/SMB-safe mode), only report duplicates where symlinks are not supported")
+	f.BoolVar(&c.largestFirst, "largest-first", false, "read all input first and process biggest potential savings first")
+	f.BoolVar(&c.printLinked, "print-linked", false, "print every filename replaced by a symlink to STDOUT")
+	f.BoolVar(&c.print0, "print0", false, "delimit -print-linked output with NUL instead of newline")
+	f.IntVar(&c.alertCount, "alert-count", 0, "alert on duplicate groups with more than this number of files (0 - disabled)")
+	sizeVar(f, &c.alertSize, "alert-size", 0, "alert on duplicate groups with total size above this size, like 10G (0 - disabled)")
+	f.StringVar(&c.alertWebhook, "alert-webhook", "", "POST alerts as JSON to this URL")
+	f.StringVar(&c.notifyURL, "notify-webhook", "", "POST run summary as JSON to this URL")
+	f.StringVar(&c.notifySlack, "notify-slack", "", "POST run summary to this Slack-compatible incoming webhook URL")
+	f.DurationVar(&c.maxDuration, "max-duration", 0, "stop the run cleanly after this duration (0 - unlimited)")
+	f.StringVar(&c.checkpoint, "checkpoint", "", "write a checkpoint to this file when the run is interrupted (by -max-duration or a signal)")
+	f.StringVar(&c.resume, "resume", "", "resume from a checkpoint file (instead of reading STDIN)")
+	f.IntVar(&c.concurrency, "concurrency", 1, "number of files hashed in parallel")
+	schedulingVars(f, &c.scheduling)
+	f.IntVar(&c.maxOpenFiles, "max-open-files", 0, "max number of simultaneously open files (0 - unlimited)")
+	sizeVar(f, &c.maxIndexMemory, "max-index-memory", 0, "rough memory budget for the hash index, like 512M (0 - unlimited)")
+	f.IntVar(&c.maxLinks, "max-links", 0, "max number of duplicates linked to a single canonical file, next one becomes a new canonical file (0 - unlimited)")
+	f.StringVar(&c.empty, "empty", "skip", "zero-byte files policy: skip, link or report (only)")
+	sizeVar(f, &c.minSize, "min-size", 0, "skip non-empty files smaller than this size, like 4K (0 - none)")
+	f.Var(&c.excludes, "exclude", "skip files, name of which or of any parent dir matches this pattern, like *.tmp or node_modules (repeatable)")
+	f.StringVar(&c.profile, "profile", "", profileUsage)
+	f.StringVar(&c.identity, "identity", "", "strict duplicate identity: comma-separated file metadata, which must match along with contents: exec (executable bits), mode (all permission bits), xattrs (extended attributes, Linux only)")
+	f.StringVar(&c.forks, "forks", "warn", "macOS resource forks / Windows alternate data streams policy: warn (about losing them), skip (duplicates having them) or hash (include them in content identity)")
+	f.BoolVar(&c.mediaReport, "media-report", false, "also report (not link) media files sharing EXIF capture metadata, but having different content")
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+	f.StringVar(&c.indexURL, "index-url", "", "publish hashed files to this shared hash index (see index-serve)")
+	f.StringVar(&c.indexHost, "index-host", "", "host name to publish to the shared hash index (default - hostname)")
+	f.StringVar(&c.journal, "journal", "", "journal in-flight link actions to this file, so they are rolled back on abort (second signal) or on next run after a crash")
+	f.BoolVar(&c.ignorePerm, "ignore-permission", false, "skip (and report) files that can't be read or replaced due to permissions, instead of failing")
+	f.DurationVar(&c.progress, "progress", 0, "print progress (rates, ETA with -prescan) to STDERR at this interval and a final summary (0 - disabled)")
+	f.BoolVar(&c.prescan, "prescan", false, "read and stat all input first, so -progress can estimate ETA")
+	f.StringVar(&c.dir, "dir", "", "walk regular files of this dir (instead of reading STDIN)")
+	f.IntVar(&c.maxDepth, "max-depth", 0, "with -dir, walk at most this number of dir levels, -dir being level 1 (0 - unlimited)")
+	f.BoolVar(&c.git, "git", false, "skip repository internals (.git dirs) of git working trees")
+	f.BoolVar(&c.gitUntracked, "git-untracked-only", false, "skip files tracked by git too (implies -git), deduplicating untracked and ignored ones (build artifacts) only")
+	f.StringVar(&c.scanCache, "scan-cache", "", "with -dir, skip dirs unchanged (mtime, entry count) since the last successful run, remembered in this file")
+	f.StringVar(&c.reportHTML, "report-html", "", "write run report (top duplicate groups, savings per directory, errors) as a standalone HTML page to this file")
+	f.Var(&c.allowedRoots, "allowed-root", "skip input symlinks resolving outside of this dir (repeatable)")
+	f.BoolVar(&c.skipSymlinks, "skip-symlinks", false, "skip input symlinks altogether")
+	f.StringVar(&c.hashCache, "hash-cache", "", "reuse hashes of files unchanged (size, mtime) since cached in this file (shared with cp), updating it")
+	f.BoolVar(&c.treeHash, "tree-hash", false, "with -dir, print -dir tree hash (see tree-hash) before and after the run, failing if it changed")
+	f.StringVar(&c.skippedFile, "skipped", "", `write every skipped (not linked) file to this file as JSON lines ({"filename":"...","reason":"...","detail":"..."})`)
+	f.BoolVar(&c.sameDevice, "same-device", false, "leave duplicates residing on another device (filesystem) than their canonical file")
+	f.StringVar(&c.originalsDir, "originals", "", "move canonical file of each duplicate group into this dir (named by content hash), symlinking all occurrences to it")
+	f.BoolVar(&c.force, "force", false, forceUsage)
+	f.StringVar(&c.diff, "diff", "", "in a dry run, write planned changes to STDOUT in this format instead of asking for confirmation: unified (diff-like) or json (readable by apply -plan)")
+	f.StringVar(&c.link, "link", "symlink", linkUsage)
+	f.Var(&c.fsLinks, "fs-link", fsLinkUsage)
+	f.StringVar(&c.compatRules, "compat-rules", "", compatUsage)
+	f.StringVar(&c.shadowDir, "shadow", "", "leave input files untouched, building a deduplicated view of -shadow-root tree of symlinks in this dir instead")
+	f.StringVar(&c.shadowRoot, "shadow-root", "", "with -shadow, dir input files are within (default - -dir)")
+	f.StringVar(&c.resolver, "resolver", "", resolverUsage)
+	lineInputVars(f, &c.input)
+}
+
+func (c *symlink) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if c.profile != "" {
+		if err := applyProfile(f, c.profile); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitUsageError
+		}
+	}
+
+	emptyPolicy, err := parseEmptyPolicy(c.empty)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	forkPolicy, err := parseForkPolicy(c.forks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
 
-func (c *symlink) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	it := fsdedupe.Lines(os.Stdin)
-	if err := fsdedupe.DedupeSymlink(ctx, it); err != nil {
+	identity, err := parseIdentity(c.identity)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
-		return subcommands.ExitFailure
+		return subcommands.ExitUsageError
+	}
+
+	linkOpts, err := linkStrategyOptions(c.link, c.fsLinks, c.compatRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	switch fsdedupe.DiffFormat(c.diff) {
+	case "":
+	case fsdedupe.DiffUnified, fsdedupe.DiffJSON:
+		if c.force || c.shadowDir != "" {
+			fmt.Fprintf(os.Stderr, "-diff is for dry runs only, not with -force or -shadow\n")
+			return subcommands.ExitUsageError
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported -diff %q, expected unified or json\n", c.diff)
+		return subcommands.ExitUsageError
+	}
+
+	logger := log.New(os.Stderr, selfCmd+": ", 0)
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(logger),
+		fsdedupe.WithConcurrency(c.concurrency),
+		fsdedupe.WithScheduling(c.scheduling),
+		fsdedupe.WithMaxOpenFiles(c.maxOpenFiles),
+		fsdedupe.WithMaxIndexMemory(c.maxIndexMemory),
+		fsdedupe.WithMaxLinks(c.maxLinks),
+		fsdedupe.WithEmptyPolicy(emptyPolicy),
+		fsdedupe.WithMinSize(c.minSize),
+		fsdedupe.WithExcludes(c.excludes...),
+		fsdedupe.WithForkPolicy(forkPolicy),
+		fsdedupe.WithIdentity(identity),
+		fsdedupe.WithAbort(abortContext(args)),
+	}
+	opts = append(opts, linkOpts...)
+	if c.skipSymlinks {
+		opts = append(opts, fsdedupe.WithAllowedRoots())
+	} else if len(c.allowedRoots) != 0 {
+		opts = append(opts, fsdedupe.WithAllowedRoots(c.allowedRoots...))
+	}
+	if c.journal != "" {
+		if err := fsdedupe.RollbackJournal(c.journal); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		opts = append(opts, fsdedupe.WithJournal(c.journal))
+	}
+	if c.networkSafe {
+		opts = append(opts, fsdedupe.WithNetworkSafe())
+	}
+	if c.largestFirst {
+		opts = append(opts, fsdedupe.WithLargestFirst())
+	}
+	if c.mediaReport {
+		opts = append(opts, fsdedupe.WithMediaGroups(func(g fsdedupe.MediaGroup) error {
+			logger.Printf("similar media (captured %s, %s, %dx%d): %q", g.Key.Captured, g.Key.Model, g.Key.Width, g.Key.Height, g.Filenames)
+			return nil
+		}))
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+	if c.printLinked {
+		delim := "\n"
+		if c.print0 {
+			delim = "\x00"
+		}
+		opts = append(opts, fsdedupe.WithOnLinked(func(filename, _ string) error {
+			_, err := io.WriteString(os.Stdout, filename+delim)
+			return err
+		}))
+	}
+
+	var onHashed []func(filename, hash string, size int64) error
+	var index *indexPublisher
+	if c.indexURL != "" {
+		host := c.indexHost
+		if host == "" {
+			if host, err = os.Hostname(); err != nil {
+				fmt.Fprintf(os.Stderr, "hostname: %s\n", err)
+				return subcommands.ExitFailure
+			}
+		}
+		index = &indexPublisher{
+			client: &fsdedupe.IndexClient{
+				URL:    c.indexURL,
+				Client: &http.Client{Timeout: 30 * time.Second},
+			},
+			host: host,
+		}
+		onHashed = append(onHashed, func(filename, hash string, size int64) error {
+			// not bound to run context: interruption should checkpoint, not fail on publishing
+			return index.add(context.Background(), filename, hash, size)
+		})
+	}
+
+	var permDenied []string
+	if c.ignorePerm {
+		opts = append(opts, fsdedupe.WithIgnorePermissionDenied(func(filename string, _ error) error {
+			permDenied = append(permDenied, filename)
+			return nil
+		}))
+	}
+
+	var alerts []fsdedupe.Alert
+	if c.alertCount > 0 || c.alertSize > 0 {
+		policy := fsdedupe.AlertPolicy{
+			MaxCount:     c.alertCount,
+			MaxTotalSize: c.alertSize,
+		}
+		opts = append(opts, fsdedupe.WithAlerts(policy, func(a fsdedupe.Alert) error {
+			logger.Printf("alert: %d files (%s total) with the same content as %q", a.Count, fsdedupe.FormatSize(a.TotalSize), a.Canonical)
+			alerts = append(alerts, a)
+			return nil
+		}))
+	}
+
+	if c.sameDevice {
+		opts = append(opts, fsdedupe.WithSameDevice())
+	}
+	if c.originalsDir != "" {
+		opts = append(opts, fsdedupe.WithOriginalsDir(c.originalsDir))
+	}
+	if c.shadowDir != "" {
+		root := c.shadowRoot
+		if root == "" {
+			root = c.dir
+		}
+		if root == "" {
+			fmt.Fprintf(os.Stderr, "-shadow requires -shadow-root or -dir\n")
+			return subcommands.ExitUsageError
+		}
+		opts = append(opts, fsdedupe.WithShadowTree(root, c.shadowDir))
+	}
+	if c.resolver != "" && (c.shadowDir != "" || c.journal != "" || c.originalsDir != "") {
+		// resolved plans are applied without shadow tree, journal and originals dir relocation
+		fmt.Fprintf(os.Stderr, "-resolver can't be combined with -shadow, -journal or -originals\n")
+		return subcommands.ExitUsageError
+	}
+	if c.skippedFile != "" {
+		out, err := os.Create(c.skippedFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create skipped file: %s\n", err)
+			return subcommands.ExitFailure
+		}
+		defer out.Close()
+
+		enc := json.NewEncoder(out)
+		opts = append(opts, fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, detail string) error {
+			return enc.Encode(struct {
+				Filename string              `json:"filename"`
+				Reason   fsdedupe.SkipReason `json:"reason"`
+				Detail   string              `json:"detail"`
+			}{filename, reason, detail})
+		}))
+	}
+
+	var hashCache *fsdedupe.HashCache
+	if c.hashCache != "" {
+		if hashCache, err = readHashCache(c.hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		opts = append(opts, fsdedupe.WithHashCache(hashCache))
+	}
+
+	var report *fsdedupe.RunReport
+	if c.reportHTML != "" {
+		report = fsdedupe.NewRunReport()
+		opts = append(opts, fsdedupe.WithRunReport(report))
+	}
+
+	it := c.input.lines(os.Stdin)
+	var scanCache *fsdedupe.ScanCache
+	if c.dir != "" {
+		if c.scanCache != "" {
+			var err error
+			if scanCache, err = readScanCache(c.scanCache); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return subcommands.ExitFailure
+			}
+		}
+		it = fsdedupe.WalkDir(c.dir, scanCache, fsdedupe.WithMaxDepth(c.maxDepth))
+	}
+	if c.resume != "" {
+		cp, err := readCheckpoint(c.resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		it = fsdedupe.Slice(cp.Remaining)
+		opts = append(opts, fsdedupe.WithResume(cp))
+	}
+	if c.gitUntracked {
+		it = fsdedupe.GitFilter(it, fsdedupe.WithUntrackedOnly())
+	} else if c.git {
+		it = fsdedupe.GitFilter(it)
+	}
+	if c.checkpoint != "" {
+		opts = append(opts, fsdedupe.WithCheckpoint(func(cp fsdedupe.Checkpoint) error {
+			if err := writeCheckpoint(c.checkpoint, cp); err != nil {
+				return err
+			}
+			logger.Printf("interrupted, checkpoint written to %q, resume with -resume", c.checkpoint)
+			return nil
+		}))
+	}
+
+	var prog *progress
+	if c.progress > 0 {
+		var total int64
+		if c.prescan {
+			var filenames []string
+			if filenames, total, err = prescan(it); err != nil {
+				fmt.Fprintf(os.Stderr, "prescan: %s\n", err)
+				return subcommands.ExitFailure
+			}
+			it = fsdedupe.Slice(filenames)
+		}
+		prog = newProgress(total)
+		onHashed = append(onHashed, func(_, _ string, size int64) error {
+			prog.hashed(size)
+			return nil
+		})
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go prog.run(os.Stderr, c.progress, stop)
+	}
+	if len(onHashed) != 0 {
+		opts = append(opts, fsdedupe.WithOnHashed(func(filename, hash string, size int64) error {
+			for _, fn := range onHashed {
+				if err := fn(filename, hash, size); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+
+	var treeHashBefore string
+	if c.treeHash && c.dir != "" {
+		if treeHashBefore, err = fsdedupe.TreeHash(ctx, c.dir); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		logger.Printf("tree hash before: %s", treeHashBefore)
+	}
+
+	if c.maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.maxDuration)
+		defer cancel()
+	}
+
+	logInodes(logger, "before", c.dir, c.shadowDir, c.originalsDir)
+	var summary fsdedupe.Summary
+	var runErr error
+	// shadow tree leaves input files untouched
+	applied := (c.force && c.resolver == "") || c.shadowDir != ""
+	if applied {
+		summary, runErr = fsdedupe.DedupeSymlink(ctx, it, opts...)
+	} else {
+		// plan first, so nothing is touched unless confirmed (and resolved)
+		opts = append(opts, fsdedupe.WithSummary(&summary))
+		var dp fsdedupe.DedupePlan
+		dp, runErr = fsdedupe.PlanSymlink(ctx, it, opts...)
+		if runErr == nil && c.resolver != "" {
+			dp, runErr = fsdedupe.ResolvePlan(ctx, dp, fsdedupe.ExecResolver(c.resolver))
+		}
+		if runErr == nil {
+			if c.force {
+				applied = true
+			} else if c.diff != "" {
+				confirmPlan(os.Stderr, dp, false, false)
+				runErr = fsdedupe.WriteDiff(os.Stdout, dp, fsdedupe.DiffFormat(c.diff))
+			} else {
+				// plans are applied without journal and originals dir relocation
+				applied = confirmPlan(os.Stderr, dp, false, c.journal == "" && c.originalsDir == "")
+			}
+			if applied {
+				runErr = fsdedupe.ApplyPlan(ctx, dp, opts...)
+			}
+		}
+	}
+	if c.maxDuration > 0 && errors.Is(runErr, context.DeadlineExceeded) {
+		logger.Printf("stopped after -max-duration %s", c.maxDuration)
+		runErr = nil
+	} else if runErr != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", runErr)
+	}
+
+	logInodes(logger, "after", c.dir, c.shadowDir, c.originalsDir)
+
+	if len(permDenied) != 0 {
+		printPermissionDenied(os.Stderr, permDenied)
+	}
+	if prog != nil {
+		printSummary(os.Stderr, summary, time.Since(prog.start))
+	}
+
+	status := subcommands.ExitSuccess
+	if treeHashBefore != "" {
+		// representation changed, logical content must not
+		after, err := fsdedupe.TreeHash(context.Background(), c.dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = subcommands.ExitFailure
+		} else {
+			logger.Printf("tree hash after:  %s", after)
+		}
+		if err == nil && after != treeHashBefore {
+			fmt.Fprintf(os.Stderr, "tree hash changed: %s -> %s\n", treeHashBefore, after)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	// run context may be cancelled already, but notifications are still wanted
+	notifyCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if runErr != nil {
+		status = subcommands.ExitFailure
+	} else if scanCache != nil && ctx.Err() == nil && applied {
+		// dry runs must not mark dirs as done
+		if err := writeScanCache(c.scanCache, scanCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	// cached hashes are validated on use, so even a failed run ones are worth keeping
+	if hashCache != nil {
+		if err := writeHashCache(c.hashCache, hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	if report != nil {
+		if err := writeReportHTML(c.reportHTML, report, summary, runErr); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	if index != nil {
+		if err := index.flush(notifyCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	if c.alertWebhook != "" && len(alerts) != 0 {
+		webhook := &fsdedupe.WebhookNotifier{URL: c.alertWebhook}
+		if err := webhook.Send(notifyCtx, map[string]interface{}{"alerts": alerts}); err != nil {
+			fmt.Fprintf(os.Stderr, "send alerts: %s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	var notifiers []fsdedupe.Notifier
+	if c.notifyURL != "" {
+		notifiers = append(notifiers, &fsdedupe.WebhookNotifier{URL: c.notifyURL})
+	}
+	if c.notifySlack != "" {
+		notifiers = append(notifiers, &fsdedupe.SlackNotifier{URL: c.notifySlack})
+	}
+	for _, n := range notifiers {
+		if err := n.Notify(notifyCtx, summary, runErr); err != nil {
+			fmt.Fprintf(os.Stderr, "notify: %s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	return status
+}
+
+func readCheckpoint(name string) (fsdedupe.Checkpoint, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return fsdedupe.Checkpoint{}, fmt.Errorf("open checkpoint: %w", err)
+	}
+	defer f.Close()
+
+	cp, err := fsdedupe.ReadCheckpoint(f)
+	if err != nil {
+		return cp, fmt.Errorf("read checkpoint %q: %w", name, err)
+	}
+	return cp, nil
+}
+
+func writeCheckpoint(name string, cp fsdedupe.Checkpoint) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("create checkpoint: %w", err)
+	}
+	defer f.Close()
+
+	if err := fsdedupe.WriteCheckpoint(f, cp); err != nil {
+		return fmt.Errorf("write checkpoint %q: %w", name, err)
+	}
+	return f.Close()
+}
+
+// readScanCache reads scan cache file, missing one means an empty cache.
+func readScanCache(name string) (*fsdedupe.ScanCache, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fsdedupe.NewScanCache(), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("open scan cache: %w", err)
+	}
+	defer f.Close()
+
+	cache, err := fsdedupe.ReadScanCache(f)
+	if err != nil {
+		return nil, fmt.Errorf("read scan cache %q: %w", name, err)
+	}
+	return cache, nil
+}
+
+func writeScanCache(name string, cache *fsdedupe.ScanCache) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create scan cache: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if _, err := cache.WriteTo(f); err != nil {
+		return fmt.Errorf("write scan cache %q: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close scan cache %q: %w", name, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("rename scan cache %q: %w", name, err)
+	}
+	return nil
+}
+
+// readHashCache reads hash cache file, missing one means an empty cache.
+func readHashCache(name string) (*fsdedupe.HashCache, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fsdedupe.NewHashCache(), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("open hash cache: %w", err)
+	}
+	defer f.Close()
+
+	cache, err := fsdedupe.ReadHashCache(f)
+	if err != nil {
+		return nil, fmt.Errorf("read hash cache %q: %w", name, err)
+	}
+	return cache, nil
+}
+
+func writeHashCache(name string, cache *fsdedupe.HashCache) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create hash cache: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if _, err := cache.WriteTo(f); err != nil {
+		return fmt.Errorf("write hash cache %q: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close hash cache %q: %w", name, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("rename hash cache %q: %w", name, err)
+	}
+	return nil
+}
+
+func writeReportHTML(name string, report *fsdedupe.RunReport, summary fsdedupe.Summary, runErr error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("create report: %w", err)
+	}
+	defer f.Close()
+
+	if err := report.WriteHTML(f, summary, runErr); err != nil {
+		return fmt.Errorf("write report %q: %w", name, err)
+	}
+	return f.Close()
+}
+
+func parseEmptyPolicy(s string) (fsdedupe.EmptyPolicy, error) {
+	switch s {
+	case "skip":
+		return fsdedupe.EmptySkip, nil
+	case "link":
+		return fsdedupe.EmptyLink, nil
+	case "report":
+		return fsdedupe.EmptyReport, nil
+	}
+	return 0, fmt.Errorf("unsupported -empty policy %q, expected skip, link or report", s)
+}
+
+func parseForkPolicy(s string) (fsdedupe.ForkPolicy, error) {
+	switch s {
+	case "warn":
+		return fsdedupe.ForkWarn, nil
+	case "skip":
+		return fsdedupe.ForkSkip, nil
+	case "hash":
+		return fsdedupe.ForkHash, nil
+	}
+	return 0, fmt.Errorf("unsupported -forks policy %q, expected warn, skip or hash", s)
+}
+
+func parseIdentity(s string) (fsdedupe.Identity, error) {
+	var identity fsdedupe.Identity
+	if s == "" {
+		return identity, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		switch name {
+		case "exec":
+			identity |= fsdedupe.IdentityExec
+		case "mode":
+			identity |= fsdedupe.IdentityMode
+		case "xattrs":
+			identity |= fsdedupe.IdentityXattrs
+		default:
+			return 0, fmt.Errorf("unsupported -identity metadata %q, expected exec, mode or xattrs", name)
+		}
+	}
+	return identity, nil
+}
+
+// printPermissionDenied prints permission-skipped files grouped by top (outermost) directory.
+func printPermissionDenied(w io.Writer, filenames []string) {
+	byDir := make(map[string][]string)
+	for _, filename := range filenames {
+		dir := filepath.Dir(filename)
+		byDir[dir] = append(byDir[dir], filename)
+	}
+
+	// top is the outermost dir (having skipped files) of the path
+	var tops []string
+	byTop := make(map[string][]string)
+	for dir, names := range byDir {
+		top := dir
+		for d := filepath.Dir(dir); d != filepath.Dir(d); d = filepath.Dir(d) {
+			if _, ok := byDir[d]; ok {
+				top = d
+			}
+		}
+		if _, ok := byTop[top]; !ok {
+			tops = append(tops, top)
+		}
+		byTop[top] = append(byTop[top], names...)
+	}
+	sort.Strings(tops)
+
+	fmt.Fprintf(w, "%d file(s) skipped due to permissions:\n", len(filenames))
+	for _, top := range tops {
+		sort.Strings(byTop[top])
+		fmt.Fprintf(w, "  %s: %d\n", top, len(byTop[top]))
+		for _, filename := range byTop[top] {
+			fmt.Fprintf(w, "    %s\n", filename)
+		}
 	}
-	return subcommands.ExitSuccess
 }
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type plan struct {
+	concurrency int
+	scheduling  fsdedupe.Scheduling
+	resolver    string
+	input       lineInput
+}
+
+func (*plan) Name() string { return "plan" }
+func (*plan) Synopsis() string {
+	return "Plan deduplication of STDIN filenames for review (read-only)"
+}
+func (*plan) Usage() string {
+	return `find <SOMEDIR> -type f -not -path '*/.*' | ` + selfCmd + ` plan > <PLANFILE>
+	Write a plan of symlink replacements (JSON lines, see artifact package) to STDOUT, to be reviewed (see review) and applied (see apply) later.
+	Nothing is modified.
+`
+}
+
+func (c *plan) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&c.concurrency, "concurrency", 1, "number of files hashed in parallel")
+	schedulingVars(f, &c.scheduling)
+	f.StringVar(&c.resolver, "resolver", "", resolverUsage)
+	lineInputVars(f, &c.input)
+}
+
+func (c *plan) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	dp, err := fsdedupe.PlanSymlink(ctx, c.input.lines(os.Stdin),
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+		fsdedupe.WithConcurrency(c.concurrency),
+		fsdedupe.WithScheduling(c.scheduling),
+	)
+	if err == nil && c.resolver != "" {
+		dp, err = fsdedupe.ResolvePlan(ctx, dp, fsdedupe.ExecResolver(c.resolver))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	if err := fsdedupe.WritePlan(os.Stdout, dp); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type review struct {
+	plan     string
+	status   string
+	reviewer string
+	note     string
+}
+
+func (*review) Name() string { return "review" }
+func (*review) Synopsis() string {
+	return "Approve, reject or defer duplicate groups of a plan"
+}
+func (*review) Usage() string {
+	return selfCmd + ` review -plan <PLANFILE> -status <approved|rejected|deferred> [-reviewer NAME] [-note TEXT] <TARGET>...
+	Set review status of duplicate groups (identified by their symlink TARGET) in PLANFILE (updated in place).
+`
+}
+
+func (c *review) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.plan, "plan", "", "plan file (required)")
+	f.StringVar(&c.status, "status", "", "review status: approved, rejected or deferred (required)")
+	f.StringVar(&c.reviewer, "reviewer", os.Getenv("USER"), "reviewer name")
+	f.StringVar(&c.note, "note", "", "free-form annotation")
+}
+
+func (c *review) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 || c.plan == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	status := fsdedupe.ReviewStatus(c.status)
+	switch status {
+	case fsdedupe.ReviewApproved, fsdedupe.ReviewRejected, fsdedupe.ReviewDeferred:
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported -status %q, expected approved, rejected or deferred\n", c.status)
+		return subcommands.ExitUsageError
+	}
+
+	dp, err := readPlan(c.plan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	for _, target := range f.Args() {
+		if !dp.Review(target, fsdedupe.PlanReview{Status: status, Reviewer: c.reviewer, Note: c.note}) {
+			fmt.Fprintf(os.Stderr, "no duplicate group of %q in plan\n", target)
+			return subcommands.ExitFailure
+		}
+	}
+	if err := writePlan(c.plan, dp); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type apply struct {
+	plan         string
+	approvedOnly bool
+	force        bool
+	link         string
+	fsLinks      listValue
+	compatRules  string
+}
+
+func (*apply) Name() string { return "apply" }
+func (*apply) Synopsis() string {
+	return "Apply a reviewed plan"
+}
+func (*apply) Usage() string {
+	return selfCmd + ` apply -plan <PLANFILE> [-approved-only] [-force] [-link <STRATEGY>] [-fs-link <TYPE>=<STRATEGY>]... [-compat-rules <FILE>]
+	Replace planned duplicates with symlinks (or other links, see -link), skipping rejected and deferred duplicate groups
+	(and not yet reviewed ones with -approved-only), as well as files changed since planned.
+	Without -force, it is a dry run: duplicates are only reported, and replaced if confirmed on a terminal.
+`
+}
+
+func (c *apply) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.plan, "plan", "", "plan file or JSON diff (see symlink -diff), required")
+	f.BoolVar(&c.approvedOnly, "approved-only", false, "apply approved duplicate groups only")
+	f.BoolVar(&c.force, "force", false, forceUsage)
+	f.StringVar(&c.link, "link", "symlink", linkUsage)
+	f.Var(&c.fsLinks, "fs-link", fsLinkUsage)
+	f.StringVar(&c.compatRules, "compat-rules", "", compatUsage)
+}
+
+func (c *apply) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.plan == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	linkOpts, err := linkStrategyOptions(c.link, c.fsLinks, c.compatRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	dp, err := readPlan(c.plan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	summary := new(fsdedupe.Summary)
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+		fsdedupe.WithSummary(summary),
+	}
+	opts = append(opts, linkOpts...)
+	if c.approvedOnly {
+		opts = append(opts, fsdedupe.WithApprovedOnly())
+	}
+	if !c.force && !confirmPlan(os.Stderr, dp, c.approvedOnly, true) {
+		return subcommands.ExitSuccess
+	}
+	err = fsdedupe.ApplyPlan(ctx, dp, opts...)
+	fmt.Printf("linked:      %d\n", summary.Linked)
+	fmt.Printf("saved size:  %s\n", fsdedupe.FormatSize(summary.BytesSaved))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+func readPlan(name string) (fsdedupe.DedupePlan, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return fsdedupe.DedupePlan{}, fmt.Errorf("open plan: %w", err)
+	}
+	defer f.Close()
+
+	dp, err := fsdedupe.ReadPlan(f)
+	if err != nil {
+		return dp, fmt.Errorf("read plan %q: %w", name, err)
+	}
+	return dp, nil
+}
+
+// writePlan atomically replaces plan file.
+func writePlan(name string, dp fsdedupe.DedupePlan) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create plan: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if err := fsdedupe.WritePlan(f, dp); err != nil {
+		return fmt.Errorf("write plan %q: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close plan %q: %w", name, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("rename plan %q: %w", name, err)
+	}
+	return nil
+}
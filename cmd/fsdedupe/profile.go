@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// builtinProfiles are preset flag values per use case (see applyProfile).
+//
+//go:embed profiles/*.conf
+var builtinProfiles embed.FS
+
+const profileUsage = "preset flag values for a use case: photos, music, builds or generic (overridden by explicitly set flags and by <user config dir>/fsdedupe/profiles/<name>.conf)"
+
+// applyProfile sets flags to profile values, unless explicitly set on the command line.
+// Repeatable flags (like -exclude) get profile values in addition to explicit ones.
+// Profile is a file of name=value lines (# for comments), either a user-provided
+// <user config dir>/fsdedupe/profiles/<name>.conf or a builtin one.
+func applyProfile(f *flag.FlagSet, name string) error {
+	b, err := readProfile(name)
+	if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]struct{})
+	f.Visit(func(fl *flag.Flag) {
+		explicit[fl.Name] = struct{}{}
+	})
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return fmt.Errorf("profile %q line %d: expected name=value, got %q", name, n, line)
+		}
+
+		fl := f.Lookup(key)
+		if fl == nil || key == "profile" {
+			return fmt.Errorf("profile %q line %d: unsupported flag %q", name, n, key)
+		}
+		if _, ok := explicit[key]; ok {
+			if _, repeatable := fl.Value.(*listValue); !repeatable {
+				continue
+			}
+		}
+		if err := f.Set(key, value); err != nil {
+			return fmt.Errorf("profile %q line %d: %w", name, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// readProfile reads a user-provided profile, falling back to a builtin one.
+func readProfile(name string) ([]byte, error) {
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		return nil, fmt.Errorf("invalid profile name %q", name)
+	}
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		filename := filepath.Join(dir, "fsdedupe", "profiles", name+".conf")
+		if b, err := os.ReadFile(filename); err == nil {
+			return b, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("read profile %q: %w", filename, err)
+		}
+	}
+
+	b, err := builtinProfiles.ReadFile(path.Join("profiles", name+".conf"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unknown profile %q, expected one of: %s", name, strings.Join(builtinProfileNames(), ", "))
+	}
+	return b, err
+}
+
+func builtinProfileNames() []string {
+	entries, _ := builtinProfiles.ReadDir("profiles")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".conf"))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// progress tracks hashing throughput and ETA (when total input size is known).
+type progress struct {
+	start time.Time
+	total int64 // total input bytes, 0 - unknown
+
+	mu    sync.Mutex
+	files int
+	bytes int64
+}
+
+func newProgress(total int64) *progress {
+	return &progress{start: time.Now(), total: total}
+}
+
+func (p *progress) hashed(size int64) {
+	p.mu.Lock()
+	p.files++
+	p.bytes += size
+	p.mu.Unlock()
+}
+
+// print writes a progress line: processed files/bytes, rates and ETA.
+func (p *progress) print(w io.Writer) {
+	p.mu.Lock()
+	files, bytes := p.files, p.bytes
+	p.mu.Unlock()
+
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	filesRate, bytesRate := float64(files)/elapsed, float64(bytes)/elapsed
+
+	line := fmt.Sprintf("%s: %d files, %s (%.1f files/s, %s/s)", selfCmd, files, fsdedupe.FormatSize(bytes), filesRate, fsdedupe.FormatSize(int64(bytesRate)))
+	if p.total > 0 {
+		line += fmt.Sprintf(", %.1f%%", 100*float64(bytes)/float64(p.total))
+		if bytesRate > 0 && bytes < p.total {
+			eta := time.Duration(float64(p.total-bytes) / bytesRate * float64(time.Second))
+			line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+		}
+	}
+	fmt.Fprintln(w, line)
+}
+
+// run prints progress every interval until stop is closed.
+func (p *progress) run(w io.Writer, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.print(w)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// prescan drains filenames, returning them with their total size (for ETA).
+// Files that can't be stat-ed are kept (to be reported by the run itself), but not counted.
+func prescan(it fsdedupe.Iterator) ([]string, int64, error) {
+	var filenames []string
+	var total int64
+	for {
+		filename, err := it.Next()
+		if err == io.EOF {
+			return filenames, total, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+		filenames = append(filenames, filename)
+		if info, err := os.Stat(filename); err == nil {
+			total += info.Size()
+		}
+	}
+}
+
+// printSummary writes a final human-readable run summary.
+func printSummary(w io.Writer, s fsdedupe.Summary, elapsed time.Duration) {
+	fmt.Fprintf(w, "%s: %d files processed in %s, %d duplicates, %d linked, %d skipped, %s saved (%s on disk), %d inodes used; already deduplicated: %d files, %s\n",
+		selfCmd, s.Files, elapsed.Round(time.Second), s.Duplicates, s.Linked, s.Skipped,
+		fsdedupe.FormatSize(s.BytesSaved), fsdedupe.FormatSize(s.DiskBytesSaved), s.InodesUsed,
+		s.AlreadyDeduped, fsdedupe.FormatSize(s.AlreadyDedupedBytes))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type relink struct {
+	oldPrefix string
+	newPrefix string
+	force     bool
+}
+
+func (*relink) Name() string { return "relink" }
+func (*relink) Synopsis() string {
+	return "Rewrite absolute symlink targets after a data dir or canonical tree was moved"
+}
+func (*relink) Usage() string {
+	return selfCmd + ` relink -old-prefix <OLDDIR> -new-prefix <NEWDIR> [-force] <LINKDIR>
+	Re-point absolute symlinks under LINKDIR, targets of which are at or under OLDDIR, to the same paths under NEWDIR
+	(e.g. after a DedupeFS data dir or a canonical files tree was moved), atomically per symlink.
+	Without -force, it is a dry run: symlinks to be rewritten are only reported, and rewritten if confirmed on a terminal.
+`
+}
+
+func (c *relink) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.oldPrefix, "old-prefix", "", "absolute dir symlink targets were moved from")
+	f.StringVar(&c.newPrefix, "new-prefix", "", "absolute dir symlink targets were moved to")
+	f.BoolVar(&c.force, "force", false, "actually rewrite symlinks without asking (otherwise it is a dry run, asking for confirmation when attached to a terminal)")
+}
+
+func (c *relink) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 || c.oldPrefix == "" || c.newPrefix == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	logger := log.New(os.Stderr, selfCmd+": ", 0)
+
+	dryRun := !c.force
+	opts := []fsdedupe.Option{fsdedupe.WithLogger(logger)}
+	if dryRun {
+		opts = append(opts, fsdedupe.WithDryRun())
+	}
+	report, err := fsdedupe.RewriteLinkTargets(ctx, f.Arg(0), c.oldPrefix, c.newPrefix, opts...)
+	if err == nil && dryRun && report.Rewritten > 0 {
+		if tty := openTTY(); tty != nil {
+			defer tty.Close()
+			if confirm(tty, fmt.Sprintf("Rewrite %d symlinks?", report.Rewritten)) {
+				dryRun = false
+				report, err = fsdedupe.RewriteLinkTargets(ctx, f.Arg(0), c.oldPrefix, c.newPrefix, fsdedupe.WithLogger(logger))
+			}
+		}
+	}
+
+	fmt.Printf("checked:   %d\n", report.Checked)
+	fmt.Printf("rewritten: %d\n", report.Rewritten)
+	fmt.Printf("dangling:  %d\n", len(report.Dangling))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	if dryRun && report.Rewritten > 0 {
+		fmt.Fprintf(os.Stderr, "%s: dry run, nothing is modified; re-run with -force to rewrite symlinks\n", selfCmd)
+	}
+	return subcommands.ExitSuccess
+}
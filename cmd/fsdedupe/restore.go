@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type restore struct {
+	bwlimit int64
+	input   lineInput
+}
+
+func (*restore) Name() string { return "restore" }
+func (*restore) Synopsis() string {
+	return "Replace STDIN symlinked duplicates of a file with independent copies"
+}
+func (*restore) Usage() string {
+	return `find <SOMEDIR> -type l | ` + selfCmd + ` restore [-bwlimit N] <CANONICAL|HASH>
+	Re-materialize STDIN symlinked duplicates of CANONICAL file (or of any file with content HASH)
+	back into independent regular files, e.g. before handing a directory over to someone.
+	Other filenames are skipped.
+`
+}
+
+func (c *restore) SetFlags(f *flag.FlagSet) {
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file copying throughput, per second, like 10M (0 - unlimited)")
+	lineInputVars(f, &c.input)
+}
+
+func (c *restore) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+
+	report, err := fsdedupe.RestoreDuplicates(ctx, f.Arg(0), c.input.lines(os.Stdin), opts...)
+	fmt.Printf("restored:      %d\n", report.Restored)
+	fmt.Printf("restored size: %s\n", fsdedupe.FormatSize(report.RestoredBytes))
+	fmt.Printf("skipped:       %d\n", report.Skipped)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
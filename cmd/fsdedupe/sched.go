@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// schedulingVars defines -nice, -ionice and -cpus flags of hashing workers scheduling (see fsdedupe.Scheduling).
+func schedulingVars(f *flag.FlagSet, p *fsdedupe.Scheduling) {
+	f.IntVar(&p.Nice, "nice", 0, "CPU niceness of hashing workers, like 10 (0 - inherited, Linux only)")
+	f.Func("ionice", "I/O scheduling of hashing workers: idle or best-effort[:LEVEL], LEVEL being 0 (highest) to 7 (Linux only)", func(s string) error {
+		class, level, hasLevel := strings.Cut(s, ":")
+		switch {
+		case class == "idle" && !hasLevel:
+			p.IOClass, p.IOLevel = fsdedupe.IOClassIdle, 0
+		case class == "best-effort":
+			p.IOClass, p.IOLevel = fsdedupe.IOClassBestEffort, 4
+			if hasLevel {
+				n, err := strconv.Atoi(level)
+				if err != nil || n < 0 || n > 7 {
+					return fmt.Errorf("invalid best-effort level %q", level)
+				}
+				p.IOLevel = n
+			}
+		default:
+			return fmt.Errorf("unknown I/O scheduling %q", s)
+		}
+		return nil
+	})
+	f.Func("cpus", "pin hashing workers to CPUs, like 0,2-3 (Linux only)", func(s string) error {
+		p.CPUs = nil
+		for _, part := range strings.Split(s, ",") {
+			from, to, isRange := strings.Cut(part, "-")
+			first, err := strconv.Atoi(from)
+			last := first
+			if err == nil && isRange {
+				last, err = strconv.Atoi(to)
+			}
+			if err != nil || first < 0 || last < first {
+				return fmt.Errorf("invalid CPU list %q", s)
+			}
+			for cpu := first; cpu <= last; cpu++ {
+				p.CPUs = append(p.CPUs, cpu)
+			}
+		}
+		return nil
+	})
+}
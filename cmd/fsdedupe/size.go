@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// sizeValue is a flag.Value of a human-readable size (see fsdedupe.ParseSize).
+type sizeValue int64
+
+func (v *sizeValue) String() string {
+	if v == nil || *v == 0 {
+		return "0"
+	}
+	return fsdedupe.FormatSize(int64(*v))
+}
+
+func (v *sizeValue) Set(s string) error {
+	n, err := fsdedupe.ParseSize(s)
+	if err != nil {
+		return err
+	}
+	*v = sizeValue(n)
+	return nil
+}
+
+// sizeVar defines a human-readable size flag (like 64K, 1.5G or 10MB, see fsdedupe.ParseSize).
+func sizeVar(f *flag.FlagSet, p *int64, name string, value int64, usage string) {
+	*p = value
+	f.Var((*sizeValue)(p), name, usage)
+}
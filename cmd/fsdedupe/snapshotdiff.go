@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type snapshotDiff struct {
+	tempDir     string
+	dataDir     string
+	linkDir     string
+	snapshotDir string
+	tarball     string
+	hashes      string
+}
+
+func (*snapshotDiff) Name() string { return "snapshot-diff" }
+func (*snapshotDiff) Synopsis() string {
+	return "Export changes between DedupeFS link tree snapshots"
+}
+func (*snapshotDiff) Usage() string {
+	return selfCmd + ` snapshot-diff -temp <TEMPDIR> -data <DATADIR> -link <LINKDIR> -snapshots <SNAPSHOTDIR> [-tar <FILE>] [-hashes <FILE>] <FROM> <TO>
+	Compare snapshots FROM and TO (empty FROM - full export), printing tab-separated "<A|M|D>	<PATH>" lines
+	for added, modified and deleted files, optionally writing added/modified files into a tarball
+	and newly referenced content hashes into a file (for incremental offsite backups).
+`
+}
+
+func (c *snapshotDiff) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.tempDir, "temp", "", "DedupeFS temp dir")
+	f.StringVar(&c.dataDir, "data", "", "DedupeFS data dir")
+	f.StringVar(&c.linkDir, "link", "", "DedupeFS link dir")
+	f.StringVar(&c.snapshotDir, "snapshots", "", "DedupeFS snapshot dir")
+	f.StringVar(&c.tarball, "tar", "", "write added/modified files into this tarball")
+	f.StringVar(&c.hashes, "hashes", "", "write newly referenced content hashes into this file")
+}
+
+func (c *snapshotDiff) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 || c.tempDir == "" || c.dataDir == "" || c.linkDir == "" || c.snapshotDir == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	store, err := fsdedupe.NewDedupeFS(c.tempDir, c.dataDir, c.linkDir, fsdedupe.WithSnapshotDir(c.snapshotDir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	diff, err := store.DiffSnapshots(f.Arg(0), f.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	for _, path := range diff.Added {
+		fmt.Fprintf(w, "A\t%s\n", path)
+	}
+	for _, path := range diff.Changed {
+		fmt.Fprintf(w, "M\t%s\n", path)
+	}
+	for _, path := range diff.Removed {
+		fmt.Fprintf(w, "D\t%s\n", path)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if c.tarball != "" {
+		if err := writeDiffTarball(c.tarball, diff); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+	}
+	if c.hashes != "" {
+		if err := writeDiffHashes(c.hashes, diff.NewHashes); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+	}
+	return subcommands.ExitSuccess
+}
+
+func writeDiffTarball(name string, diff fsdedupe.SnapshotDiff) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("create tarball: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := fsdedupe.ExportDiff(w, diff); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write tarball %q: %w", name, err)
+	}
+	return f.Close()
+}
+
+func writeDiffHashes(name string, hashes []string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("create hashes file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, hash := range hashes {
+		fmt.Fprintln(w, hash)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write hashes file %q: %w", name, err)
+	}
+	return f.Close()
+}
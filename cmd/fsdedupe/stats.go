@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type statsRecord struct {
+	tempDir string
+	dataDir string
+	linkDir string
+	history string
+	every   time.Duration
+}
+
+func (*statsRecord) Name() string { return "stats-record" }
+func (*statsRecord) Synopsis() string {
+	return "Append DedupeFS usage snapshots to a stats history file"
+}
+func (*statsRecord) Usage() string {
+	return selfCmd + ` stats-record -temp <TEMPDIR> -data <DATADIR> -link <LINKDIR> -history <FILE> [-every <DURATION>]
+	Append a store usage snapshot (links, logical/physical bytes, stored contents) to a stats history file,
+	once (like from cron) or every DURATION until interrupted. See stats-history.
+`
+}
+
+func (c *statsRecord) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.tempDir, "temp", "", "DedupeFS temp dir")
+	f.StringVar(&c.dataDir, "data", "", "DedupeFS data dir")
+	f.StringVar(&c.linkDir, "link", "", "DedupeFS link dir")
+	f.StringVar(&c.history, "history", "", "stats history file to append to")
+	f.DurationVar(&c.every, "every", 0, "keep recording snapshots at this interval until interrupted")
+}
+
+func (c *statsRecord) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 0 || c.tempDir == "" || c.dataDir == "" || c.linkDir == "" || c.history == "" || c.every < 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	store, err := fsdedupe.NewDedupeFS(c.tempDir, c.dataDir, c.linkDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	record := func() error {
+		st, err := store.Stats()
+		if err != nil {
+			return err
+		}
+		return fsdedupe.AppendStats(c.history, st)
+	}
+	if err := record(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	if c.every == 0 {
+		return subcommands.ExitSuccess
+	}
+
+	logger := log.New(os.Stderr, selfCmd+": ", 0)
+	ticker := time.NewTicker(c.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return subcommands.ExitSuccess
+		case <-ticker.C:
+		}
+		if err := record(); err != nil {
+			logger.Printf("%s", err) // keep recording, like background GC
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// statsGraphWidth is a max bar width of stats-history -graph.
+const statsGraphWidth = 50
+
+type statsHistory struct {
+	history string
+	since   time.Duration
+	json    bool
+	graph   bool
+}
+
+func (*statsHistory) Name() string { return "stats-history" }
+func (*statsHistory) Synopsis() string {
+	return "Print DedupeFS usage trends from a stats history file"
+}
+func (*statsHistory) Usage() string {
+	return selfCmd + ` stats-history -history <FILE> [-since <DURATION>] [-json|-graph]
+	Print snapshots recorded by stats-record (or WithStatsHistory background GC) as tab-separated
+	"<TIME>	<LINKS>	<LOGICAL>	<PHYSICAL>	<BLOBS>	<RATIO>" lines, JSON lines with -json,
+	or as a bar graph of physical bytes (with saved bytes) with -graph.
+`
+}
+
+func (c *statsHistory) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.history, "history", "", "stats history file to read")
+	f.DurationVar(&c.since, "since", 0, "only print snapshots of this recent period")
+	f.BoolVar(&c.json, "json", false, "print JSON lines")
+	f.BoolVar(&c.graph, "graph", false, "print a bar graph")
+}
+
+func (c *statsHistory) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 0 || c.history == "" || (c.json && c.graph) {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	history, err := fsdedupe.ReadStats(c.history)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	if c.since > 0 {
+		cutoff := time.Now().Add(-c.since)
+		for len(history) > 0 && history[0].Time.Before(cutoff) {
+			history = history[1:]
+		}
+	}
+
+	if c.graph {
+		var peak int64
+		for _, st := range history {
+			peak = max(peak, st.LogicalBytes, st.PhysicalBytes)
+		}
+		for _, st := range history {
+			physical, logical := statsBar(st.PhysicalBytes, peak), statsBar(st.LogicalBytes, peak)
+			fmt.Printf("%s %6.2fx |%s%s\n", st.Time.Format(time.DateOnly), st.DedupeRatio(),
+				strings.Repeat("#", physical), strings.Repeat(".", max(logical-physical, 0)))
+		}
+		return subcommands.ExitSuccess
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, st := range history {
+		if c.json {
+			if err := enc.Encode(st); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return subcommands.ExitFailure
+			}
+			continue
+		}
+		fmt.Printf("%s\t%d\t%d\t%d\t%d\t%.2f\n", st.Time.Format(time.RFC3339), st.Links, st.LogicalBytes, st.PhysicalBytes, st.Blobs, st.DedupeRatio())
+	}
+	return subcommands.ExitSuccess
+}
+
+// statsBar returns a bar width of n bytes, peak being statsGraphWidth wide.
+func statsBar(n, peak int64) int {
+	if peak == 0 {
+		return 0
+	}
+	return int(n * statsGraphWidth / peak)
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type store struct{}
+
+func (*store) Name() string { return "store" }
+func (*store) Synopsis() string {
+	return "Maintain a DedupeFS store: gc, check, usage, import, export"
+}
+func (*store) Usage() string {
+	return selfCmd + ` store <gc|check|usage|import|export> -temp <TEMPDIR> -data <DATADIR> -link <LINKDIR> [<ARGS>]
+	Maintain a DedupeFS store without writing Go code: reap unreferenced contents (gc),
+	re-hash contents detecting bit rot (check), report usage per namespace (usage),
+	copy a tree in (import) or write links contents out as a tarball (export).
+	Store layout flags (-snapshots, -trash, -inline etc) must match the ones the store is used with,
+	as contents referenced by snapshots, trash or inline contents dir only are otherwise unknown to gc.
+	See "` + selfCmd + ` store help <SUBCOMMAND>".
+`
+}
+
+func (*store) SetFlags(*flag.FlagSet) {}
+
+func (*store) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	top := flag.NewFlagSet(selfCmd+" store", flag.ContinueOnError)
+	if err := top.Parse(f.Args()); err != nil {
+		return subcommands.ExitUsageError
+	}
+
+	cdr := subcommands.NewCommander(top, selfCmd+" store")
+	cdr.Register(cdr.HelpCommand(), "")
+	cdr.Register(cdr.CommandsCommand(), "")
+	cdr.Register(&storeGC{}, "")
+	cdr.Register(&storeCheck{}, "")
+	cdr.Register(&storeUsage{}, "")
+	cdr.Register(&storeImport{}, "")
+	cdr.Register(&storeExport{}, "")
+	return cdr.Execute(ctx, args...)
+}
+
+// storeFlags are DedupeFS store layout flags, shared by store subcommands.
+type storeFlags struct {
+	tempDir        string
+	dataDir        string
+	linkDir        string
+	linkIndexDir   string
+	lockDir        string
+	snapshotDir    string
+	trashDir       string
+	trashRetention time.Duration
+	inlineDir      string
+	inlineMaxSize  int64
+	gcMarksDir     string
+	gcGrace        time.Duration
+}
+
+const storeFlagsUsage = `-temp <TEMPDIR> -data <DATADIR> -link <LINKDIR> [-link-index <INDEXDIR>] [-lock-dir <LOCKDIR>] [-snapshots <SNAPSHOTDIR>] [-trash <TRASHDIR>] [-inline <INLINEDIR>] [-gc-marks <MARKSDIR>]`
+
+func (c *storeFlags) setFlags(f *flag.FlagSet) {
+	f.StringVar(&c.tempDir, "temp", "", "DedupeFS temp dir")
+	f.StringVar(&c.dataDir, "data", "", "DedupeFS data dir")
+	f.StringVar(&c.linkDir, "link", "", "DedupeFS link dir")
+	f.StringVar(&c.linkIndexDir, "link-index", "", "DedupeFS link index dir")
+	f.StringVar(&c.lockDir, "lock-dir", "", "DedupeFS lock dir, to coordinate with other processes using the store")
+	f.StringVar(&c.snapshotDir, "snapshots", "", "DedupeFS snapshot dir")
+	f.StringVar(&c.trashDir, "trash", "", "DedupeFS trash dir")
+	f.DurationVar(&c.trashRetention, "trash-retention", 30*24*time.Hour, "with -trash, keep trashed links for this long")
+	f.StringVar(&c.inlineDir, "inline", "", "DedupeFS inline contents dir")
+	sizeVar(f, &c.inlineMaxSize, "inline-max", 4<<10, "with -inline, max size of inline contents, like 4K")
+	f.StringVar(&c.gcMarksDir, "gc-marks", "", "two-phase GC: keep orphan marks in this dir, reaping orphans marked by a previous run only")
+	f.DurationVar(&c.gcGrace, "gc-grace", 0, "with -gc-marks, reap orphans marked at least this long ago")
+}
+
+// valid reports if required flags are set.
+func (c *storeFlags) valid() bool {
+	return c.tempDir != "" && c.dataDir != "" && c.linkDir != "" && c.inlineMaxSize >= 0 && c.gcGrace >= 0
+}
+
+func (c *storeFlags) open() (*fsdedupe.DedupeFS, error) {
+	var opts []fsdedupe.FSOption
+	if c.linkIndexDir != "" {
+		opts = append(opts, fsdedupe.WithLinkIndex(c.linkIndexDir))
+	}
+	if c.lockDir != "" {
+		opts = append(opts, fsdedupe.WithLockDir(c.lockDir))
+	}
+	if c.snapshotDir != "" {
+		opts = append(opts, fsdedupe.WithSnapshotDir(c.snapshotDir))
+	}
+	if c.trashDir != "" {
+		opts = append(opts, fsdedupe.WithTrash(c.trashDir, c.trashRetention))
+	}
+	if c.inlineDir != "" {
+		opts = append(opts, fsdedupe.WithInlineBlobs(c.inlineDir, c.inlineMaxSize))
+	}
+	if c.gcMarksDir != "" {
+		opts = append(opts, fsdedupe.WithTwoPhaseGC(c.gcMarksDir, c.gcGrace))
+	}
+	return fsdedupe.NewDedupeFS(c.tempDir, c.dataDir, c.linkDir, opts...)
+}
+
+// ----------------------------------------------------------------------------
+
+type storeGC struct {
+	storeFlags
+	json bool
+}
+
+func (*storeGC) Name() string { return "gc" }
+func (*storeGC) Synopsis() string {
+	return "Remove unreferenced contents of a DedupeFS store"
+}
+func (*storeGC) Usage() string {
+	return selfCmd + ` store gc ` + storeFlagsUsage + ` [-json]
+	Remove data files no link (snapshot, trashed link or pin) references, purging expired trash entries first,
+	and print a GC report (JSON with -json).
+`
+}
+
+func (c *storeGC) SetFlags(f *flag.FlagSet) {
+	c.setFlags(f)
+	f.BoolVar(&c.json, "json", false, "print JSON report")
+}
+
+func (c *storeGC) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 0 || !c.valid() {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	s, err := c.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	report, err := s.GC()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if c.json {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
+	fmt.Printf("removed:      %d\n", report.Removed)
+	fmt.Printf("removed size: %s\n", fsdedupe.FormatSize(report.RemovedBytes))
+	fmt.Printf("expired:      %d\n", report.Expired)
+	fmt.Printf("pinned:       %d\n", len(report.Pinned))
+	if c.gcMarksDir != "" {
+		fmt.Printf("marked:       %d\n", report.Marked)
+	}
+	return subcommands.ExitSuccess
+}
+
+// ----------------------------------------------------------------------------
+
+type storeCheck struct {
+	storeFlags
+	quarantineDir string
+	replicaDir    string
+	bwlimit       int64
+	scheduling    fsdedupe.Scheduling
+	json          bool
+}
+
+func (*storeCheck) Name() string { return "check" }
+func (*storeCheck) Synopsis() string {
+	return "Re-hash contents of a DedupeFS store, quarantining corrupted ones"
+}
+func (*storeCheck) Usage() string {
+	return selfCmd + ` store check ` + storeFlagsUsage + ` -quarantine <QUARANTINEDIR> [-replica <DATADIR>] [-bwlimit <SIZE>] [-json]
+	Re-hash every data file (fsck), moving corrupted ones (contents not matching their hash) into QUARANTINEDIR,
+	restoring verified copies from a replica store data dir, if given.
+	Print tab-separated "<HASH>	<restored|dangling>	<LINK>" lines of links to corrupted contents
+	(JSON report with -json), exiting with 1 if any.
+`
+}
+
+func (c *storeCheck) SetFlags(f *flag.FlagSet) {
+	c.setFlags(f)
+	f.StringVar(&c.quarantineDir, "quarantine", "", "move corrupted data files into this dir")
+	f.StringVar(&c.replicaDir, "replica", "", "restore corrupted data files from this replica store data dir")
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+	schedulingVars(f, &c.scheduling)
+	f.BoolVar(&c.json, "json", false, "print JSON report")
+}
+
+func (c *storeCheck) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 0 || !c.valid() || c.quarantineDir == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	s, err := c.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	opts := []fsdedupe.ScrubOption{
+		fsdedupe.WithScrubScheduling(c.scheduling),
+	}
+	if c.replicaDir != "" {
+		opts = append(opts, fsdedupe.WithScrubReplica(c.replicaDir))
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithScrubLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+	report, err := s.Scrub(ctx, c.quarantineDir, opts...)
+
+	if c.json {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+	} else {
+		w := bufio.NewWriter(os.Stdout)
+		for _, blob := range report.Corrupted {
+			state := "dangling"
+			if blob.Restored {
+				state = "restored"
+			}
+			for _, link := range blob.Links {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", blob.Hash, state, link)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+	}
+	fmt.Fprintf(os.Stderr, "checked %d, corrupted %d data file(s)\n", report.Checked, len(report.Corrupted))
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	if len(report.Corrupted) != 0 {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// ----------------------------------------------------------------------------
+
+type storeUsage struct {
+	storeFlags
+	json bool
+}
+
+func (*storeUsage) Name() string { return "usage" }
+func (*storeUsage) Synopsis() string {
+	return "Report DedupeFS storage usage per namespace (chargeback)"
+}
+func (*storeUsage) Usage() string {
+	return selfCmd + ` store usage ` + storeFlagsUsage + ` [-json]
+	The same as "` + selfCmd + ` usage", see it.
+`
+}
+
+func (c *storeUsage) SetFlags(f *flag.FlagSet) {
+	c.setFlags(f)
+	f.BoolVar(&c.json, "json", false, "print JSON lines")
+}
+
+func (c *storeUsage) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 0 || !c.valid() {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	s, err := c.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	if err := printNamespaceUsage(s, c.json); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// ----------------------------------------------------------------------------
+
+type storeImport struct {
+	storeFlags
+	bwlimit   int64
+	hashCache string
+	backupPC  bool
+}
+
+func (*storeImport) Name() string { return "import" }
+func (*storeImport) Synopsis() string {
+	return "Copy a tree into a DedupeFS store"
+}
+func (*storeImport) Usage() string {
+	return selfCmd + ` store import ` + storeFlagsUsage + ` [-hash-cache <FILE>] [-backuppc] <SRCDIR> [<LINKPREFIX>]
+	Copy SRCDIR tree into the store under LINKPREFIX (default - link dir root), linking files to already stored contents
+	(like "` + selfCmd + ` cp -temp <TEMPDIR> -data <DATADIR> <SRCDIR> <LINKDIR>/<LINKPREFIX>"). Existing links are replaced.
+`
+}
+
+func (c *storeImport) SetFlags(f *flag.FlagSet) {
+	c.setFlags(f)
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+	f.StringVar(&c.hashCache, "hash-cache", "", "reuse hashes of files unchanged (size, mtime) since cached in this file (shared with symlink), updating it")
+	f.BoolVar(&c.backupPC, "backuppc", false, "SRCDIR is a BackupPC (v3, uncompressed) pc dir: unmangle names, skip metadata files")
+}
+
+func (c *storeImport) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() < 1 || f.NArg() > 2 || !c.valid() {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	linkPrefix := "/"
+	if f.NArg() == 2 {
+		linkPrefix = f.Arg(1)
+	}
+
+	opts := []fsdedupe.Option{
+		fsdedupe.WithLogger(log.New(os.Stderr, selfCmd+": ", 0)),
+	}
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+	if c.backupPC {
+		opts = append(opts, fsdedupe.WithImportNames(fsdedupe.BackupPCName))
+	}
+
+	s, err := c.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	var hashCache *fsdedupe.HashCache
+	if c.hashCache != "" {
+		if hashCache, err = readHashCache(c.hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		opts = append(opts, fsdedupe.WithHashCache(hashCache))
+	}
+
+	report, err := s.Import(ctx, f.Arg(0), linkPrefix, opts...)
+
+	status := subcommands.ExitSuccess
+	if hashCache != nil {
+		if err := writeHashCache(c.hashCache, hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	printCopyReport(report, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return status
+}
+
+// ----------------------------------------------------------------------------
+
+type storeExport struct {
+	storeFlags
+	output string
+}
+
+func (*storeExport) Name() string { return "export" }
+func (*storeExport) Synopsis() string {
+	return "Write DedupeFS links contents out as a tarball"
+}
+func (*storeExport) Usage() string {
+	return selfCmd + ` store export ` + storeFlagsUsage + ` [-o <FILE>] [<LINKPREFIX>]
+	Write contents (not links) of links under LINKPREFIX (default - all links) as a tarball to STDOUT (or FILE),
+	named relative to LINKPREFIX, e.g. to hand a tree over or back it up without the store.
+`
+}
+
+func (c *storeExport) SetFlags(f *flag.FlagSet) {
+	c.setFlags(f)
+	f.StringVar(&c.output, "o", "", "write tarball to this file instead of STDOUT")
+}
+
+func (c *storeExport) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() > 1 || !c.valid() {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	linkPrefix := "/"
+	if f.NArg() == 1 {
+		linkPrefix = f.Arg(0)
+	}
+
+	s, err := c.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	n, err := exportTarball(ctx, s, linkPrefix, c.output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	fmt.Fprintf(os.Stderr, "exported %d file(s)\n", n)
+	return subcommands.ExitSuccess
+}
+
+// exportTarball exports links under linkPrefix into a tarball file, "" meaning STDOUT.
+func exportTarball(ctx context.Context, s *fsdedupe.DedupeFS, linkPrefix, name string) (int, error) {
+	if name == "" {
+		w := bufio.NewWriter(os.Stdout)
+		n, err := s.Export(ctx, w, linkPrefix)
+		if err != nil {
+			return n, err
+		}
+		return n, w.Flush()
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, fmt.Errorf("create tarball: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	n, err := s.Export(ctx, w, linkPrefix)
+	if err != nil {
+		return n, err
+	}
+	if err := w.Flush(); err != nil {
+		return n, fmt.Errorf("write tarball %q: %w", name, err)
+	}
+	return n, f.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// -link and -fs-link flag usages.
+const (
+	linkUsage   = "replace duplicates with: symlink, hardlink (same device), reflink (copy-on-write clone: btrfs, XFS) or auto (reflink, hardlink or symlink, whichever is the best per filesystem)"
+	fsLinkUsage = "override -link for a filesystem type (ext4, btrfs, xfs, nfs etc), like ext4=symlink (repeatable)"
+	compatUsage = "compat rules file of \"<PATTERN> <keep|symlink|hardlink|reflink|auto>\" lines, overriding -link and -fs-link for matching duplicates"
+)
+
+func parseLinkStrategy(s string) (fsdedupe.LinkStrategy, error) {
+	switch s {
+	case "symlink":
+		return fsdedupe.LinkSymlink, nil
+	case "hardlink":
+		return fsdedupe.LinkHardlink, nil
+	case "reflink":
+		return fsdedupe.LinkReflink, nil
+	case "auto":
+		return fsdedupe.LinkAuto, nil
+	}
+	return 0, fmt.Errorf("unsupported link strategy %q, expected symlink, hardlink, reflink or auto", s)
+}
+
+// linkStrategyOptions builds options for -link strategy, -fs-link TYPE=STRATEGY overrides and -compat-rules file.
+func linkStrategyOptions(link string, fsLinks []string, compatRules string) ([]fsdedupe.Option, error) {
+	strategy, err := parseLinkStrategy(link)
+	if err != nil {
+		return nil, err
+	}
+	opts := []fsdedupe.Option{fsdedupe.WithLinkStrategy(strategy)}
+
+	for _, fsLink := range fsLinks {
+		fsType, s, ok := strings.Cut(fsLink, "=")
+		if !ok || fsType == "" {
+			return nil, fmt.Errorf("invalid -fs-link %q, expected TYPE=STRATEGY", fsLink)
+		}
+		strategy, err := parseLinkStrategy(s)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, fsdedupe.WithFSLinkStrategy(fsType, strategy))
+	}
+
+	if compatRules != "" {
+		f, err := os.Open(compatRules)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		rules, err := fsdedupe.ParseCompatRules(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", compatRules, err)
+		}
+		opts = append(opts, fsdedupe.WithCompatRules(rules...))
+	}
+	return opts, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type tierRebalance struct {
+	tempDir string
+	dataDir string
+	linkDir string
+	minSize int64
+	maxAge  time.Duration
+}
+
+func (*tierRebalance) Name() string { return "tier-rebalance" }
+func (*tierRebalance) Synopsis() string {
+	return "Migrate DedupeFS data files between hot/cold tiers"
+}
+func (*tierRebalance) Usage() string {
+	return selfCmd + ` tier-rebalance -temp <TEMPDIR> -data <DATADIR> -link <LINKDIR> [-min-size N] [-max-age D] <TIERDIR>...
+	Migrate data files between DATADIR (hot tier) and TIERDIRs (colder tiers),
+	moving data files of at least -min-size bytes or not accessed for -max-age into the next tier,
+	re-pointing links under LINKDIR to the new locations.
+`
+}
+
+func (c *tierRebalance) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.tempDir, "temp", "", "DedupeFS temp dir")
+	f.StringVar(&c.dataDir, "data", "", "DedupeFS data dir (hot tier)")
+	f.StringVar(&c.linkDir, "link", "", "DedupeFS link dir")
+	sizeVar(f, &c.minSize, "min-size", 0, "move data files of at least this size to the next tier, like 100M (0 - disabled)")
+	f.DurationVar(&c.maxAge, "max-age", 0, "move data files not accessed for this duration to the next tier (0 - disabled)")
+}
+
+func (c *tierRebalance) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 || c.tempDir == "" || c.dataDir == "" || c.linkDir == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	var policies []fsdedupe.TierPolicy
+	if c.minSize > 0 {
+		policies = append(policies, fsdedupe.TierBySize(c.minSize))
+	}
+	if c.maxAge > 0 {
+		policies = append(policies, fsdedupe.TierByAge(c.maxAge))
+	}
+	if len(policies) == 0 {
+		fmt.Fprintf(os.Stderr, "either -min-size or -max-age is required\n")
+		return subcommands.ExitUsageError
+	}
+
+	store, err := fsdedupe.NewDedupeFS(c.tempDir, c.dataDir, c.linkDir,
+		fsdedupe.WithTiers(fsdedupe.TierMax(policies...), f.Args()...),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	report, err := store.Rebalance(ctx)
+	fmt.Printf("checked:     %d\n", report.Checked)
+	fmt.Printf("moved:       %d\n", report.Moved)
+	fmt.Printf("moved size:  %s\n", fsdedupe.FormatSize(report.MovedBytes))
+	fmt.Printf("relinked:    %d\n", report.Relinked)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type treeEqual struct {
+	bwlimit   int64
+	hashCache string
+}
+
+func (*treeEqual) Name() string { return "tree-equal" }
+func (*treeEqual) Synopsis() string {
+	return "Verify two trees are content-identical (read-only)"
+}
+func (*treeEqual) Usage() string {
+	return selfCmd + ` tree-equal [-hash-cache <FILE>] <DIRA> <DIRB>
+	Compare DIRA and DIRB trees by structure and contents (following symlinks to files, ignoring modes and times),
+	printing differences (only-a, only-b, type or content, and a relative path) to STDOUT.
+	Exits with status 1 if trees differ.
+`
+}
+
+func (c *treeEqual) SetFlags(f *flag.FlagSet) {
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+	f.StringVar(&c.hashCache, "hash-cache", "", "reuse hashes of files unchanged (size, mtime) since cached in this file (see symlink -hash-cache), updating it")
+}
+
+func (c *treeEqual) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	var opts []fsdedupe.Option
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+	var hashCache *fsdedupe.HashCache
+	if c.hashCache != "" {
+		var err error
+		if hashCache, err = readHashCache(c.hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		opts = append(opts, fsdedupe.WithHashCache(hashCache))
+	}
+
+	diffs, err := fsdedupe.CompareTrees(ctx, f.Arg(0), f.Arg(1), opts...)
+	if hashCache != nil {
+		if err := writeHashCache(c.hashCache, hashCache); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	for _, d := range diffs {
+		fmt.Printf("%s\t%s\n", d.Kind, d.Path)
+	}
+	if len(diffs) != 0 {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
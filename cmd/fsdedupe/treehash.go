@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+)
+
+type treeHash struct {
+	bwlimit int64
+}
+
+func (*treeHash) Name() string { return "tree-hash" }
+func (*treeHash) Synopsis() string {
+	return "Print Merkle-style root hash of tree logical content (names + contents)"
+}
+func (*treeHash) Usage() string {
+	return selfCmd + ` tree-hash <DIR>...
+	Print root hash of every DIR tree logical content (entry names and contents, following symlinks to files),
+	which is not changed by deduplication: compare hashes taken before and after a run.
+`
+}
+
+func (c *treeHash) SetFlags(f *flag.FlagSet) {
+	sizeVar(f, &c.bwlimit, "bwlimit", 0, "limit file reading throughput, per second, like 10M (0 - unlimited)")
+}
+
+func (c *treeHash) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	var opts []fsdedupe.Option
+	if c.bwlimit > 0 {
+		opts = append(opts, fsdedupe.WithLimiter(fsdedupe.NewBandwidthLimiter(c.bwlimit)))
+	}
+
+	for _, dir := range f.Args() {
+		root, err := fsdedupe.TreeHash(ctx, dir, opts...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		fmt.Printf("%s  %s\n", root, dir)
+	}
+	return subcommands.ExitSuccess
+}
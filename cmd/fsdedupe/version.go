@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/google/subcommands"
+	"github.com/mxmCherry/fsdedupe"
+	"github.com/mxmCherry/fsdedupe/artifact"
+)
+
+type version struct {
+	json bool
+	dir  string
+}
+
+// versionInfo is version -json output, meant to be stable for orchestration tooling.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+
+	HashAlgorithms []string `json:"hash_algorithms"`
+	LinkModes      []string `json:"link_modes"`
+	// Reflink reports reflink support in ReflinkDir (kernel and filesystem).
+	Reflink      bool   `json:"reflink"`
+	ReflinkDir   string `json:"reflink_dir"`
+	ReflinkError string `json:"reflink_error,omitempty"`
+	StoreLayouts []int  `json:"store_layouts"`
+	// ArtifactVersions are checkpoint, journal and plan file format versions (see package artifact).
+	ArtifactVersions []int `json:"artifact_versions"`
+}
+
+func (*version) Name() string { return "version" }
+func (*version) Synopsis() string {
+	return "Print version and capabilities"
+}
+func (*version) Usage() string {
+	return selfCmd + ` version [-json] [-dir <DIR>]
+	Print build info, supported hash algorithms, link modes (see symlink -link), reflink support
+	(probed in DIR) and DedupeFS store layout versions understood.
+`
+}
+
+func (c *version) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&c.json, "json", false, "print as JSON")
+	f.StringVar(&c.dir, "dir", os.TempDir(), "dir to probe reflink support in (filesystem where deduplication is going to run)")
+}
+
+func (c *version) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	info := versionInfo{
+		Version:          "(devel)",
+		GoVersion:        runtime.Version(),
+		OS:               runtime.GOOS,
+		Arch:             runtime.GOARCH,
+		HashAlgorithms:   []string{fsdedupe.HashAlgorithm},
+		ReflinkDir:       c.dir,
+		StoreLayouts:     []int{fsdedupe.StoreLayoutVersion},
+		ArtifactVersions: []int{artifact.Version},
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Version != "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				info.Revision = s.Value
+			}
+		}
+	}
+	for _, mode := range []fsdedupe.LinkStrategy{fsdedupe.LinkSymlink, fsdedupe.LinkHardlink, fsdedupe.LinkReflink, fsdedupe.LinkAuto} {
+		info.LinkModes = append(info.LinkModes, mode.String())
+	}
+	var err error
+	if info.Reflink, err = fsdedupe.ReflinkSupported(c.dir); err != nil {
+		info.ReflinkError = err.Error()
+	}
+
+	if c.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
+
+	fmt.Printf("version:          %s\n", info.Version)
+	if info.Revision != "" {
+		fmt.Printf("revision:         %s\n", info.Revision)
+	}
+	fmt.Printf("go:               %s %s/%s\n", info.GoVersion, info.OS, info.Arch)
+	fmt.Printf("hash algorithms:  %v\n", info.HashAlgorithms)
+	fmt.Printf("link modes:       %v\n", info.LinkModes)
+	fmt.Printf("reflink (%s): %t\n", info.ReflinkDir, info.Reflink)
+	if info.ReflinkError != "" {
+		fmt.Printf("reflink error:    %s\n", info.ReflinkError)
+	}
+	fmt.Printf("store layouts:    %v\n", info.StoreLayouts)
+	fmt.Printf("artifacts:        %v\n", info.ArtifactVersions)
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,132 @@
+package fsdedupe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// CompatRule overrides how duplicates matching Pattern are handled (see WithCompatRules),
+// e.g. for files read by programs rejecting symlinks, or rewriting files in place.
+type CompatRule struct {
+	// Pattern is matched (see filepath.Match) against duplicate paths:
+	// patterns without separators against any path segment (like WithExcludes),
+	// patterns with separators against as many trailing path segments ("etc/*.conf" matches "/srv/app/etc/app.conf"),
+	// or against the whole (absolute) path, if rooted ("/srv/app/*").
+	Pattern string
+	// Keep leaves matching duplicates as is (see SkipCompat).
+	Keep bool
+	// Strategy replaces matching duplicates with links of this strategy, regardless of WithLinkStrategy and WithFSLinkStrategy.
+	Strategy LinkStrategy
+}
+
+// String formats the rule as a rules file line (see ParseCompatRules).
+func (r CompatRule) String() string {
+	if r.Keep {
+		return r.Pattern + " keep"
+	}
+	return r.Pattern + " " + r.Strategy.String()
+}
+
+// WithCompatRules makes DedupeSymlink and ApplyPlan handle duplicates matching rules specially,
+// so one run can respect application quirks across a mixed tree. The first matching rule wins.
+// Treating the whole tree the same, use WithLinkStrategy (or WithExcludes) instead.
+func WithCompatRules(rules ...CompatRule) Option {
+	return func(o *options) {
+		o.compatRules = append(o.compatRules, rules...)
+	}
+}
+
+// ParseCompatRules reads a rules file (see WithCompatRules) of "<PATTERN> <ACTION>" lines,
+// ACTION being "keep" or a link strategy ("symlink", "hardlink", "reflink" or "auto").
+// Blank lines and "#"-prefixed comments are ignored.
+func ParseCompatRules(r io.Reader) ([]CompatRule, error) {
+	var rules []CompatRule
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("compat rules line %d: expected <PATTERN> <ACTION>, got %q", n, line)
+		}
+		if _, err := filepath.Match(fields[0], ""); err != nil {
+			return nil, fmt.Errorf("compat rules line %d: pattern %q: %w", n, fields[0], err)
+		}
+
+		rule := CompatRule{Pattern: fields[0]}
+		switch fields[1] {
+		case "keep":
+			rule.Keep = true
+		case "symlink":
+			rule.Strategy = LinkSymlink
+		case "hardlink":
+			rule.Strategy = LinkHardlink
+		case "reflink":
+			rule.Strategy = LinkReflink
+		case "auto":
+			rule.Strategy = LinkAuto
+		default:
+			return nil, fmt.Errorf("compat rules line %d: unsupported action %q, expected keep, symlink, hardlink, reflink or auto", n, fields[1])
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read compat rules: %w", err)
+	}
+	return rules, nil
+}
+
+// matches reports if filename matches the rule pattern. Patterns are validated beforehand.
+func (r CompatRule) matches(filename string) bool {
+	filename = filepath.Clean(filename)
+	pattern := filepath.FromSlash(r.Pattern)
+	if filepath.IsAbs(pattern) {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return false
+		}
+		ok, _ := filepath.Match(pattern, abs)
+		return ok
+	}
+
+	segments := strings.Split(filename, string(filepath.Separator))
+	n := strings.Count(pattern, string(filepath.Separator)) + 1
+	if n == 1 {
+		for _, segment := range segments {
+			if ok, _ := filepath.Match(pattern, segment); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) < n {
+		return false
+	}
+	ok, _ := filepath.Match(pattern, strings.Join(segments[len(segments)-n:], string(filepath.Separator)))
+	return ok
+}
+
+// validateCompatRules checks rule patterns.
+func validateCompatRules(rules []CompatRule) error {
+	for _, rule := range rules {
+		if _, err := filepath.Match(filepath.FromSlash(rule.Pattern), ""); err != nil {
+			return fmt.Errorf("compat rule pattern %q: %w", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchCompatRules returns the first rule filename matches.
+func matchCompatRules(rules []CompatRule, filename string) (CompatRule, bool) {
+	for _, rule := range rules {
+		if rule.matches(filename) {
+			return rule, true
+		}
+	}
+	return CompatRule{}, false
+}
@@ -0,0 +1,79 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWithCompatRules(t *testing.T) {
+	tmp := t.TempDir()
+
+	canonical := filepath.Join(tmp, "file.txt")
+	writeFile(t, canonical, "DUPE")
+	symlinked := filepath.Join(tmp, "other.txt")
+	writeFile(t, symlinked, "DUPE")
+	hardlinked := filepath.Join(tmp, "app", "etc", "app.conf")
+	writeFile(t, hardlinked, "DUPE")
+	kept := filepath.Join(tmp, "db", "data.txt")
+	writeFile(t, kept, "DUPE")
+
+	rules, err := fsdedupe.ParseCompatRules(strings.NewReader(`
+# programs rejecting symlinks
+etc/*.conf hardlink
+` + filepath.ToSlash(filepath.Join(tmp, "db", "*")) + ` keep
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	skipped := make(map[string]fsdedupe.SkipReason)
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{canonical, symlinked, hardlinked, kept}),
+		fsdedupe.WithCompatRules(rules...),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+			skipped[filename] = reason
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Linked, 2; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+	if actual, expected := readlink(t, symlinked), canonical; actual != expected {
+		t.Errorf("expected %q to point to %q, got %q", symlinked, expected, actual)
+	}
+	if info := lstat(t, hardlinked); !info.Mode().IsRegular() || !os.SameFile(info, lstat(t, canonical)) {
+		t.Errorf("expected %q to be hardlinked to %q", hardlinked, canonical)
+	}
+	if actual, expected := skipped[kept], fsdedupe.SkipCompat; actual != expected {
+		t.Errorf("expected %q to be skipped as %q, got %q", kept, expected, actual)
+	}
+	if !lstat(t, kept).Mode().IsRegular() {
+		t.Errorf("expected %q to be kept as is", kept)
+	}
+}
+
+func TestParseCompatRules(t *testing.T) {
+	for _, input := range []string{"*.conf", "*.conf copy", "[ keep"} {
+		if _, err := fsdedupe.ParseCompatRules(strings.NewReader(input)); err == nil {
+			t.Errorf("expected %q to fail", input)
+		}
+	}
+
+	rules, err := fsdedupe.ParseCompatRules(strings.NewReader("*.db keep\n\n  vendor/*  auto  \n"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(rules), 2; actual != expected {
+		t.Fatalf("expected %d rules, got %d", expected, actual)
+	}
+	if actual, expected := rules[0].String()+"|"+rules[1].String(), "*.db keep|vendor/* auto"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,86 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrHashMismatch is returned by Close of a created file (see WithExpectedHash),
+// when written contents have a different hash than the expected one.
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// WithExpectedHash makes Create/WriteFile verify written contents against a content hash (see ParseHash),
+// failing with ErrHashMismatch (linking nothing) on mismatch, e.g. for uploads negotiated with HasContent.
+func WithExpectedHash(hash string) CreateOption {
+	return func(o *createOptions) {
+		o.expectedHash = hash
+	}
+}
+
+// HasContent reports if contents of a given content hash (see ParseHash) are stored,
+// so clients can skip transferring them, linking them with LinkExisting instead.
+func (s *DedupeFS) HasContent(hash string) (bool, error) {
+	hash, err := ParseHash(hash)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := s.findBlob(hash); ok {
+		return true, nil
+	}
+	_, ok, err := s.inlineBlob(hash)
+	return ok, err
+}
+
+// LinkExisting links already stored contents of a given content hash (see HasContent) as a file,
+// according to overwrite policy (see WithOverwrite) and with hints (see WithHints), without transferring them.
+// It fails with fs.ErrNotExist if no such contents are stored (e.g. reaped by GC since HasContent),
+// so clients should fall back to Create then.
+func (s *DedupeFS) LinkExisting(linkName, hash string, opts ...CreateOption) error {
+	hash, err := ParseHash(hash)
+	if err != nil {
+		return err
+	}
+	linked, err := s.linkStored(hash, linkName, buildCreateOptions(opts))
+	if err != nil {
+		return err
+	}
+	if !linked {
+		return fmt.Errorf("link existing %q: contents %q: %w", linkName, hash, fs.ErrNotExist)
+	}
+	return nil
+}
+
+// linkStored links already stored content, if any, according to create options.
+func (s *DedupeFS) linkStored(hash, linkName string, o *createOptions) (bool, error) {
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return false, err
+	}
+
+	// data file must not be reaped before it is linked
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return false, err
+	}
+	defer unlockStore()
+
+	dataFile, ok := s.findBlob(hash)
+	if ok {
+		if _, err := mergeSidecar(dataFile, o.hints, ""); err != nil {
+			return false, err
+		}
+	} else {
+		if _, inline, err := s.inlineBlob(hash); err != nil || !inline {
+			return false, err
+		}
+		dataFile = s.blobPath(0, hash)
+	}
+
+	unlock := s.locks.links.lock(absLinkName)
+	defer unlock()
+
+	return true, s.inLinkDir(absLinkName, func() error {
+		return s.indexedRelink(absLinkName, dataFile, linkFunc(dataFile, absLinkName, o.overwrite))
+	})
+}
@@ -0,0 +1,60 @@
+package fsdedupe_test
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_LinkExisting(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, subject, "/a.txt", "STORED")
+	stored := fmt.Sprintf("%x", sha512.Sum512([]byte("STORED")))
+	missing := fmt.Sprintf("%x", sha512.Sum512([]byte("MISSING")))
+
+	if ok, err := subject.HasContent("sha512:" + stored); err != nil || !ok {
+		t.Fatalf("expected stored contents to be found, got %v (%v)", ok, err)
+	}
+	if ok, err := subject.HasContent(missing); err != nil || ok {
+		t.Fatalf("expected missing contents not to be found, got %v (%v)", ok, err)
+	}
+	if _, err := subject.HasContent("nope"); !errors.Is(err, fsdedupe.ErrInvalidHash) {
+		t.Fatalf("expected ErrInvalidHash, got: %v", err)
+	}
+
+	if err := subject.LinkExisting("/dir/b.txt", stored, fsdedupe.WithHints(fsdedupe.HintCold)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	assertDedupeFSContents(t, subject, "/dir/b.txt", "STORED")
+	if hints, err := subject.Hints("/dir/b.txt"); err != nil || len(hints) != 1 || hints[0] != fsdedupe.HintCold {
+		t.Errorf("expected hints to be merged, got %v (%v)", hints, err)
+	}
+	if err := subject.LinkExisting("/dir/b.txt", stored); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected ErrExist by default overwrite policy, got: %v", err)
+	}
+	if err := subject.LinkExisting("/c.txt", missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist for missing contents, got: %v", err)
+	}
+}
+
+func TestWithExpectedHash(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	hash := fmt.Sprintf("%x", sha512.Sum512([]byte("EXPECTED")))
+
+	if _, err := subject.WriteFile("/a.txt", strings.NewReader("EXPECTED"), fsdedupe.WithExpectedHash(hash)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := subject.WriteFile("/b.txt", strings.NewReader("OTHER"), fsdedupe.WithExpectedHash(hash)); !errors.Is(err, fsdedupe.ErrHashMismatch) {
+		t.Fatalf("expected ErrHashMismatch, got: %v", err)
+	}
+	if _, err := subject.Stat("/b.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected nothing to be linked on mismatch, got: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package fsdedupe
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// CopyChunkSize is a max chunk size CopyContext reads/writes at once
+// (and requests from Limiter).
+const CopyChunkSize = 32 * 1024
+
+// Limiter throttles throughput.
+// rate.Limiter from golang.org/x/time/rate satisfies it
+// (it must allow bursts of at least CopyChunkSize).
+type Limiter interface {
+	WaitN(ctx context.Context, n int) error
+}
+
+// CopyContext copies src to dst like io.Copy,
+// but checks ctx for cancellation between chunks (of CopyChunkSize)
+// and throttles throughput with limiter (if not nil).
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader, limiter Limiter) (int64, error) {
+	buf := make([]byte, CopyChunkSize)
+
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			if limiter != nil {
+				if err := limiter.WaitN(ctx, n); err != nil {
+					return written, err
+				}
+			}
+
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if m != n {
+				return written, io.ErrShortWrite
+			}
+		}
+
+		if rerr == io.EOF {
+			return written, nil
+		} else if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	perSec float64
+	next   time.Time
+}
+
+// NewBandwidthLimiter returns a Limiter allowing roughly bytesPerSec throughput.
+// It is safe for concurrent use.
+func NewBandwidthLimiter(bytesPerSec int64) Limiter {
+	return &bandwidthLimiter{
+		perSec: float64(bytesPerSec),
+	}
+}
+
+func (l *bandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / l.perSec * float64(time.Second)))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package fsdedupe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestCopyContext(t *testing.T) {
+	src := strings.Repeat("DUMMY", fsdedupe.CopyChunkSize) // multiple chunks
+	var dst bytes.Buffer
+
+	n, err := fsdedupe.CopyContext(context.Background(), &dst, strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := n, int64(len(src)); actual != expected {
+		t.Errorf("expected %d bytes copied, got %d", expected, actual)
+	}
+	if dst.String() != src {
+		t.Errorf("expected copied contents to match source")
+	}
+}
+
+func TestCopyContext_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var dst bytes.Buffer
+	_, err := fsdedupe.CopyContext(ctx, &dst, endlessReader{}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestNewBandwidthLimiter(t *testing.T) {
+	const perSec = 4 * fsdedupe.CopyChunkSize
+	limiter := fsdedupe.NewBandwidthLimiter(perSec)
+
+	src := strings.Repeat("X", 2*fsdedupe.CopyChunkSize)
+	var dst bytes.Buffer
+
+	start := time.Now()
+	if _, err := fsdedupe.CopyContext(context.Background(), &dst, strings.NewReader(src), limiter); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// first chunk goes immediately, second one waits for 1/4s
+	if elapsed, expected := time.Since(start), 200*time.Millisecond; elapsed < expected {
+		t.Errorf("expected copy to be throttled to at least %s, took %s", expected, elapsed)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -0,0 +1,250 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CopyReport describes CopyTree/Import outcome.
+type CopyReport struct {
+	// Copied is a number of files, which contents were copied.
+	Copied int `json:"copied"`
+	// CopiedBytes is a total size of copied files.
+	CopiedBytes int64 `json:"copied_bytes"`
+	// Linked is a number of files linked to the same content already existing in destination.
+	Linked int `json:"linked"`
+	// LinkedBytes is a total size of linked files (saved copying).
+	LinkedBytes int64 `json:"linked_bytes"`
+	// Hardlinked is a number of (Import) source files hardlinked to already imported ones, linked without reading them.
+	Hardlinked int `json:"hardlinked"`
+}
+
+func (r CopyReport) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("fsdedupe.copied", r.Copied),
+		attribute.Int64("fsdedupe.copied_bytes", r.CopiedBytes),
+		attribute.Int("fsdedupe.linked", r.Linked),
+		attribute.Int64("fsdedupe.linked_bytes", r.LinkedBytes),
+		attribute.Int("fsdedupe.hardlinked", r.Hardlinked),
+	}
+}
+
+// CopyTree copies srcDir tree into dstDir, hardlinking files to same-content files already existing in dstDir
+// (anywhere in the tree, not only at the same path) instead of copying them - like a local, content-aware rsync.
+// Existing dstDir files are replaced. Only regular files are considered.
+// Files are copied if hardlinking fails (e.g. crossing devices).
+// WithLogger and WithLimiter options are honored.
+func CopyTree(ctx context.Context, srcDir, dstDir string, opts ...Option) (CopyReport, error) {
+	o := buildOptions(opts)
+	ctx, span := o.tracer.Start(ctx, "fsdedupe.CopyTree")
+	report, err := copyTree(ctx, srcDir, dstDir, o, opts)
+	endSpan(span, err, report.attributes()...)
+	return report, err
+}
+
+func copyTree(ctx context.Context, srcDir, dstDir string, o *options, opts []Option) (CopyReport, error) {
+	var report CopyReport
+
+	if err := os.MkdirAll(dstDir, 0700); err != nil {
+		return report, fmt.Errorf("ensure dir %q: %w", dstDir, err)
+	}
+	plan, err := PlanLinkDest(ctx, dstDir, srcDir, opts...)
+	if err != nil {
+		return report, err
+	}
+
+	// hardlink everything to temp names first, then rename into place,
+	// so replacing files does not affect still-to-be-linked sources
+	type pendingLink struct {
+		tmp, dst string
+		size     int64
+	}
+	var pending []pendingLink
+	defer func() {
+		for _, l := range pending {
+			os.Remove(l.tmp)
+		}
+	}()
+	for _, link := range plan.Links {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		src, dst := filepath.Join(srcDir, link.Path), filepath.Join(dstDir, link.Path)
+		info, err := os.Stat(src)
+		if err != nil {
+			return report, fmt.Errorf("stat %q: %w", src, err)
+		}
+		if dst == link.Source {
+			// already there
+			report.Linked++
+			report.LinkedBytes += info.Size()
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return report, fmt.Errorf("ensure dir for %q: %w", dst, err)
+		}
+		tmp := tempName(dst)
+		if err := os.Link(link.Source, tmp); err != nil {
+			o.logger.Printf("hardlink %q to %q failed, copying: %s", dst, link.Source, err)
+			plan.Copy = append(plan.Copy, link.Path)
+			continue
+		}
+		pending = append(pending, pendingLink{tmp: tmp, dst: dst, size: info.Size()})
+	}
+	for len(pending) != 0 {
+		l := pending[0]
+		if err := os.Rename(l.tmp, l.dst); err != nil {
+			return report, fmt.Errorf("rename %q: %w", l.tmp, err)
+		}
+		pending = pending[1:]
+		report.Linked++
+		report.LinkedBytes += l.size
+	}
+
+	for _, path := range plan.Copy {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		src, dst := filepath.Join(srcDir, path), filepath.Join(dstDir, path)
+		info, err := os.Stat(src)
+		if err != nil {
+			return report, fmt.Errorf("stat %q: %w", src, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return report, fmt.Errorf("ensure dir for %q: %w", dst, err)
+		}
+		if err := copyFile(ctx, src, dst, o.limiter); err != nil {
+			return report, err
+		}
+		report.Copied++
+		report.CopiedBytes += info.Size()
+	}
+
+	o.logger.Printf("copied %d files (%d bytes), linked %d files (%d bytes)", report.Copied, report.CopiedBytes, report.Linked, report.LinkedBytes)
+	return report, nil
+}
+
+// Import copies srcDir tree into DedupeFS under linkDir (link name prefix),
+// linking files to already stored same-content data files instead of copying them.
+// Source files hardlinked to each other (like in rsnapshot or BackupPC trees, snapshots sharing unchanged files)
+// are read once per inode, so a hardlink-heavy backup tree imports in time of its unique contents,
+// its snapshot dirs becoming link subtrees.
+// Existing links are replaced. Only regular files are considered.
+// WithLogger, WithLimiter, WithHashCache and WithImportNames options are honored.
+func (s *DedupeFS) Import(ctx context.Context, srcDir, linkDir string, opts ...Option) (CopyReport, error) {
+	o := buildOptions(opts)
+	ctx, span := o.tracer.Start(ctx, "fsdedupe.Import")
+	report, err := s.importTree(ctx, srcDir, linkDir, o)
+	endSpan(span, err, report.attributes()...)
+	return report, err
+}
+
+func (s *DedupeFS) importTree(ctx context.Context, srcDir, linkDir string, o *options) (CopyReport, error) {
+	var report CopyReport
+
+	files, err := listFiles(srcDir)
+	if err != nil {
+		return report, fmt.Errorf("list %q: %w", srcDir, err)
+	}
+
+	digest := sha512.New()
+	inodes := make(map[fileID]string) // content hashes of imported inodes
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		filename := filepath.Join(srcDir, f.path)
+		name := f.path
+		if o.importNames != nil {
+			var ok bool
+			if name, ok = o.importNames(f.path); !ok {
+				continue
+			}
+		}
+		linkName := filepath.Join(linkDir, name)
+
+		hash, ok := inodes[f.id]
+		if ok && f.hasID {
+			if linked, err := s.linkStored(hash, linkName, &createOptions{overwrite: OverwriteReplace}); err != nil {
+				return report, err
+			} else if linked {
+				report.Linked++
+				report.LinkedBytes += f.size
+				report.Hardlinked++
+				continue
+			}
+		}
+
+		hash, ok = o.hashCache.lookup(filename, f.size, f.modTime)
+		if !ok {
+			digest.Reset()
+			if hash, err = hashContents(ctx, digest, filename, o.limiter); err != nil {
+				return report, fmt.Errorf("hash contents of %q: %w", filename, err)
+			}
+			o.hashCache.store(filename, f.size, f.modTime, hash)
+		}
+		if f.hasID {
+			inodes[f.id] = hash
+		}
+
+		if linked, err := s.linkStored(hash, linkName, &createOptions{overwrite: OverwriteReplace}); err != nil {
+			return report, err
+		} else if linked {
+			report.Linked++
+			report.LinkedBytes += f.size
+			continue
+		}
+
+		if err := s.importFile(ctx, filename, linkName, o.limiter); err != nil {
+			return report, err
+		}
+		report.Copied++
+		report.CopiedBytes += f.size
+	}
+
+	o.logger.Printf("copied %d files (%d bytes), linked %d files (%d bytes, %d hardlinked)", report.Copied, report.CopiedBytes, report.Linked, report.LinkedBytes, report.Hardlinked)
+	return report, nil
+}
+
+// importFile copies file contents into DedupeFS, replacing existing link.
+func (s *DedupeFS) importFile(ctx context.Context, filename, linkName string, limiter Limiter) error {
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return err
+	}
+
+	r, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", filename, err)
+	}
+	defer r.Close()
+
+	stat, err := r.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", filename, err)
+	}
+	if err := os.MkdirAll(s.tempDir, s.dirPerm); err != nil {
+		return fmt.Errorf("ensure dir %q: %w", s.tempDir, err)
+	}
+	if err := checkFree(s.tempDir, stat.Size(), 1); err != nil {
+		return fmt.Errorf("import %q: %w", filename, err)
+	}
+
+	f, err := createFile(s, absLinkName, buildCreateOptions([]CreateOption{WithOverwrite(OverwriteReplace)}))
+	if err != nil {
+		return err
+	}
+	if _, err := CopyContext(ctx, f, r, limiter); err != nil {
+		f.abort()
+		return fmt.Errorf("copy %q: %w", filename, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,78 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestCopyTree(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+
+	writeFile(t, filepath.Join(dst, "same.txt"), "SAME")
+	writeFile(t, filepath.Join(dst, "a.txt"), "AAAA")
+	writeFile(t, filepath.Join(dst, "b.txt"), "BBBB")
+
+	writeFile(t, filepath.Join(src, "same.txt"), "SAME")
+	writeFile(t, filepath.Join(src, "a.txt"), "BBBB") // swapped
+	writeFile(t, filepath.Join(src, "b.txt"), "AAAA") // swapped
+	writeFile(t, filepath.Join(src, "sub", "new.txt"), "NEW")
+
+	report, err := fsdedupe.CopyTree(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.CopyReport{Copied: 1, CopiedBytes: 3, Linked: 3, LinkedBytes: 12}); report != expected {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+
+	for name, expected := range map[string]string{
+		"same.txt":                      "SAME",
+		"a.txt":                         "BBBB",
+		"b.txt":                         "AAAA",
+		filepath.Join("sub", "new.txt"): "NEW",
+	} {
+		b, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if actual := string(b); actual != expected {
+			t.Errorf("expected %q contents %q, got %q", name, expected, actual)
+		}
+	}
+}
+
+func TestDedupeFS_Import(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, subject, "existing.txt", "DUMMY")
+
+	src := filepath.Join(tmp, "src")
+	writeFile(t, filepath.Join(src, "dupe.txt"), "DUMMY")
+	writeFile(t, filepath.Join(src, "sub", "new.txt"), "NEW")
+
+	report, err := subject.Import(context.Background(), src, "imported")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.CopyReport{Copied: 1, CopiedBytes: 3, Linked: 1, LinkedBytes: 5}); report != expected {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+
+	link := filepath.Join(tmp, "link")
+	if actual, expected := readlink(t, filepath.Join(link, "imported", "dupe.txt")), readlink(t, filepath.Join(link, "existing.txt")); actual != expected {
+		t.Errorf("expected imported duplicate to point to %q, got %q", expected, actual)
+	}
+	b, err := os.ReadFile(filepath.Join(link, "imported", "sub", "new.txt"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := string(b), "NEW"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package fsdedupe
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice reports if a rename failed as source and destination are on different devices.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
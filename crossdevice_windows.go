@@ -0,0 +1,13 @@
+package fsdedupe
+
+import (
+	"errors"
+	"syscall"
+)
+
+const errorNotSameDevice syscall.Errno = 17 // MoveFileEx across volumes
+
+// crossDevice reports if a rename failed as source and destination are on different devices.
+func crossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
@@ -0,0 +1,205 @@
+// Package dedupe is a high-level façade of fsdedupe for embedding applications:
+// a single Runner, configured by Config, runs the whole pipeline
+// (scan sources, filters, hashing, linking or planning, reporting hooks),
+// so callers don't wire iterators, planners and appliers manually:
+//
+//	summary, err := dedupe.New(dedupe.Config{
+//		Dirs:     []string{"/srv/media"},
+//		Action:   dedupe.Link,
+//		OnLinked: func(filename, target string) error { log.Println(filename, "->", target); return nil },
+//	}).Run(ctx)
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// Action is what Runner does with found duplicates.
+type Action int
+
+const (
+	// Link replaces duplicates with links (see Config.LinkStrategy), default.
+	Link Action = iota
+	// Plan only plans replacements (see Runner.Plan), nothing is modified.
+	Plan
+)
+
+// Config configures Runner, zero values being fsdedupe defaults.
+type Config struct {
+	// Dirs are dirs to walk regular files of (symlinks are not followed), in order.
+	Dirs []string
+	// Files are additional filenames, processed after Dirs (like fsdedupe.Lines(os.Stdin)),
+	// consumed by a run (so have to be reset before running again).
+	Files fsdedupe.Iterator
+	// ScanCache makes Dirs walks skip dirs unchanged since a previous run (see fsdedupe.WalkDir).
+	ScanCache *fsdedupe.ScanCache
+	// MaxDepth limits a number of Dirs levels walked, see fsdedupe.WithMaxDepth.
+	MaxDepth int
+
+	// Include filters filenames to process, nil includes all.
+	// Excluded files are not processed (nor accounted) at all.
+	Include func(filename string) bool
+	// SkipSymlinks skips input symlinks (see fsdedupe.WithAllowedRoots).
+	SkipSymlinks bool
+	// AllowedRoots skips input symlinks resolving outside of these dirs.
+	AllowedRoots []string
+	// SameDevice leaves duplicates residing on another device than their canonical file.
+	SameDevice bool
+	// EmptyPolicy is zero-byte files policy.
+	EmptyPolicy fsdedupe.EmptyPolicy
+	// MinSize skips non-empty files smaller than this number of bytes (see fsdedupe.WithMinSize).
+	MinSize int64
+	// Identity is file metadata, which must match along with contents (see fsdedupe.WithIdentity).
+	Identity fsdedupe.Identity
+
+	// Concurrency is a number of files hashed in parallel.
+	Concurrency int
+	// Limiter limits file reading throughput.
+	Limiter fsdedupe.Limiter
+	// HashCache reuses hashes of unchanged files, updated by the run.
+	HashCache *fsdedupe.HashCache
+
+	// Action is what to do with duplicates.
+	Action Action
+	// LinkStrategy is how duplicates are linked.
+	LinkStrategy fsdedupe.LinkStrategy
+	// Resolver decides on every duplicate group before it is linked (see fsdedupe.ResolvePlan).
+	Resolver fsdedupe.GroupResolver
+
+	// Logger logs run progress, discarded by default.
+	Logger *log.Logger
+	// OnHashed is called for every hashed file.
+	OnHashed func(filename, hash string, size int64) error
+	// OnLinked is called for every duplicate replaced with a link.
+	OnLinked func(filename, target string) error
+	// OnSkipped is called for every file left as is.
+	OnSkipped func(filename string, reason fsdedupe.SkipReason, detail string) error
+	// Report collects a run report.
+	Report *fsdedupe.RunReport
+}
+
+// Runner runs deduplication configured by Config.
+type Runner struct {
+	cfg Config
+}
+
+// New creates a Runner.
+func New(cfg Config) *Runner {
+	return &Runner{cfg: cfg}
+}
+
+// Run runs deduplication, returning a run summary.
+// Runner with Plan action modifies nothing, see Plan to get planned replacements.
+func (r *Runner) Run(ctx context.Context) (fsdedupe.Summary, error) {
+	var summary fsdedupe.Summary
+	if r.cfg.Action == Plan {
+		_, err := r.plan(ctx, &summary)
+		return summary, err
+	}
+	if r.cfg.Resolver == nil {
+		return fsdedupe.DedupeSymlink(ctx, r.filenames(), r.options(&summary)...)
+	}
+
+	plan, err := r.plan(ctx, &summary)
+	if err != nil {
+		return summary, err
+	}
+	return summary, fsdedupe.ApplyPlan(ctx, plan, r.options(&summary)...)
+}
+
+// Plan plans replacements (resolved by Config.Resolver, if any) without modifying anything,
+// to be applied by fsdedupe.ApplyPlan (regardless of Config.Action).
+func (r *Runner) Plan(ctx context.Context) (fsdedupe.DedupePlan, error) {
+	return r.plan(ctx, new(fsdedupe.Summary))
+}
+
+func (r *Runner) plan(ctx context.Context, summary *fsdedupe.Summary) (fsdedupe.DedupePlan, error) {
+	plan, err := fsdedupe.PlanSymlink(ctx, r.filenames(), r.options(summary)...)
+	if err != nil || r.cfg.Resolver == nil {
+		return plan, err
+	}
+	return fsdedupe.ResolvePlan(ctx, plan, r.cfg.Resolver)
+}
+
+func (r *Runner) options(summary *fsdedupe.Summary) []fsdedupe.Option {
+	cfg := r.cfg
+	opts := []fsdedupe.Option{
+		fsdedupe.WithSummary(summary),
+		fsdedupe.WithEmptyPolicy(cfg.EmptyPolicy),
+		fsdedupe.WithMinSize(cfg.MinSize),
+		fsdedupe.WithIdentity(cfg.Identity),
+		fsdedupe.WithLinkStrategy(cfg.LinkStrategy),
+	}
+	if cfg.SkipSymlinks {
+		opts = append(opts, fsdedupe.WithAllowedRoots())
+	} else if len(cfg.AllowedRoots) != 0 {
+		opts = append(opts, fsdedupe.WithAllowedRoots(cfg.AllowedRoots...))
+	}
+	if cfg.SameDevice {
+		opts = append(opts, fsdedupe.WithSameDevice())
+	}
+	if cfg.Concurrency > 0 {
+		opts = append(opts, fsdedupe.WithConcurrency(cfg.Concurrency))
+	}
+	if cfg.Limiter != nil {
+		opts = append(opts, fsdedupe.WithLimiter(cfg.Limiter))
+	}
+	if cfg.HashCache != nil {
+		opts = append(opts, fsdedupe.WithHashCache(cfg.HashCache))
+	}
+	if cfg.Logger != nil {
+		opts = append(opts, fsdedupe.WithLogger(cfg.Logger))
+	}
+	if cfg.OnHashed != nil {
+		opts = append(opts, fsdedupe.WithOnHashed(cfg.OnHashed))
+	}
+	if cfg.OnLinked != nil {
+		opts = append(opts, fsdedupe.WithOnLinked(cfg.OnLinked))
+	}
+	if cfg.OnSkipped != nil {
+		opts = append(opts, fsdedupe.WithOnSkipped(cfg.OnSkipped))
+	}
+	if cfg.Report != nil {
+		opts = append(opts, fsdedupe.WithRunReport(cfg.Report))
+	}
+	return opts
+}
+
+// filenames chains Config scan sources, applying Config.Include.
+func (r *Runner) filenames() fsdedupe.Iterator {
+	sources := make([]fsdedupe.Iterator, 0, len(r.cfg.Dirs)+1)
+	for _, dir := range r.cfg.Dirs {
+		sources = append(sources, fsdedupe.WalkDir(dir, r.cfg.ScanCache, fsdedupe.WithMaxDepth(r.cfg.MaxDepth)))
+	}
+	if r.cfg.Files != nil {
+		sources = append(sources, r.cfg.Files)
+	}
+	return &chain{sources: sources, include: r.cfg.Include}
+}
+
+type chain struct {
+	sources []fsdedupe.Iterator
+	include func(string) bool
+}
+
+func (c *chain) Next() (string, error) {
+	for len(c.sources) != 0 {
+		filename, err := c.sources[0].Next()
+		if errors.Is(err, io.EOF) {
+			c.sources = c.sources[1:]
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("scan: %w", err)
+		}
+		if c.include == nil || c.include(filename) {
+			return filename, nil
+		}
+	}
+	return "", io.EOF
+}
@@ -0,0 +1,100 @@
+package dedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+	"github.com/mxmCherry/fsdedupe/dedupe"
+)
+
+func TestRunner(t *testing.T) {
+	tmp := t.TempDir()
+	const dupeHash = "5b853931a07284429862382338a94e0c7dc36495790b4e6d7b3b4b8b2aa5c0145c465c759fe29c3b71ba8952bf1ab3fd9ce1052a79f1401f3c8f7f82ab8bd22f" // echo -n DUPE | sha512sum
+
+	dir1 := filepath.Join(tmp, "dir1")
+	file1 := filepath.Join(dir1, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(dir1, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	ignored := filepath.Join(dir1, "ignored.tmp")
+	writeFile(t, ignored, "DUPE")
+
+	dir2 := filepath.Join(tmp, "dir2")
+	file3 := filepath.Join(dir2, "file3.txt")
+	writeFile(t, file3, "DUPE")
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "DUPE")
+
+	cfg := dedupe.Config{
+		Dirs:    []string{dir1, dir2},
+		Files:   fsdedupe.Slice([]string{file4}),
+		Include: func(filename string) bool { return !strings.HasSuffix(filename, ".tmp") },
+		Action:  dedupe.Plan,
+	}
+
+	// planning touches nothing
+	summary, err := dedupe.New(cfg).Run(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary, (fsdedupe.Summary{Files: 4, Duplicates: 3}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	cfg.Files = fsdedupe.Slice([]string{file4})
+	plan, err := dedupe.New(cfg).Plan(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.DedupePlan{Actions: []fsdedupe.PlanAction{
+		{Filename: file2, Target: file1, Size: 4, Hash: dupeHash},
+		{Filename: file3, Target: file1, Size: 4, Hash: dupeHash},
+		{Filename: file4, Target: file1, Size: 4, Hash: dupeHash},
+	}}); !reflect.DeepEqual(plan, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, plan)
+	}
+
+	// resolved groups are linked
+	var linked []string
+	cfg.Files = fsdedupe.Slice([]string{file4})
+	cfg.Action = dedupe.Link
+	cfg.Resolver = func(_ context.Context, filenames []string) (fsdedupe.GroupDecision, error) {
+		return fsdedupe.GroupDecision{Canonical: filenames[len(filenames)-1]}, nil
+	}
+	cfg.OnLinked = func(filename, _ string) error {
+		linked = append(linked, filename)
+		return nil
+	}
+	if summary, err = dedupe.New(cfg).Run(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary, (fsdedupe.Summary{Files: 4, Duplicates: 3, Linked: 3, BytesSaved: 12, DiskBytesSaved: summary.DiskBytesSaved}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	if expected := []string{file1, file2, file3}; !reflect.DeepEqual(linked, expected) {
+		t.Fatalf("expected %q to be linked, got %q", expected, linked)
+	}
+	for _, name := range []string{file1, file2, file3} {
+		if target, err := os.Readlink(name); err != nil || target != file4 {
+			t.Fatalf("expected %q to be linked to %q, got %q (%v)", name, file4, target, err)
+		}
+	}
+	if stat, err := os.Lstat(ignored); err != nil || !stat.Mode().IsRegular() {
+		t.Fatalf("expected %q to be a regular file, but it is not (%v)", ignored, err)
+	}
+}
+
+func writeFile(t *testing.T, name, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := os.WriteFile(name, []byte(contents), 0644); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
@@ -0,0 +1,93 @@
+package fsdedupe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DiffFormat is a format of planned filesystem changes, written by WriteDiff.
+type DiffFormat string
+
+const (
+	// DiffUnified is a unified-diff-like format: a hunk per replaced duplicate,
+	// its regular file (and size) removed, a link to its target added.
+	DiffUnified DiffFormat = "unified"
+	// DiffJSON is a JSON-patch-like array of DiffChange objects (one per line),
+	// which ReadPlan reads back as a plan, so a reviewed diff can be applied with ApplyPlan.
+	DiffJSON DiffFormat = "json"
+)
+
+// DiffChange is a planned filesystem change of DiffJSON diff.
+type DiffChange struct {
+	// Op is a change operation, always "replace" (a duplicate with a link).
+	Op string `json:"op"`
+	// Path is a duplicate to be replaced.
+	Path string `json:"path"`
+	// Target is a (canonical) file the link is going to point to.
+	Target string `json:"target"`
+	// Size is a duplicate size at planning time.
+	Size int64 `json:"size"`
+	// Hash is a content hash at planning time (see PlanAction.Hash).
+	Hash string `json:"hash,omitempty"`
+}
+
+// DiffReplace is DiffChange Op of duplicate replacements.
+const DiffReplace = "replace"
+
+// WriteDiff writes changes ApplyPlan would make (actions of rejected and deferred groups are left out, see DedupePlan.Review)
+// in a machine-parsable format, for review tools to consume instead of log lines.
+func WriteDiff(w io.Writer, plan DedupePlan, format DiffFormat) error {
+	var actions []PlanAction
+	for _, action := range plan.Actions {
+		if status := plan.Reviews[action.Target].Status; status == ReviewRejected || status == ReviewDeferred {
+			continue
+		}
+		actions = append(actions, action)
+	}
+
+	bw := bufio.NewWriter(w)
+	switch format {
+	case DiffUnified:
+		for _, action := range actions {
+			fmt.Fprintf(bw, "--- %s\n+++ %s\n@@ -1 +1 @@\n-file %d bytes\n+link %s\n", action.Filename, action.Filename, action.Size, action.Target)
+		}
+	case DiffJSON:
+		bw.WriteString("[")
+		for i, action := range actions {
+			b, err := json.Marshal(DiffChange{Op: DiffReplace, Path: action.Filename, Target: action.Target, Size: action.Size, Hash: action.Hash})
+			if err != nil {
+				return fmt.Errorf("encode change of %q: %w", action.Filename, err)
+			}
+			if i != 0 {
+				bw.WriteString(",")
+			}
+			bw.WriteString("\n")
+			bw.Write(b)
+		}
+		bw.WriteString("\n]\n")
+	default:
+		return fmt.Errorf("unsupported diff format %q", format)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write diff: %w", err)
+	}
+	return nil
+}
+
+// readDiff decodes DiffJSON diff as a plan.
+func readDiff(b []byte) (DedupePlan, error) {
+	var plan DedupePlan
+	var changes []DiffChange
+	if err := json.Unmarshal(b, &changes); err != nil {
+		return plan, fmt.Errorf("decode diff: %w", err)
+	}
+	for _, change := range changes {
+		if change.Op != DiffReplace {
+			return plan, fmt.Errorf("decode diff: unsupported op %q of %q", change.Op, change.Path)
+		}
+		plan.Actions = append(plan.Actions, PlanAction{Filename: change.Path, Target: change.Target, Size: change.Size, Hash: change.Hash})
+	}
+	return plan, nil
+}
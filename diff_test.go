@@ -0,0 +1,59 @@
+package fsdedupe_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWriteDiff(t *testing.T) {
+	plan := fsdedupe.DedupePlan{
+		Actions: []fsdedupe.PlanAction{
+			{Filename: "/dir/file2.txt", Target: "/dir/file1.txt", Size: 4},
+			{Filename: "/dir/other2.txt", Target: "/dir/other1.txt", Size: 5},
+			{Filename: "/dir/file3.txt", Target: "/dir/file1.txt", Size: 4},
+		},
+		Reviews: map[string]fsdedupe.PlanReview{
+			"/dir/other1.txt": {Status: fsdedupe.ReviewRejected},
+		},
+	}
+
+	var unified bytes.Buffer
+	if err := fsdedupe.WriteDiff(&unified, plan, fsdedupe.DiffUnified); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := unified.String(), ""+
+		"--- /dir/file2.txt\n+++ /dir/file2.txt\n@@ -1 +1 @@\n-file 4 bytes\n+link /dir/file1.txt\n"+
+		"--- /dir/file3.txt\n+++ /dir/file3.txt\n@@ -1 +1 @@\n-file 4 bytes\n+link /dir/file1.txt\n"; actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+
+	var diff bytes.Buffer
+	if err := fsdedupe.WriteDiff(&diff, plan, fsdedupe.DiffJSON); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := diff.String(), ""+
+		"[\n"+
+		`{"op":"replace","path":"/dir/file2.txt","target":"/dir/file1.txt","size":4},`+"\n"+
+		`{"op":"replace","path":"/dir/file3.txt","target":"/dir/file1.txt","size":4}`+"\n"+
+		"]\n"; actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+
+	read, err := fsdedupe.ReadPlan(&diff)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := read.Actions, []fsdedupe.PlanAction{plan.Actions[0], plan.Actions[2]}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+
+	if err := fsdedupe.WriteDiff(&diff, plan, "patch"); err == nil {
+		t.Fatalf("expected unsupported format error, got none")
+	}
+	if _, err := fsdedupe.ReadPlan(bytes.NewBufferString(`[{"op":"remove","path":"/dir/file1.txt"}]`)); err == nil {
+		t.Fatalf("expected unsupported op error, got none")
+	}
+}
@@ -0,0 +1,21 @@
+package fsdedupe
+
+import "context"
+
+// WithDirWalk configures how DedupeDirSymlink walks its dir (see WalkDir):
+// with cache (may be nil) and walk options (like WithMaxDepth).
+// It has no effect on Iterator-taking functions (DedupeSymlink etc): pass them a WalkDir Iterator instead.
+func WithDirWalk(cache *ScanCache, opts ...WalkOption) Option {
+	return func(o *options) {
+		o.walkCache = cache
+		o.walkOpts = append(o.walkOpts, opts...)
+	}
+}
+
+// DedupeDirSymlink deduplicates regular files of dir tree (symlinks are not followed),
+// walked as by WalkDir (see WithDirWalk) - the same as DedupeSymlink of a WalkDir Iterator,
+// so all DedupeSymlink options are honored (filters, concurrency, WithDryRun, reports etc).
+func DedupeDirSymlink(ctx context.Context, dir string, opts ...Option) (Summary, error) {
+	o := buildOptions(opts) // once, as appending options (WithDirWalk, WithExcludes etc) must not apply twice
+	return tracedDedupeSymlink(ctx, WalkDir(dir, o.walkCache, o.walkOpts...), o)
+}
@@ -0,0 +1,61 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeDirSymlink(t *testing.T) {
+	tmp := t.TempDir()
+
+	canonical := filepath.Join(tmp, "a.txt")
+	writeFile(t, canonical, "DUPE")
+	dupe := filepath.Join(tmp, "b.txt")
+	writeFile(t, dupe, "DUPE")
+	excluded := filepath.Join(tmp, "c.tmp")
+	writeFile(t, excluded, "DUPE")
+	deep := filepath.Join(tmp, "sub", "d.txt")
+	writeFile(t, deep, "DUPE")
+
+	skipped := make(map[string]fsdedupe.SkipReason)
+	opts := []fsdedupe.Option{
+		fsdedupe.WithDirWalk(nil, fsdedupe.WithMaxDepth(1)),
+		fsdedupe.WithExcludes("*.tmp"),
+		fsdedupe.WithConcurrency(2),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+			skipped[filename] = reason
+			return nil
+		}),
+	}
+
+	summary, err := fsdedupe.DedupeDirSymlink(context.Background(), tmp, append(opts, fsdedupe.WithDryRun())...)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if summary.Duplicates != 1 || summary.Linked != 0 {
+		t.Errorf("expected dry run to find 1 duplicate, but link none, got %+v", summary)
+	}
+
+	summary, err = fsdedupe.DedupeDirSymlink(context.Background(), tmp, opts...)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Linked, 1; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+	if actual, expected := readlink(t, dupe), canonical; actual != expected {
+		t.Errorf("expected %q to point to %q, got %q", dupe, expected, actual)
+	}
+	if actual, expected := skipped[excluded], fsdedupe.SkipExcluded; actual != expected {
+		t.Errorf("expected %q to be skipped as %q, got %q", excluded, expected, actual)
+	}
+	if actual, expected := skipped[filepath.Join(tmp, "sub")], fsdedupe.SkipTooDeep; actual != expected {
+		t.Errorf("expected sub dir to be skipped as %q, got %q", expected, actual)
+	}
+	if !lstat(t, deep).Mode().IsRegular() {
+		t.Errorf("expected %q to be kept as is", deep)
+	}
+}
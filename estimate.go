@@ -0,0 +1,87 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"math/rand"
+
+	"github.com/mxmCherry/fsdedupe/planner"
+)
+
+// Estimate is a statistical estimate of duplicate bytes (see EstimateDuplicates).
+type Estimate struct {
+	// Files is a number of input files.
+	Files int
+	// Groups is a number of size-collision groups (2+ files of the same size).
+	Groups int
+	// SampledGroups is a number of hashed size-collision groups.
+	SampledGroups int
+	// PotentialBytes is an upper bound of duplicate bytes
+	// (if all same-size files were duplicates).
+	PotentialBytes int64
+	// SampledPotentialBytes is an upper bound of duplicate bytes in sampled groups.
+	SampledPotentialBytes int64
+	// SampledDuplicateBytes is an actual (hashed) number of duplicate bytes in sampled groups.
+	SampledDuplicateBytes int64
+	// DuplicateBytes is an estimated total number of duplicate bytes.
+	DuplicateBytes int64
+}
+
+// EstimateDuplicates estimates total duplicate bytes (read-only)
+// by hashing a random subset (sample ratio, 0..1) of size-collision groups,
+// which is much faster than a full scan on huge inputs.
+// Sample ratio of 1 (or more) hashes all groups, yielding an exact number.
+// Only WithLogger, WithLimiter and WithEmptyPolicy options are honored.
+func EstimateDuplicates(ctx context.Context, filenames Iterator, sample float64, opts ...Option) (Estimate, error) {
+	o := buildOptions(opts)
+
+	var est Estimate
+
+	buckets, err := groupBySize(ctx, filenames, o)
+	if err != nil {
+		return est, fmt.Errorf("group by size: %w", err)
+	}
+
+	digest := sha512.New()
+	for _, b := range buckets {
+		if b.Size == 0 && o.emptyPolicy == EmptySkip {
+			continue
+		}
+		est.Files += len(b.Files)
+		if len(b.Files) < 2 {
+			continue
+		}
+		est.Groups++
+		est.PotentialBytes += b.Savings()
+
+		if sample < 1 && rand.Float64() >= sample {
+			continue
+		}
+		est.SampledGroups++
+		est.SampledPotentialBytes += b.Savings()
+
+		files := make([]planner.File, 0, len(b.Files))
+		for _, f := range b.Files {
+			digest.Reset()
+			hash, err := hashContents(ctx, digest, f.Name, o.limiter)
+			if err != nil {
+				return est, fmt.Errorf("hash contents of %q: %w", f.Name, err)
+			}
+			f.Hash = hash
+			files = append(files, f)
+		}
+		for _, g := range planner.GroupByHash(files, nil) {
+			est.SampledDuplicateBytes += g.Savings()
+		}
+		o.logger.Printf("sampled %d files of %d bytes", len(b.Files), b.Size)
+	}
+
+	if est.SampledGroups == est.Groups {
+		est.DuplicateBytes = est.SampledDuplicateBytes
+	} else if est.SampledPotentialBytes != 0 {
+		ratio := float64(est.SampledDuplicateBytes) / float64(est.SampledPotentialBytes)
+		est.DuplicateBytes = int64(ratio * float64(est.PotentialBytes))
+	}
+	return est, nil
+}
@@ -0,0 +1,58 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestEstimateDuplicates(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "UNIQ") // same size, different content
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "UNIQUE")
+
+	it := &simpleIterator{
+		Entries: []string{
+			file1,
+			file2,
+			file3,
+			file4,
+		},
+	}
+
+	// full sample yields exact numbers
+	est, err := fsdedupe.EstimateDuplicates(context.Background(), it, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := fsdedupe.Estimate{
+		Files:                 4,
+		Groups:                1,
+		SampledGroups:         1,
+		PotentialBytes:        2 * 4,
+		SampledPotentialBytes: 2 * 4,
+		SampledDuplicateBytes: 4,
+		DuplicateBytes:        4,
+	}
+	if actual := est; actual != expected {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	// nothing is modified
+	if stat := lstat(t, file3); !stat.Mode().IsRegular() {
+		t.Errorf("expected %q to be a regular file, but it is not", file3)
+	}
+}
@@ -0,0 +1,31 @@
+package fsdedupe
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// WithExcludes makes DedupeSymlink skip (as SkipExcluded, without hashing) files,
+// any path segment of which (file name or a name of a parent dir) matches any of patterns (see filepath.Match),
+// e.g. "*.tmp" skips temporary files, "node_modules" skips everything within node_modules dirs.
+func WithExcludes(patterns ...string) Option {
+	return func(o *options) {
+		o.excludes = append(o.excludes, patterns...)
+	}
+}
+
+// excluded returns a skip detail, if filename matches exclude patterns or is excluded by allowed roots.
+// Patterns are validated by DedupeSymlink beforehand.
+func (o *options) excluded(filename string) string {
+	if len(o.excludes) != 0 {
+		for _, segment := range strings.Split(filepath.Clean(filename), string(filepath.Separator)) {
+			for _, pattern := range o.excludes {
+				if ok, _ := filepath.Match(pattern, segment); ok {
+					return fmt.Sprintf("matches exclude pattern %q", pattern)
+				}
+			}
+		}
+	}
+	return o.roots.excluded(filename)
+}
@@ -0,0 +1,81 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWithExcludes(t *testing.T) {
+	tmp := t.TempDir()
+
+	canonical := filepath.Join(tmp, "file1.txt")
+	writeFile(t, canonical, "DUPE")
+	kept := filepath.Join(tmp, "file2.txt")
+	writeFile(t, kept, "DUPE")
+	if err := os.Mkdir(filepath.Join(tmp, "node_modules"), 0700); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	inDir := filepath.Join(tmp, "node_modules", "file3.txt")
+	writeFile(t, inDir, "DUPE")
+	byName := filepath.Join(tmp, "file4.tmp")
+	writeFile(t, byName, "DUPE")
+
+	skipped := make(map[string]fsdedupe.SkipReason)
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{canonical, kept, inDir, byName}),
+		fsdedupe.WithExcludes("*.tmp", "node_modules"),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+			skipped[filename] = reason
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Linked, 1; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+	if focus, actual, expected := kept, readlink(t, kept), canonical; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+	for _, filename := range []string{inDir, byName} {
+		if actual, expected := skipped[filename], fsdedupe.SkipExcluded; actual != expected {
+			t.Errorf("expected %q to be skipped as %q, got %q", filename, expected, actual)
+		}
+		if !lstat(t, filename).Mode().IsRegular() {
+			t.Errorf("expected %q to be kept as is", filename)
+		}
+	}
+
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice(nil), fsdedupe.WithExcludes("[")); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Fatalf("expected ErrBadPattern, got: %v", err)
+	}
+}
+
+func TestWithMinSize(t *testing.T) {
+	tmp := t.TempDir()
+
+	var filenames []string
+	for _, name := range []string{"small1.txt", "small2.txt"} {
+		filename := filepath.Join(tmp, name)
+		writeFile(t, filename, "DUPE")
+		filenames = append(filenames, filename)
+	}
+	for _, name := range []string{"large1.txt", "large2.txt"} {
+		filename := filepath.Join(tmp, name)
+		writeFile(t, filename, "LARGE DUPE")
+		filenames = append(filenames, filename)
+	}
+
+	summary := new(fsdedupe.Summary)
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice(filenames), fsdedupe.WithSummary(summary), fsdedupe.WithMinSize(5)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := *summary, (fsdedupe.Summary{Files: 2, Duplicates: 1, Linked: 1, BytesSaved: 10, DiskBytesSaved: summary.DiskBytesSaved, Skipped: 2}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
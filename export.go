@@ -0,0 +1,89 @@
+package fsdedupe
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Export writes links under linkDir (link name prefix, "/" - all links) as a tarball of their contents (not links),
+// named relative to linkDir and sorted, e.g. to hand a tree over or back it up without the store.
+// It returns a number of exported files.
+func (s *DedupeFS) Export(ctx context.Context, w io.Writer, linkDir string) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "fsdedupe.Export")
+	n, err := s.export(ctx, w, linkDir)
+	endSpan(span, err,
+		attribute.Int("fsdedupe.exported", n),
+	)
+	return n, err
+}
+
+func (s *DedupeFS) export(ctx context.Context, w io.Writer, linkDir string) (int, error) {
+	absDir := s.linkDir
+	if strings.TrimFunc(linkDir, isLinkNameSeparator) != "" {
+		_, abs, err := s.resolve(linkDir)
+		if err != nil {
+			return 0, err
+		}
+		absDir = abs
+	}
+	if _, err := os.Stat(absDir); err != nil {
+		return 0, fmt.Errorf("export %q: %w", linkDir, err)
+	}
+
+	links, err := collectLinks(absDir)
+	if err != nil {
+		return 0, err
+	}
+	names := make([]string, 0, len(links))
+	for rel := range links {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+
+	n := 0
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if err := s.exportLink(tw, name, filepath.Join(absDir, name)); err != nil {
+			return n, fmt.Errorf("export %q: %w", name, err)
+		}
+		n++
+	}
+	if err := tw.Close(); err != nil {
+		return n, fmt.Errorf("close tarball: %w", err)
+	}
+	return n, nil
+}
+
+// exportLink writes link contents as a tarball entry, resolving relative links and inline contents.
+func (s *DedupeFS) exportLink(tw *tar.Writer, name, absLinkName string) error {
+	f, err := s.openLink(absLinkName)
+	if err != nil {
+		return fmt.Errorf("open link: %w", err)
+	}
+	defer f.Close()
+
+	switch r := f.(type) {
+	case inlineReader:
+		// inline contents keep no times
+		return writeTarFile(tw, name, r, r.Size(), time.Unix(0, 0))
+	case *os.File:
+		stat, err := r.Stat()
+		if err != nil {
+			return fmt.Errorf("stat data file: %w", err)
+		}
+		return writeTarFile(tw, name, r, stat.Size(), stat.ModTime())
+	}
+	return fmt.Errorf("unsupported link reader %T", f)
+}
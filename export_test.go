@@ -0,0 +1,81 @@
+package fsdedupe_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_Export(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithInlineBlobs(filepath.Join(tmp, "inline"), 4),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	setupDedupeFS_Create(t, subject, "a/one.txt", "CONTENTS")
+	setupDedupeFS_Create(t, subject, "a/sub/two.txt", "CONTENTS")
+	setupDedupeFS_Create(t, subject, "a/tiny.txt", "INL")
+	setupDedupeFS_Create(t, subject, "b/other.txt", "OTHER")
+
+	exportTar := func(linkDir string) map[string]string {
+		t.Helper()
+
+		var buf bytes.Buffer
+		n, err := subject.Export(context.Background(), &buf, linkDir)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+
+		exported := make(map[string]string)
+		tr := tar.NewReader(&buf)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			exported[hdr.Name] = string(b)
+		}
+		if n != len(exported) {
+			t.Errorf("expected %d exported, got %d", len(exported), n)
+		}
+		return exported
+	}
+
+	if actual, expected := exportTar("/a"), map[string]string{
+		"one.txt":     "CONTENTS",
+		"sub/two.txt": "CONTENTS",
+		"tiny.txt":    "INL",
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if actual, expected := exportTar("/"), map[string]string{
+		"a/one.txt":     "CONTENTS",
+		"a/sub/two.txt": "CONTENTS",
+		"a/tiny.txt":    "INL",
+		"b/other.txt":   "OTHER",
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	if _, err := subject.Export(context.Background(), io.Discard, "/missing"); err == nil {
+		t.Errorf("expected an error of a missing link dir, got none")
+	}
+}
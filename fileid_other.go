@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package fsdedupe
+
+import "os"
+
+// fileID identifies a file (dir) across its names.
+type fileID struct{}
+
+// idOf returns file identity, false if it is unknown.
+func idOf(info os.FileInfo) (fileID, bool) {
+	// unsupported, dir loops are not detected
+	return fileID{}, false
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package fsdedupe
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file (dir) across its names.
+type fileID struct {
+	dev, ino uint64
+}
+
+// idOf returns file identity, false if it is unknown.
+func idOf(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
@@ -0,0 +1,48 @@
+package fsdedupe
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+)
+
+// ForkPolicy defines how files having forks (macOS resource forks, Windows alternate data streams) are handled:
+// forks are not symlinked, so they are lost when a duplicate is replaced by a symlink.
+// Forks are not detected on other platforms.
+type ForkPolicy int
+
+const (
+	// ForkWarn logs a warning about forks being lost, but links duplicates as usual (default).
+	ForkWarn ForkPolicy = iota
+	// ForkSkip leaves duplicates having forks as is.
+	ForkSkip
+	// ForkHash includes forks (names and contents) in content identity,
+	// so files are only duplicates if their forks are the same too (nothing is lost).
+	ForkHash
+)
+
+// hashForks combines contents hash with hashes of filename forks.
+func hashForks(ctx context.Context, d hash.Hash, filename, contentsHash string, forks []string, limiter Limiter) (string, error) {
+	forks = append([]string(nil), forks...)
+	sort.Strings(forks)
+
+	type forkHash struct{ name, hash string }
+	hashes := make([]forkHash, 0, len(forks))
+	for _, fork := range forks {
+		d.Reset()
+		h, err := hashContents(ctx, d, forkPath(filename, fork), limiter)
+		if err != nil {
+			return "", fmt.Errorf("fork %q: %w", fork, err)
+		}
+		hashes = append(hashes, forkHash{name: fork, hash: h})
+	}
+
+	d.Reset()
+	io.WriteString(d, contentsHash)
+	for _, h := range hashes {
+		fmt.Fprintf(d, "\n%s\x00%s", h.name, h.hash)
+	}
+	return fmt.Sprintf("%x", d.Sum(nil)), nil
+}
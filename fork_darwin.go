@@ -0,0 +1,28 @@
+package fsdedupe
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// https://developer.apple.com/library/archive/documentation/FileManagement/Conceptual/FileSystemProgrammingGuide/FileSystemDetails/FileSystemDetails.html
+const resourceFork = "rsrc"
+
+func listForks(filename string) ([]string, error) {
+	stat, err := os.Stat(forkPath(filename, resourceFork))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		return nil, nil
+	}
+	return []string{resourceFork}, nil
+}
+
+func forkPath(filename, fork string) string {
+	return filepath.Join(filename, "..namedfork", fork)
+}
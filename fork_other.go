@@ -0,0 +1,11 @@
+//go:build !darwin && !windows
+
+package fsdedupe
+
+func listForks(filename string) ([]string, error) {
+	return nil, nil
+}
+
+func forkPath(filename, fork string) string {
+	return filename
+}
@@ -0,0 +1,57 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeSymlink_forkPolicy(t *testing.T) {
+	var forkPath func(filename string) string
+	switch runtime.GOOS {
+	case "darwin":
+		forkPath = func(filename string) string { return filepath.Join(filename, "..namedfork", "rsrc") }
+	case "windows":
+		forkPath = func(filename string) string { return filename + ":fork" }
+	default:
+		t.Skip("forks are not detected on", runtime.GOOS)
+	}
+
+	setup := func(t *testing.T) (canonical, withFork, plain string) {
+		tmp := t.TempDir()
+		canonical = filepath.Join(tmp, "canonical.txt")
+		writeFile(t, canonical, "DUPE")
+		withFork = filepath.Join(tmp, "fork.txt")
+		writeFile(t, withFork, "DUPE")
+		if err := os.WriteFile(forkPath(withFork), []byte("FORK"), 0600); err != nil {
+			t.Skipf("forks are not supported by test filesystem: %s", err)
+		}
+		plain = filepath.Join(tmp, "plain.txt")
+		writeFile(t, plain, "DUPE")
+		return canonical, withFork, plain
+	}
+
+	for _, policy := range []fsdedupe.ForkPolicy{fsdedupe.ForkSkip, fsdedupe.ForkHash} {
+		canonical, withFork, plain := setup(t)
+
+		summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+			Entries: []string{canonical, withFork, plain},
+		}, fsdedupe.WithForkPolicy(policy))
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if actual, expected := summary.Linked, 1; actual != expected {
+			t.Fatalf("policy %d: expected %d linked, got %d", policy, expected, actual)
+		}
+		if stat := lstat(t, withFork); !stat.Mode().IsRegular() {
+			t.Fatalf("policy %d: expected %q to be left as is, got %s", policy, withFork, stat.Mode())
+		}
+		if actual, expected := readlink(t, plain), canonical; actual != expected {
+			t.Fatalf("policy %d: expected %q to be linked to %q, got -> %q", policy, plain, expected, actual)
+		}
+	}
+}
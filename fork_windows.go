@@ -0,0 +1,64 @@
+package fsdedupe
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procFindFirstStreamW = kernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = kernel32.NewProc("FindNextStreamW")
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/api/fileapi/ns-fileapi-win32_find_stream_data
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+const (
+	errorInvalidFunction  syscall.Errno = 1  // filesystem does not support streams (FAT)
+	errorInvalidParameter syscall.Errno = 87 // filesystem does not support streams (network shares)
+)
+
+// listForks lists non-empty alternate data streams.
+// https://learn.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-findfirststreamw
+func listForks(filename string) ([]string, error) {
+	name, err := syscall.UTF16PtrFromString(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var data win32FindStreamData
+	h, _, errno := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(name)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		switch errno {
+		case syscall.ERROR_HANDLE_EOF, errorInvalidFunction, errorInvalidParameter:
+			return nil, nil
+		}
+		return nil, errno
+	}
+	defer syscall.FindClose(syscall.Handle(h))
+
+	var forks []string
+	for {
+		// ":name:$DATA", unnamed "::$DATA" is the file contents
+		stream := strings.TrimSuffix(strings.TrimPrefix(syscall.UTF16ToString(data.StreamName[:]), ":"), ":$DATA")
+		if stream != "" && data.StreamSize > 0 {
+			forks = append(forks, stream)
+		}
+
+		if ok, _, errno := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data))); ok == 0 {
+			if errno == syscall.ERROR_HANDLE_EOF {
+				return forks, nil
+			}
+			return nil, errno
+		}
+	}
+}
+
+func forkPath(filename, fork string) string {
+	return filename + ":" + fork
+}
@@ -1,33 +1,105 @@
 package fsdedupe
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/sha512"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrPathEscapes is returned when link name resolves to a path outside the link dir
+// (e.g. via a symlinked parent dir).
+var ErrPathEscapes = errors.New("path escapes link dir")
+
+// ErrVersionMismatch is returned by *IfMatch methods
+// when current link version differs from the expected one.
+var ErrVersionMismatch = errors.New("version mismatch")
+
 // DedupeFS is a deduplicated files manager.
 // It keeps files in one dir by their content hash (SHA512),
 // and symlinks (with human-ish names) to them in another dir.
+// It is safe for concurrent use within one process.
 type DedupeFS struct {
 	tempDir string
 	dataDir string
 	linkDir string
 	dirPerm os.FileMode
+
+	// tiers are extra data dirs, dataDir being tier 0, see WithTiers
+	tiers      []string
+	tierPolicy TierPolicy
+
+	// snapshotDir keeps link tree snapshots, see WithSnapshotDir
+	snapshotDir string
+
+	// trashDir keeps softly removed links, see WithTrash
+	trashDir       string
+	trashRetention time.Duration
+
+	// gcMarksDir keeps orphan candidates of two-phase GC, see WithTwoPhaseGC
+	gcMarksDir string
+	gcGrace    time.Duration
+
+	// linkIndexDir keeps reverse (hash -> link names) index, see WithLinkIndex
+	linkIndexDir string
+
+	// inlineDir keeps pack files of tiny contents, see WithInlineBlobs
+	inlineDir     string
+	inlineMaxSize int64
+
+	// lockDir keeps cross-process lock files, see WithLockDir
+	lockDir string
+	locks   fsLocks
+
+	// limiter throttles copies between dirs, see WithFSLimiter
+	limiter Limiter
+
+	tracer trace.Tracer
+
+	// link name rules, see WithSanitizedLinkNames, WithMaxLinkDepth and WithMaxLinkNameLength
+	sanitizeLinkNames bool
+	maxLinkDepth      int
+	maxLinkNameLength int
+}
+
+// FSOption configures DedupeFS.
+type FSOption func(*DedupeFS)
+
+// WithDirPerm sets permissions of dirs DedupeFS creates (0700 by default).
+func WithDirPerm(perm os.FileMode) FSOption {
+	return func(s *DedupeFS) {
+		s.dirPerm = perm
+	}
+}
+
+// WithFSLimiter throttles throughput of data files copying DedupeFS does:
+// writing contents (see WriteFile), moving into data dirs on other devices (than temp dir),
+// tier moves (see Rebalance) and replica restores (see Scrub).
+func WithFSLimiter(l Limiter) FSOption {
+	return func(s *DedupeFS) {
+		s.limiter = l
+	}
 }
 
-// NewDedupeFS constructs a new DedupeFS with given details.
+// NewDedupeFS constructs a new DedupeFS of given dirs, configured by options.
 func NewDedupeFS(
 	tempDir string,
 	dataDir string,
 	linkDir string,
-	dirPerm os.FileMode,
+	opts ...FSOption,
 ) (*DedupeFS, error) {
 	var err error
 
@@ -48,57 +120,196 @@ func NewDedupeFS(
 		}
 	}
 
-	if dirPerm == 0 {
-		dirPerm = 0700
-	}
-
-	return &DedupeFS{
+	s := &DedupeFS{
 		tempDir: tempDir,
 		dataDir: dataDir,
 		linkDir: linkDir,
-		dirPerm: dirPerm,
-	}, nil
+		dirPerm: 0700,
+		tracer:  noopTracer,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.dirPerm == 0 {
+		s.dirPerm = 0700
+	}
+
+	for i, tier := range s.tiers {
+		if filepath.IsLocal(tier) {
+			if s.tiers[i], err = filepath.Abs(tier); err != nil {
+				return nil, fmt.Errorf("resolve abs path for tier %q: %w", tier, err)
+			}
+		}
+	}
+	if filepath.IsLocal(s.lockDir) {
+		if s.lockDir, err = filepath.Abs(s.lockDir); err != nil {
+			return nil, fmt.Errorf("resolve abs path for lock dir %q: %w", s.lockDir, err)
+		}
+	}
+	if filepath.IsLocal(s.inlineDir) {
+		if s.inlineDir, err = filepath.Abs(s.inlineDir); err != nil {
+			return nil, fmt.Errorf("resolve abs path for inline dir %q: %w", s.inlineDir, err)
+		}
+	}
+	if filepath.IsLocal(s.trashDir) {
+		if s.trashDir, err = filepath.Abs(s.trashDir); err != nil {
+			return nil, fmt.Errorf("resolve abs path for trash dir %q: %w", s.trashDir, err)
+		}
+	}
+	if filepath.IsLocal(s.gcMarksDir) {
+		if s.gcMarksDir, err = filepath.Abs(s.gcMarksDir); err != nil {
+			return nil, fmt.Errorf("resolve abs path for gc marks dir %q: %w", s.gcMarksDir, err)
+		}
+	}
+	if filepath.IsLocal(s.snapshotDir) {
+		if s.snapshotDir, err = filepath.Abs(s.snapshotDir); err != nil {
+			return nil, fmt.Errorf("resolve abs path for snapshot dir %q: %w", s.snapshotDir, err)
+		}
+	}
+	return s, nil
+}
+
+// OverwritePolicy defines how Create handles already existing links.
+type OverwritePolicy int
+
+const (
+	// OverwriteError fails with os.ErrExist if link already exists (default).
+	OverwriteError OverwritePolicy = iota
+	// OverwriteReplace atomically replaces existing link.
+	OverwriteReplace
+	// OverwriteKeepSame keeps existing link if it points to the same content (no-op),
+	// and fails with os.ErrExist otherwise.
+	OverwriteKeepSame
+)
+
+// CreateOption configures Create/WriteFile.
+type CreateOption func(*createOptions)
+
+type createOptions struct {
+	overwrite    OverwritePolicy
+	hints        []string
+	expectedHash string
+}
+
+// WithOverwrite sets a policy for already existing links.
+func WithOverwrite(p OverwritePolicy) CreateOption {
+	return func(o *createOptions) {
+		o.overwrite = p
+	}
 }
 
 // Create creates or truncates/opens existing file to be written by caller.
-func (s *DedupeFS) Create(linkName string) (io.WriteCloser, error) {
-	absLinkName := filepath.Join(
-		s.linkDir,
-		filepath.Join(string(filepath.Separator), linkName),
-	)
-	return createFile(s.tempDir, s.dataDir, absLinkName, s.dirPerm)
+// Link is (re)created on Close, according to overwrite policy (see WithOverwrite).
+func (s *DedupeFS) Create(linkName string, opts ...CreateOption) (io.WriteCloser, error) {
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return nil, err
+	}
+	return createFile(s, absLinkName, buildCreateOptions(opts))
+}
+
+// WriteFile creates the file with r contents (see Create), throttled with store limiter (see WithFSLimiter),
+// returning its new version (see Version).
+// Nothing is linked if reading r fails.
+func (s *DedupeFS) WriteFile(linkName string, r io.Reader, opts ...CreateOption) (string, error) {
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := createFile(s, absLinkName, buildCreateOptions(opts))
+	if err != nil {
+		return "", err
+	}
+	if _, err := CopyContext(context.Background(), f, r, s.limiter); err != nil {
+		f.abort()
+		return "", fmt.Errorf("write %q: %w", linkName, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return linkVersion(absLinkName)
+}
+
+// Version returns an opaque version token of the file (content hash + link mtime),
+// suitable for optimistic concurrency control (ETag etc), see RenameIfMatch/RemoveIfMatch.
+func (s *DedupeFS) Version(linkName string) (string, error) {
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return "", err
+	}
+	return linkVersion(absLinkName)
+}
+
+// RenameIfMatch renames (moves) the file only if its current version is the given one,
+// returning ErrVersionMismatch otherwise.
+// Version check and renaming are atomic within one process,
+// but writers in other processes can still interleave in between.
+func (s *DedupeFS) RenameIfMatch(oldLinkName, newLinkName, version string) error {
+	return s.rename(oldLinkName, newLinkName, version)
+}
+
+// RemoveIfMatch removes the file only if its current version is the given one,
+// returning ErrVersionMismatch otherwise.
+// Version check and removing are atomic within one process,
+// but writers in other processes can still interleave in between.
+func (s *DedupeFS) RemoveIfMatch(linkName, version string) error {
+	return s.remove(linkName, version)
 }
 
-// Open opens the file for reading.
+// Open opens the file for reading (inline contents too, see WithInlineBlobs).
 func (s *DedupeFS) Open(linkName string) (io.ReadCloser, error) {
-	absLinkName := filepath.Join(
-		s.linkDir,
-		filepath.Join(string(filepath.Separator), linkName),
-	)
-	return os.Open(absLinkName)
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return nil, err
+	}
+	return s.openLink(absLinkName)
 }
 
 // Rename renames (moves) the file.
 func (s *DedupeFS) Rename(oldLinkName, newLinkName string) error {
-	cleanOldLinkName := filepath.Join(string(filepath.Separator), oldLinkName)
-	absOldLinkName := filepath.Join(
-		s.linkDir,
-		cleanOldLinkName,
-	)
-	absNewLinkName := filepath.Join(
-		s.linkDir,
-		filepath.Join(string(filepath.Separator), newLinkName),
-	)
+	return s.rename(oldLinkName, newLinkName, "")
+}
+
+// rename renames (moves) the file, checking its version first, if given.
+func (s *DedupeFS) rename(oldLinkName, newLinkName, version string) error {
+	cleanOldLinkName, absOldLinkName, err := s.resolve(oldLinkName)
+	if err != nil {
+		return err
+	}
+	_, absNewLinkName, err := s.resolve(newLinkName)
+	if err != nil {
+		return err
+	}
+
+	// GC must not miss the link while it is being moved
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return err
+	}
+	defer unlockStore()
+	unlock := s.locks.links.lock(absOldLinkName, absNewLinkName)
+	defer unlock()
 
-	if err := os.MkdirAll(filepath.Dir(absNewLinkName), s.dirPerm); err != nil {
-		return fmt.Errorf("mkdir: %w", err)
+	if version != "" {
+		if err := s.checkVersion(oldLinkName, version); err != nil {
+			return err
+		}
 	}
 
-	if err := os.Rename(absOldLinkName, absNewLinkName); err != nil {
-		return fmt.Errorf("rename %q -> %q: %w", absOldLinkName, absNewLinkName, err)
+	if err := s.inLinkDir(absNewLinkName, func() error {
+		return s.indexedMove(absOldLinkName, absNewLinkName, func() error {
+			if err := os.Rename(absOldLinkName, absNewLinkName); err != nil {
+				return fmt.Errorf("rename %q -> %q: %w", absOldLinkName, absNewLinkName, err)
+			}
+			return nil
+		})
+	}); err != nil {
+		return err
 	}
 
-	if err := cleanTree(s.linkDir, filepath.Dir(cleanOldLinkName)); err != nil {
+	if err := s.cleanTree(filepath.Dir(cleanOldLinkName)); err != nil {
 		return fmt.Errorf("clean tree of %q: %w", cleanOldLinkName, err)
 	}
 	return nil
@@ -106,34 +317,112 @@ func (s *DedupeFS) Rename(oldLinkName, newLinkName string) error {
 
 // Remove removes the file.
 func (s *DedupeFS) Remove(linkName string) error {
-	cleanLinkName := filepath.Join(string(filepath.Separator), linkName)
-	absLinkName := filepath.Join(
-		s.linkDir,
-		cleanLinkName,
-	)
-	if err := os.RemoveAll(absLinkName); err != nil {
-		return fmt.Errorf("rm: %w", err)
+	return s.remove(linkName, "")
+}
+
+// remove removes the file, checking its version first, if given.
+func (s *DedupeFS) remove(linkName, version string) error {
+	cleanLinkName, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return err
 	}
 
-	if err := cleanTree(s.linkDir, filepath.Dir(cleanLinkName)); err != nil {
+	unlock := s.locks.links.lock(absLinkName)
+	defer unlock()
+
+	if version != "" {
+		if err := s.checkVersion(linkName, version); err != nil {
+			return err
+		}
+	}
+	if err := s.indexedRemove(absLinkName, func() error {
+		if err := os.RemoveAll(absLinkName); err != nil {
+			return fmt.Errorf("rm: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := s.cleanTree(filepath.Dir(cleanLinkName)); err != nil {
 		return fmt.Errorf("clean tree: %w", err)
 	}
 	return nil
 }
 
-// GC removes unreferenced data files.
-func (s *DedupeFS) GC() error {
+// GCReport describes GC outcome.
+type GCReport struct {
+	// Removed is a number of reaped data files.
+	Removed int `json:"removed"`
+	// RemovedBytes is a total size of reaped data files.
+	RemovedBytes int64 `json:"removed_bytes"`
+	// Pinned lists pinned content hashes (see Pin), never reaped.
+	Pinned []string `json:"pinned"`
+	// Expired is a number of purged expired trash entries (see WithTrash).
+	Expired int `json:"expired"`
+	// Marked is a number of orphans marked to be reaped by a later run (see WithTwoPhaseGC).
+	Marked int `json:"marked"`
+}
+
+// GC removes unreferenced (and not pinned, see Pin) data files, purging expired trash entries (see WithTrash) first.
+// With WithTwoPhaseGC, data files are only removed once found unreferenced by two runs.
+// Links reference data files by content hash (data file name), not by exact target path,
+// so relative links and links still pointing to a previous store location (after moving the store) keep their data files.
+func (s *DedupeFS) GC() (GCReport, error) {
+	return s.tracedGC(context.Background(), nil)
+}
+
+func (s *DedupeFS) tracedGC(ctx context.Context, limiter Limiter) (GCReport, error) {
+	ctx, span := s.tracer.Start(ctx, "fsdedupe.GC")
+	report, err := s.gc(ctx, limiter)
+	endSpan(span, err,
+		attribute.Int("fsdedupe.removed", report.Removed),
+		attribute.Int64("fsdedupe.removed_bytes", report.RemovedBytes),
+	)
+	return report, err
+}
+
+// gc reaps data files, throttling removals with limiter (if not nil),
+// one token per data file.
+func (s *DedupeFS) gc(ctx context.Context, limiter Limiter) (GCReport, error) {
+	var report GCReport
+
+	unlockStore, err := s.lockStore(true)
+	if err != nil {
+		return report, err
+	}
+	defer unlockStore()
+
+	if err := s.cleanHashLocks(); err != nil {
+		return report, err
+	}
+
 	dataFiles := make(map[string]struct{})
+	referenced := make(map[string]struct{}) // content hashes
+
+	pinned, err := s.Pins()
+	if err != nil {
+		return report, err
+	}
+	report.Pinned = pinned
 
 	collectDataFiles := func(path string, entry os.DirEntry) error {
+		if entry.IsDir() {
+			return fs.SkipDir // data dirs are flat, subdirs are not the store's
+		}
 		if !entry.Type().IsRegular() {
-			return fs.SkipDir
+			return nil
+		}
+		if strings.HasSuffix(path, hintsSuffix) {
+			return nil // removed along with data file
 		}
 		dataFiles[path] = struct{}{}
 		return nil
 	}
-	if err := walk(s.dataDir, collectDataFiles); err != nil {
-		return fmt.Errorf("walk %q: %w", s.dataDir, err)
+	for _, dataDir := range s.dataDirs() {
+		if err := walk(dataDir, collectDataFiles); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return report, fmt.Errorf("walk %q: %w", dataDir, err)
+		}
 	}
 
 	onLink := func(path string, entry os.DirEntry) error {
@@ -147,106 +436,448 @@ func (s *DedupeFS) GC() error {
 			return fmt.Errorf("readlink %q: %w", path, err)
 		}
 
-		delete(dataFiles, target)
+		// matching by hash keeps data files of relative links and of links to a previous store location
+		if hash, ok := HashFromDataName(target); ok {
+			referenced[hash] = struct{}{}
+			return nil
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		delete(dataFiles, filepath.Clean(target))
 
 		return nil
 	}
-	if err := walk(s.linkDir, onLink); err != nil {
-		return fmt.Errorf("walk %q: %w", s.linkDir, err)
+	if err := walk(s.linkDir, onLink); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return report, fmt.Errorf("walk %q: %w", s.linkDir, err)
 	}
-
-	// any data-link remains there to be reaped?
-	if len(dataFiles) == 0 {
-		return nil
+	if s.snapshotDir != "" {
+		if err := walk(s.snapshotDir, onLink); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return report, fmt.Errorf("walk %q: %w", s.snapshotDir, err)
+		}
+	}
+	if s.trashDir != "" {
+		if report.Expired, err = s.purgeTrash(time.Now()); err != nil {
+			return report, err
+		}
+		if err := walk(s.trashDir, onLink); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return report, fmt.Errorf("walk %q: %w", s.trashDir, err)
+		}
 	}
 
+	marks, err := s.loadGCMarks(time.Now())
+	if err != nil {
+		return report, err
+	}
 	for dataFile := range dataFiles {
+		hash := targetHash(dataFile)
+		if _, ok := referenced[hash]; ok && hash != "" {
+			continue
+		}
+		if slices.Contains(pinned, hash) {
+			continue
+		}
+		if !marks.reap(dataFile) {
+			continue
+		}
+		if limiter != nil {
+			if err := limiter.WaitN(ctx, 1); err != nil {
+				return report, err
+			}
+		}
+
+		stat, err := os.Stat(dataFile)
+		if err != nil {
+			return report, fmt.Errorf("stat %q: %w", dataFile, err)
+		}
 		if err := os.RemoveAll(dataFile); err != nil {
-			return fmt.Errorf("remove %q: %w", dataFile, err)
+			return report, fmt.Errorf("remove %q: %w", dataFile, err)
+		}
+		if err := os.Remove(hintsPath(dataFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return report, fmt.Errorf("remove hints of %q: %w", dataFile, err)
+		}
+		report.Removed++
+		report.RemovedBytes += stat.Size()
+	}
+
+	if s.inlineDir != "" {
+		inline, err := s.inlineSizes()
+		if err != nil {
+			return report, err
+		}
+		for hash := range inline {
+			if _, ok := referenced[hash]; !ok && !slices.Contains(pinned, hash) && !marks.reap(hash) {
+				referenced[hash] = struct{}{} // marked only
+			}
+		}
+		if err := s.gcInline(referenced, &report); err != nil {
+			return report, err
 		}
 	}
 
+	report.Marked = marks.marked()
+	if err := marks.save(s.dirPerm); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func (s *DedupeFS) checkVersion(linkName, version string) error {
+	current, err := s.Version(linkName)
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return fmt.Errorf("%q: %w", linkName, ErrVersionMismatch)
+	}
 	return nil
 }
 
+// resolve returns cleaned (rooted) link name and its absolute path within link dir.
+// It returns ErrPathEscapes if link name's parent dir resolves outside link dir.
+func (s *DedupeFS) resolve(linkName string) (string, string, error) {
+	name, err := s.LinkName(linkName)
+	if err != nil {
+		return "", "", err
+	}
+	cleanLinkName := filepath.FromSlash(name)
+	absLinkName := filepath.Join(
+		s.linkDir,
+		cleanLinkName,
+	)
+
+	if err := checkContained(s.linkDir, filepath.Dir(absLinkName)); err != nil {
+		return "", "", fmt.Errorf("resolve %q: %w", linkName, err)
+	}
+	return cleanLinkName, absLinkName, nil
+}
+
 // ----------------------------------------------------------------------------
 
+func buildCreateOptions(opts []CreateOption) *createOptions {
+	o := new(createOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 type fileWriter struct {
 	io.Writer
 
 	tempFileName string
-	dataDir      string
+	store        *DedupeFS
 	absLinkName  string
 	dirPerm      os.FileMode
+	overwrite    OverwritePolicy
+	hints        []string
+	expectedHash string
 
 	tempFile *os.File
 	digest   hash.Hash
+	sniffed  *sniffBuffer
 }
 
-func createFile(tempDir, dataDir, absLinkName string, dirPerm os.FileMode) (*fileWriter, error) {
-	tempFileName := filepath.Join(tempDir, fmt.Sprintf("%d.bin", time.Now().UnixNano()))
+func createFile(store *DedupeFS, absLinkName string, o *createOptions) (*fileWriter, error) {
+	var expectedHash string
+	if o.expectedHash != "" {
+		var err error
+		if expectedHash, err = ParseHash(o.expectedHash); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := os.MkdirAll(filepath.Dir(tempFileName), dirPerm); err != nil {
-		return nil, fmt.Errorf("ensure dir for %q: %w", tempFileName, err)
+	dirPerm := store.dirPerm
+	if err := os.MkdirAll(store.tempDir, dirPerm); err != nil {
+		return nil, fmt.Errorf("ensure dir %q: %w", store.tempDir, err)
 	}
 
-	tempFile, err := os.Create(tempFileName)
+	// uniquely named (O_EXCL), so concurrent writers, even of other processes sharing temp dir, never share a temp file
+	tempFile, err := os.CreateTemp(store.tempDir, "*"+DataFileExt)
 	if err != nil {
-		return nil, fmt.Errorf("create temp file %q: %w", tempFileName, err)
+		return nil, fmt.Errorf("create temp file in %q: %w", store.tempDir, err)
 	}
+	tempFileName := tempFile.Name()
 
 	digest := sha512.New()
+	sniffed := new(sniffBuffer)
 
 	return &fileWriter{
-		Writer: io.MultiWriter(tempFile, digest),
+		Writer: io.MultiWriter(tempFile, digest, sniffed),
 
 		tempFileName: tempFileName,
-		dataDir:      dataDir,
+		store:        store,
 		absLinkName:  absLinkName,
 		dirPerm:      dirPerm,
+		overwrite:    o.overwrite,
+		hints:        o.hints,
+		expectedHash: expectedHash,
 
 		tempFile: tempFile,
 		digest:   digest,
+		sniffed:  sniffed,
 	}, nil
 }
 
+// abort discards written data without linking anything.
+func (f *fileWriter) abort() {
+	f.tempFile.Close()
+	os.Remove(f.tempFileName)
+}
+
 func (f *fileWriter) Close() error {
+	stat, err := f.tempFile.Stat()
+	if err != nil {
+		f.tempFile.Close()
+		return fmt.Errorf("stat temp file %q: %w", f.tempFileName, err)
+	}
 	if err := f.tempFile.Close(); err != nil {
 		return fmt.Errorf("close temp file %q: %w", f.tempFileName, err)
 	}
 
-	absDataName := filepath.Join(
-		f.dataDir,
-		fmt.Sprintf("%x", f.digest.Sum(nil))+".bin",
-	)
+	blob := BlobInfo{
+		Hash:        fmt.Sprintf("%x", f.digest.Sum(nil)),
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		AccessTime:  stat.ModTime(),
+		Hints:       f.hints,
+		ContentType: http.DetectContentType(f.sniffed.buf),
+	}
+	if f.expectedHash != "" && blob.Hash != f.expectedHash {
+		os.Remove(f.tempFileName)
+		return fmt.Errorf("close %q: expected hash %q, got %q: %w", f.absLinkName, f.expectedHash, blob.Hash, ErrHashMismatch)
+	}
 
-	if err := os.MkdirAll(filepath.Dir(absDataName), f.dirPerm); err != nil {
-		return fmt.Errorf("ensure dir for %q: %w", absDataName, err)
+	// data file must not be reaped before it is linked
+	unlockStore, err := f.store.lockStore(false)
+	if err != nil {
+		return err
 	}
+	defer unlockStore()
 
-	if err := os.Rename(f.tempFileName, absDataName); err != nil {
-		return fmt.Errorf("rename temp file %q into data file %q: %w", f.tempFileName, absDataName, err)
+	absDataName, err := f.storeBlob(blob)
+	if err != nil {
+		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(f.absLinkName), f.dirPerm); err != nil {
-		return fmt.Errorf("ensure dir for %q: %w", f.absLinkName, err)
+	unlock := f.store.locks.links.lock(f.absLinkName)
+	defer unlock()
+
+	return f.store.inLinkDir(f.absLinkName, func() error {
+		return f.store.indexedRelink(f.absLinkName, absDataName, f.link(absDataName))
+	})
+}
+
+// link returns a func linking written file to its data file, according to overwrite policy.
+func (f *fileWriter) link(absDataName string) func() error {
+	return linkFunc(absDataName, f.absLinkName, f.overwrite)
+}
+
+// linkFunc returns a func linking absLinkName to a data file, according to overwrite policy.
+func linkFunc(absDataName, absLinkName string, overwrite OverwritePolicy) func() error {
+	return func() error {
+		switch overwrite {
+		case OverwriteReplace:
+			if err := replaceSymlink(absDataName, absLinkName); err != nil {
+				return fmt.Errorf("replace symlink %q pointing to data file %q: %w", absLinkName, absDataName, err)
+			}
+			return nil
+		case OverwriteKeepSame:
+			if target, err := os.Readlink(absLinkName); err == nil && target == absDataName {
+				return nil
+			}
+		}
+
+		if err := os.Symlink(absDataName, absLinkName); err != nil {
+			return fmt.Errorf("symlink %q pointing to data file %q: %w", absLinkName, absDataName, err)
+		}
+		return nil
 	}
+}
 
-	if err := os.Symlink(absDataName, f.absLinkName); err != nil {
-		return fmt.Errorf("symlink %q pointing to data file %q: %w", f.absLinkName, absDataName, err)
+// storeBlob moves temp file into data file (unless one with the same content is already stored),
+// returning data file path.
+func (f *fileWriter) storeBlob(blob BlobInfo) (string, error) {
+	unlock, err := f.store.lockHash(blob.Hash)
+	if err != nil {
+		return "", err
 	}
+	defer unlock()
+
+	absDataName, exists := f.store.findBlob(blob.Hash)
+	if !exists && f.store.inlines(blob.Size) {
+		// links point to the would-be data file, content hash being all they carry
+		if err := f.store.storeInline(blob.Hash, f.tempFileName); err != nil {
+			return "", err
+		}
+		return f.store.blobPath(0, blob.Hash), nil
+	}
+	if exists {
+		// already stored (maybe in another tier)
+		if err := os.Remove(f.tempFileName); err != nil {
+			return "", fmt.Errorf("remove temp file %q: %w", f.tempFileName, err)
+		}
+	} else {
+		absDataName = f.store.blobPath(f.store.tierOf(blob), blob.Hash)
 
+		if err := os.MkdirAll(filepath.Dir(absDataName), f.dirPerm); err != nil {
+			return "", fmt.Errorf("ensure dir for %q: %w", absDataName, err)
+		}
+
+		if err := os.Rename(f.tempFileName, absDataName); crossDevice(err) {
+			// temp dir (or a tier) may be on another device
+			if cerr := moveByCopy(context.Background(), f.tempFileName, absDataName, f.store.limiter); cerr != nil {
+				return "", fmt.Errorf("rename temp file %q into data file %q: %w (copy fallback: %w)", f.tempFileName, absDataName, err, cerr)
+			}
+		} else if err != nil {
+			return "", fmt.Errorf("rename temp file %q into data file %q: %w", f.tempFileName, absDataName, err)
+		}
+	}
+	if _, err := mergeSidecar(absDataName, blob.Hints, blob.ContentType); err != nil {
+		return "", err
+	}
+	return absDataName, nil
+}
+
+// replaceSymlink atomically creates or replaces symlink name pointing to target.
+func replaceSymlink(target, name string) error {
+	tmp := tempName(name)
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("symlink %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename %q -> %q: %w", tmp, name, err)
+	}
 	return nil
 }
 
+// tempName returns a random same-dir temp name for name (for links, which can't be os.CreateTemp-ed),
+// so concurrent writers never pick the same one.
+func tempName(name string) string {
+	return name + "." + rand.Text() + ".tmp"
+}
+
 // ----------------------------------------------------------------------------
 
+func linkVersion(absLinkName string) (string, error) {
+	stat, err := os.Lstat(absLinkName)
+	if err != nil {
+		return "", fmt.Errorf("lstat %q: %w", absLinkName, err)
+	}
+
+	target, err := os.Readlink(absLinkName)
+	if err != nil {
+		return "", fmt.Errorf("readlink %q: %w", absLinkName, err)
+	}
+	hash := targetHash(target)
+
+	return fmt.Sprintf("%s-%x", hash, stat.ModTime().UnixNano()), nil
+}
+
+// moveByCopy moves src to dst by copying (see copyFile) and removing src.
+func moveByCopy(ctx context.Context, src, dst string, limiter Limiter) error {
+	if err := copyFile(ctx, src, dst, limiter); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("remove %q: %w", src, err)
+	}
+	return nil
+}
+
+// copyFile copies src to dst via a side file, keeping sparse files' holes,
+// throttling throughput with limiter (if not nil).
+func copyFile(ctx context.Context, src, dst string, limiter Limiter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", src, err)
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", src, err)
+	}
+	if err := checkFree(filepath.Dir(dst), DiskUsage(stat), 1); err != nil {
+		return fmt.Errorf("copy %q -> %q: %w", src, dst, err)
+	}
+
+	// copy into a side file first, so dst is never observed half-written
+	tmp := dst + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	if IsSparse(stat) {
+		if err := copySparse(ctx, out, in, limiter); err != nil {
+			return fmt.Errorf("sparse copy %q -> %q: %w", src, tmp, err)
+		}
+	} else if _, err := CopyContext(ctx, out, in, limiter); err != nil {
+		return fmt.Errorf("copy %q -> %q: %w", src, tmp, err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("sync %q: %w", tmp, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close %q: %w", tmp, err)
+	}
+
+	// same-dir rename, which is what network filesystems handle best
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("rename %q -> %q: %w", tmp, dst, err)
+	}
+	return nil
+}
+
+// checkContained checks that dir (within root) does not resolve outside root via symlinks.
+func checkContained(root, dir string) error {
+	// deepest existing ancestor is what symlinks can redirect,
+	// non-existent rest will be created within it
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("lstat %q: %w", existing, err)
+		}
+
+		if existing == root {
+			// nothing exists yet, so nothing can escape
+			return nil
+		}
+		existing = filepath.Dir(existing)
+	}
+
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("eval symlinks of %q: %w", root, err)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return fmt.Errorf("eval symlinks of %q: %w", existing, err)
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || !filepath.IsLocal(rel) {
+		return ErrPathEscapes
+	}
+	return nil
+}
+
 func cleanTree(root, dir string) error {
 	for dir != string(filepath.Separator) {
 		absDir := filepath.Join(root, dir)
 
 		empty, err := isDirEmpty(absDir)
-		if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// already cleaned up
+			dir = filepath.Dir(dir)
+			continue
+		} else if err != nil {
 			return fmt.Errorf("check empty %q: %w", absDir, err)
 		}
 		if !empty {
@@ -279,11 +910,45 @@ func isDirEmpty(dir string) (bool, error) {
 	return len(names) == 0, nil
 }
 
+// walk walks path tree (depth-first), calling cb for every entry.
+// Like with fs.WalkDir, cb returning fs.SkipDir for a dir skips its contents,
+// for other entries - remaining entries of their parent dir; fs.SkipAll skips all remaining entries.
+// Dirs are traversed via os.Root handles (openat-style),
+// so renames during a long walk can't make it visit entries twice,
+// and symlinked dirs can't make it escape path.
+// Dirs being their own ancestors (bind mounts of ancestors etc) are skipped instead of looping,
+// while other dirs reachable under multiple names (bind mounts of the same dir) are walked under each name.
 func walk(path string, cb func(string, os.DirEntry) error) error {
-	d, err := os.Open(path)
+	root, err := os.OpenRoot(path)
+	if err != nil {
+		return fmt.Errorf("open root: %w", err)
+	}
+	defer root.Close()
+
+	if err := walkRoot(root, path, make(map[fileID]struct{}), cb); err != nil && !errors.Is(err, fs.SkipAll) {
+		return err
+	}
+	return nil
+}
+
+func walkRoot(root *os.Root, path string, ancestors map[fileID]struct{}, cb func(string, os.DirEntry) error) error {
+	d, err := root.Open(".")
 	if err != nil {
 		return fmt.Errorf("open: %w", err)
 	}
+	defer d.Close()
+
+	stat, err := d.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	if id, ok := idOf(stat); ok {
+		if _, ok := ancestors[id]; ok {
+			return nil // a loop: contents are being walked already
+		}
+		ancestors[id] = struct{}{}
+		defer delete(ancestors, id)
+	}
 
 	for {
 		entries, err := d.ReadDir(1)
@@ -295,14 +960,20 @@ func walk(path string, cb func(string, os.DirEntry) error) error {
 
 		for _, entry := range entries {
 			childPath := filepath.Join(path, entry.Name())
-			if err := cb(childPath, entry); errors.Is(err, fs.SkipDir) {
+			if err := cb(childPath, entry); errors.Is(err, fs.SkipDir) && entry.IsDir() {
 				continue
+			} else if errors.Is(err, fs.SkipDir) {
+				return nil
+			} else if errors.Is(err, fs.SkipAll) {
+				return fs.SkipAll
 			} else if err != nil {
 				return fmt.Errorf("cb %q: %w", childPath, err)
 			}
 
 			if entry.IsDir() {
-				if err := walk(childPath, cb); err != nil {
+				if err := walkChild(root, entry.Name(), childPath, ancestors, cb); errors.Is(err, fs.SkipAll) {
+					return fs.SkipAll
+				} else if err != nil {
 					return fmt.Errorf("walk %q: %w", childPath, err)
 				}
 			}
@@ -311,3 +982,13 @@ func walk(path string, cb func(string, os.DirEntry) error) error {
 
 	return nil
 }
+
+func walkChild(parent *os.Root, name, path string, ancestors map[fileID]struct{}, cb func(string, os.DirEntry) error) error {
+	child, err := parent.OpenRoot(name)
+	if err != nil {
+		return fmt.Errorf("open root: %w", err)
+	}
+	defer child.Close()
+
+	return walkRoot(child, path, ancestors, cb)
+}
@@ -1,9 +1,11 @@
 package fsdedupe_test
 
 import (
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/mxmCherry/fsdedupe"
@@ -34,6 +36,60 @@ func TestDedupeFS_Create(t *testing.T) {
 	}
 }
 
+func TestDedupeFS_Create_overwrite(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const name = "file.txt"
+	absLinkPath := filepath.Join(tmp, "link", name)
+
+	setupDedupeFS_Create(t, subject, name, "DUMMY")
+
+	// default policy - error
+	if _, err := subject.WriteFile(name, strings.NewReader("DUMMY")); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected %v, got: %v", os.ErrExist, err)
+	}
+
+	// keep existing, same content - no-op
+	before, err := subject.Version(name)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	after, err := subject.WriteFile(name, strings.NewReader("DUMMY"), fsdedupe.WithOverwrite(fsdedupe.OverwriteKeepSame))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if after != before {
+		t.Errorf("expected version to stay %q, got %q", before, after)
+	}
+
+	// keep existing, different content - error
+	if _, err := subject.WriteFile(name, strings.NewReader("OTHER"), fsdedupe.WithOverwrite(fsdedupe.OverwriteKeepSame)); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected %v, got: %v", os.ErrExist, err)
+	}
+
+	// replace
+	if _, err := subject.WriteFile(name, strings.NewReader("OTHER"), fsdedupe.WithOverwrite(fsdedupe.OverwriteReplace)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	b, err := os.ReadFile(absLinkPath)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := string(b), "OTHER"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// no temp links left behind
+	entries, err := os.ReadDir(filepath.Join(tmp, "link"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(entries), 1; actual != expected {
+		t.Errorf("expected %d link dir entries, got %d", expected, actual)
+	}
+}
+
 func TestDedupeFS_Read(t *testing.T) {
 	tmp := t.TempDir()
 	subject := setupDedupeFS(t, tmp)
@@ -128,7 +184,7 @@ func TestDedupeFS_GC(t *testing.T) {
 
 	// GC 1, have SOME links pointing to data file
 
-	if err := subject.GC(); err != nil {
+	if _, err := subject.GC(); err != nil {
 		t.Fatalf("expected no error, got: %s", err)
 	}
 
@@ -144,7 +200,7 @@ func TestDedupeFS_GC(t *testing.T) {
 
 	// GC 2, have NO links pointing to data file
 
-	if err := subject.GC(); err != nil {
+	if _, err := subject.GC(); err != nil {
 		t.Fatalf("expected no error, got: %s", err)
 	}
 
@@ -153,6 +209,214 @@ func TestDedupeFS_GC(t *testing.T) {
 	}
 }
 
+func TestDedupeFS_GC_movedStore(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, filepath.Join(tmp, "old"))
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	setupDedupeFS_Create(t, subject, "moved.txt", "DUMMY")
+	setupDedupeFS_Create(t, subject, "relative.txt", "OTHER")
+	setupDedupeFS_Create(t, subject, "removed.txt", "REMOVED")
+	if err := subject.Remove("removed.txt"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// store is moved, links keep pointing to the old location
+	if err := os.Rename(filepath.Join(tmp, "old"), filepath.Join(tmp, "new")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	subject = setupDedupeFS(t, filepath.Join(tmp, "new"))
+
+	// some links are relative
+	relative := filepath.Join(tmp, "new", "link", "relative.txt")
+	target, err := os.Readlink(relative)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := os.Remove(relative); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := os.Symlink(filepath.Join("..", "data", filepath.Base(target)), relative); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	report, err := subject.GC()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Removed, 1; actual != expected {
+		t.Errorf("expected %d removed data files, got %d", expected, actual)
+	}
+	for _, name := range []string{contentsHash + ".bin", filepath.Base(target)} {
+		if _, err := os.Stat(filepath.Join(tmp, "new", "data", name)); err != nil {
+			t.Errorf("expected referenced data file %q to still exist, but got: %v", name, err)
+		}
+	}
+	if b, err := os.ReadFile(relative); err != nil || string(b) != "OTHER" {
+		t.Errorf("expected relative link to still be readable, got %q, %v", b, err)
+	}
+}
+
+func TestDedupeFS_GC_foreignEntries(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	setupDedupeFS_Create(t, subject, "file.txt", "DUMMY")
+	if err := subject.Remove("file.txt"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// subdirs and non-regular entries of data dir are not the store's
+	foreign := filepath.Join(tmp, "data", "backup", contentsHash+".bin")
+	writeFile(t, foreign, "DUMMY")
+	if err := os.Symlink(foreign, filepath.Join(tmp, "data", "0-link.bin")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	report, err := subject.GC()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Removed, 1; actual != expected {
+		t.Errorf("expected %d removed data files, got %d", expected, actual)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "data", contentsHash+".bin")); !os.IsNotExist(err) {
+		t.Errorf("expected unreferenced data file to be gone, but got: %v", err)
+	}
+	for _, name := range []string{foreign, filepath.Join(tmp, "data", "0-link.bin")} {
+		if _, err := os.Lstat(name); err != nil {
+			t.Errorf("expected %q to be left as is, but got: %v", name, err)
+		}
+	}
+}
+
+func TestDedupeFS_WriteFile(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const name = "sub/dir/file.txt"
+	const contents = "DUMMY"
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+
+	version, err := subject.WriteFile(name, strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !strings.HasPrefix(version, contentsHash) {
+		t.Errorf("expected version %q to start with content hash %q", version, contentsHash)
+	}
+
+	current, err := subject.Version(name)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := current, version; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	b, err := os.ReadFile(filepath.Join(tmp, "link", name))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := string(b), contents; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestDedupeFS_WriteFile_limiter(t *testing.T) {
+	tmp := t.TempDir()
+	limiter := new(countingLimiter)
+	subject, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithFSLimiter(limiter),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if _, err := subject.WriteFile("file.txt", strings.NewReader("DUMMY")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	// temp and data dirs are on the same device, so only writing contents is throttled
+	if actual, expected := limiter.n.Load(), int64(5); actual != expected {
+		t.Errorf("expected %d bytes throttled, got %d", expected, actual)
+	}
+}
+
+func TestDedupeFS_RenameIfMatch(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	version, err := subject.WriteFile("old.txt", strings.NewReader("DUMMY"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if err := subject.RenameIfMatch("old.txt", "new.txt", "STALE"); !errors.Is(err, fsdedupe.ErrVersionMismatch) {
+		t.Fatalf("expected %v, got: %v", fsdedupe.ErrVersionMismatch, err)
+	}
+	if err := subject.RenameIfMatch("old.txt", "new.txt", version); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := os.Lstat(filepath.Join(tmp, "link", "new.txt")); err != nil {
+		t.Errorf("expected renamed link to exist, got: %v", err)
+	}
+}
+
+func TestDedupeFS_RemoveIfMatch(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	version, err := subject.WriteFile("file.txt", strings.NewReader("DUMMY"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if err := subject.RemoveIfMatch("file.txt", "STALE"); !errors.Is(err, fsdedupe.ErrVersionMismatch) {
+		t.Fatalf("expected %v, got: %v", fsdedupe.ErrVersionMismatch, err)
+	}
+	if err := subject.RemoveIfMatch("file.txt", version); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := os.Lstat(filepath.Join(tmp, "link", "file.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected link to be gone, got: %v", err)
+	}
+}
+
+func TestDedupeFS_pathEscapes(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	outside := filepath.Join(tmp, "outside")
+	if err := os.MkdirAll(outside, 0700); err != nil {
+		t.Fatalf("mkdir %q: %s", outside, err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmp, "link"), 0700); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(tmp, "link", "evil")); err != nil {
+		t.Fatalf("symlink: %s", err)
+	}
+
+	if _, err := subject.Create("evil/sub/file.txt"); !errors.Is(err, fsdedupe.ErrPathEscapes) {
+		t.Errorf("expected Create to fail with %v, got: %v", fsdedupe.ErrPathEscapes, err)
+	}
+	if _, err := subject.Open("evil/file.txt"); !errors.Is(err, fsdedupe.ErrPathEscapes) {
+		t.Errorf("expected Open to fail with %v, got: %v", fsdedupe.ErrPathEscapes, err)
+	}
+	if err := subject.Remove("evil/file.txt"); !errors.Is(err, fsdedupe.ErrPathEscapes) {
+		t.Errorf("expected Remove to fail with %v, got: %v", fsdedupe.ErrPathEscapes, err)
+	}
+
+	setupDedupeFS_Create(t, subject, "file.txt", "DUMMY")
+	if err := subject.Rename("file.txt", "evil/file.txt"); !errors.Is(err, fsdedupe.ErrPathEscapes) {
+		t.Errorf("expected Rename to fail with %v, got: %v", fsdedupe.ErrPathEscapes, err)
+	}
+}
+
 // ----------------------------------------------------------------------------
 
 func setupDedupeFS(t *testing.T, tmp string) *fsdedupe.DedupeFS {
@@ -160,7 +424,6 @@ func setupDedupeFS(t *testing.T, tmp string) *fsdedupe.DedupeFS {
 		filepath.Join(tmp, "temp"),
 		filepath.Join(tmp, "data"),
 		filepath.Join(tmp, "link"),
-		0700,
 	)
 	if err != nil {
 		t.Fatalf("expected no error, got: %s", err)
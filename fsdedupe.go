@@ -3,14 +3,19 @@ package fsdedupe
 import (
 	"bufio"
 	"context"
-	"crypto/sha512"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe/planner"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Iterator defines a string (filename) iterator.
@@ -19,31 +24,93 @@ type Iterator interface {
 	Next() (string, error)
 }
 
+// IteratorError is returned by functions consuming an Iterator (DedupeSymlink, PlanSymlink etc) when it fails,
+// wrapping the Iterator error (see Err). Lines returns it itself, with a line number.
+type IteratorError struct {
+	// Line is a (1-based) input line number of Lines Iterator errors, 0 for other Iterators.
+	Line int
+	// Err is the Iterator error.
+	Err error
+}
+
+func (e *IteratorError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("read input line %d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("read input: %s", e.Err)
+}
+
+func (e *IteratorError) Unwrap() error { return e.Err }
+
+// iteratorError wraps a failed Iterator error into IteratorError, unless it has one already.
+func iteratorError(err error) error {
+	var itErr *IteratorError
+	if errors.As(err, &itErr) {
+		return err
+	}
+	return &IteratorError{Err: err}
+}
+
 type lines struct {
-	scanner *bufio.Scanner
+	scanner       *bufio.Scanner
+	maxLineLength int
+	comments      bool
+	n             int // lines read
+}
+
+// LinesOption configures Lines.
+type LinesOption func(*lines)
+
+// WithMaxLineLength sets max line length (bytes, including line end), bufio.MaxScanTokenSize (64KB) if 0.
+// Lines iterator fails on longer lines (IteratorError wrapping bufio.ErrTooLong).
+func WithMaxLineLength(n int) LinesOption {
+	return func(l *lines) {
+		l.maxLineLength = n
+	}
+}
+
+// WithComments makes Lines skip "#"-prefixed (after leading whitespaces) comment lines,
+// so generated file lists can carry annotations. Filenames starting with "#" can't be listed then.
+func WithComments() LinesOption {
+	return func(l *lines) {
+		l.comments = true
+	}
 }
 
 // Lines is an Iterator-adapter for an io.Reader (os.Stdin etc).
 // It strips leading/trailing whitespaces and skips empty lines.
-func Lines(r io.Reader) Iterator {
-	return &lines{
+func Lines(r io.Reader, opts ...LinesOption) Iterator {
+	l := &lines{
 		scanner: bufio.NewScanner(r),
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.maxLineLength <= 0 {
+		l.maxLineLength = bufio.MaxScanTokenSize
+	}
+	l.scanner.Buffer(make([]byte, 0, min(l.maxLineLength, 4096)), l.maxLineLength)
+	return l
 }
 
 func (l *lines) Next() (string, error) {
-	if !l.scanner.Scan() {
-		if err := l.scanner.Err(); err != nil {
-			return "", err
+	for l.scanner.Scan() {
+		l.n++
+		line := strings.TrimSpace(l.scanner.Text())
+		if line == "" || (l.comments && strings.HasPrefix(line, "#")) {
+			continue
 		}
-		return "", io.EOF
+		return line, nil
 	}
 
-	line := strings.TrimSpace(l.scanner.Text())
-	if line == "" {
-		return l.Next()
+	err := l.scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		err = fmt.Errorf("longer than %d bytes (see WithMaxLineLength): %w", l.maxLineLength, err)
+	}
+	if err != nil {
+		return "", &IteratorError{Line: l.n + 1, Err: err}
 	}
-	return line, nil
+	return "", io.EOF
 }
 
 // ----------------------------------------------------------------------------
@@ -51,63 +118,777 @@ func (l *lines) Next() (string, error) {
 // DedupeSymlink deduplicates input filenames
 // by symlinking files to the first-seen file
 // by SHA512 content hash.
-func DedupeSymlink(ctx context.Context, filenames Iterator) error {
-	byHash := make(map[string]string)
-	digest := sha512.New()
+// Input filenames are normalized to absolute paths with parent dir symlinks resolved
+// (so are symlink targets and all reported filenames), and repeated ones are processed once.
+// It returns run statistics, which are also meaningful for failed/interrupted runs.
+func DedupeSymlink(ctx context.Context, filenames Iterator, opts ...Option) (Summary, error) {
+	return tracedDedupeSymlink(ctx, filenames, buildOptions(opts))
+}
+
+func tracedDedupeSymlink(ctx context.Context, filenames Iterator, o *options) (Summary, error) {
+	ctx, span := o.tracer.Start(ctx, "fsdedupe.DedupeSymlink")
+	err := dedupeSymlink(ctx, filenames, o)
+	summary := *o.summary
+	endSpan(span, err,
+		attribute.Int("fsdedupe.files", summary.Files),
+		attribute.Int("fsdedupe.duplicates", summary.Duplicates),
+		attribute.Int("fsdedupe.linked", summary.Linked),
+		attribute.Int64("fsdedupe.bytes_saved", summary.BytesSaved),
+	)
+	return summary, err
+}
+
+func dedupeSymlink(ctx context.Context, filenames Iterator, o *options) error {
+	summary := o.summary
+
+	var groups []*dupeGroup
+	byHash := make(map[string]*dupeGroup)
+	probed := make(map[string]FSInfo)
+
+	inodes := newInodeBudget(o.logger)
+	strategies := newStrategist(o.linkStrategy, o.fsStrategies, o.compatRules)
+	var rootSquash rootSquashCache
+	var folder caseFolder
+
+	for _, entry := range o.resume.Index {
+		group := &dupeGroup{
+			hash:      entry.Hash,
+			canonical: entry.Canonical,
+			size:      entry.Size,
+			count:     entry.Count,
+			links:     entry.Links,
+		}
+		byHash[entry.Hash] = group
+		groups = append(groups, group)
+	}
+
+	filenames = &uniqueFilter{filenames: filenames, logger: o.logger}
+
+	if o.restrictRoots {
+		roots, err := newRootChecker(o.allowedRoots)
+		if err != nil {
+			return err
+		}
+		o.roots = roots
+	}
+
+	for _, pattern := range o.excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("exclude pattern %q: %w", pattern, err)
+		}
+	}
+	if err := validateCompatRules(o.compatRules); err != nil {
+		return err
+	}
+
+	if o.shadowDir != "" {
+		shadow, err := newShadowTree(o.shadowRoot, o.shadowDir)
+		if err != nil {
+			return err
+		}
+		o.shadow = shadow
+	}
+
+	if o.originalsDir != "" {
+		// symlinks to originals must resolve from anywhere
+		abs, err := filepath.Abs(o.originalsDir)
+		if err != nil {
+			return fmt.Errorf("resolve originals dir %q: %w", o.originalsDir, err)
+		}
+		o.originalsDir = abs
+	}
+
+	if o.largestFirst {
+		// excluded symlinks must not even be stat-ed
+		if o.roots != nil || len(o.excludes) != 0 {
+			filenames = &rootFilter{filenames: filenames, o: o}
+		}
+
+		indexed := make(map[int64]struct{}, len(groups))
+		for _, group := range groups {
+			indexed[group.size] = struct{}{}
+		}
+
+		ordered, err := orderBySavings(ctx, filenames, indexed, o)
+		if err != nil {
+			return fmt.Errorf("order by expected savings: %w", err)
+		}
+		filenames = ordered
+	}
+
+	pipeline := startHashing(ctx, filenames, o)
+	defer pipeline.stop()
 
+	// abort is done on hard cancellation, which is ctx itself unless two-level cancellation is requested
+	abort := ctx
+	if o.abort != nil {
+		abort = o.abort
+	}
+	stopErr := func() error {
+		if err := abort.Err(); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+	isStopErr := func(err error) bool {
+		return (ctx.Err() != nil && errors.Is(err, ctx.Err())) || (abort.Err() != nil && errors.Is(err, abort.Err()))
+	}
+
+	// interrupted writes a checkpoint (if requested) of pending + not yet consumed input
+	interrupted := func(pending ...string) error {
+		if o.onCheckpoint == nil {
+			return stopErr()
+		}
+
+		cp := Checkpoint{
+			Remaining: append(pending, pipeline.stop()...),
+			Index:     make([]CheckpointEntry, 0, len(groups)),
+		}
+		for {
+			filename, err := filenames.Next()
+			var walkSkip *WalkSkipError
+			if errors.Is(err, io.EOF) {
+				break
+			} else if errors.As(err, &walkSkip) {
+				continue // is not walked on resume either
+			} else if err != nil {
+				return fmt.Errorf("drain input for checkpoint: %w", iteratorError(err))
+			}
+			cp.Remaining = append(cp.Remaining, filename)
+		}
+		for _, group := range groups {
+			cp.Index = append(cp.Index, group.checkpointEntry())
+		}
+
+		if err := o.onCheckpoint(cp); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+		return stopErr()
+	}
+
+	var mediaKeys []MediaKey
+	byMedia := make(map[MediaKey]*mediaGroup)
+
+	var indexMemory int64
+
+	// finalize reports a group no more files are going to join
+	finalize := func(group *dupeGroup) error {
+		if o.onAlert != nil {
+			if alert := group.alert(); o.alertPolicy.matches(alert) {
+				if err := o.onAlert(alert); err != nil {
+					return fmt.Errorf("on alert for %q: %w", group.canonical, err)
+				}
+			}
+		}
+		if o.onGroup != nil && group.count > 1 {
+			if err := o.onGroup(group.duplicateGroup()); err != nil {
+				return fmt.Errorf("on group for %q: %w", group.canonical, err)
+			}
+		}
+		return nil
+	}
+
+	// with WithLargestFirst, input comes in size buckets, so groups of a bucket are final once it ends
+	bucketSize := int64(-1)
+	flushBucket := func() error {
+		kept := groups[:0]
+		for _, group := range groups {
+			if group.size != bucketSize {
+				kept = append(kept, group)
+				continue
+			}
+			delete(byHash, group.hash)
+			indexMemory -= group.memory()
+			if err := finalize(group); err != nil {
+				return err
+			}
+		}
+		clear(groups[len(kept):])
+		groups = kept
+		return nil
+	}
+
+	var pending []string // not hashed due to soft cancellation (see WithAbort)
 	for {
 		select {
-		case <-ctx.Done():
-			return ctx.Err()
+		case <-abort.Done():
+			return interrupted(pending...)
 		default:
 		}
 
-		filename, err := filenames.Next()
-		if errors.Is(err, io.EOF) {
+		res, ok := pipeline.next()
+		if !ok {
 			break
-		} else if err != nil {
-			return filepath.ErrBadPattern
 		}
+		var skipErr *skipError
+		if res.err != nil && isStopErr(res.err) && abort.Err() == nil {
+			pending = append(pending, res.filename)
+			continue
+		} else if res.err != nil && isStopErr(res.err) {
+			return interrupted(append(pending, res.filename)...)
+		} else if res.err != nil && o.ignorePerm && errors.Is(res.err, fs.ErrPermission) {
+			if err := o.permissionDenied(res.filename, res.err); err != nil {
+				return err
+			}
+			continue
+		} else if res.err != nil && errors.As(res.err, &skipErr) {
+			o.logger.Printf("skipping %q: %s", res.filename, skipErr.detail)
+			if err := o.skipped(res.filename, skipErr.reason, skipErr.detail); err != nil {
+				return err
+			}
+			continue
+		} else if res.err != nil {
+			return res.err
+		}
+		filename, stat, hash := res.filename, res.stat, res.hash
+		empty := stat.Size() == 0
+		if empty && o.emptyPolicy == EmptySkip {
+			if err := o.skipped(filename, SkipTooSmall, "empty file"); err != nil {
+				return err
+			}
+			continue
+		}
+		summary.Files++
 
-		stat, err := os.Stat(filename)
-		if err != nil {
-			return fmt.Errorf("stat %q: %w", filename, err)
+		if o.largestFirst && stat.Size() != bucketSize {
+			if err := flushBucket(); err != nil {
+				return err
+			}
+			bucketSize = stat.Size()
 		}
-		if !stat.Mode().IsRegular() {
-			return fmt.Errorf("not a regular file: %q", filename)
+
+		if o.shadow != nil {
+			if created, err := o.shadow.link(filename, filename, inodes); err != nil {
+				return err
+			} else if created {
+				summary.InodesUsed++
+			}
 		}
 
-		digest.Reset()
-		hash, err := hashContents(digest, filename)
-		if err != nil {
-			return fmt.Errorf("hash contents of %q: %w", filename, err)
+		if o.onHashed != nil {
+			if err := o.onHashed(filename, hash, stat.Size()); err != nil {
+				return fmt.Errorf("on hashed %q: %w", filename, err)
+			}
 		}
 
-		existing, ok := byHash[hash]
+		if res.media != nil {
+			m, ok := byMedia[*res.media]
+			if !ok {
+				m = &mediaGroup{hashes: make(map[string]struct{})}
+				byMedia[*res.media] = m
+				mediaKeys = append(mediaKeys, *res.media)
+			}
+			if _, ok := m.hashes[hash]; !ok {
+				m.hashes[hash] = struct{}{}
+				m.filenames = append(m.filenames, filename)
+			}
+		}
+
+		group, ok := byHash[hash]
 		if !ok {
-			byHash[hash] = filename
+			group = &dupeGroup{
+				hash:      hash,
+				canonical: filename,
+				size:      stat.Size(),
+				count:     1,
+			}
+			if o.onGroup != nil {
+				group.files = []string{filename}
+			}
+			byHash[hash] = group
+			groups = append(groups, group)
+
+			// evict oldest groups once over memory budget:
+			// their later duplicates are just not going to be linked
+			indexMemory += group.memory()
+			for o.maxIndexMemory > 0 && indexMemory > o.maxIndexMemory && len(groups) > 1 {
+				evicted := groups[0]
+				groups[0] = nil
+				groups = groups[1:]
+				delete(byHash, evicted.hash)
+				indexMemory -= evicted.memory()
+				o.logger.Printf("index memory budget exceeded, evicted %q", evicted.canonical)
+				if err := finalize(evicted); err != nil {
+					return err
+				}
+			}
 			continue
 		}
+		existing := group.canonical
 
-		if err := os.Remove(filename); err != nil {
-			return fmt.Errorf("remove %q: %w", filename, err)
+		// on case-insensitive volumes, differently-cased names may be the very same file
+		if same, err := folder.same(filename, existing); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		} else if same {
+			o.logger.Printf("%q is the same file as %q (listed twice or under another name), skipping", filename, existing)
+			continue
+		}
+
+		group.count++
+		if o.onGroup != nil {
+			group.files = append(group.files, filename)
+			indexMemory += int64(len(filename)) + fileOverhead
+		}
+
+		// canonical file may be deleted by another process meanwhile, duplicate takes its place then
+		existingStat, err := os.Lstat(existing)
+		if errors.Is(err, fs.ErrNotExist) {
+			o.logger.Printf("canonical %q vanished, keeping duplicate %q as a new canonical file", existing, filename)
+			indexMemory += int64(len(filename) - len(existing))
+			group.canonical, group.links = filename, 0
+			continue
+		} else if err != nil {
+			return fmt.Errorf("lstat %q: %w", existing, err)
+		}
+
+		// re-runs over deduplicated trees list symlinks to canonical files (possibly before the files themselves)
+		if symlink, err := alreadyDeduped(filename, stat, existing, existingStat); err != nil {
+			return err
+		} else if symlink != "" {
+			if symlink == existing {
+				o.logger.Printf("%q is a symlink to %q, keeping the latter as a canonical file", existing, filename)
+				indexMemory += int64(len(filename) - len(existing))
+				group.canonical = filename
+			}
+			o.logger.Printf("%q is already deduplicated", symlink)
+			summary.AlreadyDeduped++
+			summary.AlreadyDedupedBytes += stat.Size()
+			continue
+		}
+		summary.Duplicates++
+
+		if empty && o.emptyPolicy == EmptyReport {
+			o.logger.Printf("leaving empty duplicate %q of %q as is", filename, existing)
+			if err := o.skipped(filename, SkipTooSmall, "empty file"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// with ForkHash, canonical file has the very same forks
+		if len(res.forks) != 0 && o.forkPolicy == ForkSkip {
+			o.logger.Printf("leaving duplicate %q of %q as is (has forks %q)", filename, existing, res.forks)
+			if err := o.skipped(filename, SkipForks, fmt.Sprintf("has forks %q", res.forks)); err != nil {
+				return err
+			}
+			continue
+		} else if len(res.forks) != 0 && o.forkPolicy == ForkWarn {
+			o.logger.Printf("warning: forks %q of duplicate %q are lost, replacing it with a symlink to %q", res.forks, filename, existing)
+		}
+
+		if o.maxLinks > 0 && group.links >= o.maxLinks {
+			o.logger.Printf("%q has %d links already, keeping duplicate %q as a new canonical file", existing, group.links, filename)
+			indexMemory += int64(len(filename) - len(existing))
+			group.canonical, group.links = filename, 0
+			continue
+		}
+
+		if o.networkSafe {
+			dir := filepath.Dir(filename)
+			info, ok := probed[dir]
+			if !ok {
+				var err error
+				if info, err = ProbeFS(dir); err != nil {
+					return fmt.Errorf("probe %q: %w", dir, err)
+				}
+				probed[dir] = info
+				o.logger.Printf("probed %q: %s", dir, info)
+			}
+			if !info.Symlinks {
+				o.logger.Printf("symlinks are not supported in %q, leaving duplicate %q of %q as is", dir, filename, existing)
+				if err := o.skipped(filename, SkipUnsupported, "symlinks are not supported"); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if reason, detail, err := checkLinkable(filename, existing, stat, o); err != nil {
+			return err
+		} else if reason != "" {
+			o.logger.Printf("leaving duplicate %q of %q as is (%s)", filename, existing, detail)
+			if err := o.skipped(filename, reason, detail); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// writes as root to root-squashed NFS mounts may fail or create files owned by nobody,
+		// checked before planning too, so confirmed plans never link what a direct run would not
+		if o.shadow == nil {
+			dir := filepath.Dir(filename)
+			squashed, detected, err := rootSquash.squashed(dir)
+			if err != nil {
+				return fmt.Errorf("detect root squash: %w", err)
+			}
+			if detected {
+				o.logger.Printf("warning: %q is root-squashed (running as root, but files are created as another user), only reporting duplicates on this mount", dir)
+			}
+			if squashed {
+				o.logger.Printf("leaving duplicate %q of %q as is (root-squashed)", filename, existing)
+				if err := o.skipped(filename, SkipUnsupported, "root-squashed"); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		// plans are applied by renaming a link over duplicate (see ApplyPlan)
+		if o.networkSafe && o.plan != nil && !probed[filepath.Dir(filename)].AtomicRename {
+			o.logger.Printf("atomic rename is not supported in %q, leaving duplicate %q of %q as is", filepath.Dir(filename), filename, existing)
+			if err := o.skipped(filename, SkipUnsupported, "atomic rename is not supported"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if o.plan != nil || o.scanOnly || o.dryRun {
+			if o.dryRun {
+				o.logger.Printf("would replace duplicate %q with a link to %q", filename, existing)
+			}
+			if o.plan != nil {
+				o.plan.Actions = append(o.plan.Actions, PlanAction{
+					Filename: filename,
+					Target:   existing,
+					Size:     stat.Size(),
+					Hash:     hash,
+				})
+			}
+			group.links++
+			continue
 		}
-		if err := os.Symlink(existing, filename); err != nil {
+
+		if rule, ok := strategies.keeps(filename); ok {
+			o.logger.Printf("leaving duplicate %q of %q as is (compat rule %q)", filename, existing, rule.Pattern)
+			if err := o.skipped(filename, SkipCompat, fmt.Sprintf("compat rule %q", rule.Pattern)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if o.originalsDir != "" && o.shadow == nil && !withinDir(existing, o.originalsDir) {
+			if err := inodes.consume(filepath.Dir(existing)); err != nil {
+				return fmt.Errorf("move canonical %q: %w", existing, err)
+			}
+			moved, reused, err := relocateCanonical(ctx, o.originalsDir, existing, hash, stat.Size(), o.limiter)
+			if err != nil {
+				return err
+			}
+			if !reused {
+				summary.InodesUsed++
+			}
+			o.logger.Printf("moved canonical %q to %q", existing, moved)
+			indexMemory += int64(len(moved) - len(existing))
+			group.canonical, existing = moved, moved
+		}
+
+		strategy := LinkSymlink
+		if o.shadow == nil {
+			var err error
+			if strategy, err = strategies.pick(filename, existing); err != nil {
+				return fmt.Errorf("pick link strategy for %q: %w", filename, err)
+			}
+		}
+
+		// both journal and non-symlink strategies link aside, renaming the link over duplicate then
+		if o.networkSafe && o.shadow == nil && (o.journal != "" || strategy != LinkSymlink) && !probed[filepath.Dir(filename)].AtomicRename {
+			o.logger.Printf("atomic rename is not supported in %q, leaving duplicate %q of %q as is", filepath.Dir(filename), filename, existing)
+			if err := o.skipped(filename, SkipUnsupported, "atomic rename is not supported"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// journal (and reflink) creates a link aside, so a new inode is needed until duplicate is removed
+		hardlinked := linkCount(stat) > 1
+		if o.shadow == nil && strategy != LinkHardlink && (hardlinked || o.journal != "" || strategy == LinkReflink) {
+			if err := inodes.consume(filepath.Dir(filename)); err != nil {
+				return fmt.Errorf("link %q: %w", filename, err)
+			}
+		}
+
+		linkStart := time.Now()
+		used := strategy
+		if o.shadow != nil {
+			if _, err := o.shadow.link(filename, existing, inodes); err != nil {
+				return err
+			}
+		} else if o.journal != "" {
+			link := func(target, name string) (err error) {
+				used, err = strategies.link(strategy, target, name, stat)
+				return err
+			}
+			if err := journaledLink(abort, o.journal, filename, existing, link); err != nil && isStopErr(err) {
+				return interrupted(append(pending, filename)...)
+			} else if vanished(filename, err) {
+				if err := o.skippedVanished(filename, existing); err != nil {
+					return err
+				}
+				continue
+			} else if err != nil {
+				return err
+			}
+		} else if strategy != LinkSymlink {
+			var err error
+			if used, err = strategies.replace(strategy, existing, filename, stat); err != nil && o.ignorePerm && errors.Is(err, fs.ErrPermission) {
+				if err := o.permissionDenied(filename, err); err != nil {
+					return err
+				}
+				continue
+			} else if err != nil {
+				return err
+			}
+		} else if err := os.Remove(filename); err != nil && o.ignorePerm && errors.Is(err, fs.ErrPermission) {
+			if err := o.permissionDenied(filename, err); err != nil {
+				return err
+			}
+			continue
+		} else if vanished(filename, err) {
+			if err := o.skippedVanished(filename, existing); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("remove %q: %w", filename, err)
+		} else if err := os.Symlink(existing, filename); err != nil {
 			return fmt.Errorf("symlink %q -> %q: %w", filename, existing, err)
 		}
+		summary.Linked++
+		summary.BytesSaved += stat.Size()
+		summary.DiskBytesSaved += DiskUsage(stat)
+		if o.shadow == nil {
+			summary.InodesUsed += inodesUsed(used, hardlinked)
+		}
+		group.links++
+		if o.report != nil {
+			o.report.linked(filename, existing, stat.Size())
+		}
+		_, span := o.tracer.Start(ctx, "fsdedupe.link", trace.WithTimestamp(linkStart))
+		endSpan(span, nil,
+			attribute.String("fsdedupe.path", filename),
+			attribute.String("fsdedupe.target", existing),
+			attribute.Int64("fsdedupe.bytes", stat.Size()),
+			attribute.String("fsdedupe.strategy", used.String()),
+		)
+
+		if o.onLinked != nil {
+			if err := o.onLinked(filename, existing); err != nil {
+				return fmt.Errorf("on linked %q: %w", filename, err)
+			}
+		}
 	}
 
+	// input may be cut short by cancellation just as well
+	if ctx.Err() != nil {
+		return interrupted(pending...)
+	}
+
+	for _, key := range mediaKeys {
+		m := byMedia[key]
+		if len(m.filenames) < 2 {
+			continue
+		}
+		if err := o.onMediaGroup(MediaGroup{Key: key, Filenames: m.filenames}); err != nil {
+			return fmt.Errorf("on media group for %q: %w", m.filenames[0], err)
+		}
+	}
+
+	for _, group := range groups {
+		if err := finalize(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// permissionDenied accounts a file skipped due to permission error.
+func (o *options) permissionDenied(filename string, err error) error {
+	o.logger.Printf("skipping %q: %s", filename, err)
+	o.summary.PermissionDenied++
+	if err := o.skipped(filename, SkipPermission, err.Error()); err != nil {
+		return err
+	}
+
+	if o.onPermDenied != nil {
+		if err := o.onPermDenied(filename, err); err != nil {
+			return fmt.Errorf("on permission denied %q: %w", filename, err)
+		}
+	}
 	return nil
 }
 
-func hashContents(d hash.Hash, filename string) (string, error) {
+type mediaGroup struct {
+	hashes    map[string]struct{}
+	filenames []string
+}
+
+type dupeGroup struct {
+	hash      string
+	canonical string
+	size      int64
+	count     int
+	links     int      // duplicates linked to the current canonical file
+	files     []string // all files of the group, in input order, only tracked for WithOnGroup
+}
+
+// fileOverhead is a rough memory overhead of a group file (string header).
+const fileOverhead = 16
+
+// memory roughly estimates memory consumed by group in index.
+func (g *dupeGroup) memory() int64 {
+	const overhead = 128 // struct, pointers, map bucket share
+	n := int64(len(g.hash)+len(g.canonical)) + overhead
+	for _, filename := range g.files {
+		n += int64(len(filename)) + fileOverhead
+	}
+	return n
+}
+
+func (g *dupeGroup) checkpointEntry() CheckpointEntry {
+	return CheckpointEntry{
+		Hash:      g.hash,
+		Canonical: g.canonical,
+		Size:      g.size,
+		Count:     g.count,
+		Links:     g.links,
+	}
+}
+
+func (g *dupeGroup) alert() Alert {
+	return Alert{
+		Hash:      g.hash,
+		Canonical: g.canonical,
+		Count:     g.count,
+		Size:      g.size,
+		TotalSize: g.size * int64(g.count),
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// alreadyDeduped returns duplicate or canonical filename, if it is a symlink to the same file as the other one
+// (duplicateStat following symlinks, canonicalStat not), empty string otherwise.
+func alreadyDeduped(duplicate string, duplicateStat os.FileInfo, canonical string, canonicalStat os.FileInfo) (string, error) {
+	canonicalSymlink := canonicalStat.Mode()&fs.ModeSymlink != 0
+	if canonicalSymlink {
+		var err error
+		if canonicalStat, err = os.Stat(canonical); err != nil {
+			return "", fmt.Errorf("stat %q: %w", canonical, err)
+		}
+	}
+	if !os.SameFile(canonicalStat, duplicateStat) {
+		return "", nil
+	}
+
+	stat, err := os.Lstat(duplicate)
+	if err != nil {
+		return "", fmt.Errorf("lstat %q: %w", duplicate, err)
+	}
+	switch {
+	case stat.Mode()&fs.ModeSymlink != 0:
+		return duplicate, nil
+	case canonicalSymlink:
+		return canonical, nil
+	default:
+		return "", nil // hardlinks
+	}
+}
+
+type sliceIterator struct {
+	entries []string
+}
+
+// Slice is an Iterator-adapter for a slice of filenames.
+func Slice(filenames []string) Iterator {
+	return &sliceIterator{
+		entries: filenames,
+	}
+}
+
+func (i *sliceIterator) Next() (string, error) {
+	if len(i.entries) == 0 {
+		return "", io.EOF
+	}
+
+	head := i.entries[0]
+	i.entries = i.entries[1:]
+	return head, nil
+}
+
+// groupBySize drains filenames and groups them by size (see planner.SizeBuckets).
+func groupBySize(ctx context.Context, filenames Iterator, o *options) ([]planner.Bucket, error) {
+	var files []planner.File
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		filename, err := filenames.Next()
+		var walkSkip *WalkSkipError
+		if errors.Is(err, io.EOF) {
+			break
+		} else if errors.As(err, &walkSkip) {
+			o.logger.Printf("skipping %q: %s", walkSkip.Dir, walkSkip.Detail)
+			if err := o.skipped(walkSkip.Dir, walkSkip.Reason, walkSkip.Detail); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, iteratorError(err)
+		}
+
+		stat, err := statInput(filename)
+		var skipErr *skipError
+		if errors.As(err, &skipErr) {
+			o.logger.Printf("skipping %q: %s", filename, skipErr.detail)
+			if err := o.skipped(filename, skipErr.reason, skipErr.detail); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		files = append(files, planner.File{Name: filename, Size: stat.Size()})
+	}
+
+	return planner.SizeBuckets(files), nil
+}
+
+// orderBySavings drains filenames and groups them by size,
+// ordering groups by potential savings (size * (count-1)) descending.
+// Files with unique sizes (within input and indexed sizes) can't have duplicates and come last,
+// still being hashed and counted (see Summary.Files and WithOnHashed), just like without WithLargestFirst.
+// Input order is kept within groups, so first-seen file remains the canonical one.
+func orderBySavings(ctx context.Context, filenames Iterator, indexed map[int64]struct{}, o *options) (Iterator, error) {
+	buckets, err := groupBySize(ctx, filenames, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var ordered, unique []string
+	for _, b := range planner.OrderBySavings(buckets, indexed) {
+		for _, f := range b.Files {
+			ordered = append(ordered, f.Name)
+		}
+	}
+	for _, b := range buckets {
+		if _, ok := indexed[b.Size]; !ok && len(b.Files) == 1 {
+			unique = append(unique, b.Files[0].Name)
+		}
+	}
+	return &sliceIterator{entries: append(ordered, unique...)}, nil
+}
+
+func hashContents(ctx context.Context, d hash.Hash, filename string, limiter Limiter) (string, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return "", fmt.Errorf("open: %w", err)
 	}
 	defer f.Close()
 
-	if _, err := io.Copy(d, f); err != nil {
+	if _, err := CopyContext(ctx, d, f, limiter); err != nil {
 		return "", fmt.Errorf("copy: %w", err)
 	}
 
@@ -1,10 +1,16 @@
 package fsdedupe_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -38,6 +44,62 @@ func TestLines(t *testing.T) {
 	}
 }
 
+func TestLines_WithMaxLineLength(t *testing.T) {
+	long := "/" + strings.Repeat("d/", 40<<10) + "file.txt" // deeper than bufio.Scanner default
+
+	it := fsdedupe.Lines(strings.NewReader("short.txt\n"+long+"\n"), fsdedupe.WithMaxLineLength(1<<20))
+	for _, expected := range []string{"short.txt", long} {
+		if line, err := it.Next(); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		} else if actual := line; actual != expected {
+			t.Fatalf("expected %d bytes line, got %d bytes", len(expected), len(actual))
+		}
+	}
+	if _, err := it.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+
+	it = fsdedupe.Lines(strings.NewReader("short.txt\n"+long+"\n"), fsdedupe.WithMaxLineLength(1024))
+	if _, err := it.Next(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := it.Next(); !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("expected bufio.ErrTooLong, got: %v", err)
+	} else if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error to mention line 2, got: %s", err)
+	}
+}
+
+func TestLines_WithComments(t *testing.T) {
+	r := strings.NewReader(`
+		# generated by a script
+		first.txt
+		  # indented comment
+		second.txt # not a comment
+	`)
+	it := fsdedupe.Lines(r, fsdedupe.WithComments())
+
+	var actual []string
+	for {
+		line, err := it.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		actual = append(actual, line)
+	}
+	if expected := []string{"first.txt", "second.txt # not a comment"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	if line, err := fsdedupe.Lines(strings.NewReader("#hash.txt\n")).Next(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if actual, expected := line, "#hash.txt"; actual != expected {
+		t.Errorf("expected %q without WithComments, got %q", expected, actual)
+	}
+}
+
 func TestDedupeSymlink(t *testing.T) {
 	tmp := t.TempDir()
 
@@ -61,7 +123,7 @@ func TestDedupeSymlink(t *testing.T) {
 			file4,
 		},
 	}
-	if err := fsdedupe.DedupeSymlink(context.Background(), it); err != nil {
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it); err != nil {
 		t.Fatalf("expected no error, got: %s", err)
 	}
 
@@ -94,8 +156,912 @@ func TestDedupeSymlink(t *testing.T) {
 	}
 }
 
+func TestDedupeSymlink_summary(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "UNIQ")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	var filled fsdedupe.Summary
+	it := &simpleIterator{
+		Entries: []string{
+			file1,
+			file2,
+			file3,
+		},
+	}
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithSummary(&filled))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if filled != summary {
+		t.Errorf("expected WithSummary to be filled with %+v, got %+v", summary, filled)
+	}
+
+	expected := fsdedupe.Summary{
+		Files:      3,
+		Duplicates: 1,
+		Linked:     1,
+		BytesSaved: int64(len("DUPE")),
+	}
+	// disk usage depends on filesystem block size
+	if summary.DiskBytesSaved <= 0 {
+		t.Errorf("expected disk bytes saved to be positive, got %d", summary.DiskBytesSaved)
+	}
+	summary.DiskBytesSaved = 0
+	if actual := summary; actual != expected {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	tmp := t.TempDir()
+
+	canonical := filepath.Join(tmp, "file1.txt")
+	writeFile(t, canonical, "DUPE")
+	dupe := filepath.Join(tmp, "file2.txt")
+	writeFile(t, dupe, "DUPE")
+
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{canonical, dupe}), fsdedupe.WithDryRun())
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if summary.Duplicates != 1 || summary.Linked != 0 {
+		t.Errorf("expected 1 duplicate found, but none linked, got %+v", summary)
+	}
+	if !lstat(t, dupe).Mode().IsRegular() {
+		t.Errorf("expected %q to be kept as is", dupe)
+	}
+}
+
+func TestDedupeSymlink_inodesUsed(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("link counts are not reported on", runtime.GOOS)
+	}
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+	// replacing a hardlinked duplicate does not free its inode
+	if err := os.Link(file3, filepath.Join(tmp, "file3.lnk")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, file2, file3},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.InodesUsed, int64(1); actual != expected {
+		t.Fatalf("expected %d inodes used, got %d", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_checkpoint(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "UNIQ")
+
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "DUPE")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// interrupt right after the first link
+	onLinked := func(filename, target string) error {
+		cancel()
+		return nil
+	}
+
+	var checkpoint fsdedupe.Checkpoint
+	onCheckpoint := func(cp fsdedupe.Checkpoint) error {
+		checkpoint = cp
+		return nil
+	}
+
+	it := &simpleIterator{
+		Entries: []string{
+			file1,
+			file2,
+			file3,
+			file4,
+		},
+	}
+	if _, err := fsdedupe.DedupeSymlink(ctx, it, fsdedupe.WithOnLinked(onLinked), fsdedupe.WithCheckpoint(onCheckpoint)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+
+	if actual, expected := strings.Join(checkpoint.Remaining, ","), file3+","+file4; actual != expected {
+		t.Fatalf("expected remaining %q, got %q", expected, actual)
+	}
+	if actual, expected := len(checkpoint.Index), 1; actual != expected {
+		t.Fatalf("expected %d index entries, got %d", expected, actual)
+	}
+
+	// checkpoint survives serialization
+	var buf bytes.Buffer
+	if err := fsdedupe.WriteCheckpoint(&buf, checkpoint); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	restored, err := fsdedupe.ReadCheckpoint(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	resumed := fsdedupe.Slice(restored.Remaining)
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), resumed, fsdedupe.WithResume(restored)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// file4 -> file1 (canonical file seen before interruption)
+	if focus, actual, expected := file4, readlink(t, file4), file1; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+}
+
+func TestDedupeSymlink_abort(t *testing.T) {
+	tmp := t.TempDir()
+	journal := filepath.Join(tmp, "journal")
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	abort, cancelAbort := context.WithCancel(context.Background())
+	defer cancelAbort()
+
+	// abort (both levels) right before file2 is linked
+	onHashed := func(filename, _ string, _ int64) error {
+		if filename == file2 {
+			cancel()
+			cancelAbort()
+		}
+		return nil
+	}
+
+	var checkpoint fsdedupe.Checkpoint
+	onCheckpoint := func(cp fsdedupe.Checkpoint) error {
+		checkpoint = cp
+		return nil
+	}
+
+	it := fsdedupe.Slice([]string{file1, file2, file3})
+	if _, err := fsdedupe.DedupeSymlink(ctx, it,
+		fsdedupe.WithAbort(abort),
+		fsdedupe.WithJournal(journal),
+		fsdedupe.WithOnHashed(onHashed),
+		fsdedupe.WithCheckpoint(onCheckpoint),
+	); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+
+	// in-flight action is rolled back
+	if !lstat(t, file2).Mode().IsRegular() {
+		t.Fatalf("expected %q to be restored as a regular file", file2)
+	}
+	if actual, expected := strings.Join(checkpoint.Remaining, ","), file2+","+file3; actual != expected {
+		t.Fatalf("expected remaining %q, got %q", expected, actual)
+	}
+
+	// nothing is left to roll back
+	if err := fsdedupe.RollbackJournal(journal); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatalf("readdir %q: %s", tmp, err)
+	}
+	if actual, expected := len(entries), 3; actual != expected {
+		t.Fatalf("expected %d entries (no backups/journal), got %d", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_softCancel(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "DUPE")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var linked []string
+	onLinked := func(filename, target string) error {
+		linked = append(linked, filename)
+		cancel()
+		return nil
+	}
+
+	var checkpoint fsdedupe.Checkpoint
+	onCheckpoint := func(cp fsdedupe.Checkpoint) error {
+		checkpoint = cp
+		return nil
+	}
+
+	it := fsdedupe.Slice([]string{file1, file2, file3, file4})
+	if _, err := fsdedupe.DedupeSymlink(ctx, it,
+		fsdedupe.WithAbort(context.Background()),
+		fsdedupe.WithConcurrency(2),
+		fsdedupe.WithOnLinked(onLinked),
+		fsdedupe.WithCheckpoint(onCheckpoint),
+	); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+
+	// in-flight files are finished, the rest is checkpointed: every file is either linked or remaining
+	if actual, expected := strings.Join(append(linked, checkpoint.Remaining...), ","), strings.Join([]string{file2, file3, file4}, ","); actual != expected {
+		t.Fatalf("expected linked+remaining %q, got %q", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_samePath(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file.txt")
+	writeFile(t, file1, "DUPE")
+
+	// distinct file on case-sensitive volumes, the same one on case-insensitive
+	file2 := filepath.Join(tmp, "FILE.txt")
+	writeFile(t, file2, "DUPE")
+	info, err := fsdedupe.ProbeFS(tmp)
+	if err != nil {
+		t.Fatalf("probe %q: %s", tmp, err)
+	}
+
+	summary := new(fsdedupe.Summary)
+	it := fsdedupe.Slice([]string{file1, file1, file2})
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithSummary(summary)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// the same path listed twice is never linked onto itself
+	if !lstat(t, file1).Mode().IsRegular() {
+		t.Fatalf("expected %q to be kept as is", file1)
+	}
+
+	if info.CaseInsensitive {
+		if actual, expected := summary.Duplicates, 0; actual != expected {
+			t.Fatalf("expected %d duplicates, got %d", expected, actual)
+		}
+	} else {
+		if focus, actual, expected := file2, readlink(t, file2), file1; actual != expected {
+			t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+		}
+	}
+}
+
+func TestDedupeSymlink_repeatedPath(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "real", "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "real", "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	// the same dir under another name
+	alias := filepath.Join(tmp, "alias")
+	if err := os.Symlink(filepath.Join(tmp, "real"), alias); err != nil {
+		t.Fatalf("symlink %q: %s", alias, err)
+	}
+
+	summary := new(fsdedupe.Summary)
+	it := fsdedupe.Slice([]string{
+		file1,
+		file2,
+		filepath.Join(alias, "file1.txt"),
+		file2,
+		filepath.Join(tmp, "real", ".", "file2.txt"),
+		filepath.Join(alias, "file2.txt"),
+	})
+	// all occurrences are hashed before the first one is linked
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithSummary(summary), fsdedupe.WithConcurrency(4)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// canonical file is never linked onto itself
+	if !lstat(t, file1).Mode().IsRegular() {
+		t.Fatalf("expected %q to be kept as is", file1)
+	}
+	if focus, actual, expected := file2, readlink(t, file2), file1; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+	if actual, expected := *summary, (fsdedupe.Summary{Files: 2, Duplicates: 1, Linked: 1, BytesSaved: 4, DiskBytesSaved: summary.DiskBytesSaved}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_alreadyDeduped(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	if err := os.Symlink(file1, file2); err != nil {
+		t.Fatalf("symlink %q: %s", file2, err)
+	}
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	// symlink listed before its target
+	summary := new(fsdedupe.Summary)
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{file2, file1, file3}), fsdedupe.WithSummary(summary)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !lstat(t, file1).Mode().IsRegular() {
+		t.Fatalf("expected %q to be kept as is", file1)
+	}
+	for _, filename := range []string{file2, file3} {
+		if focus, actual, expected := filename, readlink(t, filename), file1; actual != expected {
+			t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+		}
+	}
+	if actual, expected := *summary, (fsdedupe.Summary{Files: 3, Duplicates: 1, Linked: 1, BytesSaved: 4, DiskBytesSaved: summary.DiskBytesSaved, AlreadyDeduped: 1, AlreadyDedupedBytes: 4}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+
+	// re-run finds nothing new
+	summary = new(fsdedupe.Summary)
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{file1, file2, file3}), fsdedupe.WithSummary(summary)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := *summary, (fsdedupe.Summary{Files: 3, AlreadyDeduped: 2, AlreadyDedupedBytes: 8}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_relativePaths(t *testing.T) {
+	tmp := t.TempDir()
+	t.Chdir(tmp)
+
+	file1 := filepath.Join(tmp, "sub", "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "sub", "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	var linked []string
+	summary := new(fsdedupe.Summary)
+	it := fsdedupe.Slice([]string{"./sub/file1.txt", "sub//file2.txt", file1, "sub/../sub/file1.txt"})
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithSummary(summary), fsdedupe.WithOnLinked(func(filename, target string) error {
+		linked = append(linked, filename+" -> "+target)
+		return nil
+	})); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// links resolve from anywhere, reported filenames are canonical
+	if focus, actual, expected := file2, readlink(t, file2), file1; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+	if expected := []string{file2 + " -> " + file1}; !reflect.DeepEqual(linked, expected) {
+		t.Fatalf("expected %q to be linked, got %q", expected, linked)
+	}
+	if actual, expected := summary.Files, 2; actual != expected {
+		t.Fatalf("expected %d files, got %d", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_concurrency(t *testing.T) {
+	tmp := t.TempDir()
+
+	var entries []string
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(tmp, fmt.Sprintf("file%02d.txt", i))
+		writeFile(t, name, fmt.Sprintf("CONTENT%d", i%5))
+		entries = append(entries, name)
+	}
+
+	var summary fsdedupe.Summary
+	it := &simpleIterator{Entries: entries}
+	_, err := fsdedupe.DedupeSymlink(
+		context.Background(),
+		it,
+		fsdedupe.WithConcurrency(8),
+		fsdedupe.WithMaxOpenFiles(2),
+		fsdedupe.WithSummary(&summary),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := summary.Linked, 45; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+
+	// first-seen files remain canonical despite parallel hashing
+	for i, name := range entries[5:] {
+		if focus, actual, expected := name, readlink(t, name), entries[i%5]; actual != expected {
+			t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+		}
+	}
+}
+
+func TestDedupeSymlink_maxIndexMemory(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "UNIQ")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	var summary fsdedupe.Summary
+	it := &simpleIterator{
+		Entries: []string{
+			file1,
+			file2,
+			file3,
+		},
+	}
+
+	// budget for a single index entry only, file1 is evicted by file2
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithMaxIndexMemory(1), fsdedupe.WithSummary(&summary)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := summary.Linked, 0; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+	if stat := lstat(t, file3); !stat.Mode().IsRegular() {
+		t.Errorf("expected %q to be a regular file, but it is not", file3)
+	}
+}
+
+func TestDedupeSymlink_maxLinks(t *testing.T) {
+	tmp := t.TempDir()
+
+	var files []string
+	for i := range 5 {
+		name := filepath.Join(tmp, fmt.Sprintf("file%d.txt", i))
+		writeFile(t, name, "DUPE")
+		files = append(files, name)
+	}
+
+	// 2 links per canonical file: file0 <- file1, file2; file3 (new canonical) <- file4
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice(files), fsdedupe.WithMaxLinks(2))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Linked, 3; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+
+	for i, expected := range []string{"", files[0], files[0], "", files[3]} {
+		target, _ := os.Readlink(files[i])
+		if target != expected {
+			t.Errorf("expected %q to link to %q, got %q", files[i], expected, target)
+		}
+	}
+}
+
+func TestDedupeSymlink_emptyPolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy     fsdedupe.EmptyPolicy
+		files      int
+		duplicates int
+		linked     bool
+	}{
+		{policy: fsdedupe.EmptySkip, files: 0, duplicates: 0, linked: false},
+		{policy: fsdedupe.EmptyLink, files: 2, duplicates: 1, linked: true},
+		{policy: fsdedupe.EmptyReport, files: 2, duplicates: 1, linked: false},
+	} {
+		tmp := t.TempDir()
+
+		file1 := filepath.Join(tmp, "file1.txt")
+		writeFile(t, file1, "")
+
+		file2 := filepath.Join(tmp, "file2.txt")
+		writeFile(t, file2, "")
+
+		var summary fsdedupe.Summary
+		it := &simpleIterator{
+			Entries: []string{
+				file1,
+				file2,
+			},
+		}
+		if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithEmptyPolicy(c.policy), fsdedupe.WithSummary(&summary)); err != nil {
+			t.Fatalf("policy %d: expected no error, got: %s", c.policy, err)
+		}
+
+		if actual, expected := summary.Files, c.files; actual != expected {
+			t.Errorf("policy %d: expected %d files, got %d", c.policy, expected, actual)
+		}
+		if actual, expected := summary.Duplicates, c.duplicates; actual != expected {
+			t.Errorf("policy %d: expected %d duplicates, got %d", c.policy, expected, actual)
+		}
+		if actual, expected := lstat(t, file2).Mode()&os.ModeSymlink != 0, c.linked; actual != expected {
+			t.Errorf("policy %d: expected linked=%t, got %t", c.policy, expected, actual)
+		}
+	}
+}
+
+func TestDedupeSymlink_networkSafe(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	it := &simpleIterator{
+		Entries: []string{
+			file1,
+			file2,
+		},
+	}
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithNetworkSafe()); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// local temp dir supports symlinks, so it's linked as usual
+	if focus, actual, expected := file2, readlink(t, file2), file1; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+}
+
+func TestDedupeSymlink_ignorePermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+	if err := os.Chmod(file2, 0); err != nil {
+		t.Fatalf("chmod %q: %s", file2, err)
+	}
+
+	it := fsdedupe.Slice([]string{file1, file2, file3})
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it); err == nil {
+		t.Fatalf("expected permission error by default, got none")
+	}
+
+	var skipped []string
+	summary := new(fsdedupe.Summary)
+	it = fsdedupe.Slice([]string{file1, file2, file3})
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it,
+		fsdedupe.WithSummary(summary),
+		fsdedupe.WithIgnorePermissionDenied(func(filename string, err error) error {
+			skipped = append(skipped, filename)
+			return nil
+		}),
+	); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := []string{file2}; !reflect.DeepEqual(skipped, expected) {
+		t.Fatalf("expected %q to be skipped, got %q", expected, skipped)
+	}
+	if actual, expected := summary.PermissionDenied, 1; actual != expected {
+		t.Fatalf("expected %d permission denied, got %d", expected, actual)
+	}
+	if focus, actual, expected := file3, readlink(t, file3), file1; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+}
+
+func TestDedupeSymlink_onLinked(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "UNIQ")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	var linked []string
+	onLinked := func(filename, target string) error {
+		linked = append(linked, filename+" -> "+target)
+		return nil
+	}
+
+	it := &simpleIterator{
+		Entries: []string{
+			file1,
+			file2,
+			file3,
+		},
+	}
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithOnLinked(onLinked)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := strings.Join(linked, ","), file3+" -> "+file1; actual != expected {
+		t.Errorf("expected linked %q, got %q", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_largestFirst(t *testing.T) {
+	tmp := t.TempDir()
+
+	small1 := filepath.Join(tmp, "small1.txt")
+	writeFile(t, small1, "S")
+
+	large1 := filepath.Join(tmp, "large1.txt")
+	writeFile(t, large1, "LARGE")
+
+	small2 := filepath.Join(tmp, "small2.txt")
+	writeFile(t, small2, "S")
+
+	large2 := filepath.Join(tmp, "large2.txt")
+	writeFile(t, large2, "LARGE")
+
+	uniq := filepath.Join(tmp, "uniq.txt")
+	writeFile(t, uniq, "UNIQUE")
+
+	var linked []string
+	onLinked := func(filename, target string) error {
+		linked = append(linked, filename)
+		return nil
+	}
+
+	it := &simpleIterator{
+		Entries: []string{
+			small1,
+			large1,
+			small2,
+			large2,
+			uniq,
+		},
+	}
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithLargestFirst(), fsdedupe.WithOnLinked(onLinked)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// bigger savings are processed first
+	if actual, expected := strings.Join(linked, ","), large2+","+small2; actual != expected {
+		t.Errorf("expected linked %q, got %q", expected, actual)
+	}
+
+	// first-seen files stay canonical, even if processed in different order
+	if focus, actual, expected := large2, readlink(t, large2), large1; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+	if focus, actual, expected := small2, readlink(t, small2), small1; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+
+	// unique-size file is kept as is
+	stat, err := os.Lstat(uniq)
+	if err != nil {
+		t.Fatalf("stat %q: %s", uniq, err)
+	}
+	if !stat.Mode().IsRegular() {
+		t.Errorf("expected %q to be a regular file, but it is not", uniq)
+	}
+}
+
+func TestDedupeSymlink_largestFirst_summary(t *testing.T) {
+	run := func(t *testing.T, opts ...fsdedupe.Option) (fsdedupe.Summary, map[string]string) {
+		t.Helper()
+		tmp := t.TempDir()
+
+		var filenames []string
+		for _, f := range []struct{ name, contents string }{
+			{"small1.txt", "S"},
+			{"large1.txt", "LARGE"},
+			{"small2.txt", "S"},
+			{"uniq1.txt", "UNIQUE"},
+			{"large2.txt", "LARGE"},
+			{"uniq2.txt", "UNIQUE-TOO"},
+		} {
+			filename := filepath.Join(tmp, f.name)
+			writeFile(t, filename, f.contents)
+			filenames = append(filenames, filename)
+		}
+
+		hashed := make(map[string]string) // base name -> hash
+		onHashed := func(filename, hash string, _ int64) error {
+			hashed[filepath.Base(filename)] = hash
+			return nil
+		}
+		summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice(filenames), append(opts, fsdedupe.WithOnHashed(onHashed))...)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		return summary, hashed
+	}
+
+	expectedSummary, expectedHashed := run(t)
+	if actual, expected := expectedSummary.Files, 6; actual != expected {
+		t.Fatalf("expected %d files, got %d", expected, actual)
+	}
+
+	// unique-size files are counted and reported as hashed too
+	summary, hashed := run(t, fsdedupe.WithLargestFirst())
+	if actual, expected := summary, expectedSummary; actual != expected {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+	if actual, expected := hashed, expectedHashed; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected hashed %v, got %v", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_alerts(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "UNIQ")
+
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "DUPE")
+
+	var alerts []fsdedupe.Alert
+	onAlert := func(a fsdedupe.Alert) error {
+		alerts = append(alerts, a)
+		return nil
+	}
+	policy := fsdedupe.AlertPolicy{MaxCount: 2}
+
+	it := &simpleIterator{
+		Entries: []string{
+			file1,
+			file2,
+			file3,
+			file4,
+		},
+	}
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithAlerts(policy, onAlert)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := len(alerts), 1; actual != expected {
+		t.Fatalf("expected %d alerts, got %d", expected, actual)
+	}
+	alert := alerts[0]
+	if actual, expected := alert.Canonical, file1; actual != expected {
+		t.Errorf("expected alert for %q, got %q", expected, actual)
+	}
+	if actual, expected := alert.Count, 3; actual != expected {
+		t.Errorf("expected alert count %d, got %d", expected, actual)
+	}
+	if actual, expected := alert.TotalSize, int64(3*len("DUPE")); actual != expected {
+		t.Errorf("expected alert total size %d, got %d", expected, actual)
+	}
+}
+
 // ----------------------------------------------------------------------------
 
+func TestDedupeSymlink_onHashed(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	var hashed []string
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{file1, file2}),
+		fsdedupe.WithOnHashed(func(filename, hash string, size int64) error {
+			if size != 4 {
+				t.Errorf("expected size 4 of %q, got %d", filename, size)
+			}
+			if len(hash) != 128 {
+				t.Errorf("expected SHA512 hex hash of %q, got %q", filename, hash)
+			}
+			hashed = append(hashed, filename)
+			return nil
+		}),
+	); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := []string{file1, file2}; !reflect.DeepEqual(hashed, expected) {
+		t.Fatalf("expected %q, got %q", expected, hashed)
+	}
+}
+
+func TestDedupeSymlink_iteratorError(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	errBroken := errors.New("broken input")
+	long := "/" + strings.Repeat("x", 2048)
+
+	for _, tc := range []struct {
+		name     string
+		it       func() fsdedupe.Iterator
+		opts     []fsdedupe.Option
+		cause    error
+		expected int // line
+	}{
+		{
+			name:  "iterator",
+			it:    func() fsdedupe.Iterator { return &failingIterator{Entries: []string{file1}, Err: errBroken} },
+			cause: errBroken,
+		},
+		{
+			name: "lines",
+			it: func() fsdedupe.Iterator {
+				return fsdedupe.Lines(strings.NewReader(file1+"\n"+long+"\n"), fsdedupe.WithMaxLineLength(1024))
+			},
+			cause:    bufio.ErrTooLong,
+			expected: 2,
+		},
+		{
+			name: "lines, largest first",
+			it: func() fsdedupe.Iterator {
+				return fsdedupe.Lines(strings.NewReader(file1+"\n"+long+"\n"), fsdedupe.WithMaxLineLength(1024))
+			},
+			opts:     []fsdedupe.Option{fsdedupe.WithLargestFirst()},
+			cause:    bufio.ErrTooLong,
+			expected: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fsdedupe.DedupeSymlink(context.Background(), tc.it(), tc.opts...)
+
+			var itErr *fsdedupe.IteratorError
+			if !errors.As(err, &itErr) {
+				t.Fatalf("expected IteratorError, got: %v", err)
+			}
+			if !errors.Is(err, tc.cause) {
+				t.Errorf("expected %q cause, got: %s", tc.cause, err)
+			}
+			if actual := itErr.Line; actual != tc.expected {
+				t.Errorf("expected line %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
 type simpleIterator struct {
 	Entries []string
 }
@@ -110,6 +1076,22 @@ func (i *simpleIterator) Next() (string, error) {
 	return head, nil
 }
 
+// failingIterator returns Entries, then fails with Err.
+type failingIterator struct {
+	Entries []string
+	Err     error
+}
+
+func (i *failingIterator) Next() (string, error) {
+	if len(i.Entries) == 0 {
+		return "", i.Err
+	}
+
+	head := i.Entries[0]
+	i.Entries = i.Entries[1:]
+	return head, nil
+}
+
 func writeFile(t *testing.T, name string, contents string) {
 	dir := filepath.Dir(name)
 	if err := os.MkdirAll(dir, 0700); err != nil {
@@ -139,3 +1121,12 @@ func readlink(t *testing.T, name string) string {
 
 	return target
 }
+
+func lstat(t *testing.T, name string) os.FileInfo {
+	stat, err := os.Lstat(name)
+	if err != nil {
+		t.Fatalf("lstat %q: %s", name, err)
+	}
+
+	return stat
+}
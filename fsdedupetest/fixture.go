@@ -0,0 +1,111 @@
+// Package fsdedupetest generates synthetic file trees with controllable duplication,
+// for benchmarks, tests and bug report reproduction.
+package fsdedupetest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// SizeDistribution defines how file sizes are distributed.
+type SizeDistribution int
+
+const (
+	// Uniform spreads sizes uniformly up to FixtureSpec.MaxSize (default).
+	Uniform SizeDistribution = iota
+	// Zipf makes most files small, with a long tail of big ones, as real-world trees usually are.
+	Zipf
+)
+
+// MinSize is a minimal generated file size: unique files start with a distinct seed, so they (practically) never collide.
+const MinSize = 8
+
+// FixtureSpec describes a tree to generate.
+type FixtureSpec struct {
+	// Files is a number of files.
+	Files int
+	// DupeRatio (0..1) is a ratio of files being duplicates of some previously generated one.
+	DupeRatio float64
+	// Sizes is a size distribution.
+	Sizes SizeDistribution
+	// MaxSize is a max file size, 64KiB by default.
+	MaxSize int64
+	// Dirs is a number of subdirs files are spread over, files are generated right in the root by default.
+	Dirs int
+	// Seed seeds the generator, same spec generates the same tree.
+	Seed int64
+}
+
+// Fixture describes a generated tree.
+type Fixture struct {
+	// Files lists generated files in generation order (so first-seen ones are canonical).
+	Files []string
+	// Duplicates is a number of files having the same content as some previously generated one.
+	Duplicates int
+	// DuplicateBytes is a total size of duplicates.
+	DuplicateBytes int64
+}
+
+// Generate generates a tree according to spec in (existing or not) dir.
+func Generate(dir string, spec FixtureSpec) (Fixture, error) {
+	var fixture Fixture
+
+	maxSize := spec.MaxSize
+	if maxSize == 0 {
+		maxSize = 64 << 10
+	}
+	if maxSize < MinSize {
+		return fixture, fmt.Errorf("max size %d is less than %d", maxSize, MinSize)
+	}
+
+	r := rand.New(rand.NewSource(spec.Seed))
+	var zipf *rand.Zipf
+	if spec.Sizes == Zipf {
+		zipf = rand.NewZipf(r, 1.1, 1, uint64(maxSize-MinSize))
+	}
+	size := func() int64 {
+		if zipf != nil {
+			return MinSize + int64(zipf.Uint64())
+		}
+		return MinSize + r.Int63n(maxSize-MinSize+1)
+	}
+
+	// unique contents are regenerated from their own seeds, so big fixtures don't exhaust memory
+	type unique struct {
+		seed int64
+		size int64
+	}
+	var uniques []unique
+	for i := 0; i < spec.Files; i++ {
+		var u unique
+		if len(uniques) != 0 && r.Float64() < spec.DupeRatio {
+			u = uniques[r.Intn(len(uniques))]
+			fixture.Duplicates++
+			fixture.DuplicateBytes += u.size
+		} else {
+			u = unique{seed: r.Int63(), size: size()}
+			uniques = append(uniques, u)
+		}
+
+		contents := make([]byte, u.size)
+		rand.New(rand.NewSource(u.seed)).Read(contents)
+		binary.BigEndian.PutUint64(contents, uint64(u.seed))
+
+		name := filepath.Join(dir, fmt.Sprintf("file%06d.bin", i))
+		if spec.Dirs > 0 {
+			name = filepath.Join(dir, fmt.Sprintf("dir%03d", r.Intn(spec.Dirs)), fmt.Sprintf("file%06d.bin", i))
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return fixture, fmt.Errorf("mkdir %q: %w", filepath.Dir(name), err)
+		}
+		if err := os.WriteFile(name, contents, 0644); err != nil {
+			return fixture, fmt.Errorf("write %q: %w", name, err)
+		}
+		fixture.Files = append(fixture.Files, name)
+	}
+
+	return fixture, nil
+}
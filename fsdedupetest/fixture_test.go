@@ -0,0 +1,51 @@
+package fsdedupetest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+	"github.com/mxmCherry/fsdedupe/fsdedupetest"
+)
+
+func TestGenerate(t *testing.T) {
+	spec := fsdedupetest.FixtureSpec{
+		Files:     200,
+		DupeRatio: 0.3,
+		Sizes:     fsdedupetest.Zipf,
+		MaxSize:   4096,
+		Dirs:      5,
+		Seed:      1,
+	}
+	fixture, err := fsdedupetest.Generate(t.TempDir(), spec)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(fixture.Files), spec.Files; actual != expected {
+		t.Fatalf("expected %d files, got %d", expected, actual)
+	}
+	if fixture.Duplicates == 0 || fixture.Duplicates == spec.Files {
+		t.Fatalf("expected some duplicates, got %d", fixture.Duplicates)
+	}
+
+	// the same spec generates the same tree
+	again, err := fsdedupetest.Generate(t.TempDir(), spec)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if again.Duplicates != fixture.Duplicates || again.DuplicateBytes != fixture.DuplicateBytes {
+		t.Fatalf("expected %+v, got %+v", fixture, again)
+	}
+
+	// generated duplicates are exactly the ones found
+	summary := new(fsdedupe.Summary)
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice(fixture.Files), fsdedupe.WithSummary(summary)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Duplicates, fixture.Duplicates; actual != expected {
+		t.Fatalf("expected %d duplicates, got %d", expected, actual)
+	}
+	if actual, expected := summary.BytesSaved, fixture.DuplicateBytes; actual != expected {
+		t.Fatalf("expected %d bytes saved, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,151 @@
+package fsdedupe
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gcMarksFile is a GC marks dir file, listing orphan candidates (see WithTwoPhaseGC).
+const gcMarksFile = "gc.marks"
+
+// WithTwoPhaseGC makes GC reap unreferenced contents in two phases:
+// a run only marks newly found orphans (in a marks file in dir, stamped with the run generation and time),
+// and removes ones marked by previous runs, at least grace ago, and still unreferenced.
+// So contents just written by processes not sharing the lock dir (see WithLockDir),
+// and linked right after GC listed links, are not lost.
+func WithTwoPhaseGC(dir string, grace time.Duration) FSOption {
+	return func(s *DedupeFS) {
+		s.gcMarksDir = dir
+		s.gcGrace = grace
+	}
+}
+
+// gcMark is an orphan candidate mark.
+type gcMark struct {
+	generation int64
+	marked     time.Time
+}
+
+// gcMarks are orphan candidates of the previous GC run and the current one.
+// Nil gcMarks (one-phase GC) reap every orphan right away.
+type gcMarks struct {
+	path       string
+	generation int64 // current run
+	now        time.Time
+	grace      time.Duration
+	prev, next map[string]gcMark // by data file path or inline content hash
+}
+
+// loadGCMarks reads marks of the previous GC run, nil if GC is one-phase.
+// Store lock must be held exclusively.
+func (s *DedupeFS) loadGCMarks(now time.Time) (*gcMarks, error) {
+	if s.gcMarksDir == "" {
+		return nil, nil
+	}
+	m := &gcMarks{
+		path:  filepath.Join(s.gcMarksDir, gcMarksFile),
+		now:   now,
+		grace: s.gcGrace,
+		prev:  make(map[string]gcMark),
+		next:  make(map[string]gcMark),
+	}
+
+	f, err := os.Open(m.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		m.generation = 1
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("open gc marks %q: %w", m.path, err)
+	}
+	defer f.Close()
+
+	// "<GENERATION>" header of the last run, then "<GENERATION> <UNIXNANO> <QUOTED KEY>" marks
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read gc marks %q: %w", m.path, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if n == 1 {
+			if m.generation, err = strconv.ParseInt(line, 10, 64); err != nil {
+				return nil, fmt.Errorf("read gc marks %q: malformed generation", m.path)
+			}
+			m.generation++
+			continue
+		}
+		genStr, rest, _ := strings.Cut(line, " ")
+		stampStr, quotedKey, _ := strings.Cut(rest, " ")
+		gen, genErr := strconv.ParseInt(genStr, 10, 64)
+		stamp, stampErr := strconv.ParseInt(stampStr, 10, 64)
+		key, keyErr := strconv.Unquote(quotedKey)
+		if genErr != nil || stampErr != nil || keyErr != nil {
+			return nil, fmt.Errorf("read gc marks %q: malformed line %d", m.path, n)
+		}
+		m.prev[key] = gcMark{generation: gen, marked: time.Unix(0, stamp)}
+	}
+	if m.generation == 0 {
+		m.generation = 1
+	}
+	return m, nil
+}
+
+// reap reports if an orphan is to be removed: if it was marked by a previous run at least grace ago,
+// otherwise it keeps (or gets) marked.
+func (m *gcMarks) reap(key string) bool {
+	if m == nil {
+		return true
+	}
+	mark, ok := m.prev[key]
+	if ok && mark.generation < m.generation && m.now.Sub(mark.marked) >= m.grace {
+		return true
+	}
+	if !ok {
+		mark = gcMark{generation: m.generation, marked: m.now}
+	}
+	m.next[key] = mark
+	return false
+}
+
+// marked returns a number of orphans kept marked.
+func (m *gcMarks) marked() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.next)
+}
+
+// save replaces marks file with the current run marks (previous run marks still unreferenced are carried over).
+func (m *gcMarks) save(dirPerm os.FileMode) error {
+	if m == nil {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d\n", m.generation)
+	for key, mark := range m.next {
+		fmt.Fprintf(&b, "%d %d %q\n", mark.generation, mark.marked.UnixNano(), key)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), dirPerm); err != nil {
+		return fmt.Errorf("ensure dir for %q: %w", m.path, err)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("write %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename %q: %w", tmp, err)
+	}
+	return nil
+}
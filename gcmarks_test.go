@@ -0,0 +1,79 @@
+package fsdedupe_test
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWithTwoPhaseGC(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithTwoPhaseGC(filepath.Join(tmp, "marks"), 0),
+		fsdedupe.WithInlineBlobs(filepath.Join(tmp, "inline"), 4))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	setupDedupeFS_Create(t, subject, "/orphan.txt", "ORPHAN")
+	setupDedupeFS_Create(t, subject, "/relinked.txt", "RELINKED")
+	setupDedupeFS_Create(t, subject, "/tiny.txt", "TINY")
+	for _, name := range []string{"/orphan.txt", "/relinked.txt", "/tiny.txt"} {
+		if err := subject.Remove(name); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+
+	gc := func() fsdedupe.GCReport {
+		t.Helper()
+		report, err := subject.GC()
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		return report
+	}
+
+	if report := gc(); report.Removed != 0 || report.Marked != 3 {
+		t.Fatalf("expected first run to only mark 3 orphans, got %+v", report)
+	}
+
+	// linked between runs, like by a writer not sharing the lock dir
+	relinked := fmt.Sprintf("%x", sha512.Sum512([]byte("RELINKED")))
+	if err := subject.LinkExisting("/relinked.txt", relinked); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if report := gc(); report.Removed != 2 || report.Marked != 0 {
+		t.Errorf("expected second run to reap 2 still unreferenced orphans, got %+v", report)
+	}
+	assertDedupeFSContents(t, subject, "/relinked.txt", "RELINKED")
+	if ok, err := subject.HasContent(fmt.Sprintf("%x", sha512.Sum512([]byte("ORPHAN")))); err != nil || ok {
+		t.Errorf("expected orphan to be reaped, got %v (%v)", ok, err)
+	}
+}
+
+func TestWithTwoPhaseGC_grace(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithTwoPhaseGC(filepath.Join(tmp, "marks"), time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	setupDedupeFS_Create(t, subject, "/orphan.txt", "ORPHAN")
+	if err := subject.Remove("/orphan.txt"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		report, err := subject.GC()
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if report.Removed != 0 || report.Marked != 1 {
+			t.Errorf("expected run %d to keep orphan marked within grace period, got %+v", i, report)
+		}
+	}
+}
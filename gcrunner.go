@@ -0,0 +1,131 @@
+package fsdedupe
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// GCOption configures StartGC.
+type GCOption func(*gcOptions)
+
+type gcOptions struct {
+	jitter       float64
+	limiter      Limiter
+	statsHistory string
+}
+
+// WithGCJitter randomizes every interval between background GC runs by up to ±fraction (0..1) of it,
+// so multiple processes sharing a store don't collect in lockstep.
+func WithGCJitter(fraction float64) GCOption {
+	return func(o *gcOptions) {
+		o.jitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithGCLimiter throttles background GC removals, one limiter token per data file,
+// so reaping a big backlog doesn't saturate disk I/O.
+// The store is locked for a run, so throttling also delays writers.
+func WithGCLimiter(l Limiter) GCOption {
+	return func(o *gcOptions) {
+		o.limiter = l
+	}
+}
+
+// WithStatsHistory appends a store usage snapshot (see DedupeFS.Stats) to a stats history file (see AppendStats)
+// after every background GC run, so long-running processes keep a time series of dedupe savings.
+func WithStatsHistory(path string) GCOption {
+	return func(o *gcOptions) {
+		o.statsHistory = path
+	}
+}
+
+// GCRun is a result of a background GC run.
+type GCRun struct {
+	// Started is when the run started.
+	Started time.Time
+	// Report is the run report (partial if failed).
+	Report GCReport
+	// Err is the run error (or a stats history one, see WithStatsHistory), if any.
+	Err error
+}
+
+// GCRunner is a background GC, started by StartGC.
+type GCRunner struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu   sync.Mutex
+	last *GCRun
+}
+
+// StartGC runs GC every interval (must be positive) in background, until ctx is done or Stop is called.
+// Failed runs don't stop it, see Last.
+func (s *DedupeFS) StartGC(ctx context.Context, interval time.Duration, opts ...GCOption) *GCRunner {
+	o := new(gcOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &GCRunner{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.done)
+
+		timer := time.NewTimer(jittered(interval, o.jitter))
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			run := GCRun{Started: time.Now()}
+			run.Report, run.Err = s.tracedGC(ctx, o.limiter)
+			if ctx.Err() != nil {
+				return // interrupted run is not a result
+			}
+			if o.statsHistory != "" {
+				run.Err = errors.Join(run.Err, s.recordStats(o.statsHistory))
+			}
+			r.mu.Lock()
+			r.last = &run
+			r.mu.Unlock()
+
+			timer.Reset(jittered(interval, o.jitter))
+		}
+	}()
+	return r
+}
+
+// Stop stops background GC, waiting for a running GC (if any) to be interrupted.
+func (r *GCRunner) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Last returns the last completed run, false if there was none yet.
+func (r *GCRunner) Last() (GCRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil {
+		return GCRun{}, false
+	}
+	return *r.last, true
+}
+
+// jittered randomizes d by up to ±fraction of it.
+func jittered(d time.Duration, fraction float64) time.Duration {
+	if fraction == 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
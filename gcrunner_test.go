@@ -0,0 +1,50 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_StartGC(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	setupDedupeFS_Create(t, subject, "file.txt", "DUMMY")
+	setupDedupeFS_Create(t, subject, "other.txt", "OTHER")
+	if err := subject.Remove("other.txt"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	runner := subject.StartGC(context.Background(), 10*time.Millisecond,
+		fsdedupe.WithGCJitter(0.5),
+		fsdedupe.WithGCLimiter(fsdedupe.NewBandwidthLimiter(1000)),
+	)
+	defer runner.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if run, ok := runner.Last(); ok {
+			if run.Err != nil {
+				t.Fatalf("expected no error, got: %s", run.Err)
+			}
+			if actual, expected := run.Report.Removed, 1; actual != expected {
+				t.Errorf("expected %d removed data files, got %d", expected, actual)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected GC to run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	runner.Stop()
+	run, _ := runner.Last()
+	time.Sleep(30 * time.Millisecond)
+	if last, _ := runner.Last(); !last.Started.Equal(run.Started) {
+		t.Errorf("expected no runs after Stop, got one started at %s", last.Started)
+	}
+}
@@ -0,0 +1,133 @@
+package fsdedupe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitOption configures GitFilter.
+type GitOption func(*gitFilter)
+
+// WithUntrackedOnly makes GitFilter skip files tracked by git (listed in the index) too,
+// leaving untracked and ignored ones (build artifacts etc) only.
+// Tracked files are listed with git (has to be in PATH) once per working tree.
+func WithUntrackedOnly() GitOption {
+	return func(f *gitFilter) {
+		f.untrackedOnly = true
+	}
+}
+
+// GitFilter is an Iterator skipping repository internals (.git dirs) of git working trees,
+// so deduplication never touches repository content; filenames outside of working trees are kept.
+// Skipped files are not processed (nor accounted) at all.
+func GitFilter(filenames Iterator, opts ...GitOption) Iterator {
+	f := &gitFilter{
+		filenames: filenames,
+		roots:     make(map[string]string),
+		tracked:   make(map[string]map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+type gitFilter struct {
+	filenames     Iterator
+	untrackedOnly bool
+
+	roots   map[string]string              // dir -> working tree root ("" if none)
+	tracked map[string]map[string]struct{} // working tree root -> tracked filenames (relative, slash-separated)
+}
+
+func (f *gitFilter) Next() (string, error) {
+	for {
+		filename, err := f.filenames.Next()
+		if err != nil {
+			return filename, err
+		}
+		if skip, err := f.skip(filename); err != nil {
+			return "", err
+		} else if !skip {
+			return filename, nil
+		}
+	}
+}
+
+func (f *gitFilter) skip(filename string) (bool, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return false, fmt.Errorf("resolve %q: %w", filename, err)
+	}
+	for _, segment := range strings.Split(abs, string(filepath.Separator)) {
+		if segment == ".git" {
+			return true, nil
+		}
+	}
+	if !f.untrackedOnly {
+		return false, nil
+	}
+
+	root, err := f.root(filepath.Dir(abs))
+	if err != nil || root == "" {
+		return false, err
+	}
+	tracked, ok := f.tracked[root]
+	if !ok {
+		if tracked, err = listTracked(root); err != nil {
+			return false, err
+		}
+		f.tracked[root] = tracked
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return false, fmt.Errorf("resolve %q: %w", filename, err)
+	}
+	_, ok = tracked[filepath.ToSlash(rel)]
+	return ok, nil
+}
+
+// root returns the innermost working tree root dir is within, "" if none.
+func (f *gitFilter) root(dir string) (string, error) {
+	if root, ok := f.roots[dir]; ok {
+		return root, nil
+	}
+
+	var root string
+	if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+		root = dir // .git is a dir or a file (of linked worktrees and submodules)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("lstat %q: %w", filepath.Join(dir, ".git"), err)
+	} else if parent := filepath.Dir(dir); parent != dir {
+		if root, err = f.root(parent); err != nil {
+			return "", err
+		}
+	}
+	f.roots[dir] = root
+	return root, nil
+}
+
+// listTracked lists files of working tree root index.
+func listTracked(root string) (map[string]struct{}, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", root, "ls-files", "-z")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("list tracked files of %q: %w: %s", root, err, strings.TrimSpace(stderr.String()))
+	}
+
+	tracked := make(map[string]struct{})
+	for _, name := range strings.Split(stdout.String(), "\x00") {
+		if name != "" {
+			tracked[name] = struct{}{}
+		}
+	}
+	return tracked, nil
+}
@@ -0,0 +1,43 @@
+package fsdedupe_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestGitFilter(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmp := t.TempDir()
+
+	repo := filepath.Join(tmp, "repo")
+	tracked := filepath.Join(repo, "src", "main.go")
+	writeFile(t, tracked, "DUPE")
+	artifact := filepath.Join(repo, "build", "main.go")
+	writeFile(t, artifact, "DUPE")
+	writeFile(t, filepath.Join(repo, ".gitignore"), "build/\n")
+	outside := filepath.Join(tmp, "outside.txt")
+	writeFile(t, outside, "DUPE")
+	for _, args := range [][]string{{"init", "-q"}, {"add", "src", ".gitignore"}} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %q: %s: %s", args, err, out)
+		}
+	}
+	internal, err := filepath.Glob(filepath.Join(repo, ".git", "*"))
+	if err != nil || len(internal) == 0 {
+		t.Fatalf("expected .git internals, got %q, %v", internal, err)
+	}
+	filenames := append([]string{tracked, artifact, outside}, internal...)
+
+	if actual, expected := drain(t, fsdedupe.GitFilter(fsdedupe.Slice(filenames))), []string{tracked, artifact, outside}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if actual, expected := drain(t, fsdedupe.GitFilter(fsdedupe.Slice(filenames), fsdedupe.WithUntrackedOnly())), []string{artifact, outside}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
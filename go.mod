@@ -1,7 +1,18 @@
 module github.com/mxmCherry/fsdedupe
 
-go 1.20
+go 1.25
 
 require golang.org/x/exp v0.0.0-20230725093048-515e97ebf090
 
 require github.com/google/subcommands v1.2.0
+
+require (
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+)
@@ -0,0 +1,49 @@
+package fsdedupe
+
+import "context"
+
+// DuplicateGroup is a finalized group of same-content files (see WithOnGroup).
+type DuplicateGroup struct {
+	Hash string
+	Size int64
+	// Canonical is a file duplicates are (or are going to be) linked to, the last one with WithMaxLinks.
+	Canonical string
+	// Count is a number of files of the group, including ones of a resumed run (see Checkpoint).
+	Count int
+	// Filenames are files of the group seen by this run, in input order.
+	Filenames []string
+}
+
+// WithOnGroup makes DedupeSymlink (PlanSymlink, ScanGroups) stream duplicate groups (of 2+ files) to fn
+// as soon as no more files can join them: at the end of each size bucket with WithLargestFirst
+// (finalized groups are dropped from the index then, so the index holds the current bucket groups only),
+// when evicted from the index (see WithMaxIndexMemory), or at the end of input otherwise.
+// Memory is still O(number of inputs): every input path is kept to drop repeated ones,
+// and WithLargestFirst reads (and keeps) all the input upfront to group it by size.
+// Groups not yet finalized when a run is interrupted are checkpointed (see WithCheckpoint) instead.
+func WithOnGroup(fn func(DuplicateGroup) error) Option {
+	return func(o *options) {
+		o.onGroup = fn
+	}
+}
+
+// ScanGroups reports (read-only) duplicate groups to fn (see WithOnGroup) without touching any files
+// and without collecting link replacements (unlike PlanSymlink), so report-only scans of enormous inputs
+// keep no per-duplicate state beyond the groups being reported (see WithOnGroup for memory use).
+// DedupeSymlink options are honored, though WithOnLinked callback is never called.
+func ScanGroups(ctx context.Context, filenames Iterator, fn func(DuplicateGroup) error, opts ...Option) (Summary, error) {
+	opts = append(opts[:len(opts):len(opts)], WithOnGroup(fn), func(o *options) {
+		o.scanOnly = true
+	})
+	return DedupeSymlink(ctx, filenames, opts...)
+}
+
+func (g *dupeGroup) duplicateGroup() DuplicateGroup {
+	return DuplicateGroup{
+		Hash:      g.hash,
+		Size:      g.size,
+		Canonical: g.canonical,
+		Count:     g.count,
+		Filenames: g.files,
+	}
+}
@@ -0,0 +1,77 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestScanGroups(t *testing.T) {
+	tmp := t.TempDir()
+
+	small1 := filepath.Join(tmp, "small1.txt")
+	writeFile(t, small1, "DUPE")
+	large1 := filepath.Join(tmp, "large1.txt")
+	writeFile(t, large1, "LARGE DUPE")
+	small2 := filepath.Join(tmp, "small2.txt")
+	writeFile(t, small2, "DUPE")
+	large2 := filepath.Join(tmp, "large2.txt")
+	writeFile(t, large2, "LARGE DUPE")
+	unique := filepath.Join(tmp, "unique.txt")
+	writeFile(t, unique, "UNIQ")
+
+	// groups are streamed as soon as their size bucket ends, not at the end of input
+	var events []string
+	summary, err := fsdedupe.ScanGroups(context.Background(), fsdedupe.Slice([]string{small1, large1, small2, large2, unique}),
+		func(g fsdedupe.DuplicateGroup) error {
+			events = append(events, "group "+filepath.Base(g.Canonical))
+			if actual, expected := g.Count, len(g.Filenames); actual != expected {
+				t.Errorf("expected %d files, got %d", expected, actual)
+			}
+			return nil
+		},
+		fsdedupe.WithLargestFirst(),
+		fsdedupe.WithOnHashed(func(filename, _ string, _ int64) error {
+			events = append(events, "hashed "+filepath.Base(filename))
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := events, []string{
+		"hashed large1.txt", "hashed large2.txt", "group large1.txt",
+		"hashed small1.txt", "hashed small2.txt", "hashed unique.txt", "group small1.txt",
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+	if actual, expected := summary, (fsdedupe.Summary{Files: 5, Duplicates: 2}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	for _, filename := range []string{small2, large2} {
+		if !lstat(t, filename).Mode().IsRegular() {
+			t.Errorf("expected %q to be kept as is", filename)
+		}
+	}
+
+	// without WithLargestFirst, groups are streamed at the end of input
+	var groups []fsdedupe.DuplicateGroup
+	if _, err := fsdedupe.ScanGroups(context.Background(), fsdedupe.Slice([]string{small1, large1, small2, large2, unique}), func(g fsdedupe.DuplicateGroup) error {
+		groups = append(groups, g)
+		return nil
+	}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(groups), 2; actual != expected {
+		t.Fatalf("expected %d groups, got %+v", expected, groups)
+	}
+	if actual, expected := groups[0].Filenames, []string{small1, small2}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+	if actual, expected := groups[1].Size, int64(10); actual != expected {
+		t.Fatalf("expected size %d, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,133 @@
+package fsdedupe
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+)
+
+// ServeHTTP serves files (GET/HEAD, request path being a link name)
+// with Content-Type from Stat (no extra read of contents) and version ETag (see Version),
+// supporting range and conditional requests.
+func (s *DedupeFS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, err := s.Stat(r.URL.Path)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	version, err := s.Version(r.URL.Path)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	_, absLinkName, err := s.resolve(r.URL.Path)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	f, err := s.openLink(absLinkName)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("ETag", strconv.Quote(version))
+	http.ServeContent(w, r, absLinkName, info.ModTime, f)
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.Is(err, ErrPathEscapes), errors.Is(err, ErrInvalidLinkName):
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// ContentHashHeader is a request header of UploadHandler requests, carrying a content hash (see ParseHash).
+const ContentHashHeader = "X-Content-Hash"
+
+// UploadHandler returns a handler of uploads (PUT, request path being a link name), negotiating hash-before-write,
+// so contents the store already has are never transferred:
+// a HEAD request with ContentHashHeader is answered 200 if such contents are stored (see HasContent), 404 otherwise;
+// a PUT with ContentHashHeader of stored contents links them (see LinkExisting) without reading the request body
+// (so clients sending "Expect: 100-continue" don't send it at all), otherwise the body is stored, verified against the hash.
+// Existing files are replaced, unless "If-None-Match: *" is sent (412 then); uploads are answered 201 with version ETag.
+// Unlike ServeHTTP, it modifies the store, so it must only be exposed to trusted clients.
+func (s *DedupeFS) UploadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash := r.Header.Get(ContentHashHeader)
+		switch r.Method {
+		case http.MethodHead:
+			if hash == "" {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			ok, err := s.HasContent(hash)
+			if err != nil {
+				uploadError(w, err)
+			} else if !ok {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+		case http.MethodPut:
+			overwrite := OverwriteReplace
+			if r.Header.Get("If-None-Match") == "*" {
+				overwrite = OverwriteError
+			}
+			opts := []CreateOption{WithOverwrite(overwrite)}
+
+			if hash != "" {
+				err := s.LinkExisting(r.URL.Path, hash, opts...)
+				if err == nil {
+					version, err := s.Version(r.URL.Path)
+					if err != nil {
+						uploadError(w, err)
+						return
+					}
+					w.Header().Set("ETag", strconv.Quote(version))
+					w.WriteHeader(http.StatusCreated)
+					return
+				} else if !errors.Is(err, fs.ErrNotExist) {
+					uploadError(w, err)
+					return
+				}
+				opts = append(opts, WithExpectedHash(hash))
+			}
+
+			version, err := s.WriteFile(r.URL.Path, r.Body, opts...)
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+			w.Header().Set("ETag", strconv.Quote(version))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.Header().Set("Allow", "HEAD, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func uploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrHashMismatch), errors.Is(err, ErrInvalidHash):
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	case errors.Is(err, fs.ErrExist):
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	default:
+		httpError(w, err)
+	}
+}
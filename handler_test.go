@@ -0,0 +1,132 @@
+package fsdedupe_test
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_ServeHTTP(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, subject, "sub/page.html", "<!DOCTYPE html><html></html>")
+
+	srv := httptest.NewServer(subject)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/sub/page.html")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := resp.StatusCode, http.StatusOK; actual != expected {
+		t.Fatalf("expected status %d, got %d", expected, actual)
+	}
+	if actual, expected := string(body), "<!DOCTYPE html><html></html>"; actual != expected {
+		t.Errorf("expected body %q, got %q", expected, actual)
+	}
+	if actual, expected := resp.Header.Get("Content-Type"), "text/html; charset=utf-8"; actual != expected {
+		t.Errorf("expected Content-Type %q, got %q", expected, actual)
+	}
+	if resp.Header.Get("ETag") == "" {
+		t.Errorf("expected ETag to be set")
+	}
+
+	// conditional request
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/sub/page.html", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	notModified, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	notModified.Body.Close()
+	if actual, expected := notModified.StatusCode, http.StatusNotModified; actual != expected {
+		t.Errorf("expected status %d, got %d", expected, actual)
+	}
+
+	missing, err := http.Get(srv.URL + "/missing.html")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	missing.Body.Close()
+	if actual, expected := missing.StatusCode, http.StatusNotFound; actual != expected {
+		t.Errorf("expected status %d, got %d", expected, actual)
+	}
+}
+
+func TestDedupeFS_UploadHandler(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, subject, "/stored.txt", "STORED")
+
+	srv := httptest.NewServer(subject.UploadHandler())
+	defer srv.Close()
+
+	do := func(method, path, hash, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if hash != "" {
+			req.Header.Set(fsdedupe.ContentHashHeader, hash)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	stored := fmt.Sprintf("%x", sha512.Sum512([]byte("STORED")))
+	fresh := fmt.Sprintf("%x", sha512.Sum512([]byte("FRESH")))
+	never := fmt.Sprintf("%x", sha512.Sum512([]byte("NEVER")))
+
+	for _, tc := range []struct {
+		method, path, hash, body string
+		status                   int
+	}{
+		{http.MethodHead, "/", stored, "", http.StatusOK},
+		{http.MethodHead, "/", fresh, "", http.StatusNotFound},
+		{http.MethodPut, "/linked.txt", stored, "", http.StatusCreated}, // no body needed
+		{http.MethodPut, "/fresh.txt", fresh, "FRESH", http.StatusCreated},
+		{http.MethodPut, "/bad.txt", never, "TAMPERED", http.StatusBadRequest},
+		{http.MethodPut, "/plain.txt", "", "PLAIN", http.StatusCreated},
+		{http.MethodGet, "/plain.txt", "", "", http.StatusMethodNotAllowed},
+	} {
+		if actual := do(tc.method, tc.path, tc.hash, tc.body).StatusCode; actual != tc.status {
+			t.Errorf("expected %s %s status %d, got %d", tc.method, tc.path, tc.status, actual)
+		}
+	}
+	assertDedupeFSContents(t, subject, "/linked.txt", "STORED")
+	assertDedupeFSContents(t, subject, "/fresh.txt", "FRESH")
+	assertDedupeFSContents(t, subject, "/plain.txt", "PLAIN")
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/plain.txt", strings.NewReader("AGAIN"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	req.Header.Set("If-None-Match", "*")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	resp.Body.Close()
+	if actual, expected := resp.StatusCode, http.StatusPreconditionFailed; actual != expected {
+		t.Errorf("expected status %d, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,70 @@
+package fsdedupe
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// HashAlgorithm is a name of content hash algorithm, used for DedupeFS data file names.
+const HashAlgorithm = "sha512"
+
+// DataFileExt is an extension of DedupeFS data file names.
+const DataFileExt = ".bin"
+
+// StoreLayoutVersion is a version of DedupeFS dirs layout: flat "<HASH>.bin" data files
+// (with ".hints" sidecars, optionally spread over tiers) and absolute symlinks to them in link dir.
+const StoreLayoutVersion = 1
+
+// ErrInvalidHash is returned for strings that are not (optionally algorithm-prefixed) hex-encoded SHA-512 hashes.
+var ErrInvalidHash = errors.New("invalid hash")
+
+// ParseHash parses a hex-encoded content hash, optionally prefixed with algorithm ("sha512:<HEX>"),
+// into the form used in DedupeFS data file names (lowercase hex, no prefix).
+func ParseHash(s string) (string, error) {
+	hash := s
+	if algo, rest, ok := strings.Cut(s, ":"); ok {
+		if !strings.EqualFold(algo, HashAlgorithm) {
+			return "", fmt.Errorf("parse hash %q: unsupported algorithm %q: %w", s, algo, ErrInvalidHash)
+		}
+		hash = rest
+	}
+	hash = strings.ToLower(hash)
+	if !validHash(hash) {
+		return "", fmt.Errorf("parse hash %q: %w", s, ErrInvalidHash)
+	}
+	return hash, nil
+}
+
+// FormatHash returns an algorithm-prefixed content hash ("sha512:<HEX>").
+func FormatHash(hash string) string {
+	return HashAlgorithm + ":" + hash
+}
+
+// DataNameFromHash returns a data file name (relative to data dir) of a content hash,
+// which may be algorithm-prefixed (see ParseHash).
+func DataNameFromHash(hash string) (string, error) {
+	hash, err := ParseHash(hash)
+	if err != nil {
+		return "", err
+	}
+	return hash + DataFileExt, nil
+}
+
+// HashFromDataName returns a content hash of a data file name or path (or a link target pointing to one),
+// false if it's not a data file name.
+func HashFromDataName(name string) (string, bool) {
+	hash, ok := strings.CutSuffix(filepath.Base(name), DataFileExt)
+	if !ok || !validHash(hash) {
+		return "", false
+	}
+	return hash, true
+}
+
+// validHash reports if s is a hex-encoded SHA-512 hash.
+func validHash(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 2*64
+}
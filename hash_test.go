@@ -0,0 +1,80 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+const testHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+
+func TestParseHash(t *testing.T) {
+	for _, input := range []string{
+		testHash,
+		strings.ToUpper(testHash),
+		"sha512:" + testHash,
+		"SHA512:" + testHash,
+		fsdedupe.FormatHash(testHash),
+	} {
+		actual, err := fsdedupe.ParseHash(input)
+		if err != nil {
+			t.Errorf("expected no error for %q, got: %s", input, err)
+		} else if actual != testHash {
+			t.Errorf("expected %q for %q, got %q", testHash, input, actual)
+		}
+	}
+
+	for _, input := range []string{
+		"",
+		"DUMMY",
+		testHash[1:],
+		"md5:" + testHash,
+		testHash + ".bin",
+	} {
+		if _, err := fsdedupe.ParseHash(input); !errors.Is(err, fsdedupe.ErrInvalidHash) {
+			t.Errorf("expected ErrInvalidHash for %q, got: %v", input, err)
+		}
+	}
+}
+
+func TestDataNameFromHash(t *testing.T) {
+	name, err := fsdedupe.DataNameFromHash("sha512:" + testHash)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := testHash + ".bin"; name != expected {
+		t.Errorf("expected %q, got %q", expected, name)
+	}
+
+	if _, err := fsdedupe.DataNameFromHash("DUMMY"); !errors.Is(err, fsdedupe.ErrInvalidHash) {
+		t.Errorf("expected ErrInvalidHash, got: %v", err)
+	}
+}
+
+func TestHashFromDataName(t *testing.T) {
+	for _, name := range []string{
+		testHash + ".bin",
+		filepath.Join("data", testHash+".bin"),
+	} {
+		hash, ok := fsdedupe.HashFromDataName(name)
+		if !ok {
+			t.Errorf("expected %q to be a data file name", name)
+		} else if hash != testHash {
+			t.Errorf("expected %q for %q, got %q", testHash, name, hash)
+		}
+	}
+
+	for _, name := range []string{
+		testHash,
+		testHash + ".hints",
+		"DUMMY.bin",
+		"store.lock",
+	} {
+		if _, ok := fsdedupe.HashFromDataName(name); ok {
+			t.Errorf("expected %q not to be a data file name", name)
+		}
+	}
+}
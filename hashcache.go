@@ -0,0 +1,117 @@
+package fsdedupe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HashCache remembers content hashes of files (validated by size and mtime),
+// so a file hashed once (see WithHashCache) is not read again, while unchanged,
+// e.g. by a DedupeFS Import of a tree previously deduplicated by DedupeSymlink.
+// It is safe for concurrent use.
+type HashCache struct {
+	mu    sync.Mutex
+	start time.Time
+	files map[string]hashCacheEntry
+}
+
+type hashCacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // UnixNano
+	Hash    string `json:"hash"`
+}
+
+type hashCacheFile struct {
+	Files map[string]hashCacheEntry `json:"files"`
+}
+
+// NewHashCache creates an empty HashCache.
+func NewHashCache() *HashCache {
+	return &HashCache{
+		start: time.Now(),
+		files: make(map[string]hashCacheEntry),
+	}
+}
+
+// ReadHashCache reads HashCache written by WriteTo.
+func ReadHashCache(r io.Reader) (*HashCache, error) {
+	var f hashCacheFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode hash cache: %w", err)
+	}
+	c := NewHashCache()
+	for filename, e := range f.Files {
+		c.files[filename] = e
+	}
+	return c, nil
+}
+
+// WriteTo writes HashCache as JSON.
+func (c *HashCache) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	b, err := json.Marshal(hashCacheFile{Files: c.files})
+	c.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("encode hash cache: %w", err)
+	}
+	n, err := w.Write(b)
+	if err != nil {
+		return int64(n), fmt.Errorf("write hash cache: %w", err)
+	}
+	return int64(n), nil
+}
+
+// Len returns a number of cached hashes.
+func (c *HashCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.files)
+}
+
+// lookup returns cached filename hash, if file size and mtime are unchanged.
+// Nil HashCache never hits.
+func (c *HashCache) lookup(filename string, size int64, modTime time.Time) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	key, err := filepath.Abs(filename)
+	if err != nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.files[key]
+	if !ok || e.Size != size || e.ModTime != modTime.UnixNano() {
+		return "", false
+	}
+	return e.Hash, true
+}
+
+// store caches filename hash. Nil HashCache is a no-op.
+func (c *HashCache) store(filename string, size int64, modTime time.Time, hash string) {
+	if c == nil {
+		return
+	}
+	key, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// too recently modified files may change again within the same mtime tick (see scanCacheRacyWindow)
+	if c.start.Sub(modTime) <= scanCacheRacyWindow {
+		delete(c.files, key)
+		return
+	}
+	c.files[key] = hashCacheEntry{
+		Size:    size,
+		ModTime: modTime.UnixNano(),
+		Hash:    hash,
+	}
+}
@@ -0,0 +1,77 @@
+package fsdedupe_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestHashCache(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+
+	file1 := filepath.Join(src, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(src, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(src, "file3.txt")
+	writeFile(t, file3, "UNIQ")
+	// freshly modified files are not cached
+	past := time.Now().Add(-time.Hour)
+	for _, filename := range []string{file1, file2, file3} {
+		if err := os.Chtimes(filename, past, past); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+
+	cache := fsdedupe.NewHashCache()
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, file2, file3},
+	}, fsdedupe.WithHashCache(cache)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := cache.Len(), 3; actual != expected {
+		t.Fatalf("expected %d cached hashes, got %d", expected, actual)
+	}
+
+	// round-trip
+	var buf bytes.Buffer
+	if _, err := cache.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	cache, err := fsdedupe.ReadHashCache(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	store := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, store, "/existing.txt", "DUPE")
+
+	limiter := new(countingLimiter)
+	report, err := store.Import(context.Background(), src, "/imported", fsdedupe.WithHashCache(cache), fsdedupe.WithLimiter(limiter))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report, (fsdedupe.CopyReport{Copied: 1, CopiedBytes: 4, Linked: 1, LinkedBytes: 4}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	// only the new file is read (copied), cached ones are not hashed again
+	if actual, expected := limiter.n.Load(), int64(4); actual != expected {
+		t.Fatalf("expected %d bytes read, got %d", expected, actual)
+	}
+}
+
+type countingLimiter struct {
+	n atomic.Int64
+}
+
+func (l *countingLimiter) WaitN(_ context.Context, n int) error {
+	l.n.Add(int64(n))
+	return nil
+}
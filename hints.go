@@ -0,0 +1,141 @@
+package fsdedupe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Common storage hints (see WithHints), any other ones are carried as-is.
+const (
+	// HintLarge marks big files.
+	HintLarge = "large"
+	// HintCold marks rarely accessed files.
+	HintCold = "cold"
+	// HintMedia marks already compressed media (images, audio, video).
+	HintMedia = "media"
+)
+
+const hintsSuffix = ".hints"
+
+// WithHints sets storage hints (e.g. HintLarge, HintCold, HintMedia) of a created file.
+// Hints are stored in a per-data-file sidecar (merged with the ones given for the same content before),
+// so tiering policies (see TierByHint) and maintenance jobs (see Rebalance) can honor them later.
+func WithHints(hints ...string) CreateOption {
+	return func(o *createOptions) {
+		o.hints = append(o.hints, hints...)
+	}
+}
+
+// TierByHint places data files having given hint into given tier.
+func TierByHint(hint string, tier int) TierPolicy {
+	return func(b BlobInfo) int {
+		if slices.Contains(b.Hints, hint) {
+			return tier
+		}
+		return 0
+	}
+}
+
+// Hints returns storage hints of a data file, which given link points to.
+func (s *DedupeFS) Hints(linkName string) ([]string, error) {
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := os.Readlink(absLinkName)
+	if err != nil {
+		return nil, fmt.Errorf("readlink %q: %w", absLinkName, err)
+	}
+	sidecar, err := readSidecar(target)
+	return sidecar.Hints, err
+}
+
+// hintsSidecar is a per-data-file metadata sidecar
+// (named after hints, the first metadata kept there, for compatibility).
+type hintsSidecar struct {
+	Hints []string `json:"hints"`
+	// ContentType is sniffed on Create (see Stat), empty for data files stored before it was tracked.
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// hintsPath returns sidecar path of a data file.
+func hintsPath(dataFile string) string {
+	return strings.TrimSuffix(dataFile, DataFileExt) + hintsSuffix
+}
+
+// readSidecar returns data file metadata, no sidecar means no metadata.
+func readSidecar(dataFile string) (hintsSidecar, error) {
+	var sidecar hintsSidecar
+
+	b, err := os.ReadFile(hintsPath(dataFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return sidecar, nil
+	} else if err != nil {
+		return sidecar, fmt.Errorf("read hints of %q: %w", dataFile, err)
+	}
+
+	if err := json.Unmarshal(b, &sidecar); err != nil {
+		return sidecar, fmt.Errorf("decode hints of %q: %w", dataFile, err)
+	}
+	return sidecar, nil
+}
+
+// mergeSidecar adds hints (and content type, unless already known) to data file sidecar,
+// returning all of its metadata.
+func mergeSidecar(dataFile string, hints []string, contentType string) (hintsSidecar, error) {
+	existing, err := readSidecar(dataFile)
+	if err != nil {
+		return existing, err
+	}
+
+	merged := hintsSidecar{
+		Hints:       slices.Clone(existing.Hints),
+		ContentType: existing.ContentType,
+	}
+	for _, hint := range hints {
+		if !slices.Contains(merged.Hints, hint) {
+			merged.Hints = append(merged.Hints, hint)
+		}
+	}
+	if merged.ContentType == "" {
+		merged.ContentType = contentType
+	}
+	if len(merged.Hints) == len(existing.Hints) && merged.ContentType == existing.ContentType {
+		return existing, nil
+	}
+
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return existing, fmt.Errorf("encode hints of %q: %w", dataFile, err)
+	}
+	path := hintsPath(dataFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return existing, fmt.Errorf("write %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return existing, fmt.Errorf("rename %q: %w", tmp, err)
+	}
+	return merged, nil
+}
+
+// moveHints moves data file sidecar (if any) along with the data file.
+func moveHints(ctx context.Context, from, to string) error {
+	src, dst := hintsPath(from), hintsPath(to)
+	if err := copyFile(ctx, src, dst, nil); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("remove %q: %w", src, err)
+	}
+	return nil
+}
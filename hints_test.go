@@ -0,0 +1,65 @@
+package fsdedupe_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_Hints(t *testing.T) {
+	tmp := t.TempDir()
+	cold := filepath.Join(tmp, "cold")
+
+	subject, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithTiers(fsdedupe.TierByHint(fsdedupe.HintCold, 1), cold),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if _, err := subject.WriteFile("a.txt", strings.NewReader("DUMMY"), fsdedupe.WithHints(fsdedupe.HintCold)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := subject.WriteFile("b.txt", strings.NewReader("DUMMY"), fsdedupe.WithHints(fsdedupe.HintMedia, fsdedupe.HintCold)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual := readlink(t, filepath.Join(tmp, "link", "a.txt")); filepath.Dir(actual) != cold {
+		t.Errorf("expected cold-hinted file to be stored in %q, got %q", cold, actual)
+	}
+
+	// hints are per data file, merged across links
+	for _, name := range []string{"a.txt", "b.txt"} {
+		hints, err := subject.Hints(name)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if actual, expected := hints, []string{fsdedupe.HintCold, fsdedupe.HintMedia}; !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %q hints %q, got %q", name, expected, actual)
+		}
+	}
+
+	// GC removes sidecars along with data files
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := subject.Remove(name); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+	if _, err := subject.GC(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	entries, err := os.ReadDir(cold)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected cold tier to be empty, got %d entries", len(entries))
+	}
+}
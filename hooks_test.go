@@ -0,0 +1,10 @@
+package fsdedupe
+
+import "testing"
+
+// StubRootSquashed makes root squash detection report dirs as squashed by fn, till the test end.
+func StubRootSquashed(t *testing.T, fn func(dir string) bool) {
+	orig := rootSquashed
+	rootSquashed = func(dir string) (bool, error) { return fn(dir), nil }
+	t.Cleanup(func() { rootSquashed = orig })
+}
@@ -0,0 +1,62 @@
+package fsdedupe
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// Identity is a set of file metadata included in duplicate identity along with contents (see WithIdentity),
+// so files differing in it are not duplicates (e.g. when deduplicating system image trees, where mode bits matter).
+// Duplicates are still replaced by links to their canonical files, which have the very same metadata then.
+type Identity int
+
+const (
+	// IdentityExec includes executable bits (of owner, group and others).
+	IdentityExec Identity = 1 << iota
+	// IdentityMode includes all permission bits, including setuid, setgid and sticky ones (implies IdentityExec).
+	IdentityMode
+	// IdentityXattrs includes extended attributes (names and values), read on Linux only.
+	IdentityXattrs
+)
+
+// WithIdentity makes duplicate identity strict: file metadata of identity is included along with contents,
+// none by default.
+func WithIdentity(identity Identity) Option {
+	return func(o *options) {
+		o.identity = identity
+	}
+}
+
+// hashIdentity combines (contents or forks) hash with identity metadata of filename.
+func hashIdentity(d hash.Hash, filename, contentsHash string, stat os.FileInfo, identity Identity) (string, error) {
+	d.Reset()
+	io.WriteString(d, contentsHash)
+
+	switch {
+	case identity&IdentityMode != 0:
+		fmt.Fprintf(d, "\nmode\x00%o", stat.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky))
+	case identity&IdentityExec != 0:
+		fmt.Fprintf(d, "\nexec\x00%o", stat.Mode()&0111)
+	}
+
+	if identity&IdentityXattrs != 0 {
+		xattrs, err := readXattrs(filename)
+		if err != nil {
+			return "", fmt.Errorf("read xattrs: %w", err)
+		}
+		names := make([]string, 0, len(xattrs))
+		for name := range xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(d, "\nxattr %s\x00%x", name, xattrs[name])
+		}
+	}
+
+	return fmt.Sprintf("%x", d.Sum(nil)), nil
+}
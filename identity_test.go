@@ -0,0 +1,60 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWithIdentity(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bits on windows")
+	}
+
+	for _, tc := range []struct {
+		name     string
+		identity fsdedupe.Identity
+		linked   []string
+	}{
+		{name: "contents", identity: 0, linked: []string{"script.sh", "data.txt", "private.txt"}},
+		{name: "exec", identity: fsdedupe.IdentityExec, linked: []string{"data.txt", "private.txt"}},
+		{name: "mode", identity: fsdedupe.IdentityMode, linked: []string{"data.txt"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+
+			canonical := filepath.Join(tmp, "canonical.txt")
+			writeFile(t, canonical, "DUPE")
+			modes := map[string]os.FileMode{"script.sh": 0755, "data.txt": 0644, "private.txt": 0600}
+			filenames := []string{canonical}
+			for _, name := range []string{"script.sh", "data.txt", "private.txt"} {
+				filename := filepath.Join(tmp, name)
+				writeFile(t, filename, "DUPE")
+				if err := os.Chmod(filename, modes[name]); err != nil {
+					t.Fatalf("expected no error, got: %s", err)
+				}
+				filenames = append(filenames, filename)
+			}
+			if err := os.Chmod(canonical, 0644); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+
+			summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice(filenames), fsdedupe.WithIdentity(tc.identity))
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if actual, expected := summary.Linked, len(tc.linked); actual != expected {
+				t.Errorf("expected %d linked, got %d", expected, actual)
+			}
+			for _, name := range tc.linked {
+				if focus, actual, expected := name, readlink(t, filepath.Join(tmp, name)), canonical; actual != expected {
+					t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+				}
+			}
+		})
+	}
+}
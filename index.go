@@ -0,0 +1,277 @@
+package fsdedupe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// IndexEntry is a shared hash index entry: a file on some host.
+type IndexEntry struct {
+	// Hash is a hex-encoded content hash.
+	Hash string `json:"hash"`
+	// Host is a name of the host the file is on.
+	Host string `json:"host"`
+	// Path is an absolute filename on the host.
+	Path string `json:"path"`
+	// Size is a file size.
+	Size int64 `json:"size"`
+}
+
+// IndexReport is a fleet-wide savings report of a shared hash index.
+type IndexReport struct {
+	// Hosts is a number of hosts reported files.
+	Hosts int `json:"hosts"`
+	// Hashes is a number of distinct contents.
+	Hashes int `json:"hashes"`
+	// Files is a number of indexed files.
+	Files int `json:"files"`
+	// Bytes is a total size of indexed files.
+	Bytes int64 `json:"bytes"`
+	// DuplicateBytes is a total size of files having the same content as some other (first-reported) one,
+	// so potential savings of cross-host consolidation.
+	DuplicateBytes int64 `json:"duplicate_bytes"`
+	// CrossHostBytes is a part of DuplicateBytes, which has no same-content file on the same host,
+	// so can't be saved by local deduplication.
+	CrossHostBytes int64 `json:"cross_host_bytes"`
+}
+
+// IndexServer is an in-memory shared hash index, which multiple hosts can query/update over HTTP:
+//
+//	POST /entries       - add (or update) JSON array of IndexEntry, up to 32MiB per request by default
+//	GET  /hashes/{hash} - JSON array of IndexEntry with given hash, first-reported (canonical) first
+//	GET  /report        - IndexReport
+type IndexServer struct {
+	mu     sync.Mutex
+	hashes []string
+	byHash map[string][]IndexEntry
+	byFile map[indexFile]string // host/path -> hash
+	hosts  map[string]struct{}
+
+	maxRequestBytes int64
+
+	mux *http.ServeMux
+}
+
+// IndexServerOption configures IndexServer.
+type IndexServerOption func(*IndexServer)
+
+// WithIndexMaxRequestBytes limits POST /entries request body size (32MiB by default),
+// bigger requests are rejected as 413 Request Entity Too Large.
+func WithIndexMaxRequestBytes(n int64) IndexServerOption {
+	return func(s *IndexServer) {
+		s.maxRequestBytes = n
+	}
+}
+
+// NewIndexServer creates an empty IndexServer.
+func NewIndexServer(opts ...IndexServerOption) *IndexServer {
+	s := &IndexServer{
+		byHash:          make(map[string][]IndexEntry),
+		byFile:          make(map[indexFile]string),
+		hosts:           make(map[string]struct{}),
+		maxRequestBytes: 32 << 20,
+		mux:             http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux.HandleFunc("POST /entries", s.handleAdd)
+	s.mux.HandleFunc("GET /hashes/{hash}", s.handleLookup)
+	s.mux.HandleFunc("GET /report", s.handleReport)
+	return s
+}
+
+func (s *IndexServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Add adds (or updates, if the same host/path is already indexed) entries.
+// A file re-reported with a different hash (changed contents) is moved to the new hash.
+func (s *IndexServer) Add(entries ...IndexEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		s.hosts[entry.Host] = struct{}{}
+
+		file := indexFile{Host: entry.Host, Path: entry.Path}
+		if hash, ok := s.byFile[file]; ok && hash != entry.Hash {
+			s.remove(hash, file)
+		}
+		s.byFile[file] = entry.Hash
+
+		same, ok := s.byHash[entry.Hash]
+		if !ok {
+			s.hashes = append(s.hashes, entry.Hash)
+		}
+
+		found := false
+		for i, e := range same {
+			if e.Host == entry.Host && e.Path == entry.Path {
+				same[i], found = entry, true
+				break
+			}
+		}
+		if !found {
+			s.byHash[entry.Hash] = append(same, entry)
+		}
+	}
+}
+
+// indexFile identifies an indexed file.
+type indexFile struct {
+	Host string
+	Path string
+}
+
+// remove drops a stale file entry from hash bucket, dropping the bucket too, if it's left empty.
+func (s *IndexServer) remove(hash string, file indexFile) {
+	same := slices.DeleteFunc(s.byHash[hash], func(e IndexEntry) bool {
+		return e.Host == file.Host && e.Path == file.Path
+	})
+	if len(same) != 0 {
+		s.byHash[hash] = same
+		return
+	}
+	delete(s.byHash, hash)
+	if i := slices.Index(s.hashes, hash); i >= 0 {
+		s.hashes = slices.Delete(s.hashes, i, i+1)
+	}
+}
+
+// Lookup returns entries with given hash, first-reported (canonical) first.
+func (s *IndexServer) Lookup(hash string) []IndexEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]IndexEntry(nil), s.byHash[hash]...)
+}
+
+// Report builds a fleet-wide savings report.
+func (s *IndexServer) Report() IndexReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := IndexReport{
+		Hosts:  len(s.hosts),
+		Hashes: len(s.hashes),
+	}
+	for _, hash := range s.hashes {
+		seenHosts := make(map[string]struct{})
+		for i, entry := range s.byHash[hash] {
+			report.Files++
+			report.Bytes += entry.Size
+
+			_, seenHost := seenHosts[entry.Host]
+			seenHosts[entry.Host] = struct{}{}
+			if i == 0 {
+				continue
+			}
+			report.DuplicateBytes += entry.Size
+			if !seenHost {
+				report.CrossHostBytes += entry.Size
+			}
+		}
+	}
+	return report
+}
+
+func (s *IndexServer) handleAdd(w http.ResponseWriter, r *http.Request) {
+	var entries []IndexEntry
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxRequestBytes)).Decode(&entries); err != nil {
+		status := http.StatusBadRequest
+		if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("decode: %s", err), status)
+		return
+	}
+	for _, entry := range entries {
+		if entry.Hash == "" || entry.Host == "" || entry.Path == "" {
+			http.Error(w, "hash, host and path are required", http.StatusBadRequest)
+			return
+		}
+	}
+	s.Add(entries...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *IndexServer) handleLookup(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Lookup(r.PathValue("hash")))
+}
+
+func (s *IndexServer) handleReport(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Report())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ----------------------------------------------------------------------------
+
+// IndexClient is an IndexServer client.
+type IndexClient struct {
+	// URL is an IndexServer base URL.
+	URL string
+	// Client is an optional HTTP client, http.DefaultClient is used by default.
+	Client *http.Client
+}
+
+// Add adds (or updates) entries.
+func (c *IndexClient) Add(ctx context.Context, entries []IndexEntry) error {
+	return postJSON(ctx, c.Client, c.endpoint("entries"), entries)
+}
+
+// Lookup returns entries with given hash, first-reported (canonical) first.
+func (c *IndexClient) Lookup(ctx context.Context, hash string) ([]IndexEntry, error) {
+	var entries []IndexEntry
+	if err := getJSON(ctx, c.Client, c.endpoint("hashes/"+url.PathEscape(hash)), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Report returns a fleet-wide savings report.
+func (c *IndexClient) Report(ctx context.Context) (IndexReport, error) {
+	var report IndexReport
+	err := getJSON(ctx, c.Client, c.endpoint("report"), &report)
+	return report, err
+}
+
+func (c *IndexClient) endpoint(path string) string {
+	return strings.TrimSuffix(c.URL, "/") + "/" + path
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("get %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("get %q: unexpected status %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode %q response: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestIndexServer(t *testing.T) {
+	srv := httptest.NewServer(fsdedupe.NewIndexServer())
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := &fsdedupe.IndexClient{URL: srv.URL}
+
+	if err := client.Add(ctx, []fsdedupe.IndexEntry{
+		{Hash: "aaa", Host: "host1", Path: "/a1", Size: 10},
+		{Hash: "aaa", Host: "host1", Path: "/a2", Size: 10},
+		{Hash: "bbb", Host: "host1", Path: "/b1", Size: 5},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := client.Add(ctx, []fsdedupe.IndexEntry{
+		{Hash: "aaa", Host: "host2", Path: "/a1", Size: 10},
+		{Hash: "aaa", Host: "host1", Path: "/a1", Size: 10}, // re-reported
+	}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	entries, err := client.Lookup(ctx, "aaa")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []fsdedupe.IndexEntry{
+		{Hash: "aaa", Host: "host1", Path: "/a1", Size: 10},
+		{Hash: "aaa", Host: "host1", Path: "/a2", Size: 10},
+		{Hash: "aaa", Host: "host2", Path: "/a1", Size: 10},
+	}; !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, entries)
+	}
+
+	report, err := client.Report(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.IndexReport{
+		Hosts:          2,
+		Hashes:         2,
+		Files:          4,
+		Bytes:          35,
+		DuplicateBytes: 20,
+		CrossHostBytes: 10,
+	}); report != expected {
+		t.Fatalf("expected %+v, got %+v", expected, report)
+	}
+
+	if err := client.Add(ctx, []fsdedupe.IndexEntry{{Hash: "ccc"}}); err == nil {
+		t.Fatalf("expected error for incomplete entry, got none")
+	}
+}
+
+func TestIndexServer_changedFile(t *testing.T) {
+	subject := fsdedupe.NewIndexServer()
+	subject.Add(
+		fsdedupe.IndexEntry{Hash: "aaa", Host: "host1", Path: "/a1", Size: 10},
+		fsdedupe.IndexEntry{Hash: "aaa", Host: "host2", Path: "/a1", Size: 10},
+		fsdedupe.IndexEntry{Hash: "bbb", Host: "host1", Path: "/b1", Size: 5},
+	)
+	// contents changed since
+	subject.Add(
+		fsdedupe.IndexEntry{Hash: "ccc", Host: "host2", Path: "/a1", Size: 7},
+		fsdedupe.IndexEntry{Hash: "ccc", Host: "host1", Path: "/b1", Size: 7},
+	)
+
+	if actual, expected := subject.Lookup("aaa"), []fsdedupe.IndexEntry{
+		{Hash: "aaa", Host: "host1", Path: "/a1", Size: 10},
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	if actual := subject.Lookup("bbb"); len(actual) != 0 {
+		t.Fatalf("expected no stale entries, got %+v", actual)
+	}
+
+	if actual, expected := subject.Report(), (fsdedupe.IndexReport{
+		Hosts:          2,
+		Hashes:         2,
+		Files:          3,
+		Bytes:          24,
+		DuplicateBytes: 7,
+		CrossHostBytes: 7,
+	}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestIndexServer_tooLarge(t *testing.T) {
+	srv := httptest.NewServer(fsdedupe.NewIndexServer(fsdedupe.WithIndexMaxRequestBytes(1024)))
+	defer srv.Close()
+
+	body := "[" + strings.Repeat(" ", 1024) + "]"
+	resp, err := http.Post(srv.URL+"/entries", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	resp.Body.Close()
+	if actual, expected := resp.StatusCode, http.StatusRequestEntityTooLarge; actual != expected {
+		t.Fatalf("expected status %d, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,310 @@
+package fsdedupe
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// inlinePackExt is an extension of inline pack files (see WithInlineBlobs).
+const inlinePackExt = ".pack"
+
+// inlineLockFile is a lock dir file, flock-ed exclusively while appending to inline pack files.
+const inlineLockFile = "inline.lock"
+
+// WithInlineBlobs makes DedupeFS keep contents of at most maxSize bytes (like 4KB) inline,
+// in pack files in dir (one per leading hash byte), instead of individual data files,
+// saving inodes and per-file overhead of stores dominated by tiny documents.
+// Links to inline contents point to their would-be data files (so hashes, versions, GC and link index work as usual),
+// which Open, Stat and ServeHTTP (but not readers following links directly) resolve transparently.
+// Inline contents are verified against their hashes on every read and have no hints (see WithHints).
+// All processes sharing DedupeFS dirs must use the same inline dir and max size (or a bigger one),
+// as pack records bigger than maxSize are taken for corruption.
+func WithInlineBlobs(dir string, maxSize int64) FSOption {
+	return func(s *DedupeFS) {
+		s.inlineDir = dir
+		s.inlineMaxSize = maxSize
+	}
+}
+
+// inlines reports if contents of given size are to be kept inline.
+func (s *DedupeFS) inlines(size int64) bool {
+	return s.inlineDir != "" && size <= s.inlineMaxSize
+}
+
+// inlinePackPath returns a pack file path of a content hash.
+func (s *DedupeFS) inlinePackPath(hash string) string {
+	return filepath.Join(s.inlineDir, hash[:2]+inlinePackExt)
+}
+
+// readPack calls fn for every complete record ("<HASH> <SIZE>\n<CONTENTS>\n") of a pack file, until fn returns false,
+// returning the end offset of the last complete record (interrupted appends leave incomplete ones).
+// Missing pack file has no records, records bigger than maxSize are corrupted ones.
+func readPack(path string, maxSize int64, fn func(hash string, contents []byte) bool) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("open pack %q: %w", path, err)
+	}
+	defer f.Close()
+
+	var end int64
+	r := bufio.NewReader(f)
+	for {
+		header, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return end, nil
+		} else if err != nil {
+			return end, fmt.Errorf("read pack %q: %w", path, err)
+		}
+		hash, sizeStr, _ := strings.Cut(strings.TrimSuffix(header, "\n"), " ")
+		size, err := strconv.Atoi(sizeStr)
+		// records are never bigger than inline max size, so a corrupted header never makes a huge allocation
+		if !validHash(hash) || err != nil || size < 0 || int64(size) > maxSize {
+			return end, fmt.Errorf("read pack %q: corrupted record at offset %d", path, end)
+		}
+
+		record := make([]byte, size+1)
+		if _, err := io.ReadFull(r, record); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return end, nil
+		} else if err != nil {
+			return end, fmt.Errorf("read pack %q: %w", path, err)
+		}
+		end += int64(len(header) + len(record))
+		if !fn(hash, record[:size]) {
+			return end, nil
+		}
+	}
+}
+
+// inlineBlob returns inline contents of a content hash, verifying them.
+func (s *DedupeFS) inlineBlob(hash string) ([]byte, bool, error) {
+	if s.inlineDir == "" || !validHash(hash) {
+		return nil, false, nil
+	}
+
+	var contents []byte
+	found := false
+	path := s.inlinePackPath(hash)
+	if _, err := readPack(path, s.inlineMaxSize, func(h string, b []byte) bool {
+		if h == hash {
+			contents, found = b, true
+		}
+		return !found
+	}); err != nil {
+		return nil, false, err
+	}
+	if !found {
+		return nil, false, nil
+	}
+	if actual := fmt.Sprintf("%x", sha512.Sum512(contents)); actual != hash {
+		return nil, false, fmt.Errorf("inline contents of %q in %q: corrupted, hash %q", hash, path, actual)
+	}
+	return contents, true, nil
+}
+
+// storeInline appends temp file contents to its pack file (unless already there), removing temp file.
+// Store lock (see lockStore) must be held.
+func (s *DedupeFS) storeInline(hash, tempFileName string) error {
+	contents, err := os.ReadFile(tempFileName)
+	if err != nil {
+		return fmt.Errorf("read temp file %q: %w", tempFileName, err)
+	}
+
+	unlock, err := s.lockInline()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := s.inlinePackPath(hash)
+	exists := false
+	end, err := readPack(path, s.inlineMaxSize, func(h string, _ []byte) bool {
+		exists = h == hash
+		return !exists
+	})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := appendPack(path, end, hash, contents, s.dirPerm); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(tempFileName); err != nil {
+		return fmt.Errorf("remove temp file %q: %w", tempFileName, err)
+	}
+	return nil
+}
+
+// appendPack writes a record at end offset of a pack file, overwriting an incomplete record left there (if any).
+func appendPack(path string, end int64, hash string, contents []byte, dirPerm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return fmt.Errorf("ensure dir for %q: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open pack %q: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := f.Truncate(end); err != nil {
+		return fmt.Errorf("truncate pack %q: %w", path, err)
+	}
+	record := fmt.Appendf(nil, "%s %d\n", hash, len(contents))
+	record = append(append(record, contents...), '\n')
+	if _, err := f.WriteAt(record, end); err != nil {
+		return fmt.Errorf("append to pack %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close pack %q: %w", path, err)
+	}
+	return nil
+}
+
+// lockInline serializes appends to pack files, in-process and cross-process (see WithLockDir),
+// returning unlock func. Store lock (see lockStore) must be held.
+func (s *DedupeFS) lockInline() (func(), error) {
+	s.locks.inline.Lock()
+	if s.lockDir == "" {
+		return s.locks.inline.Unlock, nil
+	}
+	unlockFile, err := s.lockFile(inlineLockFile, true)
+	if err != nil {
+		s.locks.inline.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		s.locks.inline.Unlock()
+	}, nil
+}
+
+// inlineSizes returns sizes of all inline contents by content hash.
+func (s *DedupeFS) inlineSizes() (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	if s.inlineDir == "" {
+		return sizes, nil
+	}
+	packs, err := s.inlinePacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range packs {
+		if _, err := readPack(path, s.inlineMaxSize, func(hash string, contents []byte) bool {
+			sizes[hash] = int64(len(contents))
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return sizes, nil
+}
+
+// inlinePacks returns pack file paths.
+func (s *DedupeFS) inlinePacks() ([]string, error) {
+	entries, err := os.ReadDir(s.inlineDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read inline dir %q: %w", s.inlineDir, err)
+	}
+	var packs []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), inlinePackExt) {
+			packs = append(packs, filepath.Join(s.inlineDir, entry.Name()))
+		}
+	}
+	return packs, nil
+}
+
+// gcInline rewrites pack files without unreferenced (and not pinned) contents, updating GC report.
+// Store lock must be held exclusively.
+func (s *DedupeFS) gcInline(referenced map[string]struct{}, report *GCReport) error {
+	packs, err := s.inlinePacks()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range packs {
+		var kept bytes.Buffer
+		seen := make(map[string]struct{})
+		removed := 0
+		var removedBytes int64
+		if _, err := readPack(path, s.inlineMaxSize, func(hash string, contents []byte) bool {
+			_, ok := referenced[hash]
+			if _, dupe := seen[hash]; dupe || (!ok && !slices.Contains(report.Pinned, hash)) {
+				removed++
+				removedBytes += int64(len(contents))
+				return true
+			}
+			seen[hash] = struct{}{}
+			fmt.Fprintf(&kept, "%s %d\n", hash, len(contents))
+			kept.Write(contents)
+			kept.WriteByte('\n')
+			return true
+		}); err != nil {
+			return err
+		}
+		if removed == 0 {
+			continue
+		}
+
+		if kept.Len() == 0 {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("remove pack %q: %w", path, err)
+			}
+		} else {
+			tmp := path + ".tmp"
+			if err := os.WriteFile(tmp, kept.Bytes(), 0600); err != nil {
+				return fmt.Errorf("write %q: %w", tmp, err)
+			}
+			if err := os.Rename(tmp, path); err != nil {
+				os.Remove(tmp)
+				return fmt.Errorf("rename %q: %w", tmp, err)
+			}
+		}
+		report.Removed += removed
+		report.RemovedBytes += removedBytes
+	}
+	return nil
+}
+
+// inlineReader reads inline contents (see WithInlineBlobs).
+type inlineReader struct {
+	*bytes.Reader
+}
+
+func (inlineReader) Close() error { return nil }
+
+// openLink opens a link for reading, resolving inline contents of links to missing data files.
+func (s *DedupeFS) openLink(absLinkName string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(absLinkName)
+	if err == nil {
+		return f, nil
+	} else if s.inlineDir == "" || !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	target, lerr := os.Readlink(absLinkName)
+	if lerr != nil {
+		return nil, err
+	}
+	contents, ok, ierr := s.inlineBlob(targetHash(target))
+	if ierr != nil {
+		return nil, ierr
+	} else if !ok {
+		return nil, err
+	}
+	return inlineReader{bytes.NewReader(contents)}, nil
+}
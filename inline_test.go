@@ -0,0 +1,130 @@
+package fsdedupe_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWithInlineBlobs(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithInlineBlobs(filepath.Join(tmp, "inline"), 16))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	setupDedupeFS_Create(t, subject, "/a.json", `{"tiny":true}`)
+	setupDedupeFS_Create(t, subject, "/dir/b.json", `{"tiny":true}`)
+	setupDedupeFS_Create(t, subject, "/c.json", `{"tiny":false}`)
+	setupDedupeFS_Create(t, subject, "/large.txt", "LARGER THAN THRESHOLD")
+
+	dataFiles, err := filepath.Glob(filepath.Join(tmp, "data", "*"+fsdedupe.DataFileExt))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(dataFiles), 1; actual != expected {
+		t.Fatalf("expected %d data file, got %d", expected, actual)
+	}
+
+	for name, expected := range map[string]string{
+		"/a.json":     `{"tiny":true}`,
+		"/dir/b.json": `{"tiny":true}`,
+		"/large.txt":  "LARGER THAN THRESHOLD",
+	} {
+		f, err := subject.Open(name)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if actual := string(b); actual != expected {
+			t.Errorf("expected %q contents %q, got %q", name, expected, actual)
+		}
+	}
+
+	info, err := subject.Stat("/a.json")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := info.Size, int64(len(`{"tiny":true}`)); actual != expected {
+		t.Errorf("expected size %d, got %d", expected, actual)
+	}
+	if actual, expected := info.ContentType, "text/plain; charset=utf-8"; actual != expected {
+		t.Errorf("expected content type %q, got %q", expected, actual)
+	}
+
+	srv := httptest.NewServer(subject)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/dir/b.json")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := string(body), `{"tiny":true}`; actual != expected {
+		t.Errorf("expected body %q, got %q", expected, actual)
+	}
+
+	if err := subject.Remove("/a.json"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := subject.Remove("/c.json"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	report, err := subject.GC()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Removed, 1; actual != expected {
+		t.Errorf("expected %d removed, got %d", expected, actual)
+	}
+	if actual, expected := report.RemovedBytes, int64(len(`{"tiny":false}`)); actual != expected {
+		t.Errorf("expected %d bytes removed, got %d", expected, actual)
+	}
+
+	f, err := subject.Open("/dir/b.json")
+	if err != nil {
+		t.Fatalf("expected still linked inline contents to be kept, got: %s", err)
+	}
+	f.Close()
+}
+
+func TestWithInlineBlobs_corruptedPack(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithInlineBlobs(filepath.Join(tmp, "inline"), 16))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	setupDedupeFS_Create(t, subject, "/a.json", `{"tiny":true}`)
+
+	packs, err := filepath.Glob(filepath.Join(tmp, "inline", "*"))
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("expected a pack file, got %q (%v)", packs, err)
+	}
+	b, err := os.ReadFile(packs[0])
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	hash, _, _ := strings.Cut(string(b), " ")
+	for _, size := range []string{"17", "9223372036854775807"} { // above max size, max int
+		if err := os.WriteFile(packs[0], []byte(hash+" "+size+"\n"), 0600); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if _, err := subject.Open("/a.json"); err == nil || !strings.Contains(err.Error(), "corrupted record") {
+			t.Errorf("expected size %s record to be corrupted, got: %v", size, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package fsdedupe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mxmCherry/fsdedupe/artifact"
+)
+
+// JournalEntry is an in-flight link action, recorded to a journal file (see WithJournal) as an artifact (see package artifact).
+type JournalEntry struct {
+	// Filename is a duplicate being replaced by a symlink (or another link, see WithLinkStrategy).
+	Filename string `json:"filename"`
+	// Target is a (canonical) file the link points to.
+	Target string `json:"target"`
+	// Backup is where the duplicate is moved aside until the link is in place.
+	Backup string `json:"backup"`
+}
+
+// RollbackJournal rolls back an in-flight link action recorded to a journal file (see WithJournal),
+// restoring the duplicate from its backup, and removes the journal.
+// Missing or empty journal means there is nothing to roll back.
+func RollbackJournal(journal string) error {
+	b, err := os.ReadFile(journal)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read journal %q: %w", journal, err)
+	}
+
+	if len(b) != 0 {
+		var legacy JournalEntry
+		var entries []JournalEntry
+		if err := readArtifact(bytes.NewReader(b), artifact.KindJournal, &legacy, func(rec artifact.Record) {
+			entries = append(entries, JournalEntry{Filename: rec.Filename, Target: rec.Target, Backup: rec.Backup})
+		}); err != nil {
+			return fmt.Errorf("decode journal %q: %w", journal, err)
+		}
+		if legacy.Filename != "" {
+			entries = append(entries, legacy)
+		}
+		// latest action first
+		for i := len(entries) - 1; i >= 0; i-- {
+			if err := entries[i].rollback(); err != nil {
+				return fmt.Errorf("roll back %q: %w", entries[i].Filename, err)
+			}
+		}
+	}
+
+	if err := os.Remove(journal); err != nil {
+		return fmt.Errorf("remove journal %q: %w", journal, err)
+	}
+	return nil
+}
+
+func (e JournalEntry) rollback() error {
+	if _, err := os.Lstat(e.Backup); errors.Is(err, fs.ErrNotExist) {
+		// either not started, or already completed
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("lstat backup %q: %w", e.Backup, err)
+	}
+
+	// with backup in place, anything at filename is a link being created
+	if stat, err := os.Lstat(e.Filename); err == nil && !stat.IsDir() {
+		if err := os.Remove(e.Filename); err != nil {
+			return fmt.Errorf("remove link: %w", err)
+		}
+	}
+	if err := os.Rename(e.Backup, e.Filename); err != nil {
+		return fmt.Errorf("restore backup %q: %w", e.Backup, err)
+	}
+	return nil
+}
+
+// journaledLink replaces filename with a link to target (created by link), recording the action to journal first.
+// Duplicate is moved aside (not removed) until the link is in place,
+// so the action is rolled back if abort is done in the middle (or by RollbackJournal after a crash).
+func journaledLink(abort context.Context, journal, filename, target string, link func(target, name string) error) error {
+	entry := JournalEntry{
+		Filename: filename,
+		Target:   target,
+		Backup:   filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".fsdedupe-backup"),
+	}
+	if err := writeJournal(journal, entry); err != nil {
+		return err
+	}
+
+	aborted := func() error {
+		if err := abort.Err(); err != nil {
+			if rerr := entry.rollback(); rerr != nil {
+				return fmt.Errorf("roll back %q: %w (aborted: %w)", filename, rerr, err)
+			}
+			return err
+		}
+		return nil
+	}
+
+	if err := os.Rename(filename, entry.Backup); err != nil {
+		return fmt.Errorf("move %q aside: %w", filename, err)
+	}
+	if err := aborted(); err != nil {
+		return err
+	}
+
+	if err := link(target, filename); err != nil {
+		if rerr := entry.rollback(); rerr != nil {
+			return fmt.Errorf("%w (roll back: %w)", err, rerr)
+		}
+		return err
+	}
+	if err := aborted(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(entry.Backup); err != nil {
+		return fmt.Errorf("remove backup %q: %w", entry.Backup, err)
+	}
+	if err := os.Truncate(journal, 0); err != nil {
+		return fmt.Errorf("clear journal %q: %w", journal, err)
+	}
+	return nil
+}
+
+func writeJournal(journal string, entry JournalEntry) error {
+	var buf bytes.Buffer
+	aw, err := artifact.NewWriter(&buf, artifact.KindJournal)
+	if err == nil {
+		err = aw.Write(artifact.Record{Type: artifact.TypeLink, Filename: entry.Filename, Target: entry.Target, Backup: entry.Backup})
+	}
+	if err != nil {
+		return fmt.Errorf("encode journal entry: %w", err)
+	}
+
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write journal %q: %w", journal, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync journal %q: %w", journal, err)
+	}
+	return f.Close()
+}
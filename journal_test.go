@@ -0,0 +1,51 @@
+package fsdedupe_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestRollbackJournal(t *testing.T) {
+	tmp := t.TempDir()
+	journal := filepath.Join(tmp, "journal")
+
+	target := filepath.Join(tmp, "target.txt")
+	writeFile(t, target, "DUPE")
+
+	// crashed right after symlinking, before removing backup
+	filename := filepath.Join(tmp, "file.txt")
+	backup := filepath.Join(tmp, ".file.txt.fsdedupe-backup")
+	writeFile(t, backup, "DUPE")
+	if err := os.Symlink(target, filename); err != nil {
+		t.Fatalf("symlink %q: %s", filename, err)
+	}
+
+	b, err := json.Marshal(fsdedupe.JournalEntry{Filename: filename, Target: target, Backup: backup})
+	if err != nil {
+		t.Fatalf("marshal: %s", err)
+	}
+	writeFile(t, journal, string(b))
+
+	if err := fsdedupe.RollbackJournal(journal); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if !lstat(t, filename).Mode().IsRegular() {
+		t.Fatalf("expected %q to be restored as a regular file", filename)
+	}
+	if _, err := os.Lstat(backup); !os.IsNotExist(err) {
+		t.Fatalf("expected backup %q to be gone, got: %v", backup, err)
+	}
+	if _, err := os.Lstat(journal); !os.IsNotExist(err) {
+		t.Fatalf("expected journal %q to be removed, got: %v", journal, err)
+	}
+
+	// missing journal is nothing to roll back
+	if err := fsdedupe.RollbackJournal(journal); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
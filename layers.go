@@ -0,0 +1,317 @@
+package fsdedupe
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Layer is a container image layer.
+type Layer struct {
+	// Name identifies the layer in reports (layer digest, overlay2 dir ID etc).
+	Name string
+	// Path is an extracted layer dir (like docker overlay2 "<ID>/diff")
+	// or a layer tar archive, optionally gzip-compressed (like OCI image layout blobs).
+	Path string
+}
+
+// LayerFile is a regular file of a layer.
+type LayerFile struct {
+	// Layer is a layer name.
+	Layer string
+	// Path is a rooted slash-separated path within the layer ("/usr/bin/app").
+	Path string
+}
+
+// LayerGroup is a group of same-content files, found in multiple layers.
+type LayerGroup struct {
+	Hash  string
+	Size  int64
+	Files []LayerFile
+}
+
+// WastedBytes is a total size of extra copies (all but one file of the group).
+func (g LayerGroup) WastedBytes() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// LayerReport describes duplicate files across layers (see ScanLayers).
+type LayerReport struct {
+	// Layers is a number of scanned layers.
+	Layers int
+	// Files is a number of scanned (regular) files.
+	Files int
+	// Bytes is a total size of scanned files.
+	Bytes int64
+	// Groups are same-content file groups spanning multiple layers, most wasted bytes first.
+	Groups []LayerGroup
+	// WastedBytes is a total size of extra copies of Groups.
+	WastedBytes int64
+}
+
+// ScanLayers reports (read-only) duplicate files across container image layers:
+// content re-added by later layers, which deduplication of layers can't reclaim, but image builds can avoid.
+// Files overridden or deleted (whiteouts) by later layers are not taken into account.
+// Layer tar archives compressed otherwise than with gzip (like zstd) are skipped with a log message.
+// Only WithLogger, WithLimiter and WithEmptyPolicy options are honored.
+func ScanLayers(ctx context.Context, layers []Layer, opts ...Option) (LayerReport, error) {
+	o := buildOptions(opts)
+
+	var report LayerReport
+	byHash := make(map[string]*LayerGroup)
+	var hashes []string
+
+	digest := sha512.New()
+	onFile := func(layer Layer, name string, size int64, r io.Reader) error {
+		if size == 0 && o.emptyPolicy == EmptySkip {
+			return nil
+		}
+		digest.Reset()
+		if _, err := CopyContext(ctx, digest, r, o.limiter); err != nil {
+			return fmt.Errorf("hash %q of layer %q: %w", name, layer.Name, err)
+		}
+		h := fmt.Sprintf("%x", digest.Sum(nil))
+
+		report.Files++
+		report.Bytes += size
+		group, ok := byHash[h]
+		if !ok {
+			group = &LayerGroup{Hash: h, Size: size}
+			byHash[h] = group
+			hashes = append(hashes, h)
+		}
+		group.Files = append(group.Files, LayerFile{Layer: layer.Name, Path: name})
+		return nil
+	}
+
+	for _, layer := range layers {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := scanLayer(layer, onFile, o); err != nil {
+			return report, err
+		}
+		report.Layers++
+	}
+
+	for _, h := range hashes {
+		group := byHash[h]
+		if !multiLayer(group.Files) {
+			continue
+		}
+		report.Groups = append(report.Groups, *group)
+		report.WastedBytes += group.WastedBytes()
+	}
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		return report.Groups[i].WastedBytes() > report.Groups[j].WastedBytes()
+	})
+	return report, nil
+}
+
+func multiLayer(files []LayerFile) bool {
+	for _, f := range files[1:] {
+		if f.Layer != files[0].Layer {
+			return true
+		}
+	}
+	return false
+}
+
+func scanLayer(layer Layer, onFile func(Layer, string, int64, io.Reader) error, o *options) error {
+	stat, err := os.Stat(layer.Path)
+	if err != nil {
+		return fmt.Errorf("stat layer %q: %w", layer.Name, err)
+	}
+	if stat.IsDir() {
+		return scanLayerDir(layer, onFile)
+	}
+	return scanLayerTar(layer, onFile, o)
+}
+
+func scanLayerDir(layer Layer, onFile func(Layer, string, int64, io.Reader) error) error {
+	files := WalkDir(layer.Path, nil)
+	for {
+		filename, err := files.Next()
+		var walkSkip *WalkSkipError
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if errors.As(err, &walkSkip) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("walk layer %q: %w", layer.Name, err)
+		}
+
+		rel, err := filepath.Rel(layer.Path, filename)
+		if err != nil {
+			return fmt.Errorf("resolve %q: %w", filename, err)
+		}
+		if err := scanLayerFile(layer, filename, "/"+filepath.ToSlash(rel), onFile); err != nil {
+			return err
+		}
+	}
+}
+
+func scanLayerFile(layer Layer, filename, name string, onFile func(Layer, string, int64, io.Reader) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", filename, err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", filename, err)
+	}
+	return onFile(layer, name, stat.Size(), f)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func scanLayerTar(layer Layer, onFile func(Layer, string, int64, io.Reader) error, o *options) error {
+	f, err := os.Open(layer.Path)
+	if err != nil {
+		return fmt.Errorf("open layer %q: %w", layer.Name, err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(zstdMagic))
+
+	var r io.Reader = br
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("decompress layer %q: %w", layer.Name, err)
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.HasPrefix(magic, zstdMagic):
+		o.logger.Printf("skipping layer %q: zstd compression is not supported", layer.Name)
+		return nil
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read layer %q: %w", layer.Name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := onFile(layer, path.Join("/", hdr.Name), hdr.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// ociDescriptor is a content descriptor of OCI image layout index, image index or manifest.
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// ociManifest is an OCI image layout index, image index or image manifest.
+type ociManifest struct {
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// OCILayers lists layers of all images of an OCI image layout dir (like "docker save" output, extracted),
+// named by digest, each one once.
+func OCILayers(dir string) ([]Layer, error) {
+	var layers []Layer
+	seen := make(map[string]struct{})
+
+	var visit func(manifest string, depth int) error
+	visit = func(manifest string, depth int) error {
+		b, err := os.ReadFile(manifest)
+		if err != nil {
+			return fmt.Errorf("read manifest: %w", err)
+		}
+		var m ociManifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("decode manifest %q: %w", manifest, err)
+		}
+
+		for _, layer := range m.Layers {
+			if _, ok := seen[layer.Digest]; ok {
+				continue
+			}
+			seen[layer.Digest] = struct{}{}
+
+			blob, err := ociBlobPath(dir, layer.Digest)
+			if err != nil {
+				return err
+			}
+			layers = append(layers, Layer{Name: layer.Digest, Path: blob})
+		}
+		for _, child := range m.Manifests {
+			if depth > 8 {
+				return fmt.Errorf("decode manifest %q: too deeply nested", manifest)
+			}
+			blob, err := ociBlobPath(dir, child.Digest)
+			if err != nil {
+				return err
+			}
+			if err := visit(blob, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(filepath.Join(dir, "index.json"), 0); err != nil {
+		return nil, fmt.Errorf("list layers of %q: %w", dir, err)
+	}
+	return layers, nil
+}
+
+func ociBlobPath(dir, digest string) (string, error) {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok || algo == "" || hex == "" || strings.ContainsAny(digest, `/\`) {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(dir, "blobs", algo, hex), nil
+}
+
+// Overlay2Layers lists layers of a docker overlay2 storage dir ("/var/lib/docker/overlay2"),
+// named by layer dir ID.
+func Overlay2Layers(dir string) ([]Layer, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("list layers of %q: %w", dir, err)
+	}
+
+	var layers []Layer
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		diff := filepath.Join(dir, entry.Name(), "diff")
+		if stat, err := os.Stat(diff); err != nil || !stat.IsDir() {
+			continue // "l" dir of short name symlinks etc
+		}
+		layers = append(layers, Layer{Name: entry.Name(), Path: diff})
+	}
+	return layers, nil
+}
@@ -0,0 +1,126 @@
+package fsdedupe_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestScanLayers_overlay2(t *testing.T) {
+	tmp := t.TempDir()
+
+	writeFile(t, filepath.Join(tmp, "base", "diff", "usr", "lib", "libfoo.so"), "LIBFOO")
+	writeFile(t, filepath.Join(tmp, "base", "diff", "etc", "conf"), "CONF")
+	writeFile(t, filepath.Join(tmp, "app", "diff", "app", "libfoo.so"), "LIBFOO")
+	writeFile(t, filepath.Join(tmp, "app", "diff", "app", "conf.bak"), "CONF")
+	writeFile(t, filepath.Join(tmp, "app", "diff", "app", "conf.orig"), "CONF")
+	writeFile(t, filepath.Join(tmp, "app", "diff", "app", "main"), "MAIN")
+	if err := os.MkdirAll(filepath.Join(tmp, "l"), 0700); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	layers, err := fsdedupe.Overlay2Layers(tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := layers, []fsdedupe.Layer{
+		{Name: "app", Path: filepath.Join(tmp, "app", "diff")},
+		{Name: "base", Path: filepath.Join(tmp, "base", "diff")},
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+
+	report, err := fsdedupe.ScanLayers(context.Background(), layers)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Files, 6; actual != expected {
+		t.Errorf("expected %d files, got %d", expected, actual)
+	}
+	if actual, expected := report.WastedBytes, int64(len("CONF")*2+len("LIBFOO")); actual != expected {
+		t.Errorf("expected %d wasted bytes, got %d", expected, actual)
+	}
+	var groups [][]fsdedupe.LayerFile
+	for _, g := range report.Groups {
+		groups = append(groups, g.Files)
+	}
+	if expected := [][]fsdedupe.LayerFile{
+		{{Layer: "app", Path: "/app/conf.bak"}, {Layer: "app", Path: "/app/conf.orig"}, {Layer: "base", Path: "/etc/conf"}},
+		{{Layer: "app", Path: "/app/libfoo.so"}, {Layer: "base", Path: "/usr/lib/libfoo.so"}},
+	}; !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected %+v, got %+v", expected, groups)
+	}
+}
+
+func TestScanLayers_oci(t *testing.T) {
+	tmp := t.TempDir()
+
+	blob := func(b []byte) string {
+		digest := fmt.Sprintf("%x", sha256.Sum256(b))
+		writeFile(t, filepath.Join(tmp, "blobs", "sha256", digest), string(b))
+		return "sha256:" + digest
+	}
+	layer := func(files map[string]string) string {
+		filename := filepath.Join(t.TempDir(), "layer.tar.gz")
+		f, err := os.Create(filename)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		zw := gzip.NewWriter(f)
+		tw := tar.NewWriter(zw)
+		for name, contents := range files {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if _, err := tw.Write([]byte(contents)); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+		}
+		for _, c := range []interface{ Close() error }{tw, zw, f} {
+			if err := c.Close(); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+		}
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		return blob(b)
+	}
+
+	base := layer(map[string]string{"usr/share/data.bin": "DATA"})
+	app := layer(map[string]string{"./app/data.bin": "DATA", "app/main": "MAIN"})
+	manifest := blob(fmt.Appendf(nil, `{"layers":[{"digest":%q},{"digest":%q}]}`, base, app))
+	writeFile(t, filepath.Join(tmp, "index.json"), fmt.Sprintf(`{"manifests":[{"digest":%q},{"digest":%q}]}`, manifest, manifest))
+
+	layers, err := fsdedupe.OCILayers(tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(layers), 2; actual != expected {
+		t.Fatalf("expected %d layers, got %+v", expected, layers)
+	}
+
+	report, err := fsdedupe.ScanLayers(context.Background(), layers)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(report.Groups), 1; actual != expected {
+		t.Fatalf("expected %d groups, got %+v", expected, report.Groups)
+	}
+	if actual, expected := report.Groups, []fsdedupe.LayerGroup{{
+		Hash:  report.Groups[0].Hash,
+		Size:  4,
+		Files: []fsdedupe.LayerFile{{Layer: base, Path: "/usr/share/data.bin"}, {Layer: app, Path: "/app/data.bin"}},
+	}}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
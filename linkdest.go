@@ -0,0 +1,135 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// LinkDestPlan describes an rsync-style (--link-dest) incremental snapshot of a source tree:
+// files having the same content in a previous snapshot are hardlinked from it, the rest are copied.
+// Unlike rsync --link-dest, files are matched by content, not by path, so renamed/moved files are linked too.
+type LinkDestPlan struct {
+	// Copy lists source tree files (relative paths) to be copied (rsync --files-from).
+	Copy []string `json:"copy"`
+	// Links lists source tree files to be hardlinked from the previous snapshot.
+	Links []LinkDestLink `json:"links"`
+}
+
+// LinkDestLink maps a source tree file to a same-content file of the previous snapshot.
+type LinkDestLink struct {
+	// Path is a source tree file (relative path), which is also its path in the new snapshot.
+	Path string `json:"path"`
+	// Source is a same-content file of the previous snapshot (prevDir-joined).
+	Source string `json:"source"`
+}
+
+// PlanLinkDest compares srcDir tree with the previous snapshot prevDir tree.
+// Only regular files are considered, and only size-colliding ones are hashed.
+// WithLogger and WithLimiter options are honored.
+func PlanLinkDest(ctx context.Context, prevDir, srcDir string, opts ...Option) (LinkDestPlan, error) {
+	o := buildOptions(opts)
+	var plan LinkDestPlan
+
+	prev, err := listFiles(prevDir)
+	if err != nil {
+		return plan, fmt.Errorf("list %q: %w", prevDir, err)
+	}
+	src, err := listFiles(srcDir)
+	if err != nil {
+		return plan, fmt.Errorf("list %q: %w", srcDir, err)
+	}
+
+	srcSizes := make(map[int64]struct{}, len(src))
+	for _, f := range src {
+		srcSizes[f.size] = struct{}{}
+	}
+
+	digest := sha512.New()
+	byHash := make(map[string]string)
+	for _, f := range prev {
+		if _, ok := srcSizes[f.size]; !ok {
+			continue
+		}
+
+		filename := filepath.Join(prevDir, f.path)
+		digest.Reset()
+		hash, err := hashContents(ctx, digest, filename, o.limiter)
+		if err != nil {
+			return plan, fmt.Errorf("hash contents of %q: %w", filename, err)
+		}
+		if _, ok := byHash[hash]; !ok {
+			byHash[hash] = filename
+		}
+	}
+
+	prevSizes := make(map[int64]struct{}, len(prev))
+	for _, f := range prev {
+		prevSizes[f.size] = struct{}{}
+	}
+
+	for _, f := range src {
+		if _, ok := prevSizes[f.size]; !ok {
+			plan.Copy = append(plan.Copy, f.path)
+			continue
+		}
+
+		filename := filepath.Join(srcDir, f.path)
+		digest.Reset()
+		hash, err := hashContents(ctx, digest, filename, o.limiter)
+		if err != nil {
+			return plan, fmt.Errorf("hash contents of %q: %w", filename, err)
+		}
+
+		if source, ok := byHash[hash]; ok {
+			plan.Links = append(plan.Links, LinkDestLink{Path: f.path, Source: source})
+		} else {
+			plan.Copy = append(plan.Copy, f.path)
+		}
+	}
+
+	o.logger.Printf("%d files to copy, %d to hardlink from %q", len(plan.Copy), len(plan.Links), prevDir)
+	return plan, nil
+}
+
+type listedFile struct {
+	path    string // relative
+	size    int64
+	modTime time.Time
+	id      fileID
+	hasID   bool // id is known
+}
+
+// listFiles lists regular files of a tree (relative paths), sorted by path.
+func listFiles(dir string) ([]listedFile, error) {
+	var files []listedFile
+	err := walk(dir, func(path string, entry os.DirEntry) error {
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("stat: %w", err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("relative path: %w", err)
+		}
+		id, hasID := idOf(info)
+		files = append(files, listedFile{path: rel, size: info.Size(), modTime: info.ModTime(), id: id, hasID: hasID})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
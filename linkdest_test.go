@@ -0,0 +1,40 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestPlanLinkDest(t *testing.T) {
+	tmp := t.TempDir()
+	prev := filepath.Join(tmp, "prev")
+	src := filepath.Join(tmp, "src")
+
+	writeFile(t, filepath.Join(prev, "same.txt"), "SAME")
+	writeFile(t, filepath.Join(prev, "old", "moved.txt"), "MOVED")
+	writeFile(t, filepath.Join(prev, "changed.txt"), "OLD!")
+
+	writeFile(t, filepath.Join(src, "same.txt"), "SAME")
+	writeFile(t, filepath.Join(src, "new", "moved.txt"), "MOVED")
+	writeFile(t, filepath.Join(src, "changed.txt"), "NEW!")
+	writeFile(t, filepath.Join(src, "added.txt"), "ADDED")
+
+	plan, err := fsdedupe.PlanLinkDest(context.Background(), prev, src)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := []string{"added.txt", "changed.txt"}; !reflect.DeepEqual(plan.Copy, expected) {
+		t.Errorf("expected %q to be copied, got %q", expected, plan.Copy)
+	}
+	if expected := []fsdedupe.LinkDestLink{
+		{Path: filepath.Join("new", "moved.txt"), Source: filepath.Join(prev, "old", "moved.txt")},
+		{Path: "same.txt", Source: filepath.Join(prev, "same.txt")},
+	}; !reflect.DeepEqual(plan.Links, expected) {
+		t.Errorf("expected %+v to be linked, got %+v", expected, plan.Links)
+	}
+}
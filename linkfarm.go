@@ -0,0 +1,68 @@
+package fsdedupe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BuildLinkFarm constructs a link tree in outDir against an existing (DedupeFS) data dir,
+// materializing a "view" (release, user workspace etc) over one deduplicated data files pool.
+// Manifest maps logical paths to content hashes in sha512sum output format ("<HASH>  <PATH>" or "<HASH> *<PATH>" lines),
+// paths must be local (relative, not escaping outDir); blank lines and lines starting with # are ignored.
+// Existing outDir links are replaced. It fails on missing data files, before creating any links.
+func BuildLinkFarm(manifest io.Reader, dataDir, outDir string) error {
+	absDataDir, err := filepath.Abs(dataDir)
+	if err != nil {
+		return fmt.Errorf("resolve abs path for data dir %q: %w", dataDir, err)
+	}
+
+	type farmLink struct {
+		path   string
+		target string
+	}
+	var links []farmLink
+
+	sc := bufio.NewScanner(manifest)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// sha512sum marks text/binary mode with " "/"*" path prefix
+		hash, path, ok := strings.Cut(line, " ")
+		if !ok || (!strings.HasPrefix(path, " ") && !strings.HasPrefix(path, "*")) {
+			return fmt.Errorf("manifest line %d: expected \"<HASH>  <PATH>\"", lineNo)
+		}
+		path = path[1:]
+		if !validHash(hash) {
+			return fmt.Errorf("manifest line %d: invalid hash %q", lineNo, hash)
+		}
+		if !filepath.IsLocal(path) {
+			return fmt.Errorf("manifest line %d: %q: %w", lineNo, path, ErrPathEscapes)
+		}
+
+		target := filepath.Join(absDataDir, hash+DataFileExt)
+		if _, err := os.Stat(target); err != nil {
+			return fmt.Errorf("manifest line %d: data file of %q: %w", lineNo, path, err)
+		}
+		links = append(links, farmLink{path: filepath.Join(outDir, path), target: target})
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+
+	for _, link := range links {
+		if err := os.MkdirAll(filepath.Dir(link.path), 0700); err != nil {
+			return fmt.Errorf("ensure dir for %q: %w", link.path, err)
+		}
+		if err := replaceSymlink(link.target, link.path); err != nil {
+			return fmt.Errorf("replace symlink %q pointing to data file %q: %w", link.path, link.target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestBuildLinkFarm(t *testing.T) {
+	tmp := t.TempDir()
+	store := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, store, "file.txt", "DUMMY")
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	dataDir := filepath.Join(tmp, "data")
+	outDir := filepath.Join(tmp, "view")
+
+	manifest := "# release 1\n" +
+		contentsHash + "  a.txt\n" +
+		"\n" +
+		contentsHash + " *sub/b.txt\n"
+	if err := fsdedupe.BuildLinkFarm(strings.NewReader(manifest), dataDir, outDir); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	for _, name := range []string{"a.txt", filepath.Join("sub", "b.txt")} {
+		b, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if actual, expected := string(b), "DUMMY"; actual != expected {
+			t.Errorf("expected %q contents %q, got %q", name, expected, actual)
+		}
+	}
+
+	if err := fsdedupe.BuildLinkFarm(strings.NewReader(contentsHash+"  ../escape.txt\n"), dataDir, outDir); !errors.Is(err, fsdedupe.ErrPathEscapes) {
+		t.Errorf("expected %v, got: %v", fsdedupe.ErrPathEscapes, err)
+	}
+	if err := fsdedupe.BuildLinkFarm(strings.NewReader(strings.Repeat("0", 128)+"  missing.txt\n"), dataDir, outDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got: %v", os.ErrNotExist, err)
+	}
+	if _, err := os.Lstat(filepath.Join(outDir, "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be linked on failure, got: %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// WithLinkIndex makes DedupeFS maintain a reverse (content hash -> link names) index in dir,
+// so LinksFor does not walk the whole link dir.
+// Links are indexed before being created and unindexed after being removed,
+// so the index may only have stale entries (which LinksFor verifies and skips), but never misses links
+// created by DedupeFS with this option. Links created otherwise (e.g. before the index was enabled) are indexed by RebuildLinkIndex.
+// All processes sharing DedupeFS dirs must use the same index dir.
+func WithLinkIndex(dir string) FSOption {
+	return func(s *DedupeFS) {
+		s.linkIndexDir = dir
+	}
+}
+
+// LinksFor returns names of links pointing to a data file of given content hash, sorted,
+// e.g. to find out which files reference a corrupted data file (see Scrub).
+// It uses link index, if configured (see WithLinkIndex), otherwise walks the whole link dir.
+func (s *DedupeFS) LinksFor(hash string) ([]string, error) {
+	hash, err := ParseHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	if s.linkIndexDir == "" {
+		return s.walkLinksFor(hash)
+	}
+
+	indexDir := filepath.Join(s.linkIndexDir, hash)
+	entries, err := os.ReadDir(indexDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read link index %q: %w", indexDir, err)
+	}
+
+	var links []string
+	for _, entry := range entries {
+		b, err := os.ReadFile(filepath.Join(indexDir, entry.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // unindexed meanwhile
+		} else if err != nil {
+			return nil, fmt.Errorf("read link index entry %q: %w", entry.Name(), err)
+		}
+		linkName := string(b)
+		_, absLinkName, err := s.resolve(linkName)
+		if err != nil {
+			continue // corrupted entry
+		}
+		// stale entries (interrupted writes, removals) are skipped
+		if target, err := os.Readlink(absLinkName); err == nil && targetHash(target) == hash {
+			links = append(links, linkName)
+		}
+	}
+	sort.Strings(links)
+	return links, nil
+}
+
+func (s *DedupeFS) walkLinksFor(hash string) ([]string, error) {
+	links, err := s.linksAt(s.linkDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for linkName, target := range links {
+		if targetHash(target) == hash {
+			names = append(names, linkName)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RebuildLinkIndex rebuilds link index (see WithLinkIndex) from scratch, walking the whole link dir.
+// It blocks DedupeFS writes (like GC).
+func (s *DedupeFS) RebuildLinkIndex(ctx context.Context) error {
+	if s.linkIndexDir == "" {
+		return fmt.Errorf("rebuild link index: no link index dir")
+	}
+
+	unlockStore, err := s.lockStore(true)
+	if err != nil {
+		return err
+	}
+	defer unlockStore()
+
+	links, err := s.linksAt(s.linkDir)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(s.linkIndexDir); err != nil {
+		return fmt.Errorf("remove link index %q: %w", s.linkIndexDir, err)
+	}
+	for linkName, target := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.indexLink(linkName, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkNameOf returns clean (rooted) link name of absolute path within link dir.
+func (s *DedupeFS) linkNameOf(absPath string) (string, error) {
+	rel, err := filepath.Rel(s.linkDir, absPath)
+	if err != nil {
+		return "", fmt.Errorf("link name of %q: %w", absPath, err)
+	}
+	return filepath.Join(string(filepath.Separator), rel), nil
+}
+
+// linksAt returns links (clean link names -> targets) at absolute path within link dir:
+// a single link or all links of a dir tree. Missing path has no links.
+func (s *DedupeFS) linksAt(absPath string) (map[string]string, error) {
+	base, err := s.linkNameOf(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Lstat(absPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("lstat %q: %w", absPath, err)
+	}
+	if stat.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("readlink %q: %w", absPath, err)
+		}
+		return map[string]string{base: target}, nil
+	}
+	if !stat.IsDir() {
+		return nil, nil
+	}
+
+	tree, err := collectLinks(absPath)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string]string, len(tree))
+	for rel, target := range tree {
+		links[filepath.Join(base, rel)] = target
+	}
+	return links, nil
+}
+
+// indexEntryPath returns link index entry path of a link pointing to content hash.
+func (s *DedupeFS) indexEntryPath(hash, linkName string) string {
+	return filepath.Join(s.linkIndexDir, hash, fmt.Sprintf("%x", sha256.Sum256([]byte(linkName))))
+}
+
+// indexLink adds link (pointing to target data file) to link index.
+func (s *DedupeFS) indexLink(linkName, target string) error {
+	hash := targetHash(target)
+	if hash == "" {
+		return nil
+	}
+	entry := s.indexEntryPath(hash, linkName)
+	for attempt := 1; ; attempt++ {
+		if err := os.MkdirAll(filepath.Dir(entry), s.dirPerm); err != nil {
+			return fmt.Errorf("ensure link index dir %q: %w", filepath.Dir(entry), err)
+		}
+		// hash dir may be removed in between by unindexing its last entry concurrently,
+		// which can't happen once it has this entry
+		err := os.WriteFile(entry, []byte(linkName), 0600)
+		if errors.Is(err, fs.ErrNotExist) && attempt < maxIndexAttempts {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("index link %q: %w", linkName, err)
+		}
+		return nil
+	}
+}
+
+// maxIndexAttempts limits indexLink retries of hash dirs removed concurrently.
+const maxIndexAttempts = 100
+
+// unindexLinks removes links (clean link names -> former targets) from link index,
+// except ones (still) pointing to the same content in keep.
+func (s *DedupeFS) unindexLinks(links, keep map[string]string) error {
+	for linkName, target := range links {
+		hash := targetHash(target)
+		if kept, ok := keep[linkName]; hash == "" || (ok && targetHash(kept) == hash) {
+			continue
+		}
+		entry := s.indexEntryPath(hash, linkName)
+		if err := os.Remove(entry); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("unindex link %q: %w", linkName, err)
+		}
+		// fails unless it was the last entry of hash
+		os.Remove(filepath.Dir(entry))
+	}
+	return nil
+}
+
+// indexedRelink (re-)points link to target data file with fn, keeping link index (if configured) up to date:
+// the new link is indexed before fn, the replaced one is unindexed after.
+func (s *DedupeFS) indexedRelink(absLinkName, target string, fn func() error) error {
+	if s.linkIndexDir == "" {
+		return fn()
+	}
+	linkName, err := s.linkNameOf(absLinkName)
+	if err != nil {
+		return err
+	}
+	replaced, err := s.linksAt(absLinkName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.indexLink(linkName, target); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.unindexLinks(replaced, map[string]string{linkName: target})
+}
+
+// indexedMove moves link (or a dir of links) with fn, keeping link index (if configured) up to date.
+func (s *DedupeFS) indexedMove(absOldName, absNewName string, fn func() error) error {
+	if s.linkIndexDir == "" {
+		return fn()
+	}
+	oldName, err := s.linkNameOf(absOldName)
+	if err != nil {
+		return err
+	}
+	newName, err := s.linkNameOf(absNewName)
+	if err != nil {
+		return err
+	}
+	moved, err := s.linksAt(absOldName)
+	if err != nil {
+		return err
+	}
+	replaced, err := s.linksAt(absNewName)
+	if err != nil {
+		return err
+	}
+
+	movedTo := make(map[string]string, len(moved))
+	for linkName, target := range moved {
+		rel, err := filepath.Rel(oldName, linkName)
+		if err != nil {
+			return fmt.Errorf("link name of %q: %w", linkName, err)
+		}
+		movedTo[filepath.Join(newName, rel)] = target
+	}
+	for linkName, target := range movedTo {
+		if err := s.indexLink(linkName, target); err != nil {
+			return err
+		}
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := s.unindexLinks(moved, movedTo); err != nil {
+		return err
+	}
+	return s.unindexLinks(replaced, movedTo)
+}
+
+// indexedRemove removes link (or a dir of links) with fn, unindexing it after (if link index is configured).
+func (s *DedupeFS) indexedRemove(absName string, fn func() error) error {
+	if s.linkIndexDir == "" {
+		return fn()
+	}
+	removed, err := s.linksAt(absName)
+	if err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.unindexLinks(removed, nil)
+}
@@ -0,0 +1,149 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_LinksFor(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []fsdedupe.FSOption
+	}{
+		{"walk", nil},
+		{"index", []fsdedupe.FSOption{fsdedupe.WithLinkIndex(filepath.Join(t.TempDir(), "index"))}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			store, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"), tc.opts...)
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+
+			setupDedupeFS_Create(t, store, "/a.txt", "DUPE")
+			setupDedupeFS_Create(t, store, "/dir/b.txt", "DUPE")
+			setupDedupeFS_Create(t, store, "/dir/c.txt", "DUPE")
+			setupDedupeFS_Create(t, store, "/uniq.txt", "UNIQ")
+
+			info, err := store.Stat("/a.txt")
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			assertLinksFor(t, store, info.Hash, []string{"/a.txt", "/dir/b.txt", "/dir/c.txt"})
+
+			if err := store.Rename("/dir", "/moved"); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if err := store.Remove("/a.txt"); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			// overwritten with another content
+			if _, err := store.WriteFile("/moved/c.txt", strings.NewReader("UNIQ"), fsdedupe.WithOverwrite(fsdedupe.OverwriteReplace)); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			assertLinksFor(t, store, info.Hash, []string{"/moved/b.txt"})
+
+			if _, err := store.LinksFor("not a hash"); err == nil {
+				t.Fatalf("expected an error for an invalid hash, got none")
+			}
+		})
+	}
+}
+
+func TestDedupeFS_RebuildLinkIndex(t *testing.T) {
+	tmp := t.TempDir()
+	store := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, store, "/a.txt", "DUPE")
+	setupDedupeFS_Create(t, store, "/b.txt", "DUPE")
+
+	// links created before index is enabled are missed until rebuilt
+	indexed, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithLinkIndex(filepath.Join(tmp, "index")))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	info, err := indexed.Stat("/a.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	assertLinksFor(t, indexed, info.Hash, nil)
+
+	if err := indexed.RebuildLinkIndex(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	assertLinksFor(t, indexed, info.Hash, []string{"/a.txt", "/b.txt"})
+}
+
+func assertLinksFor(t *testing.T, store *fsdedupe.DedupeFS, hash string, expected []string) {
+	t.Helper()
+	actual, err := store.LinksFor(hash)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected links %q, got %q", expected, actual)
+	}
+}
+
+// TestDedupeFS_LinksFor_concurrent creates links of the same content while removing others,
+// so last entries of the content are unindexed (removing its index dir) while new ones are indexed.
+func TestDedupeFS_LinksFor_concurrent(t *testing.T) {
+	tmp := t.TempDir()
+	store, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithLinkIndex(filepath.Join(tmp, "index")),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	const links = 100
+	errs := make(chan error, 2*links)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range links {
+			name := fmt.Sprintf("/removed%d.txt", i)
+			if _, err := store.WriteFile(name, strings.NewReader("DUPE")); err != nil {
+				errs <- err
+			} else if err := store.Remove(name); err != nil {
+				errs <- err
+			}
+		}
+	}()
+	var kept []string
+	go func() {
+		defer wg.Done()
+		for i := range links {
+			name := fmt.Sprintf("/kept%d.txt", i)
+			if _, err := store.WriteFile(name, strings.NewReader("DUPE")); err != nil {
+				errs <- err
+			}
+			if i%10 == 0 {
+				// leave the content link-less for a while
+				if err := store.Remove(name); err != nil {
+					errs <- err
+				}
+				continue
+			}
+			kept = append(kept, name)
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	const dupeHash = "5b853931a07284429862382338a94e0c7dc36495790b4e6d7b3b4b8b2aa5c0145c465c759fe29c3b71ba8952bf1ab3fd9ce1052a79f1401f3c8f7f82ab8bd22f" // echo -n DUPE | sha512sum
+	sort.Strings(kept)
+	assertLinksFor(t, store, dupeHash, kept)
+}
@@ -0,0 +1,148 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidLinkName is matched (see errors.Is) by InvalidLinkNameError.
+var ErrInvalidLinkName = errors.New("invalid link name")
+
+// InvalidLinkNameError is returned by DedupeFS methods for link names failing validation (see ValidateLinkName).
+type InvalidLinkNameError struct {
+	// Name is a link name as given.
+	Name string
+	// Reason is why the name is invalid.
+	Reason string
+}
+
+func (e *InvalidLinkNameError) Error() string {
+	return fmt.Sprintf("invalid link name %q: %s", e.Name, e.Reason)
+}
+
+func (e *InvalidLinkNameError) Is(target error) bool {
+	return target == ErrInvalidLinkName
+}
+
+// WithSanitizedLinkNames makes DedupeFS sanitize link names (see SanitizeLinkName) instead of rejecting them,
+// so user-provided names (e.g. of web uploads) are stored safely; see DedupeFS.LinkName for a resulting name.
+func WithSanitizedLinkNames() FSOption {
+	return func(s *DedupeFS) {
+		s.sanitizeLinkNames = true
+	}
+}
+
+// WithMaxLinkDepth limits a number of link name path segments (dirs and the file itself), 0 - unlimited.
+func WithMaxLinkDepth(n int) FSOption {
+	return func(s *DedupeFS) {
+		s.maxLinkDepth = n
+	}
+}
+
+// WithMaxLinkNameLength limits link name length, in bytes of the cleaned rooted name (see DedupeFS.LinkName), 0 - unlimited.
+func WithMaxLinkNameLength(n int) FSOption {
+	return func(s *DedupeFS) {
+		s.maxLinkNameLength = n
+	}
+}
+
+// ValidateLinkName returns InvalidLinkNameError for empty names, names with trailing slashes,
+// control characters or reserved segments: "." and ".." (instead of silently resolving them),
+// as well as device names (CON, NUL, COM1 etc) on Windows.
+func ValidateLinkName(name string) error {
+	invalid := func(reason string) error {
+		return &InvalidLinkNameError{Name: name, Reason: reason}
+	}
+
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return invalid("control characters")
+	}
+	if strings.LastIndexFunc(name, isLinkNameSeparator) == len(name)-1 && strings.TrimFunc(name, isLinkNameSeparator) != "" {
+		return invalid("trailing slash")
+	}
+
+	empty := true
+	for _, segment := range strings.FieldsFunc(name, isLinkNameSeparator) {
+		empty = false
+		if segment == "." || segment == ".." {
+			return invalid(fmt.Sprintf("reserved name %q", segment))
+		}
+		if reservedDeviceName(segment) {
+			return invalid(fmt.Sprintf("reserved device name %q", segment))
+		}
+	}
+	if empty {
+		return invalid("empty")
+	}
+	return nil
+}
+
+// SanitizeLinkName makes name pass ValidateLinkName (unless nothing is left of it):
+// it drops control characters, empty and reserved "." and ".." segments (so trailing slashes too),
+// and prefixes device names (on Windows) with an underscore.
+func SanitizeLinkName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	var segments []string
+	for _, segment := range strings.FieldsFunc(name, isLinkNameSeparator) {
+		switch {
+		case segment == "." || segment == "..":
+			continue
+		case reservedDeviceName(segment):
+			segment = "_" + segment
+		}
+		segments = append(segments, segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// LinkName returns link name as stored: validated (or sanitized, see WithSanitizedLinkNames),
+// cleaned and rooted ("/dir/file.txt"), checked against WithMaxLinkDepth and WithMaxLinkNameLength limits.
+func (s *DedupeFS) LinkName(name string) (string, error) {
+	given := name
+	if s.sanitizeLinkNames {
+		name = SanitizeLinkName(name)
+	}
+	if err := ValidateLinkName(name); err != nil {
+		return "", &InvalidLinkNameError{Name: given, Reason: err.(*InvalidLinkNameError).Reason}
+	}
+
+	segments := strings.FieldsFunc(name, isLinkNameSeparator)
+	clean := "/" + strings.Join(segments, "/")
+	if s.maxLinkDepth > 0 && len(segments) > s.maxLinkDepth {
+		return "", &InvalidLinkNameError{Name: given, Reason: fmt.Sprintf("deeper than %d", s.maxLinkDepth)}
+	}
+	if s.maxLinkNameLength > 0 && len(clean) > s.maxLinkNameLength {
+		return "", &InvalidLinkNameError{Name: given, Reason: fmt.Sprintf("longer than %d bytes", s.maxLinkNameLength)}
+	}
+	return clean, nil
+}
+
+func isLinkNameSeparator(r rune) bool {
+	return r == '/' || r == filepath.Separator
+}
+
+// reservedDeviceName reports if segment is a Windows device name (also with an extension, like "nul.txt").
+func reservedDeviceName(segment string) bool {
+	if runtime.GOOS != "windows" {
+		return false
+	}
+	base, _, _ := strings.Cut(strings.ToUpper(segment), ".")
+	switch base = strings.TrimRight(base, " "); base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) && base[3] >= '1' && base[3] <= '9' {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestValidateLinkName(t *testing.T) {
+	for _, name := range []string{"file.txt", "/dir/file.txt", "dir//file.txt", "aux.c", "...", "dir/.hidden"} {
+		if err := fsdedupe.ValidateLinkName(name); err != nil {
+			t.Errorf("expected %q to be valid, got: %s", name, err)
+		}
+	}
+	for _, name := range []string{"", "/", "dir/", "dir/../file.txt", "./file.txt", "file\x00.txt", "new\nline.txt", "tab\t.txt"} {
+		err := fsdedupe.ValidateLinkName(name)
+		if !errors.Is(err, fsdedupe.ErrInvalidLinkName) {
+			t.Errorf("expected %q to be invalid, got: %v", name, err)
+		}
+		var nameErr *fsdedupe.InvalidLinkNameError
+		if !errors.As(err, &nameErr) || nameErr.Name != name {
+			t.Errorf("expected InvalidLinkNameError for %q, got: %v", name, err)
+		}
+	}
+}
+
+func TestSanitizeLinkName(t *testing.T) {
+	for input, expected := range map[string]string{
+		"file.txt":              "/file.txt",
+		"dir/":                  "/dir",
+		"/a//b/./../c.txt":      "/a/b/c.txt",
+		"bad\x00na\nme.txt":     "/badname.txt",
+		"../../../etc/passwd":   "/etc/passwd",
+		"":                      "/",
+		"dir/\x01/file.txt\r\n": "/dir/file.txt",
+	} {
+		if actual := fsdedupe.SanitizeLinkName(input); actual != expected {
+			t.Errorf("expected %q to be sanitized to %q, got %q", input, expected, actual)
+		}
+	}
+}
+
+func TestDedupeFS_LinkName(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	if _, err := subject.Create("dir/../file.txt"); !errors.Is(err, fsdedupe.ErrInvalidLinkName) {
+		t.Fatalf("expected ErrInvalidLinkName, got: %v", err)
+	}
+	if _, err := subject.Stat("dir/"); !errors.Is(err, fsdedupe.ErrInvalidLinkName) {
+		t.Fatalf("expected ErrInvalidLinkName, got: %v", err)
+	}
+
+	sanitized, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithSanitizedLinkNames(),
+		fsdedupe.WithMaxLinkDepth(2),
+		fsdedupe.WithMaxLinkNameLength(16),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	name, err := sanitized.LinkName("dir/../up\nload.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := "/dir/upload.txt"; name != expected {
+		t.Fatalf("expected %q, got %q", expected, name)
+	}
+	setupDedupeFS_Create(t, sanitized, "dir/../up\nload.txt", "DUMMY")
+	if _, err := os.Lstat(filepath.Join(tmp, "link", "dir", "upload.txt")); err != nil {
+		t.Fatalf("expected sanitized link to exist, got: %v", err)
+	}
+
+	for _, name := range []string{"a/b/c.txt", "dir/too-long-name.txt", "../\x00"} {
+		if _, err := sanitized.LinkName(name); !errors.Is(err, fsdedupe.ErrInvalidLinkName) {
+			t.Errorf("expected ErrInvalidLinkName for %q, got: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// storeLockFile is a lock dir file, flock-ed shared by writers and exclusively by GC-like operations.
+const storeLockFile = "store.lock"
+
+// WithLockDir enables cross-process coordination via lock files (flock) in a given dir,
+// so multiple processes sharing the same DedupeFS dirs (on a local filesystem) can safely write concurrently:
+// a store-level lock file is held shared while writing and exclusively by GC, Rebalance and Scrub,
+// per-hash lock files serialize storing the same content, per-upload ones - resumable upload operations.
+// Temp files need no locks: they are uniquely named (os.CreateTemp), even across processes sharing temp dir.
+// All processes must use the same lock dir. It is a no-op on platforms without flock.
+func WithLockDir(dir string) FSOption {
+	return func(s *DedupeFS) {
+		s.lockDir = dir
+	}
+}
+
+// fsLocks serializes DedupeFS operations within one process.
+// Lock order (to avoid deadlocks): uploads, gc, links, hashes, inline, tree.
+type fsLocks struct {
+	// uploads serialize operations on the same resumable upload.
+	uploads stripedMutex
+	// gc is held exclusively by GC-like operations (reaping/moving data files)
+	// and shared by the ones linking data files, so data files are never reaped between storing and linking.
+	gc sync.RWMutex
+	// links serialize operations on the same link names.
+	links stripedMutex
+	// hashes serialize storing of the same content.
+	hashes stripedMutex
+	// inline serializes appends to inline pack files.
+	inline sync.Mutex
+	// tree is held exclusively while cleaning up empty link dirs
+	// and shared while creating links, so parent dirs are not removed right before linking.
+	tree sync.RWMutex
+}
+
+const lockStripes = 64
+
+// stripedMutex is a fixed set of mutexes, keys are mapped to them by hash.
+type stripedMutex [lockStripes]sync.Mutex
+
+// lock locks stripes of given keys (in stripe order, each one once), returning unlock func.
+func (m *stripedMutex) lock(keys ...string) func() {
+	stripes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		stripes = append(stripes, int(h.Sum32()%lockStripes))
+	}
+	sort.Ints(stripes)
+
+	locked := make([]int, 0, len(stripes))
+	for i, stripe := range stripes {
+		if i > 0 && stripe == stripes[i-1] {
+			continue
+		}
+		m[stripe].Lock()
+		locked = append(locked, stripe)
+	}
+
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			m[locked[i]].Unlock()
+		}
+	}
+}
+
+// inLinkDir runs fn creating a link, ensuring its parent dir exists (and is not cleaned up concurrently).
+func (s *DedupeFS) inLinkDir(absLinkName string, fn func() error) error {
+	s.locks.tree.RLock()
+	defer s.locks.tree.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(absLinkName), s.dirPerm); err != nil {
+		return fmt.Errorf("ensure dir for %q: %w", absLinkName, err)
+	}
+	return fn()
+}
+
+// cleanTree removes empty link dirs, walking up from a given (link dir relative) dir.
+func (s *DedupeFS) cleanTree(dir string) error {
+	s.locks.tree.Lock()
+	defer s.locks.tree.Unlock()
+
+	return cleanTree(s.linkDir, dir)
+}
+
+// lockStore takes DedupeFS-wide lock (shared by writers, exclusive for GC-like operations),
+// in-process and cross-process (see WithLockDir), returning unlock func.
+func (s *DedupeFS) lockStore(exclusive bool) (func(), error) {
+	if exclusive {
+		s.locks.gc.Lock()
+	} else {
+		s.locks.gc.RLock()
+	}
+	unlockMem := func() {
+		if exclusive {
+			s.locks.gc.Unlock()
+		} else {
+			s.locks.gc.RUnlock()
+		}
+	}
+
+	if s.lockDir == "" {
+		return unlockMem, nil
+	}
+	unlockFile, err := s.lockFile(storeLockFile, exclusive)
+	if err != nil {
+		unlockMem()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		unlockMem()
+	}, nil
+}
+
+// lockHash serializes storing of the same content, in-process and cross-process (see WithLockDir),
+// returning unlock func. Store lock (see lockStore) must be held.
+func (s *DedupeFS) lockHash(hash string) (func(), error) {
+	unlockMem := s.locks.hashes.lock(hash)
+	if s.lockDir == "" {
+		return unlockMem, nil
+	}
+	unlockFile, err := s.lockFile(hash+".lock", true)
+	if err != nil {
+		unlockMem()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		unlockMem()
+	}, nil
+}
+
+// lockFile flock-s a lock dir file, returning unlock func.
+func (s *DedupeFS) lockFile(name string, exclusive bool) (func(), error) {
+	if err := os.MkdirAll(s.lockDir, s.dirPerm); err != nil {
+		return nil, fmt.Errorf("ensure lock dir %q: %w", s.lockDir, err)
+	}
+	path := filepath.Join(s.lockDir, name)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file %q: %w", path, err)
+	}
+	if err := flock(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("flock %q: %w", path, err)
+	}
+	// closing releases flock
+	return func() { f.Close() }, nil
+}
+
+// cleanHashLocks removes per-hash lock files, store lock must be held exclusively
+// (so no other process can be holding or waiting for per-hash locks).
+func (s *DedupeFS) cleanHashLocks() error {
+	if s.lockDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(s.lockDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read lock dir: %w", err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != storeLockFile && strings.HasSuffix(name, ".lock") {
+			if err := os.Remove(filepath.Join(s.lockDir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("remove lock file %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package fsdedupe
+
+import "os"
+
+func flock(f *os.File, exclusive bool) error {
+	// unsupported, in-process locking only
+	return nil
+}
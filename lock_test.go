@@ -0,0 +1,212 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+// TestDedupeFS_concurrent is a stress test, meant to be run with -race.
+func TestDedupeFS_concurrent(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const workers = 8
+	const iterations = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*iterations)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				// few names and contents, so operations collide
+				name := fmt.Sprintf("dir%d/file%d.txt", i%3, (w+i)%4)
+				contents := fmt.Sprintf("CONTENTS %d", i%5)
+
+				switch i % 4 {
+				case 0, 1:
+					f, err := subject.Create(name)
+					if err != nil {
+						errs <- err
+						continue
+					}
+					if _, err := f.Write([]byte(contents)); err != nil {
+						errs <- err
+					}
+					if err := f.Close(); err != nil && !errors.Is(err, fs.ErrExist) {
+						errs <- err
+					}
+				case 2:
+					if err := subject.Rename(name, "moved/"+name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						errs <- err
+					}
+				case 3:
+					if err := subject.Remove(name); err != nil {
+						errs <- err
+					}
+					if _, err := subject.GC(); err != nil {
+						errs <- err
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("expected no error, got: %s", err)
+	}
+
+	// every remaining link must point to existing data
+	err := filepath.WalkDir(filepath.Join(tmp, "link"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(string(b), "CONTENTS ") {
+			return fmt.Errorf("%q: unexpected contents %q", path, b)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("expected no error, got: %s", err)
+	}
+}
+
+// TestDedupeFS_concurrentCreate starts many Creates at once (within the same clock tick on platforms with coarse clocks),
+// writing interleaved chunks, each one of which must store its own content.
+func TestDedupeFS_concurrentCreate(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const writers = 64
+	contentsOf := func(i int) string {
+		return strings.Repeat(fmt.Sprintf("CONTENTS %d;", i%4), 1000) // few contents, so storing collides too
+	}
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			f, err := subject.Create(fmt.Sprintf("file%d.txt", i))
+			if err != nil {
+				errs <- err
+				return
+			}
+			contents := contentsOf(i)
+			for chunk := range strings.SplitAfterSeq(contents, ";") {
+				if _, err := f.Write([]byte(chunk)); err != nil {
+					errs <- err
+					return
+				}
+				runtime.Gosched()
+			}
+			if err := f.Close(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("expected no error, got: %s", err)
+	}
+
+	for i := range writers {
+		name := fmt.Sprintf("file%d.txt", i)
+		b, err := os.ReadFile(filepath.Join(tmp, "link", name))
+		if err != nil {
+			t.Errorf("expected no error, got: %s", err)
+		} else if actual, expected := string(b), contentsOf(i); actual != expected {
+			t.Errorf("expected %q to have %d bytes of its own content, got %d bytes %.30q...", name, len(expected), len(actual), actual)
+		}
+	}
+}
+
+// TestDedupeFS_lockDir emulates multiple processes with multiple DedupeFS instances
+// (not sharing in-process locks) over the same dirs.
+func TestDedupeFS_lockDir(t *testing.T) {
+	tmp := t.TempDir()
+	setup := func() *fsdedupe.DedupeFS {
+		subject, err := fsdedupe.NewDedupeFS(
+			filepath.Join(tmp, "temp"),
+			filepath.Join(tmp, "data"),
+			filepath.Join(tmp, "link"),
+			fsdedupe.WithLockDir(filepath.Join(tmp, "lock")),
+		)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		return subject
+	}
+	writer, collector, other := setup(), setup(), setup()
+
+	done := make(chan struct{})
+	gcErr := make(chan error, 1)
+	go func() {
+		defer close(gcErr)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := collector.GC(); err != nil {
+				gcErr <- err
+				return
+			}
+		}
+	}()
+
+	// writers of "other processes" share temp dir too
+	var wg sync.WaitGroup
+	writeErr := make(chan error, 100)
+	for w, s := range []*fsdedupe.DedupeFS{writer, other} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < 100; i += 2 {
+				if _, err := s.WriteFile(fmt.Sprintf("file%d.txt", i), strings.NewReader(fmt.Sprintf("CONTENTS %d", i))); err != nil {
+					writeErr <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	close(writeErr)
+	for err := range writeErr {
+		t.Errorf("expected no error, got: %s", err)
+	}
+	if err := <-gcErr; err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	for i := range 100 {
+		name := filepath.Join(tmp, "link", fmt.Sprintf("file%d.txt", i))
+		if b, err := os.ReadFile(name); err != nil {
+			t.Errorf("expected %q data to be kept, got: %s", name, err)
+		} else if actual, expected := string(b), fmt.Sprintf("CONTENTS %d", i); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	}
+}
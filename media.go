@@ -0,0 +1,220 @@
+package fsdedupe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errNoMediaKey is returned when file has no (supported) EXIF capture metadata.
+var errNoMediaKey = errors.New("no EXIF capture metadata")
+
+// MediaKey identifies a shot by EXIF capture metadata,
+// which is shared by different edits/exports of the same photo even when bytes differ.
+type MediaKey struct {
+	// Captured is an EXIF DateTimeOriginal ("2006:01:02 15:04:05").
+	Captured string `json:"captured"`
+	// Model is a camera model.
+	Model string `json:"model"`
+	// Width is an image width, pixels.
+	Width int `json:"width"`
+	// Height is an image height, pixels.
+	Height int `json:"height"`
+}
+
+// MediaGroup groups files sharing the same MediaKey,
+// but having different content (exact duplicates are reported/linked as usual).
+type MediaGroup struct {
+	Key       MediaKey `json:"key"`
+	Filenames []string `json:"filenames"`
+}
+
+// ReadMediaKey reads EXIF capture metadata of a JPEG or TIFF-based (TIFF, DNG, most RAW formats) file.
+// Capture timestamp is required, other fields may be empty.
+func ReadMediaKey(filename string) (MediaKey, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return MediaKey{}, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return MediaKey{}, fmt.Errorf("stat: %w", err)
+	}
+
+	var magic [2]byte
+	if _, err := f.ReadAt(magic[:], 0); err != nil {
+		return MediaKey{}, errNoMediaKey
+	}
+
+	var tiff *io.SectionReader
+	switch string(magic[:]) {
+	case "\xFF\xD8": // JPEG
+		if tiff, err = jpegEXIF(f); err != nil {
+			return MediaKey{}, err
+		}
+	case "II", "MM": // TIFF
+		tiff = io.NewSectionReader(f, 0, stat.Size())
+	default:
+		return MediaKey{}, errNoMediaKey
+	}
+
+	return parseEXIF(tiff)
+}
+
+// jpegEXIF locates EXIF (TIFF) data in APP1 segment of JPEG.
+func jpegEXIF(f io.ReaderAt) (*io.SectionReader, error) {
+	offset := int64(2)
+	for {
+		var hdr [4]byte
+		if _, err := f.ReadAt(hdr[:], offset); err != nil {
+			return nil, errNoMediaKey
+		}
+		if hdr[0] != 0xFF {
+			return nil, errNoMediaKey
+		}
+
+		marker := hdr[1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			return nil, errNoMediaKey
+		}
+		length := int64(binary.BigEndian.Uint16(hdr[2:]))
+
+		if marker == 0xE1 {
+			var prefix [6]byte
+			if _, err := f.ReadAt(prefix[:], offset+4); err == nil && string(prefix[:]) == "Exif\x00\x00" {
+				return io.NewSectionReader(f, offset+10, length-8), nil
+			}
+		}
+		offset += 2 + length
+	}
+}
+
+const (
+	exifTagModel            = 0x0110
+	exifTagImageWidth       = 0x0100
+	exifTagImageHeight      = 0x0101
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+	exifTagPixelXDimension  = 0xA002
+	exifTagPixelYDimension  = 0xA003
+)
+
+func parseEXIF(r *io.SectionReader) (MediaKey, error) {
+	var key MediaKey
+
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return key, errNoMediaKey
+	}
+
+	var order binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return key, errNoMediaKey
+	}
+	if order.Uint16(hdr[2:]) != 42 {
+		return key, errNoMediaKey
+	}
+
+	ifd0, err := readIFD(r, order, int64(order.Uint32(hdr[4:])))
+	if err != nil {
+		return key, err
+	}
+	key.Model = ifd0.ascii(r, order, exifTagModel)
+	key.Width = ifd0.uint(order, exifTagImageWidth)
+	key.Height = ifd0.uint(order, exifTagImageHeight)
+
+	if e, ok := ifd0[exifTagExifIFD]; ok {
+		exif, err := readIFD(r, order, int64(order.Uint32(e.value[:])))
+		if err != nil {
+			return key, err
+		}
+		key.Captured = exif.ascii(r, order, exifTagDateTimeOriginal)
+		if w := exif.uint(order, exifTagPixelXDimension); w != 0 {
+			key.Width = w
+		}
+		if h := exif.uint(order, exifTagPixelYDimension); h != 0 {
+			key.Height = h
+		}
+	}
+
+	if key.Captured == "" {
+		return key, errNoMediaKey
+	}
+	return key, nil
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value [4]byte
+}
+
+type ifd map[uint16]ifdEntry
+
+func readIFD(r io.ReaderAt, order binary.ByteOrder, offset int64) (ifd, error) {
+	var n [2]byte
+	if _, err := r.ReadAt(n[:], offset); err != nil {
+		return nil, errNoMediaKey
+	}
+	count := int(order.Uint16(n[:]))
+
+	buf := make([]byte, 12*count)
+	if _, err := r.ReadAt(buf, offset+2); err != nil {
+		return nil, errNoMediaKey
+	}
+
+	entries := make(ifd, count)
+	for i := 0; i < count; i++ {
+		b := buf[12*i:]
+		var e ifdEntry
+		e.typ = order.Uint16(b[2:])
+		e.count = order.Uint32(b[4:])
+		copy(e.value[:], b[8:12])
+		entries[order.Uint16(b)] = e
+	}
+	return entries, nil
+}
+
+func (d ifd) ascii(r io.ReaderAt, order binary.ByteOrder, tag uint16) string {
+	e, ok := d[tag]
+	if !ok || e.typ != 2 || e.count == 0 || e.count > 1024 {
+		return ""
+	}
+
+	var b []byte
+	if e.count <= 4 {
+		b = e.value[:e.count]
+	} else {
+		b = make([]byte, e.count)
+		if _, err := r.ReadAt(b, int64(order.Uint32(e.value[:]))); err != nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(string(bytes.TrimRight(b, "\x00")))
+}
+
+func (d ifd) uint(order binary.ByteOrder, tag uint16) int {
+	e, ok := d[tag]
+	if !ok || e.count != 1 {
+		return 0
+	}
+
+	switch e.typ {
+	case 3: // SHORT
+		return int(order.Uint16(e.value[:]))
+	case 4: // LONG
+		return int(order.Uint32(e.value[:]))
+	}
+	return 0
+}
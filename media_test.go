@@ -0,0 +1,135 @@
+package fsdedupe_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestReadMediaKey(t *testing.T) {
+	tmp := t.TempDir()
+
+	name := filepath.Join(tmp, "photo.jpg")
+	writeFile(t, name, string(fakeJPEG("2021:06:01 12:00:00", "DUMMY CAM", 4000, 3000, "PIXELS")))
+
+	key, err := fsdedupe.ReadMediaKey(name)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := fsdedupe.MediaKey{
+		Captured: "2021:06:01 12:00:00",
+		Model:    "DUMMY CAM",
+		Width:    4000,
+		Height:   3000,
+	}
+	if actual := key; actual != expected {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	plain := filepath.Join(tmp, "plain.txt")
+	writeFile(t, plain, "DUMMY")
+	if _, err := fsdedupe.ReadMediaKey(plain); err == nil {
+		t.Errorf("expected error for a non-media file, got none")
+	}
+}
+
+func TestDedupeSymlink_mediaGroups(t *testing.T) {
+	tmp := t.TempDir()
+
+	original := filepath.Join(tmp, "original.jpg")
+	writeFile(t, original, string(fakeJPEG("2021:06:01 12:00:00", "DUMMY CAM", 4000, 3000, "ORIGINAL")))
+
+	edited := filepath.Join(tmp, "edited.jpg")
+	writeFile(t, edited, string(fakeJPEG("2021:06:01 12:00:00", "DUMMY CAM", 4000, 3000, "EDITED")))
+
+	copied := filepath.Join(tmp, "copied.jpg")
+	writeFile(t, copied, string(fakeJPEG("2021:06:01 12:00:00", "DUMMY CAM", 4000, 3000, "EDITED")))
+
+	other := filepath.Join(tmp, "other.jpg")
+	writeFile(t, other, string(fakeJPEG("2022:01:01 00:00:00", "DUMMY CAM", 4000, 3000, "OTHER")))
+
+	var groups []fsdedupe.MediaGroup
+	onMediaGroup := func(g fsdedupe.MediaGroup) error {
+		groups = append(groups, g)
+		return nil
+	}
+
+	it := &simpleIterator{
+		Entries: []string{
+			original,
+			edited,
+			copied,
+			other,
+		},
+	}
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithMediaGroups(onMediaGroup)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := len(groups), 1; actual != expected {
+		t.Fatalf("expected %d media groups, got %d", expected, actual)
+	}
+	// exact duplicate (copied) is linked as usual, and not listed
+	if actual, expected := groups[0].Filenames, []string{original, edited}; len(actual) != len(expected) || actual[0] != expected[0] || actual[1] != expected[1] {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if focus, actual, expected := copied, readlink(t, copied), edited; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// fakeJPEG builds a minimal JPEG with EXIF capture metadata and given pixel data.
+func fakeJPEG(captured, model string, width, height uint16, pixels string) []byte {
+	le := binary.LittleEndian
+
+	// TIFF layout: header (8), IFD0 (2+2*12+4), ExifIFD (2+3*12+4), then strings
+	const ifd0Offset = 8
+	const exifOffset = ifd0Offset + 2 + 2*12 + 4
+	const dataOffset = exifOffset + 2 + 3*12 + 4
+
+	modelBytes := append([]byte(model), 0)
+	capturedBytes := append([]byte(captured), 0)
+
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(ifd0Offset))
+
+	entry := func(tag, typ uint16, count, value uint32) {
+		binary.Write(&tiff, le, tag)
+		binary.Write(&tiff, le, typ)
+		binary.Write(&tiff, le, count)
+		binary.Write(&tiff, le, value)
+	}
+
+	binary.Write(&tiff, le, uint16(2))
+	entry(0x0110, 2, uint32(len(modelBytes)), dataOffset)
+	entry(0x8769, 4, 1, exifOffset)
+	binary.Write(&tiff, le, uint32(0))
+
+	binary.Write(&tiff, le, uint16(3))
+	entry(0x9003, 2, uint32(len(capturedBytes)), dataOffset+uint32(len(modelBytes)))
+	entry(0xA002, 3, 1, uint32(width))
+	entry(0xA003, 3, 1, uint32(height))
+	binary.Write(&tiff, le, uint32(0))
+
+	tiff.Write(modelBytes)
+	tiff.Write(capturedBytes)
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xFF, 0xDA})
+	jpeg.WriteString(pixels)
+	jpeg.Write([]byte{0xFF, 0xD9})
+	return jpeg.Bytes()
+}
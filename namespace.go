@@ -0,0 +1,204 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NamespaceUsage is a storage usage of a namespace, for chargeback reports (see DedupeFS.NamespaceUsage).
+// Namespaces are top-level link dirs ("/tenant-a" of "/tenant-a/dir/file.txt"), e.g. per tenant or per application.
+type NamespaceUsage struct {
+	// Namespace is a rooted top-level link dir ("/tenant-a"), "" for links directly in the link dir.
+	Namespace string `json:"namespace"`
+	// Links is a number of links.
+	Links int `json:"links"`
+	// LogicalBytes is a total size of linked files, as if stored without deduplication.
+	LogicalBytes int64 `json:"logical_bytes"`
+	// ExclusiveBytes is a total size of data files linked by this namespace only,
+	// reclaimed by GCNamespace.
+	ExclusiveBytes int64 `json:"exclusive_bytes"`
+	// SharedBytes is a total size of data files linked by other namespaces too.
+	SharedBytes int64 `json:"shared_bytes"`
+	// ChargedBytes is ExclusiveBytes plus an equal share of each shared data file
+	// among namespaces linking it, so charged bytes of all namespaces sum up to (roughly, rounded down) stored bytes.
+	ChargedBytes int64 `json:"charged_bytes"`
+}
+
+// NamespaceUsage accounts stored data files per namespace (see NamespaceUsage), sorted by namespace.
+// It uses link index, if configured (see WithLinkIndex), otherwise walks the whole link dir.
+// Data files referenced by snapshots (see WithSnapshotDir) or trash (see WithTrash) only are not accounted to any namespace.
+func (s *DedupeFS) NamespaceUsage() ([]NamespaceUsage, error) {
+	type blob struct {
+		size       int64
+		namespaces map[string]struct{}
+	}
+	blobs := make(map[string]*blob) // by content hash
+	byNamespace := make(map[string]*NamespaceUsage)
+
+	onLink := func(ns, hash string, size int64) {
+		usage, ok := byNamespace[ns]
+		if !ok {
+			usage = &NamespaceUsage{Namespace: ns}
+			byNamespace[ns] = usage
+		}
+		usage.Links++
+		usage.LogicalBytes += size
+
+		b, ok := blobs[hash]
+		if !ok {
+			b = &blob{size: size, namespaces: make(map[string]struct{})}
+			blobs[hash] = b
+		}
+		b.namespaces[ns] = struct{}{}
+	}
+	inline, err := s.inlineSizes()
+	if err != nil {
+		return nil, err
+	}
+	visit := s.walkNamespaceLinks
+	if s.linkIndexDir != "" {
+		visit = s.indexedNamespaceLinks
+	}
+	if err := visit(inline, onLink); err != nil {
+		return nil, err
+	}
+
+	for _, b := range blobs {
+		for ns := range b.namespaces {
+			usage := byNamespace[ns]
+			if len(b.namespaces) == 1 {
+				usage.ExclusiveBytes += b.size
+			} else {
+				usage.SharedBytes += b.size
+			}
+			usage.ChargedBytes += b.size / int64(len(b.namespaces))
+		}
+	}
+
+	usages := make([]NamespaceUsage, 0, len(byNamespace))
+	for _, usage := range byNamespace {
+		usages = append(usages, *usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Namespace < usages[j].Namespace
+	})
+	return usages, nil
+}
+
+// walkNamespaceLinks calls fn with namespace, content hash and size of each link, walking the whole link dir,
+// inline being sizes of inline contents (see WithInlineBlobs).
+func (s *DedupeFS) walkNamespaceLinks(inline map[string]int64, fn func(ns, hash string, size int64)) error {
+	onLink := func(path string, entry os.DirEntry) error {
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", path, err)
+		}
+		hash, ok := HashFromDataName(target)
+		if !ok {
+			return nil // not a store link
+		}
+		size, ok := inline[hash]
+		if stat, err := os.Stat(path); err == nil {
+			size = stat.Size()
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("stat %q: %w", path, err)
+		} else if !ok {
+			return nil // data file is missing, see Scrub
+		}
+
+		ns, err := s.namespaceOf(path)
+		if err != nil {
+			return err
+		}
+		fn(ns, hash, size)
+		return nil
+	}
+	if err := walk(s.linkDir, onLink); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("walk %q: %w", s.linkDir, err)
+	}
+	return nil
+}
+
+// indexedNamespaceLinks calls fn with namespace, content hash and size of each link, reading the link index
+// (stat-ing every data file once, not every link); stale entries are verified and skipped, as by LinksFor.
+func (s *DedupeFS) indexedNamespaceLinks(inline map[string]int64, fn func(ns, hash string, size int64)) error {
+	hashes, err := os.ReadDir(s.linkIndexDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read link index %q: %w", s.linkIndexDir, err)
+	}
+
+	for _, entry := range hashes {
+		hash, err := ParseHash(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue // not an index dir
+		}
+		size, ok := inline[hash]
+		if dataFile, found := s.findBlob(hash); found {
+			stat, err := os.Stat(dataFile)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // reaped meanwhile
+			} else if err != nil {
+				return fmt.Errorf("stat %q: %w", dataFile, err)
+			}
+			size = stat.Size()
+		} else if !ok {
+			continue // data file is missing, see Scrub
+		}
+
+		links, err := s.LinksFor(hash)
+		if err != nil {
+			return err
+		}
+		for _, linkName := range links {
+			ns, err := s.namespaceOf(filepath.Join(s.linkDir, filepath.FromSlash(linkName)))
+			if err != nil {
+				return err
+			}
+			fn(ns, hash, size)
+		}
+	}
+	return nil
+}
+
+// GCNamespace removes all links of a namespace ("/tenant-a", see NamespaceUsage)
+// and reaps data files no longer referenced by any namespace (see GC),
+// which other namespaces' links (as well as snapshots and pins) keep.
+func (s *DedupeFS) GCNamespace(namespace string) (GCReport, error) {
+	name, err := s.LinkName(namespace)
+	if err != nil {
+		return GCReport{}, err
+	}
+	if strings.Count(name, "/") != 1 {
+		return GCReport{}, fmt.Errorf("gc namespace %q: not a top-level link dir", namespace)
+	}
+	if stat, err := os.Lstat(filepath.Join(s.linkDir, filepath.FromSlash(name))); err == nil && !stat.IsDir() {
+		return GCReport{}, fmt.Errorf("gc namespace %q: not a top-level link dir", namespace)
+	}
+	if err := s.Remove(name); err != nil {
+		return GCReport{}, fmt.Errorf("remove namespace %q: %w", namespace, err)
+	}
+	return s.GC()
+}
+
+// namespaceOf returns a namespace of a link path within link dir.
+func (s *DedupeFS) namespaceOf(path string) (string, error) {
+	rel, err := filepath.Rel(s.linkDir, path)
+	if err != nil {
+		return "", fmt.Errorf("link name of %q: %w", path, err)
+	}
+	top, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+	if !nested {
+		return "", nil
+	}
+	return "/" + top, nil
+}
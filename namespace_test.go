@@ -0,0 +1,84 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_NamespaceUsage(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	setupDedupeFS_Create(t, subject, "/tenant-a/shared.txt", "SHARED")
+	setupDedupeFS_Create(t, subject, "/tenant-a/dir/own.txt", "A-OWN")
+	setupDedupeFS_Create(t, subject, "/tenant-a/dir/copy.txt", "A-OWN")
+	setupDedupeFS_Create(t, subject, "/tenant-b/shared.txt", "SHARED")
+	setupDedupeFS_Create(t, subject, "/root.txt", "ROOT")
+
+	usages, err := subject.NamespaceUsage()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []fsdedupe.NamespaceUsage{
+		{Namespace: "", Links: 1, LogicalBytes: 4, ExclusiveBytes: 4, ChargedBytes: 4},
+		{Namespace: "/tenant-a", Links: 3, LogicalBytes: 16, ExclusiveBytes: 5, SharedBytes: 6, ChargedBytes: 8},
+		{Namespace: "/tenant-b", Links: 1, LogicalBytes: 6, SharedBytes: 6, ChargedBytes: 3},
+	}; !reflect.DeepEqual(usages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, usages)
+	}
+
+	report, err := subject.GCNamespace("/tenant-a")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.RemovedBytes, int64(5); actual != expected {
+		t.Fatalf("expected %d bytes reclaimed, got %d", expected, actual)
+	}
+	if _, err := subject.Stat("/tenant-a/shared.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected namespace links to be removed, got: %v", err)
+	}
+	if _, err := subject.Stat("/tenant-b/shared.txt"); err != nil {
+		t.Fatalf("expected shared data file to be kept, got: %s", err)
+	}
+
+	for _, namespace := range []string{"/tenant-b/shared.txt", "/root.txt"} {
+		if _, err := subject.GCNamespace(namespace); err == nil {
+			t.Errorf("expected %q to be rejected, got no error", namespace)
+		}
+	}
+}
+
+func TestDedupeFS_NamespaceUsage_linkIndex(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithLinkIndex(filepath.Join(tmp, "index")))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	setupDedupeFS_Create(t, subject, "/tenant-a/shared.txt", "SHARED")
+	setupDedupeFS_Create(t, subject, "/tenant-a/own.txt", "A-OWN")
+	setupDedupeFS_Create(t, subject, "/tenant-b/shared.txt", "SHARED")
+	setupDedupeFS_Create(t, subject, "/tenant-b/stale.txt", "A-OWN")
+	// removed behind DedupeFS back, leaving a stale index entry
+	if err := os.Remove(filepath.Join(tmp, "link", "tenant-b", "stale.txt")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	usages, err := subject.NamespaceUsage()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []fsdedupe.NamespaceUsage{
+		{Namespace: "/tenant-a", Links: 2, LogicalBytes: 11, ExclusiveBytes: 5, SharedBytes: 6, ChargedBytes: 8},
+		{Namespace: "/tenant-b", Links: 1, LogicalBytes: 6, SharedBytes: 6, ChargedBytes: 3},
+	}; !reflect.DeepEqual(usages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, usages)
+	}
+}
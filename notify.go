@@ -0,0 +1,100 @@
+package fsdedupe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Notifier notifies about run outcome.
+type Notifier interface {
+	// Notify sends run summary, runErr is an error the run failed with (if any).
+	Notify(ctx context.Context, summary Summary, runErr error) error
+}
+
+// WebhookNotifier POSTs run summary as generic JSON
+// ({"files":N,"duplicates":N,"linked":N,"bytes_saved":N,"error":"..."}).
+type WebhookNotifier struct {
+	URL string
+	// Client is an optional HTTP client, http.DefaultClient is used by default.
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, summary Summary, runErr error) error {
+	payload := struct {
+		Summary
+		Error string `json:"error,omitempty"`
+	}{
+		Summary: summary,
+	}
+	if runErr != nil {
+		payload.Error = runErr.Error()
+	}
+	return n.Send(ctx, payload)
+}
+
+// Send POSTs arbitrary JSON-marshalable v.
+func (n *WebhookNotifier) Send(ctx context.Context, v interface{}) error {
+	return postJSON(ctx, n.Client, n.URL, v)
+}
+
+// SlackNotifier POSTs human-readable run summary to Slack-compatible incoming webhook
+// ({"text":"..."}).
+type SlackNotifier struct {
+	URL string
+	// Client is an optional HTTP client, http.DefaultClient is used by default.
+	Client *http.Client
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, summary Summary, runErr error) error {
+	text := fmt.Sprintf(
+		"fsdedupe: %d files processed, %d duplicates found, %d linked, %d bytes saved (%d on disk)",
+		summary.Files,
+		summary.Duplicates,
+		summary.Linked,
+		summary.BytesSaved,
+		summary.DiskBytesSaved,
+	)
+	if runErr != nil {
+		text += "\nerror: " + runErr.Error()
+	}
+
+	payload := struct {
+		Text string `json:"text"`
+	}{
+		Text: text,
+	}
+	return postJSON(ctx, n.Client, n.URL, payload)
+}
+
+// ----------------------------------------------------------------------------
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post %q: unexpected status %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var payload map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %s", err)
+		}
+	}))
+	defer srv.Close()
+
+	subject := &fsdedupe.WebhookNotifier{URL: srv.URL}
+	summary := fsdedupe.Summary{Files: 3, Duplicates: 2, Linked: 1, BytesSaved: 4}
+	if err := subject.Notify(context.Background(), summary, errors.New("DUMMY")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := payload["linked"], float64(1); actual != expected {
+		t.Errorf("expected linked %v, got %v", expected, actual)
+	}
+	if actual, expected := payload["bytes_saved"], float64(4); actual != expected {
+		t.Errorf("expected bytes_saved %v, got %v", expected, actual)
+	}
+	if actual, expected := payload["error"], "DUMMY"; actual != expected {
+		t.Errorf("expected error %v, got %v", expected, actual)
+	}
+}
+
+func TestWebhookNotifier_badStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	subject := &fsdedupe.WebhookNotifier{URL: srv.URL}
+	if err := subject.Notify(context.Background(), fsdedupe.Summary{}, nil); err == nil {
+		t.Fatalf("expected error, got none")
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var payload struct {
+		Text string `json:"text"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %s", err)
+		}
+	}))
+	defer srv.Close()
+
+	subject := &fsdedupe.SlackNotifier{URL: srv.URL}
+	summary := fsdedupe.Summary{Files: 3, Duplicates: 2, Linked: 1, BytesSaved: 4}
+	if err := subject.Notify(context.Background(), summary, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := "1 linked, 4 bytes saved"; !strings.Contains(payload.Text, expected) {
+		t.Errorf("expected text to contain %q, got %q", expected, payload.Text)
+	}
+}
@@ -0,0 +1,25 @@
+package fsdedupe
+
+import (
+	"os"
+	"syscall"
+)
+
+// openForWrite reports if file is open for writing by any process:
+// a read lease can't be taken then (EAGAIN).
+// It is false if leases are not supported (network filesystems) or not permitted (not file owner).
+// https://man7.org/linux/man-pages/man2/fcntl.2.html
+func openForWrite(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_SETLEASE, syscall.F_RDLCK)
+	if errno != 0 {
+		return errno == syscall.EAGAIN
+	}
+	syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_SETLEASE, syscall.F_UNLCK)
+	return false
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package fsdedupe
+
+func openForWrite(filename string) bool {
+	return false
+}
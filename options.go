@@ -0,0 +1,390 @@
+package fsdedupe
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EmptyPolicy defines how zero-byte files are handled:
+// all of them hash identically, and linking them to one canonical empty file is rarely desirable.
+type EmptyPolicy int
+
+const (
+	// EmptySkip ignores empty files (default).
+	EmptySkip EmptyPolicy = iota
+	// EmptyLink deduplicates empty files as any other ones.
+	EmptyLink
+	// EmptyReport reports (logs and counts as duplicates) empty files, but does not link them.
+	EmptyReport
+)
+
+// Option configures DedupeSymlink.
+type Option func(*options)
+
+type options struct {
+	logger       *log.Logger
+	networkSafe  bool
+	largestFirst bool
+	onLinked     func(filename, target string) error
+	limiter      Limiter
+	alertPolicy  AlertPolicy
+	onAlert      func(Alert) error
+	summary      *Summary
+	onCheckpoint func(Checkpoint) error
+	resume       Checkpoint
+
+	concurrency    int
+	scheduling     Scheduling
+	maxOpenFiles   int
+	maxIndexMemory int64
+	maxLinks       int
+	emptyPolicy    EmptyPolicy
+	minSize        int64
+	excludes       []string
+	forkPolicy     ForkPolicy
+	identity       Identity
+	onMediaGroup   func(MediaGroup) error
+	onHashed       func(filename, hash string, size int64) error
+	ignorePerm     bool
+	onPermDenied   func(filename string, err error) error
+	onSkipped      func(filename string, reason SkipReason, detail string) error
+	sameDevice     bool
+	originalsDir   string
+	linkStrategy   LinkStrategy
+	fsStrategies   map[string]LinkStrategy // by FS type
+	compatRules    []CompatRule
+	shadowRoot     string
+	shadowDir      string
+	shadow         *shadowTree // resolved shadowRoot, shadowDir
+	abort          context.Context
+	journal        string
+
+	tracer trace.Tracer
+
+	approvedOnly bool
+	report       *RunReport
+
+	hashCache     *HashCache
+	importNames   func(rel string) (string, bool)
+	restrictRoots bool
+	allowedRoots  []string
+	roots         *rootChecker // resolved allowedRoots
+
+	// plan collects link replacements instead of applying them (see PlanSymlink)
+	plan *DedupePlan
+	// scanOnly neither applies nor collects link replacements (see ScanGroups)
+	scanOnly bool
+	onGroup  func(DuplicateGroup) error
+
+	// dryRun only reports link replacements (see WithDryRun)
+	dryRun bool
+
+	// DedupeDirSymlink walk, see WithDirWalk
+	walkCache *ScanCache
+	walkOpts  []WalkOption
+}
+
+func buildOptions(opts []Option) *options {
+	o := &options{
+		logger:  log.New(io.Discard, "", 0),
+		summary: new(Summary),
+		tracer:  noopTracer,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLogger sets the logger for diagnostic messages.
+// Diagnostics are discarded by default.
+func WithLogger(l *log.Logger) Option {
+	return func(o *options) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// WithDryRun makes DedupeSymlink (and DedupeDirSymlink) only find and log duplicates, touching no files
+// (Summary counting them as Duplicates, not Linked), and RewriteLinkTargets only check symlinks.
+// To review replacements before applying them, see PlanSymlink.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithNetworkSafe enables network-filesystem (NFS/SMB) safe mode:
+// target dirs are probed (see ProbeFS) before linking,
+// and duplicates in dirs without symlink support are only reported (logged), but left as is.
+// So are duplicates in dirs without atomic rename support, if replacing them relies on renames
+// (WithJournal, non-symlink link strategies).
+func WithNetworkSafe() Option {
+	return func(o *options) {
+		o.networkSafe = true
+	}
+}
+
+// WithLargestFirst makes DedupeSymlink read all the input upfront,
+// and process size-collision groups in descending order of potential savings
+// (size * duplicate count), so the biggest wins land first even if the run is interrupted.
+// Files of unique sizes come last, still hashed and counted the same (see Summary.Files and WithOnHashed).
+func WithLargestFirst() Option {
+	return func(o *options) {
+		o.largestFirst = true
+	}
+}
+
+// WithOnLinked sets a callback, called for every filename replaced by a symlink to target.
+// Returning an error from callback aborts the run.
+func WithOnLinked(fn func(filename, target string) error) Option {
+	return func(o *options) {
+		o.onLinked = fn
+	}
+}
+
+// WithLimiter throttles file reading (hashing) throughput.
+func WithLimiter(l Limiter) Option {
+	return func(o *options) {
+		o.limiter = l
+	}
+}
+
+// WithAlerts sets a callback, called (after all input is processed)
+// for every duplicate group exceeding policy thresholds.
+// Returning an error from callback aborts the run.
+func WithAlerts(policy AlertPolicy, fn func(Alert) error) Option {
+	return func(o *options) {
+		o.alertPolicy = policy
+		o.onAlert = fn
+	}
+}
+
+// WithSummary makes DedupeSymlink (and ApplyPlan) fill s with run statistics as it goes,
+// in addition to the ones DedupeSymlink returns.
+func WithSummary(s *Summary) Option {
+	return func(o *options) {
+		if s != nil {
+			o.summary = s
+		}
+	}
+}
+
+// WithCheckpoint sets a callback, called when the run is interrupted (ctx is done),
+// with a checkpoint of remaining input and hash index to resume from later (see WithResume).
+// Remaining input is drained from the iterator.
+// Returning an error from callback fails the run.
+func WithCheckpoint(fn func(Checkpoint) error) Option {
+	return func(o *options) {
+		o.onCheckpoint = fn
+	}
+}
+
+// WithResume seeds hash index from a checkpoint (see WithCheckpoint),
+// so files processed before interruption are still matched as canonical ones.
+// Remaining input is expected to be passed to DedupeSymlink by caller (see Slice).
+func WithResume(cp Checkpoint) Option {
+	return func(o *options) {
+		o.resume = cp
+	}
+}
+
+// WithConcurrency sets a number of files hashed in parallel (1 by default).
+// Results are still processed in input order, so first-seen file remains the canonical one.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithMaxOpenFiles limits a number of files opened (for hashing) simultaneously,
+// workers block until a slot is available (0 - unlimited).
+func WithMaxOpenFiles(n int) Option {
+	return func(o *options) {
+		o.maxOpenFiles = n
+	}
+}
+
+// WithMaxIndexMemory sets a (rough) memory budget for the hash index, bytes (0 - unlimited).
+// Once exceeded, oldest index entries are evicted (logged),
+// so their later duplicates are not linked (nor alerted/checkpointed).
+func WithMaxIndexMemory(bytes int64) Option {
+	return func(o *options) {
+		o.maxIndexMemory = bytes
+	}
+}
+
+// WithMaxLinks caps a number of duplicates linked to a single canonical file (0 - unlimited).
+// The next duplicate past the cap is kept as is and becomes a new canonical file for later ones,
+// which limits the blast radius of a corrupted or deleted canonical file.
+func WithMaxLinks(n int) Option {
+	return func(o *options) {
+		o.maxLinks = n
+	}
+}
+
+// WithEmptyPolicy sets zero-byte files handling policy (EmptySkip by default).
+func WithEmptyPolicy(p EmptyPolicy) Option {
+	return func(o *options) {
+		o.emptyPolicy = p
+	}
+}
+
+// WithMinSize makes DedupeSymlink skip (as SkipTooSmall) non-empty files smaller than n bytes without hashing them,
+// as linking them saves next to nothing; empty files are handled by EmptyPolicy.
+func WithMinSize(n int64) Option {
+	return func(o *options) {
+		o.minSize = n
+	}
+}
+
+// WithForkPolicy sets how duplicates having forks (macOS resource forks, Windows alternate data streams)
+// are handled, see ForkPolicy.
+func WithForkPolicy(p ForkPolicy) Option {
+	return func(o *options) {
+		o.forkPolicy = p
+	}
+}
+
+// WithMediaGroups sets a callback, called (after all input is processed)
+// for every group of media files sharing EXIF capture metadata (see MediaKey),
+// but having different content (e.g. different edits/exports of the same shot).
+// Groups list the first-seen file of each distinct content only.
+// Returning an error from callback aborts the run.
+func WithMediaGroups(fn func(MediaGroup) error) Option {
+	return func(o *options) {
+		o.onMediaGroup = fn
+	}
+}
+
+// WithOnHashed sets a callback, called for every processed (hashed) file in input order,
+// for example to feed a shared hash index (see IndexClient).
+// Returning an error from callback aborts the run.
+func WithOnHashed(fn func(filename, hash string, size int64) error) Option {
+	return func(o *options) {
+		o.onHashed = fn
+	}
+}
+
+// WithIgnorePermissionDenied makes DedupeSymlink skip files it has no permission to read or replace
+// (instead of failing the run), counting them in Summary.PermissionDenied.
+// Optional callback is called for every skipped file, returning an error from it aborts the run.
+func WithIgnorePermissionDenied(fn func(filename string, err error) error) Option {
+	return func(o *options) {
+		o.ignorePerm = true
+		o.onPermDenied = fn
+	}
+}
+
+// WithOnSkipped sets a callback, called for every file not linked (see SkipReason)
+// with a human-readable detail, e.g. to audit why expected duplicates weren't linked.
+// Returning an error from callback aborts the run.
+func WithOnSkipped(fn func(filename string, reason SkipReason, detail string) error) Option {
+	return func(o *options) {
+		o.onSkipped = fn
+	}
+}
+
+// WithSameDevice makes DedupeSymlink leave duplicates residing on another device (filesystem) than their canonical file,
+// so symlinks never point into other (e.g. removable) mounts.
+func WithSameDevice() Option {
+	return func(o *options) {
+		o.sameDevice = true
+	}
+}
+
+// WithOriginalsDir makes DedupeSymlink move canonical file of each linked duplicate group into dir
+// (named by content hash, like DedupeFS data files), replacing it with a symlink too,
+// so all the unique deduplicated content resides (and can be backed up) in a single place.
+// Content already in dir is reused. Ignored with WithPlan and WithShadowTree.
+func WithOriginalsDir(dir string) Option {
+	return func(o *options) {
+		o.originalsDir = dir
+	}
+}
+
+// WithLinkStrategy makes DedupeSymlink and ApplyPlan replace duplicates by links of given strategy
+// instead of symlinks, e.g. LinkAuto to pick the best one per filesystem.
+func WithLinkStrategy(strategy LinkStrategy) Option {
+	return func(o *options) {
+		o.linkStrategy = strategy
+	}
+}
+
+// WithFSLinkStrategy overrides link strategy (see WithLinkStrategy) for duplicates on filesystems of given type (see FSStat).
+// Can be given multiple times for different filesystem types.
+func WithFSLinkStrategy(fsType string, strategy LinkStrategy) Option {
+	return func(o *options) {
+		if o.fsStrategies == nil {
+			o.fsStrategies = make(map[string]LinkStrategy)
+		}
+		o.fsStrategies[fsType] = strategy
+	}
+}
+
+// WithShadowTree makes DedupeSymlink leave input files untouched (e.g. on a read-only mount)
+// and build a deduplicated view of root tree in dir instead:
+// a symlink at the same relative path for every processed input file (which must be within root),
+// pointing to the canonical file of its content (or to the file itself), regardless of WithLinkStrategy.
+// Files skipped before hashing (non-regular, empty with EmptySkip etc) are not represented.
+// Summary reports savings of the view. Dir must not be within root.
+func WithShadowTree(root, dir string) Option {
+	return func(o *options) {
+		o.shadowRoot, o.shadowDir = root, dir
+	}
+}
+
+// WithAbort enables two-level cancellation:
+// once DedupeSymlink ctx is done, no new files are taken, but in-flight ones are still hashed and processed
+// (and a checkpoint is written, see WithCheckpoint);
+// once abort is done, in-flight hashing is cancelled, and in-flight link action is rolled back (see WithJournal).
+// Without this option, ctx cancels in-flight hashing right away.
+func WithAbort(abort context.Context) Option {
+	return func(o *options) {
+		o.abort = abort
+	}
+}
+
+// WithRunReport makes DedupeSymlink (and ApplyPlan) collect linked duplicate groups,
+// savings per directory and skipped files into r (see NewRunReport).
+func WithRunReport(r *RunReport) Option {
+	return func(o *options) {
+		o.report = r
+	}
+}
+
+// WithAllowedRoots makes DedupeSymlink skip (log, but neither hash nor count) input symlinks,
+// which resolve outside of roots (or can't be resolved), e.g. user-created links to other volumes,
+// so re-scanning a tree never reads unrelated files.
+// Without roots, input symlinks are skipped altogether.
+// Regular files are processed as usual.
+func WithAllowedRoots(roots ...string) Option {
+	return func(o *options) {
+		o.restrictRoots = true
+		o.allowedRoots = roots
+	}
+}
+
+// WithHashCache makes DedupeSymlink (and DedupeFS Import) reuse hashes of files unchanged (size, mtime)
+// since cached, instead of reading them, and cache newly computed ones.
+// The same cache may be passed to both, so an import of an already deduplicated tree reads new files only.
+func WithHashCache(c *HashCache) Option {
+	return func(o *options) {
+		o.hashCache = c
+	}
+}
+
+// WithJournal makes DedupeSymlink record every link action to journal file before performing it,
+// and move duplicates aside (instead of removing) until symlinks are in place,
+// so actions interrupted by abort (see WithAbort) are rolled back,
+// and ones interrupted by a crash can be rolled back with RollbackJournal.
+// Journal is left empty after a successful action.
+func WithJournal(journal string) Option {
+	return func(o *options) {
+		o.journal = journal
+	}
+}
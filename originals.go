@@ -0,0 +1,58 @@
+package fsdedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// originalsPath returns a path of content (hash) within originals dir (see WithOriginalsDir),
+// named like DedupeFS data files.
+func originalsPath(dir, hash string) string {
+	return filepath.Join(dir, hash+DataFileExt)
+}
+
+// withinDir reports if path is within dir (or is dir itself); both must be absolute or relative to the same dir.
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// relocateCanonical moves canonical file of content hash into originals dir (see WithOriginalsDir),
+// replacing it with a symlink to the moved one, and returns the new canonical path.
+// If originals dir has this content already, canonical file is just linked to it (reused).
+func relocateCanonical(ctx context.Context, dir, canonical, hash string, size int64, limiter Limiter) (_ string, reused bool, _ error) {
+	dst := originalsPath(dir, hash)
+
+	if stat, err := os.Lstat(dst); err == nil {
+		if !stat.Mode().IsRegular() || stat.Size() != size {
+			return "", false, fmt.Errorf("original %q of %q is not a regular file of the same size", dst, canonical)
+		}
+		if err := replaceSymlink(dst, canonical); err != nil {
+			return "", false, fmt.Errorf("link canonical %q to original %q: %w", canonical, dst, err)
+		}
+		return dst, true, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", false, fmt.Errorf("lstat %q: %w", dst, err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, fmt.Errorf("ensure dir %q: %w", dir, err)
+	}
+	if err := os.Rename(canonical, dst); crossDevice(err) {
+		// originals dir may be on another device
+		if err := moveByCopy(ctx, canonical, dst, limiter); err != nil {
+			return "", false, fmt.Errorf("move canonical %q to %q: %w", canonical, dst, err)
+		}
+	} else if err != nil {
+		return "", false, fmt.Errorf("move canonical %q to %q: %w", canonical, dst, err)
+	}
+	if err := os.Symlink(dst, canonical); err != nil {
+		return "", false, fmt.Errorf("symlink %q -> %q: %w", canonical, dst, err)
+	}
+	return dst, false, nil
+}
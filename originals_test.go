@@ -0,0 +1,78 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeSymlink_originalsDir(t *testing.T) {
+	tmp := t.TempDir()
+	originals := filepath.Join(tmp, "originals")
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+	uniq := filepath.Join(tmp, "uniq.txt")
+	writeFile(t, uniq, "UNIQ")
+
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, file2, file3, uniq},
+	}, fsdedupe.WithOriginalsDir(originals))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Linked, 2; actual != expected {
+		t.Fatalf("expected %d linked, got %d", expected, actual)
+	}
+	// first-seen path symlink is the only new one
+	if actual, expected := summary.InodesUsed, int64(1); actual != expected {
+		t.Fatalf("expected %d inodes used, got %d", expected, actual)
+	}
+
+	entries, err := os.ReadDir(originals)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(entries), 1; actual != expected {
+		t.Fatalf("expected %d originals, got %d", expected, actual)
+	}
+	original := filepath.Join(originals, entries[0].Name())
+	if actual, expected := filepath.Ext(original), fsdedupe.DataFileExt; actual != expected {
+		t.Fatalf("expected original extension %q, got %q", expected, actual)
+	}
+	if stat := lstat(t, original); !stat.Mode().IsRegular() {
+		t.Fatalf("expected original %q to be a regular file, got %s", original, stat.Mode())
+	}
+
+	for _, filename := range []string{file1, file2, file3} {
+		if actual, expected := readlink(t, filename), original; actual != expected {
+			t.Fatalf("expected %q to link %q, got %q", filename, expected, actual)
+		}
+	}
+	if stat := lstat(t, uniq); !stat.Mode().IsRegular() {
+		t.Fatalf("expected unique file %q to be left as is, got %s", uniq, stat.Mode())
+	}
+
+	// content already in originals dir is reused
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "DUPE")
+	file5 := filepath.Join(tmp, "file5.txt")
+	writeFile(t, file5, "DUPE")
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file4, file5},
+	}, fsdedupe.WithOriginalsDir(originals)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, filename := range []string{file4, file5} {
+		if actual, expected := readlink(t, filename), original; actual != expected {
+			t.Fatalf("expected %q to link %q, got %q", filename, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// pinDir is a data dir subdir keeping pins, one empty file per pinned hash.
+const pinDir = ".pins"
+
+// Pin protects data file of a given content hash from GC, even if it is (temporarily) unreferenced,
+// e.g. while content is being migrated between namespaces.
+// Pins are persisted in data dir. Content does not have to be stored yet.
+func (s *DedupeFS) Pin(hash string) error {
+	path, err := s.pinPath(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), s.dirPerm); err != nil {
+		return fmt.Errorf("ensure dir for %q: %w", path, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create pin %q: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Unpin removes a pin (see Pin), unpinning not pinned hashes is a no-op.
+func (s *DedupeFS) Unpin(hash string) error {
+	path, err := s.pinPath(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove pin %q: %w", path, err)
+	}
+	return nil
+}
+
+// Pins lists pinned content hashes, sorted.
+func (s *DedupeFS) Pins() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dataDir, pinDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read pins: %w", err)
+	}
+
+	var hashes []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && validHash(entry.Name()) {
+			hashes = append(hashes, entry.Name())
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+func (s *DedupeFS) pinPath(hash string) (string, error) {
+	if !validHash(hash) {
+		return "", fmt.Errorf("pin %q: %w", hash, ErrInvalidHash)
+	}
+	return filepath.Join(s.dataDir, pinDir, hash), nil
+}
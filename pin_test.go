@@ -0,0 +1,53 @@
+package fsdedupe_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDedupeFS_Pin(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	absDataPath := filepath.Join(tmp, "data", contentsHash+".bin")
+
+	setupDedupeFS_Create(t, subject, "file.txt", "DUMMY")
+	setupDedupeFS_Create(t, subject, "other.txt", "OTHER")
+	if err := subject.Pin(contentsHash); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	subject.Remove("file.txt")
+	subject.Remove("other.txt")
+
+	// pinned data file survives GC while unreferenced
+	report, err := subject.GC()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Removed, 1; actual != expected {
+		t.Errorf("expected %d removed data files, got %d", expected, actual)
+	}
+	if expected := []string{contentsHash}; !reflect.DeepEqual(report.Pinned, expected) {
+		t.Errorf("expected pinned %q, got %q", expected, report.Pinned)
+	}
+	if _, err := os.Stat(absDataPath); err != nil {
+		t.Fatalf("expected pinned data file to still exist, but got: %v", err)
+	}
+
+	if err := subject.Unpin(contentsHash); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := subject.GC(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := os.Stat(absDataPath); !os.IsNotExist(err) {
+		t.Fatalf("expected unpinned data file to be gone, but got: %v", err)
+	}
+
+	if err := subject.Pin("../../escape"); err == nil {
+		t.Errorf("expected invalid hash error, got none")
+	}
+}
@@ -0,0 +1,261 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type hashed struct {
+	filename string
+	stat     os.FileInfo
+	hash     string
+	media    *MediaKey
+	forks    []string // see ForkPolicy
+	err      error
+
+	notWalked bool // filename is a dir not walked (see WalkSkipError), not an input file
+}
+
+// hashPipeline reads filenames from an iterator and hashes them with a pool of workers,
+// yielding results in input order.
+// Bounded queues provide back-pressure: at most concurrency files are read ahead.
+type hashPipeline struct {
+	filenames Iterator
+	ordered   chan chan hashed
+	cancel    context.CancelFunc
+
+	readerDone chan struct{}
+	workers    sync.WaitGroup
+	stopOnce   sync.Once
+
+	// unqueued is a filename consumed from iterator, but not queued due to cancellation
+	unqueued string
+}
+
+// startHashing starts reading filenames until ctx is done.
+// In-flight files are hashed until ctx is done too, or until abort is done, if set (see WithAbort).
+func startHashing(ctx context.Context, filenames Iterator, o *options) *hashPipeline {
+	ctx, cancelRead := context.WithCancel(ctx)
+	hashCtx, cancelHash := ctx, context.CancelFunc(func() {})
+	if o.abort != nil {
+		hashCtx, cancelHash = context.WithCancel(o.abort)
+	}
+	cancel := func() {
+		cancelRead()
+		cancelHash()
+	}
+
+	concurrency := o.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var openFiles chan struct{}
+	if o.maxOpenFiles > 0 {
+		openFiles = make(chan struct{}, o.maxOpenFiles)
+	}
+
+	p := &hashPipeline{
+		filenames:  filenames,
+		ordered:    make(chan chan hashed, concurrency),
+		cancel:     cancel,
+		readerDone: make(chan struct{}),
+	}
+
+	type job struct {
+		filename string
+		res      chan hashed
+	}
+	jobs := make(chan job)
+
+	for i := 0; i < concurrency; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+
+			schedErr := o.scheduling.lockThread()
+			digest := sha512.New()
+			for j := range jobs {
+				if schedErr != nil {
+					j.res <- hashed{filename: j.filename, err: schedErr}
+					continue
+				}
+				_, span := o.tracer.Start(ctx, "fsdedupe.hash", trace.WithAttributes(attribute.String("fsdedupe.path", j.filename)))
+				res := hashFile(hashCtx, digest, j.filename, o, openFiles)
+				var size int64
+				if res.stat != nil {
+					size = res.stat.Size()
+				}
+				endSpan(span, res.err, attribute.Int64("fsdedupe.bytes", size))
+				j.res <- res
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.readerDone)
+		defer close(p.ordered)
+		defer close(jobs)
+
+		for ctx.Err() == nil {
+			filename, err := filenames.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			res := make(chan hashed, 1)
+			skipped := false // not to be hashed
+			var walkSkip *WalkSkipError
+			if errors.As(err, &walkSkip) {
+				res <- hashed{filename: walkSkip.Dir, err: &skipError{reason: walkSkip.Reason, detail: walkSkip.Detail}, notWalked: true}
+				err, skipped = nil, true
+			} else if err != nil {
+				res <- hashed{err: iteratorError(err)}
+			} else if detail := o.excluded(filename); detail != "" {
+				res <- hashed{filename: filename, err: &skipError{reason: SkipExcluded, detail: detail}}
+				skipped = true
+			}
+
+			select {
+			case p.ordered <- res:
+			case <-ctx.Done():
+				p.unqueued = filename
+				return
+			}
+			if err != nil {
+				return
+			} else if skipped {
+				continue
+			}
+
+			select {
+			case jobs <- job{filename: filename, res: res}:
+			case <-ctx.Done():
+				res <- hashed{filename: filename, err: ctx.Err()}
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// next returns next hashed file in input order, false when input is drained.
+func (p *hashPipeline) next() (hashed, bool) {
+	res, ok := <-p.ordered
+	if !ok {
+		return hashed{}, false
+	}
+	return <-res, true
+}
+
+// stop stops the pipeline, returning filenames consumed from iterator, but not yet returned by next.
+// Iterator can be used again once stop returns.
+func (p *hashPipeline) stop() []string {
+	var pending []string
+	p.stopOnce.Do(func() {
+		p.cancel()
+
+		for res := range p.ordered {
+			if h := <-res; h.filename != "" && !h.notWalked {
+				pending = append(pending, h.filename)
+			}
+		}
+		<-p.readerDone
+		p.workers.Wait()
+
+		if p.unqueued != "" {
+			pending = append(pending, p.unqueued)
+		}
+	})
+	return pending
+}
+
+func hashFile(ctx context.Context, digest hash.Hash, filename string, o *options, openFiles chan struct{}) hashed {
+	res := hashed{filename: filename}
+
+	// scanning live dirs races with other processes deleting files
+	stat, err := statInput(filename)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.stat = stat
+	if stat.Size() != 0 && stat.Size() < o.minSize {
+		res.err = &skipError{reason: SkipTooSmall, detail: fmt.Sprintf("smaller than %d bytes", o.minSize)}
+		return res
+	}
+
+	if openFiles != nil {
+		select {
+		case openFiles <- struct{}{}:
+		case <-ctx.Done():
+			res.err = ctx.Err()
+			return res
+		}
+		defer func() { <-openFiles }()
+	}
+
+	hash, ok := o.hashCache.lookup(filename, stat.Size(), stat.ModTime())
+	if !ok {
+		digest.Reset()
+		if hash, err = hashContents(ctx, digest, filename, o.limiter); err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			res.err = ctx.Err()
+			return res
+		} else if errors.Is(err, fs.ErrNotExist) {
+			res.err = &skipError{reason: SkipChanged, detail: "vanished since listed"}
+			return res
+		} else if err != nil {
+			res.err = fmt.Errorf("hash contents of %q: %w", filename, err)
+			return res
+		}
+		o.hashCache.store(filename, stat.Size(), stat.ModTime(), hash)
+	}
+	res.hash = hash
+
+	if res.forks, err = listForks(filename); err != nil {
+		res.err = fmt.Errorf("list forks of %q: %w", filename, err)
+		return res
+	}
+	if len(res.forks) != 0 && o.forkPolicy == ForkHash {
+		if res.hash, err = hashForks(ctx, digest, filename, hash, res.forks, o.limiter); err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			res.err = ctx.Err()
+			return res
+		} else if err != nil {
+			res.err = fmt.Errorf("hash forks of %q: %w", filename, err)
+			return res
+		}
+	}
+
+	if o.identity != 0 {
+		if res.hash, err = hashIdentity(digest, filename, res.hash, stat, o.identity); err != nil {
+			res.err = fmt.Errorf("hash identity of %q: %w", filename, err)
+			return res
+		}
+	}
+
+	res.media = readMediaKey(filename, o)
+	return res
+}
+
+// readMediaKey reads media key, if media groups are requested (see WithMediaGroups) and filename is a media file.
+func readMediaKey(filename string, o *options) *MediaKey {
+	if o.onMediaGroup == nil {
+		return nil
+	}
+	key, err := ReadMediaKey(filename)
+	if err != nil {
+		return nil
+	}
+	return &key
+}
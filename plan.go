@@ -0,0 +1,450 @@
+package fsdedupe
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe/artifact"
+)
+
+// PlanAction is a planned replacement of a duplicate with a symlink.
+type PlanAction struct {
+	// Filename is a duplicate to be replaced.
+	Filename string `json:"filename"`
+	// Target is a (canonical) file the symlink is going to point to.
+	Target string `json:"target"`
+	// Size is a duplicate size at planning time.
+	Size int64 `json:"size"`
+	// Hash is a hex-encoded content hash of both duplicate and target at planning time,
+	// re-verified by ApplyPlan (empty for plans of fsdedupe versions preceding it, which are not re-verified).
+	Hash string `json:"hash,omitempty"`
+}
+
+// DedupePlan is a list of link replacements, computed by PlanSymlink and applied by ApplyPlan.
+type DedupePlan struct {
+	Actions []PlanAction `json:"actions"`
+	// Reviews are duplicate group reviews by group target (see Review).
+	Reviews map[string]PlanReview `json:"reviews,omitempty"`
+}
+
+// ReviewStatus is a duplicate group review status.
+type ReviewStatus string
+
+const (
+	// ReviewPending is a not yet reviewed group, applied unless WithApprovedOnly is given.
+	ReviewPending ReviewStatus = ""
+	// ReviewApproved is a group approved to be applied.
+	ReviewApproved ReviewStatus = "approved"
+	// ReviewRejected is a group never to be applied.
+	ReviewRejected ReviewStatus = "rejected"
+	// ReviewDeferred is a group postponed to a later review.
+	ReviewDeferred ReviewStatus = "deferred"
+)
+
+// PlanReview is a review of a duplicate group: all plan actions having the same target.
+type PlanReview struct {
+	// Status is a review status.
+	Status ReviewStatus `json:"status,omitempty"`
+	// Reviewer is who reviewed the group.
+	Reviewer string `json:"reviewer,omitempty"`
+	// Note is a free-form annotation.
+	Note string `json:"note,omitempty"`
+}
+
+// Review sets a review of a duplicate group, identified by its target (see PlanAction),
+// returning false if plan has no such group.
+func (p *DedupePlan) Review(target string, review PlanReview) bool {
+	found := false
+	for _, action := range p.Actions {
+		if action.Target == target {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	if p.Reviews == nil {
+		p.Reviews = make(map[string]PlanReview)
+	}
+	p.Reviews[target] = review
+	return true
+}
+
+// WithApprovedOnly makes ApplyPlan apply approved duplicate groups only (see DedupePlan.Review),
+// so a plan generated by one person is only executed after another one approves it.
+func WithApprovedOnly() Option {
+	return func(o *options) {
+		o.approvedOnly = true
+	}
+}
+
+// PlanSymlink computes DedupeSymlink link replacements without touching any files.
+// DedupeSymlink options are honored, though WithOnLinked callback is only called by ApplyPlan.
+func PlanSymlink(ctx context.Context, filenames Iterator, opts ...Option) (DedupePlan, error) {
+	plan := new(DedupePlan)
+	opts = append(opts[:len(opts):len(opts)], func(o *options) {
+		o.plan = plan
+	})
+	if _, err := DedupeSymlink(ctx, filenames, opts...); err != nil {
+		return *plan, err
+	}
+	return *plan, nil
+}
+
+// ApplyPlan applies link replacements.
+// Actions are batched per directory: each directory is opened once,
+// and duplicates are atomically replaced with renames relative to it,
+// which saves path lookups (that dominate runtime on network filesystems).
+// Duplicates changed since planning (no longer regular files, of a different size or content, see PlanAction.Hash),
+// or having their target changed, are logged and left as is (see SkipChanged).
+// Rejected and deferred duplicate groups (see DedupePlan.Review) are skipped,
+// so are duplicates in root-squashed dirs (see RootSquashed) and, with WithNetworkSafe, in dirs without atomic rename support.
+// Each duplicate group is applied as an independent transaction: if linking a duplicate fails,
+// already linked duplicates of the group are rolled back (re-materialized from the canonical file,
+// see SkipFailed) and other groups are applied as usual; failures of all groups are returned joined at the end.
+// WithLogger, WithOnLinked, WithSummary, WithApprovedOnly, WithRunReport, WithLinkStrategy and WithCompatRules options are honored.
+func ApplyPlan(ctx context.Context, plan DedupePlan, opts ...Option) error {
+	o := buildOptions(opts)
+
+	var dirs []string
+	byDir := make(map[string][]PlanAction)
+	skipped := make(map[string]struct{})
+	for _, action := range plan.Actions {
+		if status := plan.Reviews[action.Target].Status; status == ReviewRejected || status == ReviewDeferred ||
+			(o.approvedOnly && status != ReviewApproved) {
+			if _, ok := skipped[action.Target]; !ok {
+				skipped[action.Target] = struct{}{}
+				if status == ReviewPending {
+					status = "pending"
+				}
+				o.logger.Printf("skipping duplicates of %q (review status %s)", action.Target, status)
+			}
+			if err := o.skipped(action.Filename, SkipExcluded, fmt.Sprintf("review status %s", status)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		dir := filepath.Dir(action.Filename)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], action)
+	}
+
+	if err := validateCompatRules(o.compatRules); err != nil {
+		return err
+	}
+	inodes := newInodeBudget(o.logger)
+	strategies := newStrategist(o.linkStrategy, o.fsStrategies, o.compatRules)
+	tx := &applyTx{applied: make(map[string][]appliedLink), failed: make(map[string]struct{}), targets: make(map[string]string)}
+	for _, dir := range dirs {
+		if err := applyDir(ctx, dir, byDir[dir], inodes, strategies, tx, o); err != nil {
+			return err
+		}
+	}
+	return errors.Join(tx.errs...)
+}
+
+// applyTx makes each duplicate group (actions having the same target) an independent transaction:
+// a group failing to apply is rolled back as a whole, while other groups are applied as usual.
+type applyTx struct {
+	applied map[string][]appliedLink // by target
+	failed  map[string]struct{}      // targets
+	targets map[string]string        // target -> content hash, verified once per run
+	errs    []error
+}
+
+// appliedLink is a duplicate replaced with a link.
+type appliedLink struct {
+	filename string
+	stat     os.FileInfo // of the replaced duplicate
+	used     LinkStrategy
+}
+
+// fail rolls back already applied duplicates of target group (re-materializing them from target),
+// records err and accounts the rolled back (and remaining) duplicates as skipped.
+func (tx *applyTx) fail(ctx context.Context, action PlanAction, err error, o *options) error {
+	err = fmt.Errorf("apply duplicates of %q: %w", action.Target, err)
+	o.logger.Printf("%s, rolling back the group", err)
+	tx.failed[action.Target] = struct{}{}
+	tx.errs = append(tx.errs, err)
+
+	for _, link := range tx.applied[action.Target] {
+		if _, err := restoreFile(ctx, action.Target, link.filename, o.limiter); err != nil {
+			// still linked, so content is not lost
+			tx.errs = append(tx.errs, fmt.Errorf("roll back %q: %w", link.filename, err))
+			continue
+		}
+		// duplicate metadata, not the canonical one
+		if err := os.Chmod(link.filename, link.stat.Mode().Perm()); err != nil {
+			tx.errs = append(tx.errs, fmt.Errorf("roll back %q: chmod: %w", link.filename, err))
+		}
+		if err := os.Chtimes(link.filename, time.Time{}, link.stat.ModTime()); err != nil {
+			tx.errs = append(tx.errs, fmt.Errorf("roll back %q: chtimes: %w", link.filename, err))
+		}
+
+		o.summary.Linked--
+		o.summary.BytesSaved -= link.stat.Size()
+		o.summary.DiskBytesSaved -= DiskUsage(link.stat)
+		o.summary.InodesUsed -= inodesUsed(link.used, linkCount(link.stat) > 1)
+		if o.report != nil {
+			o.report.unlinked(link.filename, action.Target, link.stat.Size())
+		}
+		if err := o.skipped(link.filename, SkipFailed, "group rolled back"); err != nil {
+			return err
+		}
+	}
+	delete(tx.applied, action.Target)
+	return o.skipped(action.Filename, SkipFailed, err.Error())
+}
+
+func applyDir(ctx context.Context, dir string, actions []PlanAction, inodes *inodeBudget, strategies *strategist, tx *applyTx, o *options) error {
+	root, err := os.OpenRoot(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		o.logger.Printf("%q vanished since planned, leaving its duplicates as is", dir)
+		for _, action := range actions {
+			if err := o.skipped(action.Filename, SkipChanged, "vanished since planned"); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("open dir %q: %w", dir, err)
+	}
+	defer root.Close()
+
+	// re-checked, as the mount may have changed since planned
+	if detail, err := unsupportedDir(dir, o); err != nil {
+		return err
+	} else if detail != "" {
+		o.logger.Printf("leaving duplicates in %q as is (%s)", dir, detail)
+		for _, action := range actions {
+			if err := o.skipped(action.Filename, SkipUnsupported, detail); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, action := range actions {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if _, ok := tx.failed[action.Target]; ok {
+			if err := o.skipped(action.Filename, SkipFailed, "group rolled back"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		link, reason, detail, err := applyAction(ctx, root, dir, action, inodes, strategies, tx, o.limiter)
+		if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return err
+		} else if err != nil {
+			if err := tx.fail(ctx, action, err, o); err != nil {
+				return err
+			}
+			continue
+		} else if reason != "" {
+			o.logger.Printf("leaving duplicate %q of %q as is (%s)", action.Filename, action.Target, detail)
+			if err := o.skipped(action.Filename, reason, detail); err != nil {
+				return err
+			}
+			continue
+		}
+		tx.applied[action.Target] = append(tx.applied[action.Target], link)
+
+		hardlinked := linkCount(link.stat) > 1
+		o.summary.Linked++
+		o.summary.BytesSaved += link.stat.Size()
+		o.summary.DiskBytesSaved += DiskUsage(link.stat)
+		o.summary.InodesUsed += inodesUsed(link.used, hardlinked)
+		if o.report != nil {
+			o.report.linked(action.Filename, action.Target, link.stat.Size())
+		}
+
+		if o.onLinked != nil {
+			if err := o.onLinked(action.Filename, action.Target); err != nil {
+				return fmt.Errorf("on linked %q: %w", action.Filename, err)
+			}
+		}
+	}
+	return nil
+}
+
+// unsupportedDir returns why duplicates in dir can not be replaced (empty if they can):
+// root squash (see RootSquashed) or, in network-safe mode, no atomic rename support, which applyAction relies on.
+func unsupportedDir(dir string, o *options) (string, error) {
+	if squashed, err := rootSquashed(dir); err != nil {
+		return "", fmt.Errorf("detect root squash: %w", err)
+	} else if squashed {
+		return "root-squashed", nil
+	}
+	if !o.networkSafe {
+		return "", nil
+	}
+	if atomic, err := probeRename(dir); err != nil {
+		return "", fmt.Errorf("probe rename support in %q: %w", dir, err)
+	} else if !atomic {
+		return "atomic rename is not supported", nil
+	}
+	return "", nil
+}
+
+// applyAction replaces a duplicate with a link, unless it (or its target) changed since planned:
+// a skip reason and detail are returned then.
+func applyAction(ctx context.Context, root *os.Root, dir string, action PlanAction, inodes *inodeBudget, strategies *strategist, tx *applyTx, limiter Limiter) (appliedLink, SkipReason, string, error) {
+	link := appliedLink{filename: action.Filename}
+
+	name := filepath.Base(action.Filename)
+	stat, err := root.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return link, SkipChanged, "vanished since planned", nil
+	} else if err != nil {
+		return link, "", "", fmt.Errorf("lstat %q: %w", action.Filename, err)
+	}
+	if !stat.Mode().IsRegular() || stat.Size() != action.Size {
+		return link, SkipChanged, "changed since planned", nil
+	}
+	link.stat = stat
+
+	// never leave a dangling link instead of the last copy of content
+	if _, err := os.Stat(action.Target); errors.Is(err, fs.ErrNotExist) {
+		return link, SkipChanged, "canonical vanished since planned", nil
+	} else if err != nil {
+		return link, "", "", fmt.Errorf("stat %q: %w", action.Target, err)
+	}
+
+	// same-size edits since planned would otherwise be replaced with a link to unrelated content
+	if action.Hash != "" {
+		if actual, err := hashContents(ctx, sha512.New(), filepath.Join(dir, name), limiter); err != nil {
+			return link, "", "", fmt.Errorf("hash contents of %q: %w", action.Filename, err)
+		} else if actual != action.Hash {
+			return link, SkipChanged, "contents changed since planned", nil
+		}
+
+		target, ok := tx.targets[action.Target]
+		if !ok {
+			if target, err = hashContents(ctx, sha512.New(), action.Target, limiter); err != nil {
+				return link, "", "", fmt.Errorf("hash contents of %q: %w", action.Target, err)
+			}
+			tx.targets[action.Target] = target
+		}
+		if target != action.Hash {
+			return link, SkipChanged, "canonical changed since planned", nil
+		}
+	}
+
+	if rule, ok := strategies.keeps(action.Filename); ok {
+		return link, SkipCompat, fmt.Sprintf("compat rule %q", rule.Pattern), nil
+	}
+
+	strategy, err := strategies.pick(action.Filename, action.Target)
+	if err != nil {
+		return link, "", "", fmt.Errorf("pick link strategy for %q: %w", action.Filename, err)
+	}
+
+	// link is created aside first, so a new inode is needed until the file is replaced
+	if strategy != LinkHardlink {
+		if err := inodes.consume(dir); err != nil {
+			return link, "", "", fmt.Errorf("link %q: %w", action.Filename, err)
+		}
+	}
+
+	link.used = strategy
+	if strategy != LinkSymlink {
+		// hardlinks and reflinks need target by path, not within dir root
+		if link.used, err = strategies.replace(strategy, action.Target, action.Filename, stat); err != nil {
+			return link, "", "", err
+		}
+	} else {
+		tmp := "." + name + ".fsdedupe-link"
+		if err := root.Symlink(action.Target, tmp); err != nil {
+			return link, "", "", fmt.Errorf("symlink %q -> %q: %w", filepath.Join(dir, tmp), action.Target, err)
+		}
+		if err := root.Rename(tmp, name); err != nil {
+			root.Remove(tmp)
+			return link, "", "", fmt.Errorf("rename %q -> %q: %w", filepath.Join(dir, tmp), action.Filename, err)
+		}
+	}
+	return link, "", "", nil
+}
+
+// WritePlan writes plan as an artifact (see package artifact), reviews after actions.
+func WritePlan(w io.Writer, plan DedupePlan) error {
+	aw, err := artifact.NewWriter(w, artifact.KindPlan)
+	if err != nil {
+		return err
+	}
+	for _, action := range plan.Actions {
+		if err := aw.Write(artifact.Record{
+			Type:     artifact.TypeAction,
+			Filename: action.Filename,
+			Target:   action.Target,
+			Size:     action.Size,
+			Hash:     action.Hash,
+		}); err != nil {
+			return err
+		}
+	}
+
+	targets := make([]string, 0, len(plan.Reviews))
+	for target := range plan.Reviews {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		review := plan.Reviews[target]
+		if err := aw.Write(artifact.Record{
+			Type:     artifact.TypeReview,
+			Target:   target,
+			Status:   string(review.Status),
+			Reviewer: review.Reviewer,
+			Note:     review.Note,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPlan reads plan written by WritePlan, DiffJSON diff written by WriteDiff
+// (or a single JSON object by fsdedupe versions preceding artifacts).
+func ReadPlan(r io.Reader) (DedupePlan, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return DedupePlan{}, fmt.Errorf("read: %w", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		return readDiff(b)
+	}
+
+	var plan DedupePlan
+	err = readArtifact(bytes.NewReader(b), artifact.KindPlan, &plan, func(rec artifact.Record) {
+		switch rec.Type {
+		case artifact.TypeAction:
+			plan.Actions = append(plan.Actions, PlanAction{Filename: rec.Filename, Target: rec.Target, Size: rec.Size, Hash: rec.Hash})
+		case artifact.TypeReview:
+			if plan.Reviews == nil {
+				plan.Reviews = make(map[string]PlanReview)
+			}
+			plan.Reviews[rec.Target] = PlanReview{Status: ReviewStatus(rec.Status), Reviewer: rec.Reviewer, Note: rec.Note}
+		}
+	})
+	return plan, err
+}
@@ -0,0 +1,395 @@
+package fsdedupe_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestPlanSymlink(t *testing.T) {
+	tmp := t.TempDir()
+	const dupeHash = "5b853931a07284429862382338a94e0c7dc36495790b4e6d7b3b4b8b2aa5c0145c465c759fe29c3b71ba8952bf1ab3fd9ce1052a79f1401f3c8f7f82ab8bd22f" // echo -n DUPE | sha512sum
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	file3 := filepath.Join(tmp, "sub", "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "DUPE")
+
+	file5 := filepath.Join(tmp, "sub", "file5.txt")
+	writeFile(t, file5, "DUPE")
+
+	plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice([]string{file1, file2, file3, file4, file5}))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.DedupePlan{Actions: []fsdedupe.PlanAction{
+		{Filename: file2, Target: file1, Size: 4, Hash: dupeHash},
+		{Filename: file3, Target: file1, Size: 4, Hash: dupeHash},
+		{Filename: file4, Target: file1, Size: 4, Hash: dupeHash},
+		{Filename: file5, Target: file1, Size: 4, Hash: dupeHash},
+	}}); !reflect.DeepEqual(plan, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, plan)
+	}
+
+	// planning does not touch files
+	for _, name := range []string{file2, file3, file4, file5} {
+		if !lstat(t, name).Mode().IsRegular() {
+			t.Fatalf("expected %q to be a regular file, but it is not", name)
+		}
+	}
+
+	// plan survives serialization
+	var buf bytes.Buffer
+	if err := fsdedupe.WritePlan(&buf, plan); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if plan, err = fsdedupe.ReadPlan(&buf); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// changed since planned
+	writeFile(t, file5, "CHANGED")
+
+	var linked []string
+	summary := new(fsdedupe.Summary)
+	if err := fsdedupe.ApplyPlan(context.Background(), plan,
+		fsdedupe.WithSummary(summary),
+		fsdedupe.WithOnLinked(func(filename, _ string) error {
+			linked = append(linked, filename)
+			return nil
+		}),
+	); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// batched per directory, in first-seen order
+	if expected := []string{file2, file4, file3}; !reflect.DeepEqual(linked, expected) {
+		t.Fatalf("expected %q to be linked, got %q", expected, linked)
+	}
+	if actual, expected := summary.Linked, 3; actual != expected {
+		t.Fatalf("expected %d linked, got %d", expected, actual)
+	}
+
+	for _, name := range []string{file2, file3, file4} {
+		if actual, expected := readlink(t, name), file1; actual != expected {
+			t.Fatalf("expected %q to point to %q, got %q", name, expected, actual)
+		}
+	}
+	if !lstat(t, file5).Mode().IsRegular() {
+		t.Fatalf("expected changed %q to be left as is", file5)
+	}
+}
+
+func TestApplyPlan_reviews(t *testing.T) {
+	tmp := t.TempDir()
+
+	var files []string
+	for i, contents := range []string{"A", "A", "B", "B", "C", "C", "D", "D"} {
+		name := filepath.Join(tmp, fmt.Sprintf("file%d.txt", i))
+		writeFile(t, name, contents)
+		files = append(files, name)
+	}
+
+	plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice(files))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for target, status := range map[string]fsdedupe.ReviewStatus{
+		files[0]: fsdedupe.ReviewApproved,
+		files[2]: fsdedupe.ReviewRejected,
+		files[4]: fsdedupe.ReviewDeferred,
+	} {
+		if !plan.Review(target, fsdedupe.PlanReview{Status: status, Reviewer: "bob"}) {
+			t.Fatalf("expected %q group to be found", target)
+		}
+	}
+	if plan.Review(files[1], fsdedupe.PlanReview{Status: fsdedupe.ReviewApproved}) {
+		t.Errorf("expected %q (not a group target) not to be found", files[1])
+	}
+
+	// reviews survive serialization
+	var buf bytes.Buffer
+	if err := fsdedupe.WritePlan(&buf, plan); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if plan, err = fsdedupe.ReadPlan(&buf); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	var linked []string
+	onLinked := fsdedupe.WithOnLinked(func(filename, _ string) error {
+		linked = append(linked, filename)
+		return nil
+	})
+
+	// approved only
+	if err := fsdedupe.ApplyPlan(context.Background(), plan, fsdedupe.WithApprovedOnly(), onLinked); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{files[1]}; !reflect.DeepEqual(linked, expected) {
+		t.Fatalf("expected %q to be linked, got %q", expected, linked)
+	}
+
+	// pending ones too
+	linked = nil
+	if err := fsdedupe.ApplyPlan(context.Background(), plan, onLinked); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{files[7]}; !reflect.DeepEqual(linked, expected) {
+		t.Fatalf("expected %q to be linked, got %q", expected, linked)
+	}
+}
+
+func TestReadPlan_legacy(t *testing.T) {
+	// single JSON object, written before plans became artifacts
+	plan, err := fsdedupe.ReadPlan(strings.NewReader(`{"actions":[{"filename":"/a/file2","target":"/a/file1","size":4}],"reviews":{"/a/file1":{"status":"approved"}}}`))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.DedupePlan{
+		Actions: []fsdedupe.PlanAction{{Filename: "/a/file2", Target: "/a/file1", Size: 4}},
+		Reviews: map[string]fsdedupe.PlanReview{"/a/file1": {Status: fsdedupe.ReviewApproved}},
+	}); !reflect.DeepEqual(plan, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, plan)
+	}
+}
+
+func TestApplyPlan_vanished(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(tmp, "sub", "file3.txt")
+	writeFile(t, file3, "DUPE")
+	file4 := filepath.Join(tmp, "file4.txt")
+	writeFile(t, file4, "UNIQ")
+	file5 := filepath.Join(tmp, "file5.txt")
+	writeFile(t, file5, "UNIQ")
+
+	plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice([]string{file1, file2, file3, file4, file5}))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// duplicate, its whole dir and a canonical file are deleted meanwhile
+	for _, name := range []string{file2, filepath.Dir(file3), file4} {
+		if err := os.RemoveAll(name); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+
+	summary := new(fsdedupe.Summary)
+	if err := fsdedupe.ApplyPlan(context.Background(), plan, fsdedupe.WithSummary(summary)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := *summary, (fsdedupe.Summary{Skipped: 3}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	if !lstat(t, file5).Mode().IsRegular() {
+		t.Fatalf("expected %q to be kept as is", file5)
+	}
+}
+
+func TestApplyPlan_groupRollback(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(tmp, "sub", "file3.txt")
+	writeFile(t, file3, "DUPE")
+	file4 := filepath.Join(tmp, "sub", "file4.txt")
+	writeFile(t, file4, "DUPE")
+	other1 := filepath.Join(tmp, "other1.txt")
+	writeFile(t, other1, "OTHER")
+	other2 := filepath.Join(tmp, "sub", "other2.txt")
+	writeFile(t, other2, "OTHER")
+	if err := os.Chmod(file2, 0600); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice([]string{file1, file2, other1, file3, file4, other2}))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// symlink of file3 can't be created aside (after file2 is linked)
+	if err := os.MkdirAll(filepath.Join(tmp, "sub", ".file3.txt.fsdedupe-link", "blocked"), 0700); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	skipped := make(map[string]fsdedupe.SkipReason)
+	summary := new(fsdedupe.Summary)
+	err = fsdedupe.ApplyPlan(context.Background(), plan,
+		fsdedupe.WithSummary(summary),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+			skipped[filename] = reason
+			return nil
+		}),
+	)
+	if err == nil || !strings.Contains(err.Error(), file1) {
+		t.Fatalf("expected group error, got: %v", err)
+	}
+
+	// failed group is rolled back as a whole, other ones are applied
+	for _, name := range []string{file2, file3, file4} {
+		if !lstat(t, name).Mode().IsRegular() {
+			t.Errorf("expected %q to be a regular file, but it is not", name)
+		}
+		if actual, expected := skipped[name], fsdedupe.SkipFailed; actual != expected {
+			t.Errorf("expected %q to be skipped as %q, got %q", name, expected, actual)
+		}
+	}
+	if actual, expected := lstat(t, file2).Mode().Perm(), os.FileMode(0600); actual != expected {
+		t.Errorf("expected rolled back %q to have mode %s, got %s", file2, expected, actual)
+	}
+	if b, err := os.ReadFile(file2); err != nil || string(b) != "DUPE" {
+		t.Errorf("expected rolled back %q contents, got %q (%v)", file2, b, err)
+	}
+	if actual, expected := readlink(t, other2), other1; actual != expected {
+		t.Fatalf("expected %q to point to %q, got %q", other2, expected, actual)
+	}
+	if actual, expected := *summary, (fsdedupe.Summary{Linked: 1, BytesSaved: 5, DiskBytesSaved: summary.DiskBytesSaved, InodesUsed: summary.InodesUsed, Skipped: 3}); actual != expected {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestApplyPlan_rootSquashed(t *testing.T) {
+	tmp := t.TempDir()
+
+	canonical := filepath.Join(tmp, "file1.txt")
+	writeFile(t, canonical, "DUPE")
+	dupe1 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, dupe1, "DUPE")
+	dupe2 := filepath.Join(tmp, "sub", "file3.txt")
+	writeFile(t, dupe2, "DUPE")
+	filenames := []string{canonical, dupe1, dupe2}
+
+	// planned before the mount got root-squashed
+	planned, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice(filenames))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(planned.Actions), 2; actual != expected {
+		t.Fatalf("expected %d actions, got %+v", expected, planned.Actions)
+	}
+
+	fsdedupe.StubRootSquashed(t, func(string) bool { return true })
+
+	skipped := make(map[string]fsdedupe.SkipReason)
+	onSkipped := fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+		skipped[filename] = reason
+		return nil
+	})
+	expectedSkipped := map[string]fsdedupe.SkipReason{dupe1: fsdedupe.SkipUnsupported, dupe2: fsdedupe.SkipUnsupported}
+
+	plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice(filenames), onSkipped)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(plan.Actions) != 0 {
+		t.Fatalf("expected no actions, got %+v", plan.Actions)
+	}
+	if !reflect.DeepEqual(skipped, expectedSkipped) {
+		t.Fatalf("expected %v skipped, got %v", expectedSkipped, skipped)
+	}
+
+	clear(skipped)
+	summary := new(fsdedupe.Summary)
+	if err := fsdedupe.ApplyPlan(context.Background(), planned, fsdedupe.WithSummary(summary), onSkipped); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if summary.Linked != 0 {
+		t.Fatalf("expected nothing linked, got %+v", summary)
+	}
+	if !reflect.DeepEqual(skipped, expectedSkipped) {
+		t.Fatalf("expected %v skipped, got %v", expectedSkipped, skipped)
+	}
+	for _, name := range []string{dupe1, dupe2} {
+		if !lstat(t, name).Mode().IsRegular() {
+			t.Fatalf("expected %q to be a regular file, but it is not", name)
+		}
+	}
+}
+
+func TestApplyPlan_sameSizeChanges(t *testing.T) {
+	tmp := t.TempDir()
+
+	canonical1 := filepath.Join(tmp, "a1.txt")
+	writeFile(t, canonical1, "AAAA")
+	dupe1 := filepath.Join(tmp, "a2.txt")
+	writeFile(t, dupe1, "AAAA")
+	canonical2 := filepath.Join(tmp, "b1.txt")
+	writeFile(t, canonical2, "BBBB")
+	dupe2 := filepath.Join(tmp, "b2.txt")
+	writeFile(t, dupe2, "BBBB")
+
+	plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice([]string{canonical1, dupe1, canonical2, dupe2}))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(plan.Actions), 2; actual != expected {
+		t.Fatalf("expected %d actions, got %+v", expected, plan.Actions)
+	}
+
+	// plan survives serialization
+	var buf bytes.Buffer
+	if err := fsdedupe.WritePlan(&buf, plan); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if plan, err = fsdedupe.ReadPlan(&buf); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// edited since planned, keeping sizes
+	writeFile(t, dupe1, "XXXX")
+	writeFile(t, canonical2, "YYYY")
+
+	skipped := make(map[string]string)
+	summary := new(fsdedupe.Summary)
+	if err := fsdedupe.ApplyPlan(context.Background(), plan,
+		fsdedupe.WithSummary(summary),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, detail string) error {
+			if reason != fsdedupe.SkipChanged {
+				t.Errorf("expected %q to be skipped as %q, got %q", filename, fsdedupe.SkipChanged, reason)
+			}
+			skipped[filename] = detail
+			return nil
+		}),
+	); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if summary.Linked != 0 {
+		t.Fatalf("expected nothing linked, got %+v", summary)
+	}
+	if expected := map[string]string{
+		dupe1: "contents changed since planned",
+		dupe2: "canonical changed since planned",
+	}; !reflect.DeepEqual(skipped, expected) {
+		t.Fatalf("expected %v skipped, got %v", expected, skipped)
+	}
+	for name, expected := range map[string]string{dupe1: "XXXX", dupe2: "BBBB"} {
+		if b, err := os.ReadFile(name); err != nil {
+			t.Fatalf("read %q: %s", name, err)
+		} else if actual := string(b); actual != expected {
+			t.Fatalf("expected %q to be kept as %q, got %q", name, expected, actual)
+		}
+	}
+}
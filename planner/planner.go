@@ -0,0 +1,148 @@
+// Package planner implements filesystem-free duplicate grouping:
+// given file names, sizes and content hashes, it decides which files are duplicates
+// and which one of each group is kept.
+// Outputs depend on inputs only (including their order), so it is safe to fuzz and reuse by other frontends.
+package planner
+
+import "sort"
+
+// File is a planner input.
+type File struct {
+	// Name is a filename (opaque to planner).
+	Name string `json:"name"`
+	// Size is a file size.
+	Size int64 `json:"size"`
+	// Hash is a content hash, only needed for GroupByHash.
+	Hash string `json:"hash,omitempty"`
+}
+
+// ----------------------------------------------------------------------------
+
+// Bucket is a group of files of the same size.
+type Bucket struct {
+	Size  int64
+	Files []File
+}
+
+// Savings returns potential savings of the bucket (if all its files are duplicates).
+func (b Bucket) Savings() int64 {
+	if len(b.Files) < 2 {
+		return 0
+	}
+	return b.Size * int64(len(b.Files)-1)
+}
+
+// SizeBuckets groups files by size, in first-seen order (also within buckets).
+// Single-file buckets are kept, as such files may still duplicate files seen before (see OrderBySavings).
+func SizeBuckets(files []File) []Bucket {
+	var buckets []Bucket
+	bySize := make(map[int64]int)
+
+	for _, f := range files {
+		i, ok := bySize[f.Size]
+		if !ok {
+			i = len(buckets)
+			bySize[f.Size] = i
+			buckets = append(buckets, Bucket{Size: f.Size})
+		}
+		buckets[i].Files = append(buckets[i].Files, f)
+	}
+	return buckets
+}
+
+// OrderBySavings orders buckets by potential savings descending (keeping first-seen order for equal savings),
+// dropping single-file buckets, unless their size is in known set (sizes of files seen before).
+func OrderBySavings(buckets []Bucket, known map[int64]struct{}) []Bucket {
+	ordered := make([]Bucket, 0, len(buckets))
+	for _, b := range buckets {
+		if _, ok := known[b.Size]; !ok && len(b.Files) < 2 {
+			continue
+		}
+		ordered = append(ordered, b)
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Savings() > ordered[j].Savings()
+	})
+	return ordered
+}
+
+// ----------------------------------------------------------------------------
+
+// KeepPolicy selects a file (index) to keep out of same-content candidates (in first-seen order, at least 2).
+type KeepPolicy func(candidates []File) int
+
+// KeepFirst keeps the first-seen file.
+func KeepFirst(candidates []File) int {
+	return 0
+}
+
+// KeepShortestName keeps the file with the shortest name (first-seen one of equally short).
+func KeepShortestName(candidates []File) int {
+	keep := 0
+	for i, f := range candidates {
+		if len(f.Name) < len(candidates[keep].Name) {
+			keep = i
+		}
+	}
+	return keep
+}
+
+// Group is a group of same-content files.
+type Group struct {
+	Hash string
+	Size int64
+	// Keep is a file to be kept.
+	Keep File
+	// Duplicates are files to be replaced by links to Keep, in first-seen order.
+	Duplicates []File
+}
+
+// GroupByHash groups files by content hash, returning groups of 2+ files in first-seen order.
+// Keep policy selects files to keep (KeepFirst if nil); out of range selection falls back to the first-seen file.
+func GroupByHash(files []File, keep KeepPolicy) []Group {
+	if keep == nil {
+		keep = KeepFirst
+	}
+
+	var hashes []string
+	byHash := make(map[string][]File)
+	for _, f := range files {
+		if _, ok := byHash[f.Hash]; !ok {
+			hashes = append(hashes, f.Hash)
+		}
+		byHash[f.Hash] = append(byHash[f.Hash], f)
+	}
+
+	var groups []Group
+	for _, hash := range hashes {
+		same := byHash[hash]
+		if len(same) < 2 {
+			continue
+		}
+
+		k := keep(same)
+		if k < 0 || k >= len(same) {
+			k = 0
+		}
+
+		g := Group{
+			Hash:       hash,
+			Size:       same[k].Size,
+			Keep:       same[k],
+			Duplicates: make([]File, 0, len(same)-1),
+		}
+		for i, f := range same {
+			if i != k {
+				g.Duplicates = append(g.Duplicates, f)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// Savings returns total size of duplicates.
+func (g Group) Savings() int64 {
+	return g.Size * int64(len(g.Duplicates))
+}
@@ -0,0 +1,110 @@
+package planner_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe/planner"
+)
+
+func TestSizeBuckets(t *testing.T) {
+	files := []planner.File{
+		{Name: "a", Size: 1},
+		{Name: "b", Size: 10},
+		{Name: "c", Size: 1},
+		{Name: "d", Size: 5},
+		{Name: "e", Size: 10},
+		{Name: "f", Size: 10},
+	}
+
+	buckets := planner.SizeBuckets(files)
+	if actual, expected := len(buckets), 3; actual != expected {
+		t.Fatalf("expected %d buckets, got %d", expected, actual)
+	}
+
+	ordered := planner.OrderBySavings(buckets, map[int64]struct{}{})
+	if expected := []planner.Bucket{
+		{Size: 10, Files: []planner.File{files[1], files[4], files[5]}},
+		{Size: 1, Files: []planner.File{files[0], files[2]}},
+	}; !reflect.DeepEqual(ordered, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, ordered)
+	}
+
+	// single-file bucket of a known size is kept
+	ordered = planner.OrderBySavings(buckets, map[int64]struct{}{5: {}})
+	if actual, expected := len(ordered), 3; actual != expected {
+		t.Fatalf("expected %d buckets, got %d", expected, actual)
+	}
+}
+
+func TestGroupByHash(t *testing.T) {
+	files := []planner.File{
+		{Name: "dir/long-name", Size: 4, Hash: "x"},
+		{Name: "uniq", Size: 4, Hash: "y"},
+		{Name: "short", Size: 4, Hash: "x"},
+		{Name: "dir/other", Size: 4, Hash: "x"},
+	}
+
+	groups := planner.GroupByHash(files, nil)
+	if expected := []planner.Group{{
+		Hash:       "x",
+		Size:       4,
+		Keep:       files[0],
+		Duplicates: []planner.File{files[2], files[3]},
+	}}; !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, groups)
+	}
+
+	groups = planner.GroupByHash(files, planner.KeepShortestName)
+	if actual, expected := groups[0].Keep, files[2]; actual != expected {
+		t.Fatalf("expected to keep %+v, got %+v", expected, actual)
+	}
+	if actual, expected := groups[0].Savings(), int64(8); actual != expected {
+		t.Fatalf("expected savings %d, got %d", expected, actual)
+	}
+}
+
+func FuzzGroupByHash(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 2, 1})
+	f.Fuzz(func(t *testing.T, hashes []byte) {
+		files := make([]planner.File, len(hashes))
+		for i, h := range hashes {
+			files[i] = planner.File{Name: fmt.Sprint(i), Size: 1, Hash: fmt.Sprint(h % 8)}
+		}
+
+		seen := make(map[string]int)
+		for _, policy := range []planner.KeepPolicy{planner.KeepFirst, planner.KeepShortestName} {
+			for k := range seen {
+				delete(seen, k)
+			}
+
+			for _, g := range planner.GroupByHash(files, policy) {
+				if len(g.Duplicates) == 0 {
+					t.Fatalf("expected duplicates in group %+v", g)
+				}
+				for _, f := range append([]planner.File{g.Keep}, g.Duplicates...) {
+					if f.Hash != g.Hash {
+						t.Fatalf("expected hash %q, got %+v", g.Hash, f)
+					}
+					seen[f.Name]++
+				}
+			}
+
+			// every file with a same-hash sibling is in exactly one group
+			count := make(map[string]int)
+			for _, f := range files {
+				count[f.Hash]++
+			}
+			for _, f := range files {
+				expected := 0
+				if count[f.Hash] > 1 {
+					expected = 1
+				}
+				if seen[f.Name] != expected {
+					t.Fatalf("expected %q to be grouped %d times, got %d", f.Name, expected, seen[f.Name])
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FSInfo describes probed filesystem capabilities.
+type FSInfo struct {
+	// Type is a filesystem type name (ext4, nfs, cifs etc), empty if unknown.
+	Type string
+	// Symlinks reports if symlinks can be created (and read back).
+	Symlinks bool
+	// AtomicRename reports if renaming a file over an existing one works as expected
+	// (see WithNetworkSafe).
+	AtomicRename bool
+	// RootSquash reports if running as root, but files are created as an unprivileged user
+	// (NFS root-squash), see RootSquashed.
+	RootSquash bool
+	// CaseInsensitive reports if differently-cased names refer to the same file (macOS, Windows).
+	CaseInsensitive bool
+}
+
+func (i FSInfo) String() string {
+	typ := i.Type
+	if typ == "" {
+		typ = "unknown"
+	}
+	return fmt.Sprintf("type=%s symlinks=%t atomic-rename=%t root-squash=%t case-insensitive=%t", typ, i.Symlinks, i.AtomicRename, i.RootSquash, i.CaseInsensitive)
+}
+
+// FSStat describes filesystem of a dir.
+// Fields unsupported by platform are left empty.
+type FSStat struct {
+	// Type is a filesystem type name (ext4, nfs, cifs etc), empty if unknown.
+	Type string
+	// Network reports if filesystem is known to be a network one (NFS, SMB etc).
+	Network bool
+	// FreeBytes is a number of bytes available to unprivileged users.
+	FreeBytes uint64
+	// FreeInodes is a number of free inodes (file slots).
+	FreeInodes uint64
+	// TotalInodes is a total number of inodes, zero if filesystem allocates them dynamically (btrfs, ZFS etc).
+	TotalInodes uint64
+}
+
+// StatFS returns filesystem details of given dir.
+func StatFS(dir string) (FSStat, error) {
+	st, err := statFS(dir)
+	if err != nil {
+		return st, fmt.Errorf("statfs %q: %w", dir, err)
+	}
+	return st, nil
+}
+
+// SameDevice reports if both paths reside on the same device (filesystem),
+// so files can be renamed (not copied) between them.
+func SameDevice(path1, path2 string) (bool, error) {
+	dev1, err := deviceID(path1)
+	if err != nil {
+		return false, fmt.Errorf("stat %q: %w", path1, err)
+	}
+	dev2, err := deviceID(path2)
+	if err != nil {
+		return false, fmt.Errorf("stat %q: %w", path2, err)
+	}
+	return dev1 == dev2, nil
+}
+
+// ProbeFS probes filesystem of given (existing, writable) dir.
+// It creates (and removes) temporary probe files in this dir.
+func ProbeFS(dir string) (FSInfo, error) {
+	var info FSInfo
+
+	st, err := statFS(dir)
+	if err != nil {
+		return info, fmt.Errorf("detect filesystem type of %q: %w", dir, err)
+	}
+	info.Type = st.Type
+
+	if info.Symlinks, err = probeSymlink(dir); err != nil {
+		return info, fmt.Errorf("probe symlink support in %q: %w", dir, err)
+	}
+	if info.AtomicRename, err = probeRename(dir); err != nil {
+		return info, fmt.Errorf("probe rename support in %q: %w", dir, err)
+	}
+	if info.RootSquash, err = probeRootSquash(dir); err != nil {
+		return info, fmt.Errorf("probe root squash in %q: %w", dir, err)
+	}
+	if info.CaseInsensitive, err = probeCase(dir); err != nil {
+		return info, fmt.Errorf("probe case sensitivity in %q: %w", dir, err)
+	}
+	return info, nil
+}
+
+func probeCase(dir string) (bool, error) {
+	f, err := os.CreateTemp(dir, ".fsdedupe-probe-*")
+	if err != nil {
+		return false, fmt.Errorf("create probe file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("close probe file: %w", err)
+	}
+
+	insensitive, _, err := caseInsensitive(f.Name())
+	return insensitive, err
+}
+
+// rootSquashed is RootSquashed, stubbed by tests.
+var rootSquashed = RootSquashed
+
+// RootSquashed reports if dir is on a network filesystem, which squashes root to an unprivileged user
+// (NFS root-squash): writes may fail or create files owned by nobody.
+// It is always false when not running as root.
+// It may create (and remove) a temporary probe file in dir.
+func RootSquashed(dir string) (bool, error) {
+	if os.Geteuid() != 0 {
+		return false, nil
+	}
+
+	st, err := statFS(dir)
+	if err != nil {
+		return false, fmt.Errorf("detect filesystem type of %q: %w", dir, err)
+	}
+	if !st.Network {
+		return false, nil
+	}
+
+	squashed, err := probeRootSquash(dir)
+	if err != nil {
+		return false, fmt.Errorf("probe root squash in %q: %w", dir, err)
+	}
+	return squashed, nil
+}
+
+func probeSymlink(dir string) (bool, error) {
+	f, err := os.CreateTemp(dir, ".fsdedupe-probe-*")
+	if err != nil {
+		return false, fmt.Errorf("create probe file: %w", err)
+	}
+	target := f.Name()
+	defer os.Remove(target)
+
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("close probe file: %w", err)
+	}
+
+	link := target + ".lnk"
+	if err := os.Symlink(target, link); err != nil {
+		return false, nil
+	}
+	defer os.Remove(link)
+
+	actual, err := os.Readlink(link)
+	if err != nil {
+		return false, nil
+	}
+	return actual == target, nil
+}
+
+func probeRename(dir string) (bool, error) {
+	src, err := os.CreateTemp(dir, ".fsdedupe-probe-*")
+	if err != nil {
+		return false, fmt.Errorf("create probe file: %w", err)
+	}
+	defer os.Remove(src.Name())
+
+	if _, err := src.WriteString("src"); err != nil {
+		src.Close()
+		return false, fmt.Errorf("write probe file: %w", err)
+	}
+	if err := src.Close(); err != nil {
+		return false, fmt.Errorf("close probe file: %w", err)
+	}
+
+	dst := filepath.Join(dir, filepath.Base(src.Name())+".dst")
+	if err := os.WriteFile(dst, []byte("dst"), 0600); err != nil {
+		return false, fmt.Errorf("write probe file: %w", err)
+	}
+	defer os.Remove(dst)
+
+	if err := os.Rename(src.Name(), dst); err != nil {
+		return false, nil
+	}
+
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		return false, nil
+	}
+	if _, err := os.Lstat(src.Name()); !os.IsNotExist(err) {
+		return false, nil
+	}
+	return string(b) == "src", nil
+}
+
+func probeRootSquash(dir string) (bool, error) {
+	if os.Geteuid() != 0 {
+		return false, nil
+	}
+
+	f, err := os.CreateTemp(dir, ".fsdedupe-probe-*")
+	if errors.Is(err, fs.ErrPermission) {
+		return true, nil // root would not be denied otherwise
+	} else if err != nil {
+		return false, fmt.Errorf("create probe file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat probe file: %w", err)
+	}
+	uid, ok := ownerUID(stat)
+	return ok && uid != 0, nil
+}
+
+// rootSquashCache caches RootSquashed per mount (device).
+type rootSquashCache struct {
+	byDir    map[string]bool
+	byDevice map[uint64]bool
+}
+
+// squashed reports if dir is root-squashed, detected reports if it is the first dir of the mount detected so.
+func (c *rootSquashCache) squashed(dir string) (squashed, detected bool, err error) {
+	if squashed, ok := c.byDir[dir]; ok {
+		return squashed, false, nil
+	}
+	if c.byDir == nil {
+		c.byDir = make(map[string]bool)
+		c.byDevice = make(map[uint64]bool)
+	}
+
+	dev, err := deviceID(dir)
+	if err != nil {
+		return false, false, fmt.Errorf("stat %q: %w", dir, err)
+	}
+	squashed, ok := c.byDevice[dev]
+	if !ok {
+		if squashed, err = rootSquashed(dir); err != nil {
+			return false, false, err
+		}
+		c.byDevice[dev] = squashed
+		detected = squashed
+	}
+	c.byDir[dir] = squashed
+	return squashed, detected, nil
+}
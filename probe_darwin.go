@@ -0,0 +1,53 @@
+package fsdedupe
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+var darwinNetworkFSTypes = map[string]bool{
+	"nfs":    true,
+	"smbfs":  true,
+	"afpfs":  true,
+	"webdav": true,
+}
+
+func statFS(dir string) (FSStat, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return FSStat{}, err
+	}
+
+	name := make([]byte, 0, len(st.Fstypename))
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+
+	return FSStat{
+		Type:        string(name),
+		Network:     darwinNetworkFSTypes[string(name)],
+		FreeBytes:   st.Bavail * uint64(st.Bsize),
+		FreeInodes:  st.Ffree,
+		TotalInodes: st.Files,
+	}, nil
+}
+
+func deviceID(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Dev), nil
+}
+
+func accessTime(fi os.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(st.Atimespec.Unix())
+}
@@ -0,0 +1,64 @@
+package fsdedupe
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// https://man7.org/linux/man-pages/man2/statfs.2.html
+var linuxFSTypes = map[uint32]struct {
+	name    string
+	network bool
+}{
+	0xEF53:     {"ext4", false},
+	0x9123683E: {"btrfs", false},
+	0x58465342: {"xfs", false},
+	0x2FC12FC1: {"zfs", false},
+	0x01021994: {"tmpfs", false},
+	0x794C7630: {"overlayfs", false},
+	0x4D44:     {"vfat", false},
+	0x2011BAB0: {"exfat", false},
+	0x5346544E: {"ntfs", false},
+	0x65735546: {"fuse", false},
+	0x6969:     {"nfs", true},
+	0x517B:     {"smb", true},
+	0xFF534D42: {"cifs", true},
+	0xFE534D42: {"smb2", true},
+	0x01021997: {"9p", true},
+	0x00C36400: {"ceph", true},
+}
+
+func statFS(dir string) (FSStat, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return FSStat{}, err
+	}
+
+	res := FSStat{
+		FreeBytes:   st.Bavail * uint64(st.Bsize),
+		FreeInodes:  st.Ffree,
+		TotalInodes: st.Files,
+	}
+	if t, ok := linuxFSTypes[uint32(st.Type)]; ok {
+		res.Type = t.name
+		res.Network = t.network
+	}
+	return res, nil
+}
+
+func deviceID(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Dev), nil
+}
+
+func accessTime(fi os.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(st.Atim.Unix())
+}
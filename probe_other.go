@@ -0,0 +1,36 @@
+//go:build !linux && !darwin
+
+package fsdedupe
+
+import (
+	"os"
+	"time"
+)
+
+// freeSpaceSupported reports if statFS reports FreeBytes.
+const freeSpaceSupported = false
+
+// linkCount returns a number of hardlinks of a file, unknown (1) on this platform.
+func linkCount(fi os.FileInfo) uint64 {
+	return 1
+}
+
+func statFS(dir string) (FSStat, error) {
+	return FSStat{}, nil
+}
+
+func deviceID(path string) (uint64, error) {
+	// unknown, consider everything to be on the same device
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func ownerUID(fi os.FileInfo) (uint32, bool) {
+	return 0, false
+}
+
+func accessTime(fi os.FileInfo) time.Time {
+	return fi.ModTime()
+}
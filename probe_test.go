@@ -0,0 +1,87 @@
+package fsdedupe_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestProbeFS(t *testing.T) {
+	tmp := t.TempDir()
+
+	info, err := fsdedupe.ProbeFS(tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// test temp dirs are expected to be local and fully-featured
+	if st, err := fsdedupe.StatFS(tmp); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if st.Network {
+		t.Errorf("expected %q to be on a local filesystem, got: %s", tmp, st.Type)
+	}
+	if !info.Symlinks {
+		t.Errorf("expected %q to support symlinks, got: %s", tmp, info)
+	}
+	if !info.AtomicRename {
+		t.Errorf("expected %q to support atomic rename, got: %s", tmp, info)
+	}
+	if info.RootSquash {
+		t.Errorf("expected %q not to be root-squashed, got: %s", tmp, info)
+	}
+
+	// probe files are cleaned up
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatalf("readdir %q: %s", tmp, err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected probe files to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestRootSquashed(t *testing.T) {
+	tmp := t.TempDir()
+
+	squashed, err := fsdedupe.RootSquashed(tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if squashed {
+		t.Errorf("expected local %q not to be root-squashed", tmp)
+	}
+}
+
+func TestStatFS(t *testing.T) {
+	tmp := t.TempDir()
+
+	if _, err := fsdedupe.StatFS(tmp); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if _, err := fsdedupe.StatFS(filepath.Join(tmp, "missing")); err == nil {
+		t.Fatalf("expected error for a missing dir, got none")
+	}
+}
+
+func TestSameDevice(t *testing.T) {
+	tmp := t.TempDir()
+
+	dir1 := filepath.Join(tmp, "dir1")
+	dir2 := filepath.Join(tmp, "dir2")
+	for _, dir := range []string{dir1, dir2} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("mkdir %q: %s", dir, err)
+		}
+	}
+
+	same, err := fsdedupe.SameDevice(dir1, dir2)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !same {
+		t.Errorf("expected sibling dirs to be on the same device")
+	}
+}
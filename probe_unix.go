@@ -0,0 +1,28 @@
+//go:build linux || darwin
+
+package fsdedupe
+
+import (
+	"os"
+	"syscall"
+)
+
+// freeSpaceSupported reports if statFS reports FreeBytes.
+const freeSpaceSupported = true
+
+// linkCount returns a number of hardlinks of a file.
+func linkCount(fi os.FileInfo) uint64 {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1
+	}
+	return uint64(st.Nlink)
+}
+
+func ownerUID(fi os.FileInfo) (uint32, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return st.Uid, true
+}
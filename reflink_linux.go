@@ -0,0 +1,39 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ficlone is FICLONE ioctl request: https://man7.org/linux/man-pages/man2/ioctl_ficlone.2.html
+const ficlone = 0x40049409
+
+// reflink creates name as a copy-on-write clone of target.
+func reflink(target, name string) error {
+	src, err := os.Open(target)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", target, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", name, err)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if cerr := dst.Close(); errno == 0 && cerr != nil {
+		os.Remove(name)
+		return fmt.Errorf("close %q: %w", name, cerr)
+	}
+	if errno != 0 {
+		os.Remove(name)
+		if errors.Is(errno, syscall.EOPNOTSUPP) || errors.Is(errno, syscall.ENOTTY) || errors.Is(errno, syscall.EINVAL) || errors.Is(errno, syscall.EXDEV) {
+			return fmt.Errorf("%w: %w", errReflinkUnsupported, errno)
+		}
+		return fmt.Errorf("clone: %w", errno)
+	}
+	return nil
+}
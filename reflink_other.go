@@ -0,0 +1,8 @@
+//go:build !linux
+
+package fsdedupe
+
+// reflink is not supported on this platform.
+func reflink(target, name string) error {
+	return errReflinkUnsupported
+}
@@ -0,0 +1,97 @@
+package fsdedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// RelinkReport is a RewriteLinkTargets report.
+type RelinkReport struct {
+	// Checked is a number of inspected symlinks.
+	Checked int `json:"checked"`
+	// Rewritten is a number of symlinks re-pointed (or to be re-pointed in a dry run).
+	Rewritten int `json:"rewritten"`
+	// Dangling lists rewritten symlinks, new targets of which don't exist (yet).
+	Dangling []string `json:"dangling"`
+}
+
+// RewriteLinkTargets re-points absolute symlinks of a dir tree after their targets were moved in bulk
+// (like a DedupeFS data dir or a canonical files tree relocated to another mount):
+// targets at or under oldPrefix (matched by whole path segments) get it replaced with newPrefix,
+// each symlink being replaced atomically. Relative symlinks and ones to other paths are left as is.
+// With WithDryRun, symlinks are only checked, the report telling what would be rewritten.
+// WithOnLinked callback gets every rewritten symlink (with its new target), WithLogger option is honored too.
+func RewriteLinkTargets(ctx context.Context, dir, oldPrefix, newPrefix string, opts ...Option) (RelinkReport, error) {
+	o := buildOptions(opts)
+	dryRun := o.dryRun
+	var report RelinkReport
+
+	if !filepath.IsAbs(oldPrefix) || !filepath.IsAbs(newPrefix) {
+		return report, fmt.Errorf("rewrite link targets %q -> %q: prefixes must be absolute", oldPrefix, newPrefix)
+	}
+	oldPrefix, newPrefix = filepath.Clean(oldPrefix), filepath.Clean(newPrefix)
+
+	onLink := func(path string, entry os.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		report.Checked++
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", path, err)
+		}
+		newTarget, ok := replacePrefix(target, oldPrefix, newPrefix)
+		if !ok {
+			return nil
+		}
+
+		if _, err := os.Stat(newTarget); errors.Is(err, fs.ErrNotExist) {
+			o.logger.Printf("new target %q of %q does not exist", newTarget, path)
+			report.Dangling = append(report.Dangling, path)
+		}
+		if !dryRun {
+			if err := replaceSymlink(newTarget, path); err != nil {
+				return err
+			}
+		}
+		report.Rewritten++
+
+		if o.onLinked != nil {
+			if err := o.onLinked(path, newTarget); err != nil {
+				return fmt.Errorf("on linked %q: %w", path, err)
+			}
+		}
+		return nil
+	}
+	if err := walk(dir, onLink); err != nil {
+		return report, fmt.Errorf("walk %q: %w", dir, err)
+	}
+
+	verb := "rewrote"
+	if dryRun {
+		verb = "would rewrite"
+	}
+	o.logger.Printf("%s %d of %d symlinks (%d dangling)", verb, report.Rewritten, report.Checked, len(report.Dangling))
+	return report, nil
+}
+
+// replacePrefix replaces (clean) oldPrefix of an absolute target with newPrefix,
+// reporting if target is at or under oldPrefix.
+func replacePrefix(target, oldPrefix, newPrefix string) (string, bool) {
+	if !filepath.IsAbs(target) {
+		return "", false
+	}
+	rel, err := filepath.Rel(oldPrefix, filepath.Clean(target))
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return filepath.Join(newPrefix, rel), true
+}
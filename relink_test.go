@@ -0,0 +1,74 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestRewriteLinkTargets(t *testing.T) {
+	tmp := t.TempDir()
+	oldDir := filepath.Join(tmp, "a")
+	newDir := filepath.Join(tmp, "b")
+	links := filepath.Join(tmp, "links")
+	if err := os.MkdirAll(filepath.Join(links, "sub"), 0700); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := os.MkdirAll(newDir, 0700); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	writeFile(t, filepath.Join(newDir, "moved.bin"), "MOVED")
+
+	moved := filepath.Join(links, "moved.txt")
+	dangling := filepath.Join(links, "sub", "dangling.txt")
+	sibling := filepath.Join(links, "sibling.txt")
+	relative := filepath.Join(links, "relative.txt")
+	for name, target := range map[string]string{
+		moved:    filepath.Join(oldDir, "moved.bin"),
+		dangling: filepath.Join(oldDir, "gone.bin"),
+		sibling:  filepath.Join(tmp, "ab", "other.bin"), // same string prefix, other dir
+		relative: filepath.Join("..", "a", "moved.bin"),
+	} {
+		if err := os.Symlink(target, name); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+
+	dryRun, err := fsdedupe.RewriteLinkTargets(context.Background(), links, oldDir, newDir, fsdedupe.WithDryRun())
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if focus, actual, expected := moved, readlink(t, moved), filepath.Join(oldDir, "moved.bin"); actual != expected {
+		t.Errorf("expected dry run to keep %q pointing to %q, but got: %q", focus, expected, actual)
+	}
+
+	report, err := fsdedupe.RewriteLinkTargets(context.Background(), links, oldDir+"/", newDir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.RelinkReport{Checked: 4, Rewritten: 2, Dangling: []string{dangling}}); !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+	if !reflect.DeepEqual(dryRun, report) {
+		t.Errorf("expected dry run report %+v, got %+v", report, dryRun)
+	}
+
+	for name, expected := range map[string]string{
+		moved:    filepath.Join(newDir, "moved.bin"),
+		dangling: filepath.Join(newDir, "gone.bin"),
+		sibling:  filepath.Join(tmp, "ab", "other.bin"),
+		relative: filepath.Join("..", "a", "moved.bin"),
+	} {
+		if actual := readlink(t, name); actual != expected {
+			t.Errorf("expected %q to point to %q, but got: %q", name, expected, actual)
+		}
+	}
+
+	if _, err := fsdedupe.RewriteLinkTargets(context.Background(), links, "a", newDir); err == nil {
+		t.Errorf("expected relative prefix to be rejected, got no error")
+	}
+}
@@ -0,0 +1,223 @@
+package fsdedupe
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// reportTopGroups is a max number of duplicate groups rendered by RunReport.WriteHTML.
+const reportTopGroups = 20
+
+// RunReport collects linked duplicate groups, savings per directory and skipped files of a run
+// (see WithRunReport), to be rendered by WriteHTML.
+type RunReport struct {
+	groups  map[string]*ReportGroup // by canonical
+	dirs    map[string]*ReportDir   // by dir
+	skipped map[SkipReason]int
+	errors  []string
+}
+
+// ReportGroup is a linked duplicate group.
+type ReportGroup struct {
+	// Canonical is a filename duplicates are linked to.
+	Canonical string
+	// Size is a single file size.
+	Size int64
+	// Linked is a number of duplicates replaced by symlinks.
+	Linked int
+}
+
+// BytesSaved is a total size of duplicates replaced by symlinks.
+func (g ReportGroup) BytesSaved() int64 {
+	return g.Size * int64(g.Linked)
+}
+
+// ReportDir holds savings of a directory (duplicates directly in it, not in subdirs).
+type ReportDir struct {
+	Dir string
+	// Linked is a number of duplicates replaced by symlinks.
+	Linked int
+	// BytesSaved is a total size of duplicates replaced by symlinks.
+	BytesSaved int64
+}
+
+// NewRunReport creates an empty RunReport.
+func NewRunReport() *RunReport {
+	return &RunReport{
+		groups:  make(map[string]*ReportGroup),
+		dirs:    make(map[string]*ReportDir),
+		skipped: make(map[SkipReason]int),
+	}
+}
+
+func (r *RunReport) linked(filename, target string, size int64) {
+	group, ok := r.groups[target]
+	if !ok {
+		group = &ReportGroup{Canonical: target, Size: size}
+		r.groups[target] = group
+	}
+	group.Linked++
+
+	dir := filepath.Dir(filename)
+	d, ok := r.dirs[dir]
+	if !ok {
+		d = &ReportDir{Dir: dir}
+		r.dirs[dir] = d
+	}
+	d.Linked++
+	d.BytesSaved += size
+}
+
+// unlinked reverts linked for a rolled back duplicate.
+func (r *RunReport) unlinked(filename, target string, size int64) {
+	if group, ok := r.groups[target]; ok {
+		if group.Linked--; group.Linked == 0 {
+			delete(r.groups, target)
+		}
+	}
+	if d, ok := r.dirs[filepath.Dir(filename)]; ok {
+		d.Linked--
+		d.BytesSaved -= size
+		if d.Linked == 0 {
+			delete(r.dirs, d.Dir)
+		}
+	}
+}
+
+func (r *RunReport) skip(filename string, reason SkipReason, detail string) {
+	r.skipped[reason]++
+	r.errors = append(r.errors, fmt.Sprintf("%s: %s (%s)", filename, reason, detail))
+}
+
+// Groups returns linked duplicate groups, biggest savings first.
+func (r *RunReport) Groups() []ReportGroup {
+	groups := make([]ReportGroup, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if a, b := groups[i].BytesSaved(), groups[j].BytesSaved(); a != b {
+			return a > b
+		}
+		return groups[i].Canonical < groups[j].Canonical
+	})
+	return groups
+}
+
+// Dirs returns directories having linked duplicates, biggest savings first.
+func (r *RunReport) Dirs() []ReportDir {
+	dirs := make([]ReportDir, 0, len(r.dirs))
+	for _, d := range r.dirs {
+		dirs = append(dirs, *d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if a, b := dirs[i].BytesSaved, dirs[j].BytesSaved; a != b {
+			return a > b
+		}
+		return dirs[i].Dir < dirs[j].Dir
+	})
+	return dirs
+}
+
+// Skipped returns numbers of skipped files by reason.
+func (r *RunReport) Skipped() map[SkipReason]int {
+	return r.skipped
+}
+
+// Errors returns skipped files (see WithOnSkipped) with reasons.
+func (r *RunReport) Errors() []string {
+	return r.errors
+}
+
+// WriteHTML renders run summary and report as a standalone (no external resources) HTML page,
+// e.g. to be attached to notification emails.
+// RunErr is an error the run failed with (if any).
+func (r *RunReport) WriteHTML(w io.Writer, summary Summary, runErr error) error {
+	data := struct {
+		Generated time.Time
+		Summary   Summary
+		RunErr    error
+		Groups    []ReportGroup
+		More      int
+		Dirs      []ReportDir
+		Skipped   map[SkipReason]int
+		Errors    []string
+	}{
+		Generated: time.Now(),
+		Summary:   summary,
+		RunErr:    runErr,
+		Groups:    r.Groups(),
+		Dirs:      r.Dirs(),
+		Skipped:   r.skipped,
+		Errors:    r.errors,
+	}
+	if len(data.Groups) > reportTopGroups {
+		data.More = len(data.Groups) - reportTopGroups
+		data.Groups = data.Groups[:reportTopGroups]
+	}
+
+	if err := reportTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("render report: %w", err)
+	}
+	return nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size": FormatSize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>fsdedupe report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.num { text-align: right; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>fsdedupe report</h1>
+<p>Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}.</p>
+{{if .RunErr}}<p class="error">Run failed: {{.RunErr}}</p>{{end}}
+<h2>Summary</h2>
+<table>
+<tr><th>Processed files</th><td class="num">{{.Summary.Files}}</td></tr>
+<tr><th>Duplicates found</th><td class="num">{{.Summary.Duplicates}}</td></tr>
+<tr><th>Duplicates linked</th><td class="num">{{.Summary.Linked}}</td></tr>
+<tr><th>Saved size</th><td class="num">{{size .Summary.BytesSaved}}</td></tr>
+<tr><th>Saved disk space</th><td class="num">{{size .Summary.DiskBytesSaved}}</td></tr>
+<tr><th>Inodes used</th><td class="num">{{.Summary.InodesUsed}}</td></tr>
+<tr><th>Already deduplicated</th><td class="num">{{.Summary.AlreadyDeduped}} ({{size .Summary.AlreadyDedupedBytes}})</td></tr>
+{{range $reason, $n := .Skipped}}<tr><th>Skipped ({{$reason}})</th><td class="num">{{$n}}</td></tr>
+{{end}}
+</table>
+{{if .Groups}}
+<h2>Top duplicate groups</h2>
+<table>
+<tr><th>File</th><th>Size</th><th>Duplicates linked</th><th>Saved size</th></tr>
+{{range .Groups}}<tr><td>{{.Canonical}}</td><td class="num">{{size .Size}}</td><td class="num">{{.Linked}}</td><td class="num">{{size .BytesSaved}}</td></tr>
+{{end}}</table>
+{{if .More}}<p>... and {{.More}} more.</p>{{end}}
+{{end}}
+{{if .Dirs}}
+<h2>Savings per directory</h2>
+<table>
+<tr><th>Directory</th><th>Duplicates linked</th><th>Saved size</th></tr>
+{{range .Dirs}}<tr><td>{{.Dir}}</td><td class="num">{{.Linked}}</td><td class="num">{{size .BytesSaved}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Errors}}
+<h2>Skipped files</h2>
+<ul class="error">
+{{range .Errors}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
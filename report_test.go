@@ -0,0 +1,69 @@
+package fsdedupe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestRunReport(t *testing.T) {
+	tmp := t.TempDir()
+
+	big1 := filepath.Join(tmp, "big1.txt")
+	writeFile(t, big1, "DUPE-DUPE")
+	big2 := filepath.Join(tmp, "a", "big2.txt")
+	writeFile(t, big2, "DUPE-DUPE")
+	small1 := filepath.Join(tmp, "small1.txt")
+	writeFile(t, small1, "DUPE")
+	small2 := filepath.Join(tmp, "a", "small2.txt")
+	writeFile(t, small2, "DUPE")
+	small3 := filepath.Join(tmp, "<b>", "small3.txt")
+	writeFile(t, small3, "DUPE")
+
+	report := fsdedupe.NewRunReport()
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{big1, small1, big2, small2, small3},
+	}, fsdedupe.WithRunReport(report))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := report.Groups(), []fsdedupe.ReportGroup{
+		{Canonical: big1, Size: 9, Linked: 1},
+		{Canonical: small1, Size: 4, Linked: 2},
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected groups %+v, got %+v", expected, actual)
+	}
+	if actual, expected := report.Dirs(), []fsdedupe.ReportDir{
+		{Dir: filepath.Join(tmp, "a"), Linked: 2, BytesSaved: 13},
+		{Dir: filepath.Join(tmp, "<b>"), Linked: 1, BytesSaved: 4},
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected dirs %+v, got %+v", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteHTML(&buf, summary, errors.New("boom")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	html := buf.String()
+	for _, expected := range []string{
+		"<!DOCTYPE html>",
+		small1,
+		"&lt;b&gt;",
+		"17 B", // saved size
+		"Run failed: boom",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Fatalf("expected HTML to contain %q, got:\n%s", expected, html)
+		}
+	}
+	if strings.Contains(html, "<b>") {
+		t.Fatalf("expected filenames to be escaped, got:\n%s", html)
+	}
+}
@@ -0,0 +1,149 @@
+package fsdedupe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ResolverReviewer is a reviewer name of duplicate groups skipped by a GroupResolver (see ResolvePlan).
+const ResolverReviewer = "resolver"
+
+// GroupDecision is a GroupResolver decision on a duplicate group.
+type GroupDecision struct {
+	// Skip leaves the whole group as is.
+	Skip bool
+	// Note is a free-form skip reason.
+	Note string
+	// Canonical is a group file to keep, all others are replaced with links to it.
+	// Empty keeps the planned one.
+	Canonical string
+}
+
+// GroupResolver decides on a duplicate group: planned canonical file first, then its duplicates.
+type GroupResolver func(ctx context.Context, filenames []string) (GroupDecision, error)
+
+// ResolvePlan asks resolve about every (not yet reviewed) duplicate group of plan, in plan order,
+// so site-specific policies (like consulting an asset database) decide which file is kept.
+// Skipped groups are rejected (see DedupePlan.Review) with ResolverReviewer as a reviewer.
+func ResolvePlan(ctx context.Context, plan DedupePlan, resolve GroupResolver) (DedupePlan, error) {
+	var targets []string
+	groups := make(map[string][]PlanAction)
+	for _, action := range plan.Actions {
+		if _, ok := groups[action.Target]; !ok {
+			targets = append(targets, action.Target)
+		}
+		groups[action.Target] = append(groups[action.Target], action)
+	}
+
+	resolved := DedupePlan{
+		Actions: make([]PlanAction, 0, len(plan.Actions)),
+		Reviews: make(map[string]PlanReview, len(plan.Reviews)),
+	}
+	for target, review := range plan.Reviews {
+		resolved.Reviews[target] = review
+	}
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return plan, err
+		}
+
+		group := groups[target]
+		if plan.Reviews[target].Status != ReviewPending {
+			resolved.Actions = append(resolved.Actions, group...)
+			continue
+		}
+
+		filenames := make([]string, 0, len(group)+1)
+		filenames = append(filenames, target)
+		for _, action := range group {
+			filenames = append(filenames, action.Filename)
+		}
+		decision, err := resolve(ctx, filenames)
+		if err != nil {
+			return plan, fmt.Errorf("resolve duplicates of %q: %w", target, err)
+		}
+
+		switch {
+		case decision.Skip:
+			resolved.Actions = append(resolved.Actions, group...)
+			resolved.Reviews[target] = PlanReview{Status: ReviewRejected, Reviewer: ResolverReviewer, Note: decision.Note}
+		case decision.Canonical == "" || decision.Canonical == target:
+			resolved.Actions = append(resolved.Actions, group...)
+		default:
+			found := false
+			for _, action := range group {
+				if action.Filename == decision.Canonical {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return plan, fmt.Errorf("resolve duplicates of %q: %q is not in the group", target, decision.Canonical)
+			}
+
+			// planned canonical has the same size as its duplicates
+			resolved.Actions = append(resolved.Actions, PlanAction{Filename: target, Target: decision.Canonical, Size: group[0].Size, Hash: group[0].Hash})
+			for _, action := range group {
+				if action.Filename != decision.Canonical {
+					action.Target = decision.Canonical
+					resolved.Actions = append(resolved.Actions, action)
+				}
+			}
+		}
+	}
+	if len(resolved.Reviews) == 0 {
+		resolved.Reviews = nil
+	}
+	return resolved, nil
+}
+
+// ExecResolver returns a GroupResolver running an external program per duplicate group.
+// Group filenames (see GroupResolver) are written to program STDIN, one per line,
+// and the first line of its STDOUT is a decision:
+//
+//	keep         - keep the planned (first) file
+//	keep <FILE>  - keep this group file instead
+//	skip [NOTE]  - leave the group as is
+//
+// Program failures (non-zero exit, unexpected output) fail the resolution.
+func ExecResolver(name string, args ...string) GroupResolver {
+	return func(ctx context.Context, filenames []string) (GroupDecision, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = strings.NewReader(strings.Join(filenames, "\n") + "\n")
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return GroupDecision{}, fmt.Errorf("run %q: %w: %s", name, err, msg)
+			}
+			return GroupDecision{}, fmt.Errorf("run %q: %w", name, err)
+		}
+
+		line, _, _ := bufio.NewReader(&stdout).ReadLine()
+		decision, err := parseGroupDecision(string(line))
+		if err != nil {
+			return GroupDecision{}, fmt.Errorf("run %q: %w", name, err)
+		}
+		return decision, nil
+	}
+}
+
+func parseGroupDecision(line string) (GroupDecision, error) {
+	verb, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+	switch verb {
+	case "keep":
+		return GroupDecision{Canonical: arg}, nil
+	case "skip":
+		return GroupDecision{Skip: true, Note: arg}, nil
+	case "":
+		return GroupDecision{}, errors.New("no decision")
+	}
+	return GroupDecision{}, fmt.Errorf("unsupported decision %q, expected keep or skip", line)
+}
@@ -0,0 +1,129 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestResolvePlan(t *testing.T) {
+	plan := fsdedupe.DedupePlan{Actions: []fsdedupe.PlanAction{
+		{Filename: "/a/file2", Target: "/a/file1", Size: 4},
+		{Filename: "/b/file2", Target: "/b/file1", Size: 5},
+		{Filename: "/a/file3", Target: "/a/file1", Size: 4},
+		{Filename: "/c/file2", Target: "/c/file1", Size: 6},
+		{Filename: "/d/file2", Target: "/d/file1", Size: 7},
+	}}
+	plan.Review("/d/file1", fsdedupe.PlanReview{Status: fsdedupe.ReviewApproved})
+
+	var asked [][]string
+	resolved, err := fsdedupe.ResolvePlan(context.Background(), plan, func(_ context.Context, filenames []string) (fsdedupe.GroupDecision, error) {
+		asked = append(asked, filenames)
+		switch filenames[0] {
+		case "/a/file1":
+			return fsdedupe.GroupDecision{Canonical: "/a/file3"}, nil
+		case "/b/file1":
+			return fsdedupe.GroupDecision{Skip: true, Note: "in use"}, nil
+		}
+		return fsdedupe.GroupDecision{}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// reviewed groups are not asked about
+	if expected := [][]string{
+		{"/a/file1", "/a/file2", "/a/file3"},
+		{"/b/file1", "/b/file2"},
+		{"/c/file1", "/c/file2"},
+	}; !reflect.DeepEqual(asked, expected) {
+		t.Fatalf("expected %q to be asked about, got %q", expected, asked)
+	}
+	if expected := (fsdedupe.DedupePlan{
+		Actions: []fsdedupe.PlanAction{
+			{Filename: "/a/file1", Target: "/a/file3", Size: 4},
+			{Filename: "/a/file2", Target: "/a/file3", Size: 4},
+			{Filename: "/b/file2", Target: "/b/file1", Size: 5},
+			{Filename: "/c/file2", Target: "/c/file1", Size: 6},
+			{Filename: "/d/file2", Target: "/d/file1", Size: 7},
+		},
+		Reviews: map[string]fsdedupe.PlanReview{
+			"/b/file1": {Status: fsdedupe.ReviewRejected, Reviewer: fsdedupe.ResolverReviewer, Note: "in use"},
+			"/d/file1": {Status: fsdedupe.ReviewApproved},
+		},
+	}); !reflect.DeepEqual(resolved, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, resolved)
+	}
+
+	// canonical must be in the group
+	if _, err := fsdedupe.ResolvePlan(context.Background(), plan, func(context.Context, []string) (fsdedupe.GroupDecision, error) {
+		return fsdedupe.GroupDecision{Canonical: "/x/file"}, nil
+	}); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+}
+
+func TestExecResolver(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on", runtime.GOOS)
+	}
+	tmp := t.TempDir()
+
+	// keeps the last file of a group, skips groups of "keep" dir
+	script := filepath.Join(tmp, "resolver.sh")
+	writeFile(t, script, `#!/bin/sh
+last=
+while read -r name; do last=$name; done
+case $last in
+*/keep/*) echo "skip kept by policy" ;;
+*) echo "keep $last" ;;
+esac
+`)
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(tmp, "keep", "file3.txt")
+	writeFile(t, file3, "KEEP")
+	file4 := filepath.Join(tmp, "keep", "file4.txt")
+	writeFile(t, file4, "KEEP")
+
+	plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice([]string{file1, file2, file3, file4}))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if plan, err = fsdedupe.ResolvePlan(context.Background(), plan, fsdedupe.ExecResolver(script)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	summary := new(fsdedupe.Summary)
+	if err := fsdedupe.ApplyPlan(context.Background(), plan, fsdedupe.WithSummary(summary)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := readlink(t, file1), file2; actual != expected {
+		t.Fatalf("expected %q to be linked to %q, got %q", file1, expected, actual)
+	}
+	for _, name := range []string{file2, file3, file4} {
+		if !lstat(t, name).Mode().IsRegular() {
+			t.Fatalf("expected %q to be a regular file, but it is not", name)
+		}
+	}
+	if actual, expected := summary.Skipped, 1; actual != expected {
+		t.Fatalf("expected %d skipped, got %d", expected, actual)
+	}
+
+	// unexpected output fails
+	writeFile(t, script, "#!/bin/sh\necho remove\n")
+	if _, err := fsdedupe.ExecResolver(script)(context.Background(), []string{file1, file2}); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+}
@@ -0,0 +1,167 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RestoreReport is a RestoreDuplicates report.
+type RestoreReport struct {
+	// Restored is a number of symlinks replaced with independent copies.
+	Restored int `json:"restored"`
+	// RestoredBytes is a total size of restored copies (disk space no longer saved).
+	RestoredBytes int64 `json:"restored_bytes"`
+	// Skipped is a number of filenames, which are not symlinked duplicates of canonical.
+	Skipped int `json:"skipped"`
+}
+
+// RestoreDuplicates re-materializes symlinked duplicates (see DedupeSymlink) back into independent regular files,
+// e.g. before handing a directory over to someone, who must receive self-contained files.
+// Canonical is either a file path (duplicates are symlinks resolving to it)
+// or a content hash (see ParseHash, duplicates are symlinks resolving to a file with such contents).
+// Filenames, which are not symlinked duplicates of canonical, are skipped (and logged).
+// Copies get canonical file mode and modification time, and replace symlinks atomically.
+// WithLogger and WithLimiter options are honored.
+func RestoreDuplicates(ctx context.Context, canonical string, filenames Iterator, opts ...Option) (RestoreReport, error) {
+	o := buildOptions(opts)
+	var report RestoreReport
+
+	isDuplicate, err := duplicateMatcher(ctx, canonical, o.limiter)
+	if err != nil {
+		return report, err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		filename, err := filenames.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return report, iteratorError(err)
+		}
+
+		lstat, err := os.Lstat(filename)
+		if err != nil {
+			return report, fmt.Errorf("lstat %q: %w", filename, err)
+		}
+		if lstat.Mode()&fs.ModeSymlink == 0 {
+			o.logger.Printf("skipping %q: not a symlink", filename)
+			report.Skipped++
+			continue
+		}
+		target, err := filepath.EvalSymlinks(filename)
+		if err != nil {
+			return report, fmt.Errorf("resolve %q: %w", filename, err)
+		}
+		if ok, err := isDuplicate(target); err != nil {
+			return report, err
+		} else if !ok {
+			o.logger.Printf("skipping %q: not a duplicate of %q", filename, canonical)
+			report.Skipped++
+			continue
+		}
+
+		size, err := restoreFile(ctx, target, filename, o.limiter)
+		if err != nil {
+			return report, err
+		}
+		report.Restored++
+		report.RestoredBytes += size
+	}
+
+	return report, nil
+}
+
+// duplicateMatcher returns a func, reporting if a (resolved) symlink target is the canonical file path
+// or has the canonical content hash.
+func duplicateMatcher(ctx context.Context, canonical string, limiter Limiter) (func(target string) (bool, error), error) {
+	if hash, err := ParseHash(canonical); err == nil {
+		digest := sha512.New()
+		hashes := make(map[string]string) // target -> hash, many duplicates point to the same target
+		return func(target string) (bool, error) {
+			actual, ok := hashes[target]
+			if !ok {
+				digest.Reset()
+				if actual, err = hashContents(ctx, digest, target, limiter); err != nil {
+					return false, fmt.Errorf("hash contents of %q: %w", target, err)
+				}
+				hashes[target] = actual
+			}
+			return actual == hash, nil
+		}, nil
+	}
+
+	canonicalStat, err := os.Stat(canonical)
+	if err != nil {
+		return nil, fmt.Errorf("stat canonical %q: %w", canonical, err)
+	}
+	return func(target string) (bool, error) {
+		stat, err := os.Stat(target)
+		if err != nil {
+			return false, fmt.Errorf("stat %q: %w", target, err)
+		}
+		return os.SameFile(stat, canonicalStat), nil
+	}, nil
+}
+
+// restoreFile atomically replaces symlink name with a copy of src, returning the copied size.
+func restoreFile(ctx context.Context, src, name string, limiter Limiter) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("open %q: %w", src, err)
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat %q: %w", src, err)
+	}
+	if err := checkFree(filepath.Dir(name), DiskUsage(stat), 1); err != nil {
+		return 0, fmt.Errorf("restore %q: %w", name, err)
+	}
+
+	// same-dir temp file, so the final rename is atomic
+	out, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("create temp file for %q: %w", name, err)
+	}
+	tmp := out.Name()
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	if IsSparse(stat) {
+		if err := copySparse(ctx, out, in, limiter); err != nil {
+			return 0, fmt.Errorf("sparse copy %q -> %q: %w", src, tmp, err)
+		}
+	} else if _, err := CopyContext(ctx, out, in, limiter); err != nil {
+		return 0, fmt.Errorf("copy %q -> %q: %w", src, tmp, err)
+	}
+	if err := out.Sync(); err != nil {
+		return 0, fmt.Errorf("sync %q: %w", tmp, err)
+	}
+	if err := out.Close(); err != nil {
+		return 0, fmt.Errorf("close %q: %w", tmp, err)
+	}
+	// explicit chmod, as creation mode is subject to umask
+	if err := os.Chmod(tmp, stat.Mode().Perm()); err != nil {
+		return 0, fmt.Errorf("chmod %q: %w", tmp, err)
+	}
+	if err := os.Chtimes(tmp, time.Time{}, stat.ModTime()); err != nil {
+		return 0, fmt.Errorf("chtimes %q: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return 0, fmt.Errorf("rename %q -> %q: %w", tmp, name, err)
+	}
+	return stat.Size(), nil
+}
@@ -0,0 +1,63 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestRestoreDuplicates(t *testing.T) {
+	for name, canonical := range map[string]func(file1 string) string{
+		"path": func(file1 string) string { return file1 },
+		"hash": func(string) string {
+			return "sha512:5b853931a07284429862382338a94e0c7dc36495790b4e6d7b3b4b8b2aa5c0145c465c759fe29c3b71ba8952bf1ab3fd9ce1052a79f1401f3c8f7f82ab8bd22f" // echo -n DUPE | sha512sum
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+
+			file1 := filepath.Join(tmp, "file1.txt")
+			writeFile(t, file1, "DUPE")
+			file2 := filepath.Join(tmp, "project", "file2.txt")
+			writeFile(t, file2, "DUPE")
+			file3 := filepath.Join(tmp, "other", "file3.txt")
+			writeFile(t, file3, "DUPE")
+			file4 := filepath.Join(tmp, "project", "file4.txt")
+			writeFile(t, file4, "UNIQ")
+
+			if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{file1, file2, file3, file4})); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+
+			report, err := fsdedupe.RestoreDuplicates(context.Background(), canonical(file1), fsdedupe.Slice([]string{file2, file4}))
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if expected := (fsdedupe.RestoreReport{Restored: 1, RestoredBytes: 4, Skipped: 1}); report != expected {
+				t.Errorf("expected %+v, got %+v", expected, report)
+			}
+
+			// restored copy is an independent regular file
+			if stat, err := os.Lstat(file2); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			} else if !stat.Mode().IsRegular() {
+				t.Errorf("expected %q to be a regular file, got %s", file2, stat.Mode())
+			}
+			if b, err := os.ReadFile(file2); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			} else if actual, expected := string(b), "DUPE"; actual != expected {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+
+			// not selected duplicate is kept symlinked
+			if stat, err := os.Lstat(file3); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			} else if stat.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("expected %q to still be a symlink, got %s", file3, stat.Mode())
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package fsdedupe
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnknownUpload is returned for unknown (never created, committed or cancelled) resumable upload tokens.
+var ErrUnknownUpload = errors.New("unknown upload")
+
+const uploadStateSuffix = ".upload"
+
+// uploadLockSuffix is a lock dir file suffix of resumable uploads,
+// not a ".lock" one, which per-hash lock files (cleaned up by GC) have.
+const uploadLockSuffix = ".uploadlock"
+
+// uploadsDir is a temp dir subdir of resumable uploads, so upload files never share Create temp files namespace.
+const uploadsDir = "uploads"
+
+// uploadTokenAlphabet is an alphabet of rand.Text upload tokens.
+const uploadTokenAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+
+// uploadState is a persisted resumable upload state.
+type uploadState struct {
+	LinkName  string          `json:"link_name"`
+	Overwrite OverwritePolicy `json:"overwrite"`
+	Hints     []string        `json:"hints,omitempty"`
+	// Offset is a number of durably written (synced) bytes.
+	Offset int64 `json:"offset"`
+	// Digest is a marshaled hash state as of Offset.
+	Digest []byte `json:"digest"`
+}
+
+// CreateResumable starts a resumable upload of the file (see Create),
+// returning an opaque token for AppendChunk/Commit/CancelResumable.
+// Upload state is persisted in temp dir, so interrupted uploads can be continued
+// (even by another process, see WithLockDir) from UploadOffset.
+// Operations on the same upload are serialized, concurrent appends are applied one after another.
+func (s *DedupeFS) CreateResumable(linkName string, opts ...CreateOption) (string, error) {
+	cleanLinkName, _, err := s.resolve(linkName)
+	if err != nil {
+		return "", err
+	}
+	o := buildCreateOptions(opts)
+
+	dir := filepath.Join(s.tempDir, uploadsDir)
+	if err := os.MkdirAll(dir, s.dirPerm); err != nil {
+		return "", fmt.Errorf("ensure dir %q: %w", dir, err)
+	}
+
+	// random (unguessable, never colliding) token
+	token := rand.Text()
+	tempFile, err := os.OpenFile(s.uploadPath(token), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return "", fmt.Errorf("close temp file: %w", err)
+	}
+
+	digest, err := sha512.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return "", fmt.Errorf("marshal digest: %w", err)
+	}
+	state := uploadState{
+		LinkName:  cleanLinkName,
+		Overwrite: o.overwrite,
+		Hints:     o.hints,
+		Digest:    digest,
+	}
+	if err := s.saveUpload(token, &state); err != nil {
+		os.Remove(s.uploadPath(token))
+		return "", err
+	}
+	return token, nil
+}
+
+// UploadOffset returns a number of durably stored bytes of a resumable upload,
+// which is where the client should continue from after interruption.
+func (s *DedupeFS) UploadOffset(token string) (int64, error) {
+	state, err := s.loadUpload(token)
+	if err != nil {
+		return 0, err
+	}
+	return state.Offset, nil
+}
+
+// AppendChunk appends r contents to a resumable upload, returning its new offset.
+// Chunk is durably stored (synced) before returning, partially written chunks are discarded on next append.
+func (s *DedupeFS) AppendChunk(token string, r io.Reader) (int64, error) {
+	state, unlock, err := s.lockedUpload(token)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	digest := sha512.New()
+	if err := digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.Digest); err != nil {
+		return 0, fmt.Errorf("unmarshal digest: %w", err)
+	}
+
+	tempFileName := s.uploadPath(token)
+	tempFile, err := os.OpenFile(tempFileName, os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("open temp file %q: %w", tempFileName, err)
+	}
+	defer tempFile.Close()
+
+	// drop anything written after the last saved state (interrupted append)
+	if err := tempFile.Truncate(state.Offset); err != nil {
+		return 0, fmt.Errorf("truncate temp file %q: %w", tempFileName, err)
+	}
+	if _, err := tempFile.Seek(state.Offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek temp file %q: %w", tempFileName, err)
+	}
+
+	n, err := io.Copy(io.MultiWriter(tempFile, digest), r)
+	if err != nil {
+		return state.Offset, fmt.Errorf("write %q: %w", state.LinkName, err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		return state.Offset, fmt.Errorf("sync temp file %q: %w", tempFileName, err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return state.Offset, fmt.Errorf("close temp file %q: %w", tempFileName, err)
+	}
+
+	if state.Digest, err = digest.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		return state.Offset, fmt.Errorf("marshal digest: %w", err)
+	}
+	state.Offset += n
+	if err := s.saveUpload(token, state); err != nil {
+		return state.Offset - n, err
+	}
+	return state.Offset, nil
+}
+
+// Commit finishes a resumable upload, linking the file (see Create) and returning its new version (see Version).
+func (s *DedupeFS) Commit(token string) (string, error) {
+	state, unlock, err := s.lockedUpload(token)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	_, absLinkName, err := s.resolve(state.LinkName)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha512.New()
+	if err := digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.Digest); err != nil {
+		return "", fmt.Errorf("unmarshal digest: %w", err)
+	}
+
+	tempFileName := s.uploadPath(token)
+	tempFile, err := os.OpenFile(tempFileName, os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("open temp file %q: %w", tempFileName, err)
+	}
+	if err := tempFile.Truncate(state.Offset); err != nil {
+		tempFile.Close()
+		return "", fmt.Errorf("truncate temp file %q: %w", tempFileName, err)
+	}
+	sniffed, err := sniffFile(tempFileName)
+	if err != nil {
+		tempFile.Close()
+		return "", err
+	}
+
+	f := &fileWriter{
+		tempFileName: tempFileName,
+		store:        s,
+		absLinkName:  absLinkName,
+		dirPerm:      s.dirPerm,
+		overwrite:    state.Overwrite,
+		hints:        state.Hints,
+
+		tempFile: tempFile,
+		digest:   digest,
+		sniffed:  sniffed,
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Remove(s.uploadStatePath(token)); err != nil {
+		return "", fmt.Errorf("remove upload state: %w", err)
+	}
+	if err := s.removeUploadLock(token); err != nil {
+		return "", err
+	}
+
+	return linkVersion(absLinkName)
+}
+
+// CancelResumable discards a resumable upload.
+func (s *DedupeFS) CancelResumable(token string) error {
+	_, unlock, err := s.lockedUpload(token)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(s.uploadPath(token)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove temp file: %w", err)
+	}
+	if err := os.Remove(s.uploadStatePath(token)); err != nil {
+		return fmt.Errorf("remove upload state: %w", err)
+	}
+	return s.removeUploadLock(token)
+}
+
+func (s *DedupeFS) uploadPath(token string) string {
+	return filepath.Join(s.tempDir, uploadsDir, token+DataFileExt)
+}
+
+func (s *DedupeFS) uploadStatePath(token string) string {
+	return filepath.Join(s.tempDir, uploadsDir, token+uploadStateSuffix)
+}
+
+// lockedUpload locks (see lockUpload) and loads upload state, returning unlock func.
+func (s *DedupeFS) lockedUpload(token string) (*uploadState, func(), error) {
+	unlock, err := s.lockUpload(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := s.loadUpload(token)
+	if errors.Is(err, ErrUnknownUpload) {
+		// do not leave lock files of finished uploads behind
+		if rerr := s.removeUploadLock(token); rerr != nil {
+			err = errors.Join(err, rerr)
+		}
+	}
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return state, unlock, nil
+}
+
+// lockUpload serializes operations on the same upload, in-process and cross-process (see WithLockDir),
+// returning unlock func.
+func (s *DedupeFS) lockUpload(token string) (func(), error) {
+	// token is a part of file names
+	if token == "" || strings.Trim(token, uploadTokenAlphabet) != "" {
+		return nil, fmt.Errorf("%q: %w", token, ErrUnknownUpload)
+	}
+
+	unlockMem := s.locks.uploads.lock(token)
+	if s.lockDir == "" {
+		return unlockMem, nil
+	}
+	unlockFile, err := s.lockFile(token+uploadLockSuffix, true)
+	if err != nil {
+		unlockMem()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		unlockMem()
+	}, nil
+}
+
+// removeUploadLock removes lock file of a finished (committed, cancelled) upload, its lock must be held.
+// Processes waiting for it find the upload unknown then.
+func (s *DedupeFS) removeUploadLock(token string) error {
+	if s.lockDir == "" {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(s.lockDir, token+uploadLockSuffix)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove upload lock file: %w", err)
+	}
+	return nil
+}
+
+func (s *DedupeFS) loadUpload(token string) (*uploadState, error) {
+	if token == "" || strings.Trim(token, uploadTokenAlphabet) != "" {
+		return nil, fmt.Errorf("%q: %w", token, ErrUnknownUpload)
+	}
+
+	b, err := os.ReadFile(s.uploadStatePath(token))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%q: %w", token, ErrUnknownUpload)
+	} else if err != nil {
+		return nil, fmt.Errorf("read upload state: %w", err)
+	}
+
+	state := new(uploadState)
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("decode upload state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *DedupeFS) saveUpload(token string, state *uploadState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode upload state: %w", err)
+	}
+
+	path := s.uploadStatePath(token)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return fmt.Errorf("write %q: %w", tmp, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync %q: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close %q: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename %q: %w", tmp, err)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package fsdedupe_test
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_CreateResumable(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const name = "sub/dir/file.txt"
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+
+	token, err := subject.CreateResumable(name)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if offset, err := subject.AppendChunk(token, strings.NewReader("DUM")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if offset != 3 {
+		t.Errorf("expected offset 3, got %d", offset)
+	}
+
+	// interrupted append: garbage past the saved offset is discarded
+	f, err := os.OpenFile(filepath.Join(tmp, "temp", "uploads", token+".bin"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := f.WriteString("GARBAGE"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	f.Close()
+
+	// resume with a fresh instance (e.g. after restart)
+	subject = setupDedupeFS(t, tmp)
+	offset, err := subject.UploadOffset(token)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if offset != 3 {
+		t.Errorf("expected offset 3, got %d", offset)
+	}
+	if _, err := subject.AppendChunk(token, strings.NewReader("MY")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	version, err := subject.Commit(token)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !strings.HasPrefix(version, contentsHash) {
+		t.Errorf("expected version %q to start with content hash %q", version, contentsHash)
+	}
+
+	b, err := os.ReadFile(filepath.Join(tmp, "link", name))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := string(b), "DUMMY"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	if _, err := subject.AppendChunk(token, strings.NewReader("MORE")); !errors.Is(err, fsdedupe.ErrUnknownUpload) {
+		t.Errorf("expected %v after commit, got: %v", fsdedupe.ErrUnknownUpload, err)
+	}
+}
+
+func TestDedupeFS_CancelResumable(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	token, err := subject.CreateResumable("file.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := subject.AppendChunk(token, strings.NewReader("DUMMY")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := subject.CancelResumable(token); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(tmp, "temp", "uploads"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected uploads dir to be empty, got %d entries", len(entries))
+	}
+	if _, err := subject.Commit(token); !errors.Is(err, fsdedupe.ErrUnknownUpload) {
+		t.Errorf("expected %v, got: %v", fsdedupe.ErrUnknownUpload, err)
+	}
+}
+
+func TestDedupeFS_CreateResumable_concurrent(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const uploads = 50
+	tokens := make(chan string, uploads)
+	errs := make(chan error, uploads)
+	var wg sync.WaitGroup
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := subject.CreateResumable(fmt.Sprintf("file%d.txt", i))
+			if err != nil {
+				errs <- err
+				return
+			}
+			tokens <- token
+		}()
+	}
+	wg.Wait()
+	close(tokens)
+	close(errs)
+	for err := range errs {
+		t.Errorf("expected no error, got: %s", err)
+	}
+
+	seen := make(map[string]struct{})
+	for token := range tokens {
+		if _, ok := seen[token]; ok {
+			t.Errorf("expected unique tokens, got %q twice", token)
+		}
+		seen[token] = struct{}{}
+	}
+
+	// plain Creates never touch upload files
+	setupDedupeFS_Create(t, subject, "plain.txt", "PLAIN")
+	for token := range seen {
+		if offset, err := subject.UploadOffset(token); err != nil {
+			t.Errorf("expected no error, got: %s", err)
+		} else if offset != 0 {
+			t.Errorf("expected offset 0, got %d", offset)
+		}
+	}
+
+	if _, err := subject.UploadOffset("../plain"); !errors.Is(err, fsdedupe.ErrUnknownUpload) {
+		t.Errorf("expected ErrUnknownUpload, got: %v", err)
+	}
+}
+
+// TestDedupeFS_AppendChunk_concurrent appends chunks of the same upload concurrently
+// via two DedupeFS instances (not sharing in-process locks, as separate processes would) over the same dirs.
+func TestDedupeFS_AppendChunk_concurrent(t *testing.T) {
+	tmp := t.TempDir()
+	setup := func() *fsdedupe.DedupeFS {
+		subject, err := fsdedupe.NewDedupeFS(
+			filepath.Join(tmp, "temp"),
+			filepath.Join(tmp, "data"),
+			filepath.Join(tmp, "link"),
+			fsdedupe.WithLockDir(filepath.Join(tmp, "lock")),
+		)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		return subject
+	}
+	instances := []*fsdedupe.DedupeFS{setup(), setup()}
+
+	token, err := instances[0].CreateResumable("file.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	const appends = 20
+	errs := make(chan error, 2*appends)
+	var wg sync.WaitGroup
+	for i, subject := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chunk := strings.Repeat(fmt.Sprintf("CHUNK %d;", i), 1000)
+			for range appends {
+				if _, err := subject.AppendChunk(token, strings.NewReader(chunk)); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if _, err := instances[1].Commit(token); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := instances[0].CancelResumable(token); !errors.Is(err, fsdedupe.ErrUnknownUpload) {
+		t.Fatalf("expected ErrUnknownUpload, got: %v", err)
+	}
+
+	// whole chunks, all of them, stored under their actual hash
+	link := filepath.Join(tmp, "link", "file.txt")
+	b, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatalf("read %q: %s", link, err)
+	}
+	if actual, expected := len(b), 2*appends*len("CHUNK 0;")*1000; actual != expected {
+		t.Fatalf("expected %d bytes, got %d", expected, actual)
+	}
+	sum := sha512.Sum512(b)
+	if actual, expected := filepath.Base(readlink(t, link)), hex.EncodeToString(sum[:])+".bin"; actual != expected {
+		t.Fatalf("expected data file %q, got %q", expected, actual)
+	}
+
+	if entries, err := os.ReadDir(filepath.Join(tmp, "lock")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else {
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".uploadlock") {
+				t.Errorf("expected upload lock file to be removed, got %q", entry.Name())
+			}
+		}
+	}
+}
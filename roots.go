@@ -0,0 +1,79 @@
+package fsdedupe
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// rootChecker detects input symlinks, which resolve outside of allowed roots (see WithAllowedRoots).
+type rootChecker struct {
+	roots []string // absolute, resolved
+}
+
+func newRootChecker(roots []string) (*rootChecker, error) {
+	resolved := make([]string, 0, len(roots))
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("resolve root %q: %w", root, err)
+		}
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			return nil, fmt.Errorf("resolve root %q: %w", root, err)
+		}
+		resolved = append(resolved, abs)
+	}
+	return &rootChecker{roots: resolved}, nil
+}
+
+// excluded returns a skip detail, if filename is a symlink resolving outside of roots (or not resolving at all).
+// Missing files are not excluded, but left to fail as usual.
+// Nil rootChecker excludes nothing.
+func (c *rootChecker) excluded(filename string) string {
+	if c == nil {
+		return ""
+	}
+	lstat, err := os.Lstat(filename)
+	if err != nil || lstat.Mode()&fs.ModeSymlink == 0 {
+		return ""
+	}
+
+	target, err := filepath.EvalSymlinks(filename)
+	if err == nil {
+		target, err = filepath.Abs(target)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	for _, root := range c.roots {
+		if withinDir(target, root) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("target %q is outside allowed roots", target)
+}
+
+// rootFilter is an Iterator skipping (and accounting) excluded filenames (see options.excluded).
+// It must be consumed by the run goroutine (not by the hash pipeline).
+type rootFilter struct {
+	filenames Iterator
+	o         *options
+}
+
+func (f *rootFilter) Next() (string, error) {
+	for {
+		filename, err := f.filenames.Next()
+		if err != nil {
+			return filename, err
+		}
+		if detail := f.o.excluded(filename); detail != "" {
+			f.o.logger.Printf("skipping %q: %s", filename, detail)
+			if err := f.o.skipped(filename, SkipExcluded, detail); err != nil {
+				return "", err
+			}
+			continue
+		}
+		return filename, nil
+	}
+}
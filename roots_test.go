@@ -0,0 +1,61 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeSymlink_allowedRoots(t *testing.T) {
+	tmp := t.TempDir()
+	tree := filepath.Join(tmp, "tree")
+
+	file1 := filepath.Join(tree, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tree, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	external := filepath.Join(tmp, "external.txt")
+	writeFile(t, external, "DUPE")
+
+	externalLink := filepath.Join(tree, "external.txt")
+	if err := os.Symlink(external, externalLink); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	internalLink := filepath.Join(tree, "internal.txt")
+	if err := os.Symlink("file2.txt", internalLink); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{externalLink, file1, internalLink},
+	}, fsdedupe.WithAllowedRoots(tree))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Files, 2; actual != expected {
+		t.Fatalf("expected %d files, got %d", expected, actual)
+	}
+	if actual, expected := readlink(t, externalLink), external; actual != expected {
+		t.Fatalf("expected external symlink to be left as is (-> %q), got -> %q", expected, actual)
+	}
+	if actual, expected := readlink(t, internalLink), file1; actual != expected {
+		t.Fatalf("expected internal symlink to be relinked to %q, got -> %q", expected, actual)
+	}
+
+	// no roots: symlinks are not considered at all
+	summary, err = fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, internalLink, file2},
+	}, fsdedupe.WithAllowedRoots())
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Files, 2; actual != expected {
+		t.Fatalf("expected %d files, got %d", expected, actual)
+	}
+	if actual, expected := readlink(t, file2), file1; actual != expected {
+		t.Fatalf("expected %q to be linked to %q, got -> %q", file2, expected, actual)
+	}
+}
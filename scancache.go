@@ -0,0 +1,245 @@
+package fsdedupe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// scanCacheRacyWindow is a max filesystem mtime granularity (FAT has 2s):
+// directories modified that close to a scan may still change without mtime change,
+// so they are not cached (they are re-scanned next time).
+const scanCacheRacyWindow = 2 * time.Second
+
+// ScanCache remembers fingerprints (mtime, entry count) of scanned directories (see WalkDir),
+// so directories unchanged since a previous run are skipped entirely on repeat runs.
+// Note that in-place modifications of files don't change directory fingerprint.
+// It is safe for concurrent use.
+type ScanCache struct {
+	mu   sync.Mutex
+	dirs map[string]dirFingerprint
+}
+
+type dirFingerprint struct {
+	ModTime int64    `json:"mtime"` // UnixNano
+	Entries int      `json:"entries"`
+	Subdirs []string `json:"subdirs"` // names, still walked (their changes don't affect parent fingerprint)
+}
+
+type scanCacheFile struct {
+	Dirs map[string]dirFingerprint `json:"dirs"`
+}
+
+// NewScanCache creates an empty ScanCache.
+func NewScanCache() *ScanCache {
+	return &ScanCache{dirs: make(map[string]dirFingerprint)}
+}
+
+// ReadScanCache reads ScanCache written by WriteTo.
+func ReadScanCache(r io.Reader) (*ScanCache, error) {
+	var f scanCacheFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("decode scan cache: %w", err)
+	}
+	c := NewScanCache()
+	for dir, fp := range f.Dirs {
+		c.dirs[dir] = fp
+	}
+	return c, nil
+}
+
+// WriteTo writes ScanCache as JSON.
+// It is meant to be called after a successful run only,
+// as directories are recorded as scanned once their files are iterated.
+func (c *ScanCache) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	b, err := json.Marshal(scanCacheFile{Dirs: c.dirs})
+	c.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("encode scan cache: %w", err)
+	}
+	n, err := w.Write(b)
+	if err != nil {
+		return int64(n), fmt.Errorf("write scan cache: %w", err)
+	}
+	return int64(n), nil
+}
+
+func (c *ScanCache) lookup(dir string) (dirFingerprint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fp, ok := c.dirs[dir]
+	return fp, ok
+}
+
+func (c *ScanCache) store(dir string, fp dirFingerprint, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ok {
+		c.dirs[dir] = fp
+	} else {
+		delete(c.dirs, dir)
+	}
+}
+
+type dirWalker struct {
+	cache    *ScanCache
+	start    time.Time
+	maxDepth int
+
+	dirs    []walkDir // to be walked
+	files   []string  // of the current dir
+	visited map[fileID]string
+}
+
+type walkDir struct {
+	path  string
+	depth int // root being 1
+}
+
+// WalkOption configures WalkDir.
+type WalkOption func(*dirWalker)
+
+// WithMaxDepth limits a number of dir levels walked (root being level 1), 0 - unlimited.
+// Dirs beyond the limit are not walked, see WalkSkipError.
+func WithMaxDepth(n int) WalkOption {
+	return func(w *dirWalker) {
+		w.maxDepth = n
+	}
+}
+
+// WalkSkipError is returned by WalkDir Iterator for a dir it does not descend into:
+// a dir loop (a bind mount of an ancestor etc) or a dir beyond WithMaxDepth.
+// Unlike other errors, it does not end the iteration: further Next calls continue with other dirs.
+// DedupeSymlink (and PlanSymlink) account such dirs as skipped (the run report has them) instead of failing.
+type WalkSkipError struct {
+	// Dir is a dir not walked.
+	Dir string
+	// Reason is SkipLoop or SkipTooDeep.
+	Reason SkipReason
+	// Detail is a human-readable explanation.
+	Detail string
+}
+
+func (e *WalkSkipError) Error() string {
+	return fmt.Sprintf("not walking %q: %s", e.Dir, e.Detail)
+}
+
+// WalkDir is an Iterator of regular files in root tree (symlinks are not followed).
+// With cache (may be nil), files of directories unchanged since a previous run are skipped
+// without listing or stat-ing them; pass WithResume index of that run to link new duplicates to them.
+// Dirs already walked under another name (loops) are detected on Linux and macOS only.
+func WalkDir(root string, cache *ScanCache, opts ...WalkOption) Iterator {
+	w := &dirWalker{
+		cache:   cache,
+		start:   time.Now(),
+		dirs:    []walkDir{{path: filepath.Clean(root), depth: 1}},
+		visited: make(map[fileID]string),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+func (w *dirWalker) Next() (string, error) {
+	for len(w.files) == 0 {
+		if len(w.dirs) == 0 {
+			return "", io.EOF
+		}
+		dir := w.dirs[len(w.dirs)-1]
+		w.dirs = w.dirs[:len(w.dirs)-1]
+		if err := w.scan(dir); err != nil {
+			return "", err
+		}
+	}
+
+	filename := w.files[0]
+	w.files = w.files[1:]
+	return filename, nil
+}
+
+// scan queues dir files (unless unchanged since cached) and subdirs.
+func (w *dirWalker) scan(d walkDir) error {
+	dir := d.path
+	if w.maxDepth > 0 && d.depth > w.maxDepth {
+		return &WalkSkipError{Dir: dir, Reason: SkipTooDeep, Detail: fmt.Sprintf("deeper than %d levels", w.maxDepth)}
+	}
+
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", dir, err)
+	}
+	if id, ok := idOf(stat); ok {
+		if visited, ok := w.visited[id]; ok {
+			return &WalkSkipError{Dir: dir, Reason: SkipLoop, Detail: fmt.Sprintf("same dir as already walked %q", visited)}
+		}
+		w.visited[id] = dir
+	}
+
+	var cached dirFingerprint
+	var isCached bool
+	if w.cache != nil {
+		cached, isCached = w.cache.lookup(dir)
+	}
+	if isCached && cached.ModTime == stat.ModTime().UnixNano() {
+		names, err := readDirNames(dir)
+		if err != nil {
+			return err
+		}
+		if len(names) == cached.Entries {
+			w.pushSubdirs(d, cached.Subdirs)
+			return nil
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read dir %q: %w", dir, err)
+	}
+	fp := dirFingerprint{
+		ModTime: stat.ModTime().UnixNano(),
+		Entries: len(entries),
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir():
+			fp.Subdirs = append(fp.Subdirs, entry.Name())
+		case entry.Type().IsRegular():
+			w.files = append(w.files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	w.pushSubdirs(d, fp.Subdirs)
+
+	if w.cache != nil {
+		// too recently modified dirs may change again within the same mtime tick
+		w.cache.store(dir, fp, w.start.Sub(stat.ModTime()) > scanCacheRacyWindow)
+	}
+	return nil
+}
+
+// pushSubdirs queues subdirs to be walked in name order.
+func (w *dirWalker) pushSubdirs(d walkDir, names []string) {
+	for i := len(names) - 1; i >= 0; i-- {
+		w.dirs = append(w.dirs, walkDir{path: filepath.Join(d.path, names[i]), depth: d.depth + 1})
+	}
+}
+
+// readDirNames lists dir entry names without stat-ing them.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open dir %q: %w", dir, err)
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %q: %w", dir, err)
+	}
+	return names, nil
+}
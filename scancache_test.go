@@ -0,0 +1,135 @@
+package fsdedupe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWalkDir(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUMMY")
+	file2 := filepath.Join(tmp, "sub", "file2.txt")
+	writeFile(t, file2, "DUMMY")
+	file3 := filepath.Join(tmp, "sub", "dir", "file3.txt")
+	writeFile(t, file3, "DUMMY")
+	if err := os.Symlink(file1, filepath.Join(tmp, "link.txt")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// dirs modified long ago are cached
+	past := time.Now().Add(-time.Hour)
+	for _, dir := range []string{tmp, filepath.Join(tmp, "sub"), filepath.Join(tmp, "sub", "dir")} {
+		if err := os.Chtimes(dir, past, past); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+
+	cache := fsdedupe.NewScanCache()
+	if actual, expected := drain(t, fsdedupe.WalkDir(tmp, cache)), []string{file1, file2, file3}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	if _, err := cache.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	cache, err := fsdedupe.ReadScanCache(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	// unchanged tree is skipped
+	if actual := drain(t, fsdedupe.WalkDir(tmp, cache)); len(actual) != 0 {
+		t.Errorf("expected no files, got %q", actual)
+	}
+
+	// only changed (just now, so not cached) dir is re-scanned
+	file4 := filepath.Join(tmp, "sub", "dir", "file4.txt")
+	writeFile(t, file4, "DUMMY")
+	for range 2 {
+		if actual, expected := drain(t, fsdedupe.WalkDir(tmp, cache)), []string{file3, file4}; !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	}
+
+	// no cache
+	if actual, expected := drain(t, fsdedupe.WalkDir(tmp, nil)), []string{file1, file2, file3, file4}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestWalkDir_maxDepth(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUMMY")
+	file2 := filepath.Join(tmp, "sub", "file2.txt")
+	writeFile(t, file2, "DUMMY")
+	writeFile(t, filepath.Join(tmp, "sub", "dir", "file3.txt"), "DUMMY")
+
+	it := fsdedupe.WalkDir(tmp, nil, fsdedupe.WithMaxDepth(2))
+	if actual, expected := drain(t, &walkSkips{Iterator: it}), []string{file1, file2, "skip too-deep " + filepath.Join(tmp, "sub", "dir")}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// too deep dirs are accounted as skipped, duplicates within depth are linked
+	var skipped []string
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.WalkDir(tmp, nil, fsdedupe.WithMaxDepth(2)),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+			skipped = append(skipped, string(reason)+" "+filename)
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"too-deep " + filepath.Join(tmp, "sub", "dir")}; !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("expected skipped %q, got %q", expected, skipped)
+	}
+	if actual, expected := summary.Skipped, 1; actual != expected {
+		t.Errorf("expected %d skipped, got %d", expected, actual)
+	}
+	if actual, expected := summary.Linked, 1; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+}
+
+// walkSkips is an Iterator turning WalkSkipError into "skip <reason> <dir>" entries.
+type walkSkips struct {
+	fsdedupe.Iterator
+}
+
+func (it *walkSkips) Next() (string, error) {
+	filename, err := it.Iterator.Next()
+	var walkSkip *fsdedupe.WalkSkipError
+	if errors.As(err, &walkSkip) {
+		return "skip " + string(walkSkip.Reason) + " " + walkSkip.Dir, nil
+	}
+	return filename, err
+}
+
+func drain(t *testing.T, it fsdedupe.Iterator) []string {
+	t.Helper()
+
+	var filenames []string
+	for {
+		filename, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			return filenames
+		} else if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		filenames = append(filenames, filename)
+	}
+}
@@ -0,0 +1,73 @@
+package fsdedupe
+
+import "runtime"
+
+// IOClass is an I/O scheduling class (see Scheduling).
+type IOClass int
+
+const (
+	// IOClassInherited keeps I/O scheduling class of the process.
+	IOClassInherited IOClass = iota
+	// IOClassBestEffort is a default class, prioritized by level (see Scheduling.IOLevel).
+	IOClassBestEffort
+	// IOClassIdle only gets disk time when no other process needs it.
+	IOClassIdle
+)
+
+// Scheduling is an OS scheduling of hashing (verification) workers (see WithScheduling, WithScrubScheduling),
+// so batch jobs coexist with latency-sensitive workloads on the same host. Zero value keeps the inherited one.
+// It is supported on Linux only, failing runs elsewhere.
+type Scheduling struct {
+	// Nice is a CPU niceness, like the nice command one (1..19 - lower priority, below 0 needs privileges), 0 - inherited.
+	Nice int
+	// IOClass is an I/O scheduling class, like the ionice command one.
+	IOClass IOClass
+	// IOLevel is a priority level of IOClassBestEffort (0 - highest, 7 - lowest).
+	IOLevel int
+	// CPUs are (0-based) CPUs to pin workers to, none - not pinned.
+	CPUs []int
+}
+
+// WithScheduling applies OS scheduling to hashing workers (see WithConcurrency), each one running on an own OS thread.
+func WithScheduling(s Scheduling) Option {
+	return func(o *options) {
+		o.scheduling = s
+	}
+}
+
+// WithScrubScheduling applies OS scheduling to data files verification (hashing) of Scrub.
+func WithScrubScheduling(s Scheduling) ScrubOption {
+	return func(o *scrubOptions) {
+		o.scheduling = s
+	}
+}
+
+func (s Scheduling) isZero() bool {
+	return s.Nice == 0 && s.IOClass == IOClassInherited && len(s.CPUs) == 0
+}
+
+// lockThread locks calling goroutine to its OS thread and applies scheduling to the thread.
+// The thread is never unlocked, so it exits along with the goroutine instead of being reused by other goroutines.
+func (s Scheduling) lockThread() error {
+	if s.isZero() {
+		return nil
+	}
+	runtime.LockOSThread()
+	return applyScheduling(s)
+}
+
+// runScheduled runs fn in a goroutine of its own, locked to an OS thread with scheduling applied (see lockThread).
+func runScheduled(s Scheduling, fn func() error) error {
+	if s.isZero() {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() {
+		if err := s.lockThread(); err != nil {
+			done <- err
+			return
+		}
+		done <- fn()
+	}()
+	return <-done
+}
@@ -0,0 +1,59 @@
+package fsdedupe
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ioprioWhoProcess = 1 // a thread id on Linux
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+
+	cpuSetSize = 1024
+)
+
+// applyScheduling applies scheduling to the calling OS thread (Linux schedules threads, not processes).
+func applyScheduling(s Scheduling) error {
+	tid := syscall.Gettid()
+
+	if s.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, s.Nice); err != nil {
+			return fmt.Errorf("set nice %d: %w", s.Nice, err)
+		}
+	}
+
+	if s.IOClass != IOClassInherited {
+		var prio int
+		switch s.IOClass {
+		case IOClassBestEffort:
+			if s.IOLevel < 0 || s.IOLevel > 7 {
+				return fmt.Errorf("set I/O priority: invalid best-effort level %d", s.IOLevel)
+			}
+			prio = ioprioClassBE<<ioprioClassShift | s.IOLevel
+		case IOClassIdle:
+			prio = ioprioClassIdle << ioprioClassShift
+		default:
+			return fmt.Errorf("set I/O priority: invalid class %d", s.IOClass)
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+			return fmt.Errorf("set I/O priority: %w", errno)
+		}
+	}
+
+	if len(s.CPUs) > 0 {
+		var mask [cpuSetSize / 64]uint64
+		for _, cpu := range s.CPUs {
+			if cpu < 0 || cpu >= cpuSetSize {
+				return fmt.Errorf("set CPU affinity: invalid CPU %d", cpu)
+			}
+			mask[cpu/64] |= 1 << (cpu % 64)
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask))); errno != 0 {
+			return fmt.Errorf("set CPU affinity %v: %w", s.CPUs, errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+)
+
+func applyScheduling(Scheduling) error {
+	return fmt.Errorf("apply scheduling: %w", errors.ErrUnsupported)
+}
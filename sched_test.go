@@ -0,0 +1,58 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestWithScheduling(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("scheduling is not supported on", runtime.GOOS)
+	}
+	tmp := t.TempDir()
+
+	canonical := filepath.Join(tmp, "file1.txt")
+	writeFile(t, canonical, "DUPE")
+	duplicate := filepath.Join(tmp, "file2.txt")
+	writeFile(t, duplicate, "DUPE")
+
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{canonical, duplicate}),
+		fsdedupe.WithConcurrency(2),
+		fsdedupe.WithScheduling(fsdedupe.Scheduling{Nice: 10, IOClass: fsdedupe.IOClassIdle, CPUs: []int{0}}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Linked, 1; actual != expected {
+		t.Errorf("expected %d linked, got %d", expected, actual)
+	}
+
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{canonical}),
+		fsdedupe.WithScheduling(fsdedupe.Scheduling{IOClass: fsdedupe.IOClassBestEffort, IOLevel: 8}),
+	); err == nil {
+		t.Fatalf("expected invalid I/O level to fail, got no error")
+	}
+}
+
+func TestWithScrubScheduling(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("scheduling is not supported on", runtime.GOOS)
+	}
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, subject, "/a.txt", "CONTENTS")
+
+	report, err := subject.Scrub(context.Background(), filepath.Join(tmp, "quarantine"),
+		fsdedupe.WithScrubScheduling(fsdedupe.Scheduling{Nice: 19, IOClass: fsdedupe.IOClassBestEffort, IOLevel: 7}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Checked, 1; actual != expected {
+		t.Errorf("expected %d checked, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,277 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ScrubReport describes Scrub outcome.
+type ScrubReport struct {
+	// Checked is a number of re-hashed data files.
+	Checked int `json:"checked"`
+	// Corrupted lists data files, which contents no longer match their hash.
+	Corrupted []CorruptedBlob `json:"corrupted"`
+}
+
+// CorruptedBlob is a data file, which contents no longer match its hash.
+type CorruptedBlob struct {
+	// Hash is an expected content hash.
+	Hash string `json:"hash"`
+	// Quarantined is where the corrupted data file is moved to:
+	// <hash>.bin for the primary data dir, <hash>.tier<N>.bin for the N-th data dir (see WithTiers).
+	Quarantined string `json:"quarantined"`
+	// Links lists link names pointing to the data file.
+	Links []string `json:"links"`
+	// Restored reports if a verified copy is restored from a replica (see WithScrubReplica),
+	// otherwise links are left dangling.
+	Restored bool `json:"restored"`
+}
+
+// ScrubOption configures Scrub.
+type ScrubOption func(*scrubOptions)
+
+type scrubOptions struct {
+	limiter    Limiter
+	replica    string
+	scheduling Scheduling
+}
+
+// WithScrubLimiter throttles data files reading (hashing) throughput.
+func WithScrubLimiter(l Limiter) ScrubOption {
+	return func(o *scrubOptions) {
+		o.limiter = l
+	}
+}
+
+// WithScrubReplica sets a data dir of a replica DedupeFS store to restore corrupted data files from
+// (replica copies are verified before restoring).
+func WithScrubReplica(dataDir string) ScrubOption {
+	return func(o *scrubOptions) {
+		o.replica = dataDir
+	}
+}
+
+// Scrub re-hashes every data file (under shared store lock, not blocking writers), moving corrupted ones (contents not matching their hash)
+// into quarantine dir, and restoring verified copies from a replica, if configured (see WithScrubReplica).
+// Corrupted data files are re-verified and quarantined under exclusive store lock.
+// It is meant to be run periodically (throttled, see WithScrubLimiter) to detect bit rot.
+func (s *DedupeFS) Scrub(ctx context.Context, quarantineDir string, opts ...ScrubOption) (ScrubReport, error) {
+	ctx, span := s.tracer.Start(ctx, "fsdedupe.Scrub")
+	report, err := s.scrub(ctx, quarantineDir, opts)
+	endSpan(span, err,
+		attribute.Int("fsdedupe.checked", report.Checked),
+		attribute.Int("fsdedupe.corrupted", len(report.Corrupted)),
+	)
+	return report, err
+}
+
+func (s *DedupeFS) scrub(ctx context.Context, quarantineDir string, opts []ScrubOption) (ScrubReport, error) {
+	o := new(scrubOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var report ScrubReport
+	suspects, err := s.scrubSuspects(ctx, o, &report)
+	if err != nil || len(suspects) == 0 {
+		return report, err
+	}
+
+	// exclusively only while re-verifying and quarantining suspects, writers are blocked briefly
+	unlockStore, err := s.lockStore(true)
+	if err != nil {
+		return report, err
+	}
+	defer unlockStore()
+
+	corrupted := make(map[string]int)      // data file -> report index
+	byHash := make(map[string]map[int]int) // hash -> tier -> report index
+	for _, suspect := range suspects {
+		// may be gone (reaped, restored) meanwhile
+		if actual, err := hashContents(ctx, sha512.New(), suspect.path, o.limiter); errors.Is(err, fs.ErrNotExist) || (err == nil && actual == suspect.hash) {
+			continue
+		} else if err != nil {
+			return report, fmt.Errorf("hash contents of %q: %w", suspect.path, err)
+		}
+
+		name := filepath.Base(suspect.path)
+		if suspect.tier > 0 {
+			// the same content may be corrupted in multiple tiers
+			name = fmt.Sprintf("%s.tier%d%s", suspect.hash, suspect.tier, DataFileExt)
+		}
+		corrupted[suspect.path] = len(report.Corrupted)
+		if byHash[suspect.hash] == nil {
+			byHash[suspect.hash] = make(map[int]int)
+		}
+		byHash[suspect.hash][suspect.tier] = len(report.Corrupted)
+		report.Corrupted = append(report.Corrupted, CorruptedBlob{
+			Hash:        suspect.hash,
+			Quarantined: filepath.Join(quarantineDir, name),
+		})
+	}
+	if len(corrupted) == 0 {
+		return report, nil
+	}
+
+	if err := os.MkdirAll(quarantineDir, s.dirPerm); err != nil {
+		return report, fmt.Errorf("ensure quarantine dir %q: %w", quarantineDir, err)
+	}
+	for dataFile, i := range corrupted {
+		blob := &report.Corrupted[i]
+		if err := os.Rename(dataFile, blob.Quarantined); crossDevice(err) {
+			// quarantine dir may be on another device
+			if cerr := moveByCopy(ctx, dataFile, blob.Quarantined, s.limiter); cerr != nil {
+				return report, fmt.Errorf("quarantine %q: %w (copy fallback: %w)", dataFile, err, cerr)
+			}
+		} else if err != nil {
+			return report, fmt.Errorf("quarantine %q: %w", dataFile, err)
+		}
+
+		if o.replica != "" {
+			restored, err := s.restoreBlob(ctx, filepath.Join(o.replica, filepath.Base(dataFile)), dataFile, blob.Hash, o.limiter)
+			if err != nil {
+				return report, fmt.Errorf("restore %q from replica: %w", dataFile, err)
+			}
+			blob.Restored = restored
+		}
+	}
+
+	if s.linkIndexDir != "" {
+		for _, i := range corrupted {
+			blob := &report.Corrupted[i]
+			if blob.Links, err = s.LinksFor(blob.Hash); err != nil {
+				return report, fmt.Errorf("links of %q: %w", blob.Hash, err)
+			}
+		}
+		return report, nil
+	}
+
+	onLink := func(path string, entry os.DirEntry) error {
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", path, err)
+		}
+		if i, ok := s.corruptedLink(path, target, byHash); ok {
+			rel, err := filepath.Rel(s.linkDir, path)
+			if err != nil {
+				return fmt.Errorf("link name of %q: %w", path, err)
+			}
+			report.Corrupted[i].Links = append(report.Corrupted[i].Links, filepath.Join(string(filepath.Separator), rel))
+		}
+		return nil
+	}
+	if err := walk(s.linkDir, onLink); err != nil {
+		return report, fmt.Errorf("walk %q: %w", s.linkDir, err)
+	}
+
+	return report, nil
+}
+
+// corruptedLink returns report index of a corrupted data file link (at path) points to.
+// Like with GC, links are matched by target hash (so relative and not clean targets match too),
+// then by target tier, unless it is unknown (e.g. a link to a previous store location) and the hash is corrupted in one tier only.
+func (s *DedupeFS) corruptedLink(path, target string, byHash map[string]map[int]int) (int, bool) {
+	hash, ok := HashFromDataName(target)
+	if !ok {
+		return 0, false
+	}
+	tiers := byHash[hash]
+	if len(tiers) == 0 {
+		return 0, false
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	dir := filepath.Dir(filepath.Clean(target))
+	for tier, dataDir := range s.dataDirs() {
+		if filepath.Clean(dataDir) == dir {
+			i, ok := tiers[tier]
+			return i, ok // a link to a healthy copy in another tier is not affected
+		}
+	}
+	if len(tiers) == 1 {
+		for _, i := range tiers {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// scrubSuspect is a data file, which contents did not match its hash (when re-hashed under shared store lock).
+type scrubSuspect struct {
+	path string
+	hash string
+	tier int
+}
+
+// scrubSuspects re-hashes every data file under shared store lock (not blocking writers for the whole, likely throttled, run),
+// returning ones not matching their hashes.
+func (s *DedupeFS) scrubSuspects(ctx context.Context, o *scrubOptions, report *ScrubReport) ([]scrubSuspect, error) {
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockStore()
+
+	var suspects []scrubSuspect
+	digest := sha512.New()
+	err = runScheduled(o.scheduling, func() error {
+		for tier, dataDir := range s.dataDirs() {
+			scrubDataFile := func(path string, entry os.DirEntry) error {
+				if entry.IsDir() {
+					return fs.SkipDir // data dirs are flat
+				}
+				expected, ok := HashFromDataName(path)
+				if !entry.Type().IsRegular() || !ok {
+					return nil
+				}
+
+				digest.Reset()
+				actual, err := hashContents(ctx, digest, path, o.limiter)
+				if err != nil {
+					return fmt.Errorf("hash contents: %w", err)
+				}
+				report.Checked++
+				if actual != expected {
+					suspects = append(suspects, scrubSuspect{path: path, hash: expected, tier: tier})
+				}
+				return nil
+			}
+			if err := walk(dataDir, scrubDataFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("walk %q: %w", dataDir, err)
+			}
+		}
+		return nil
+	})
+	return suspects, err
+}
+
+// restoreBlob restores data file from replica copy, if one exists and matches the hash
+// (hashing throttled with limiter, copying - with store one, see WithFSLimiter).
+func (s *DedupeFS) restoreBlob(ctx context.Context, replica, dataFile, hash string, limiter Limiter) (bool, error) {
+	actual, err := hashContents(ctx, sha512.New(), replica, limiter)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("hash contents of %q: %w", replica, err)
+	}
+	if actual != hash {
+		return false, nil
+	}
+
+	if err := copyFile(ctx, replica, dataFile, s.limiter); err != nil {
+		return false, err
+	}
+	return true, nil
+}
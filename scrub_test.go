@@ -0,0 +1,140 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_Scrub(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	quarantine := filepath.Join(tmp, "quarantine")
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	setupDedupeFS_Create(t, subject, "sub/file.txt", "DUMMY")
+	setupDedupeFS_Create(t, subject, "other.txt", "OTHER")
+
+	// nothing is corrupted yet
+	report, err := subject.Scrub(context.Background(), quarantine)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Checked, 2; actual != expected {
+		t.Fatalf("expected %d checked, got %d", expected, actual)
+	}
+	if len(report.Corrupted) != 0 {
+		t.Fatalf("expected nothing corrupted, got %+v", report.Corrupted)
+	}
+
+	// bit rot, with a healthy replica
+	dataFile := filepath.Join(tmp, "data", contentsHash+".bin")
+	writeFile(t, dataFile, "DUMMX")
+	replica := filepath.Join(tmp, "replica")
+	writeFile(t, filepath.Join(replica, contentsHash+".bin"), "DUMMY")
+
+	report, err = subject.Scrub(context.Background(), quarantine, fsdedupe.WithScrubReplica(replica))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []fsdedupe.CorruptedBlob{{
+		Hash:        contentsHash,
+		Quarantined: filepath.Join(quarantine, contentsHash+".bin"),
+		Links:       []string{filepath.Join(string(filepath.Separator), "sub", "file.txt")},
+		Restored:    true,
+	}}; !reflect.DeepEqual(report.Corrupted, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, report.Corrupted)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(quarantine, contentsHash+".bin")); err != nil {
+		t.Fatalf("read quarantined: %s", err)
+	} else if actual, expected := string(b), "DUMMX"; actual != expected {
+		t.Fatalf("expected quarantined %q, got %q", expected, actual)
+	}
+	if b, err := os.ReadFile(filepath.Join(tmp, "link", "sub", "file.txt")); err != nil {
+		t.Fatalf("read restored: %s", err)
+	} else if actual, expected := string(b), "DUMMY"; actual != expected {
+		t.Fatalf("expected restored %q, got %q", expected, actual)
+	}
+}
+
+func TestDedupeFS_Scrub_tiers(t *testing.T) {
+	tmp := t.TempDir()
+	hot, cold := filepath.Join(tmp, "data"), filepath.Join(tmp, "cold")
+	subject, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		hot,
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithTiers(fsdedupe.TierBySize(1<<20), cold),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	quarantine := filepath.Join(tmp, "quarantine")
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	setupDedupeFS_Create(t, subject, "file.txt", "DUMMY")
+
+	// the same content, corrupted in both tiers (e.g. a stale copy, left by an interrupted tier move)
+	writeFile(t, filepath.Join(hot, contentsHash+".bin"), "DUMMX")
+	writeFile(t, filepath.Join(cold, contentsHash+".bin"), "DUMMZ")
+
+	report, err := subject.Scrub(context.Background(), quarantine)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Checked, 2; actual != expected {
+		t.Fatalf("expected %d checked, got %d", expected, actual)
+	}
+	if actual, expected := len(report.Corrupted), 2; actual != expected {
+		t.Fatalf("expected %d corrupted, got %+v", expected, report.Corrupted)
+	}
+
+	for name, expected := range map[string]string{
+		contentsHash + ".bin":       "DUMMX",
+		contentsHash + ".tier1.bin": "DUMMZ",
+	} {
+		if b, err := os.ReadFile(filepath.Join(quarantine, name)); err != nil {
+			t.Fatalf("read quarantined: %s", err)
+		} else if actual := string(b); actual != expected {
+			t.Fatalf("expected quarantined %s %q, got %q", name, expected, actual)
+		}
+	}
+}
+
+func TestDedupeFS_Scrub_linkTargetForms(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	setupDedupeFS_Create(t, subject, "sub/file.txt", "DUMMY")
+
+	// links to the same data file, written in other forms
+	if err := os.Symlink(filepath.Join("..", "data", contentsHash+".bin"), filepath.Join(tmp, "link", "relative.txt")); err != nil {
+		t.Fatalf("symlink: %s", err)
+	}
+	if err := os.Symlink(filepath.Join(tmp, "link", "..", "data", contentsHash+".bin"), filepath.Join(tmp, "link", "sub", "unclean.txt")); err != nil {
+		t.Fatalf("symlink: %s", err)
+	}
+
+	writeFile(t, filepath.Join(tmp, "data", contentsHash+".bin"), "DUMMX")
+
+	report, err := subject.Scrub(context.Background(), filepath.Join(tmp, "quarantine"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(report.Corrupted) != 1 {
+		t.Fatalf("expected 1 corrupted, got %+v", report.Corrupted)
+	}
+	if actual, expected := report.Corrupted[0].Links, []string{
+		filepath.Join(string(filepath.Separator), "relative.txt"),
+		filepath.Join(string(filepath.Separator), "sub", "file.txt"),
+		filepath.Join(string(filepath.Separator), "sub", "unclean.txt"),
+	}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected links %v, got %v", expected, actual)
+	}
+}
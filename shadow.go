@@ -0,0 +1,69 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// shadowTree builds a deduplicated view of root tree in dir (see WithShadowTree).
+type shadowTree struct {
+	root string // absolute
+	dir  string // absolute
+}
+
+func newShadowTree(root, dir string) (*shadowTree, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolve shadow root %q: %w", root, err)
+	}
+	// input filenames are canonical (see caseFolder.path)
+	if absRoot, err = filepath.EvalSymlinks(absRoot); err != nil {
+		return nil, fmt.Errorf("resolve shadow root %q: %w", root, err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve shadow dir %q: %w", dir, err)
+	}
+	if withinDir(absDir, absRoot) {
+		return nil, fmt.Errorf("shadow dir %q is within shadow root %q", dir, root)
+	}
+	return &shadowTree{root: absRoot, dir: absDir}, nil
+}
+
+// link creates or replaces shadow symlink of filename (relative to root), pointing to target,
+// consuming an inode of budget for that.
+// It reports if a new shadow symlink is created (not replaced).
+func (t *shadowTree) link(filename, target string, inodes *inodeBudget) (bool, error) {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return false, fmt.Errorf("resolve %q: %w", filename, err)
+	}
+	if !withinDir(absFilename, t.root) || absFilename == t.root {
+		return false, fmt.Errorf("%q is not within shadow root %q", filename, t.root)
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return false, fmt.Errorf("resolve %q: %w", target, err)
+	}
+
+	rel, err := filepath.Rel(t.root, absFilename)
+	if err != nil {
+		return false, fmt.Errorf("resolve %q: %w", filename, err)
+	}
+	name := filepath.Join(t.dir, rel)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return false, fmt.Errorf("ensure dir %q: %w", filepath.Dir(name), err)
+	}
+	if err := inodes.consume(filepath.Dir(name)); err != nil {
+		return false, fmt.Errorf("shadow %q: %w", name, err)
+	}
+	_, err = os.Lstat(name)
+	created := errors.Is(err, fs.ErrNotExist)
+	if err := replaceSymlink(absTarget, name); err != nil {
+		return false, fmt.Errorf("shadow %q -> %q: %w", name, absTarget, err)
+	}
+	return created, nil
+}
@@ -0,0 +1,78 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeSymlink_shadowTree(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	shadow := filepath.Join(tmp, "shadow")
+
+	file1 := filepath.Join(src, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(src, "sub", "file2.txt")
+	writeFile(t, file2, "DUPE")
+	uniq := filepath.Join(src, "uniq.txt")
+	writeFile(t, uniq, "UNIQ")
+
+	before, err := fsdedupe.TreeHash(context.Background(), src)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, file2, uniq},
+	}, fsdedupe.WithShadowTree(src, shadow))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := summary.Linked, 1; actual != expected {
+		t.Fatalf("expected %d linked, got %d", expected, actual)
+	}
+	if actual, expected := summary.InodesUsed, int64(3); actual != expected {
+		t.Fatalf("expected %d inodes used, got %d", expected, actual)
+	}
+
+	// source is untouched
+	for _, filename := range []string{file1, file2, uniq} {
+		if stat := lstat(t, filename); !stat.Mode().IsRegular() {
+			t.Fatalf("expected %q to be left as is, got %s", filename, stat.Mode())
+		}
+	}
+
+	for filename, target := range map[string]string{
+		filepath.Join(shadow, "file1.txt"):        file1,
+		filepath.Join(shadow, "sub", "file2.txt"): file1,
+		filepath.Join(shadow, "uniq.txt"):         uniq,
+	} {
+		if actual, expected := readlink(t, filename), target; actual != expected {
+			t.Fatalf("expected %q to link %q, got %q", filename, expected, actual)
+		}
+	}
+
+	// the view has the very same logical content
+	after, err := fsdedupe.TreeHash(context.Background(), shadow)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if after != before {
+		t.Fatalf("expected shadow tree hash %s, got %s", before, after)
+	}
+}
+
+func TestDedupeSymlink_shadowTreeOutsideRoot(t *testing.T) {
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "file.txt")
+	writeFile(t, file, "DATA")
+
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file},
+	}, fsdedupe.WithShadowTree(filepath.Join(tmp, "src"), filepath.Join(tmp, "shadow"))); err == nil {
+		t.Fatalf("expected an error for a file outside of shadow root, got none")
+	}
+}
@@ -0,0 +1,71 @@
+package fsdedupe
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kib": 1 << 10,
+	"kb":  1e3,
+	"m":   1 << 20,
+	"mib": 1 << 20,
+	"mb":  1e6,
+	"g":   1 << 30,
+	"gib": 1 << 30,
+	"gb":  1e9,
+	"t":   1 << 40,
+	"tib": 1 << 40,
+	"tb":  1e12,
+	"p":   1 << 50,
+	"pib": 1 << 50,
+	"pb":  1e15,
+}
+
+// ParseSize parses a human-readable size, like "512", "64K", "1.5G", "10MB" or "2 TiB" (case-insensitive).
+// Single-letter and *iB units are binary (1K = 1024), *B ones are decimal (1KB = 1000).
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	num, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	mul, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+	}
+	if v *= mul; v > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too big", s)
+	}
+	return int64(v), nil
+}
+
+// FormatSize formats a size with binary units (B, KiB, MiB, GiB, TiB, PiB), like "1.5 GiB".
+func FormatSize(bytes int64) string {
+	const units = "KMGTP"
+	if bytes < 1<<10 && bytes > -1<<10 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	v := float64(bytes)
+	i := -1
+	for math.Abs(v) >= 1<<10 && i < len(units)-1 {
+		v /= 1 << 10
+		i++
+	}
+	num := strings.TrimSuffix(strconv.FormatFloat(v, 'f', 1, 64), ".0")
+	return num + " " + string(units[i]) + "iB"
+}
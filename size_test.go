@@ -0,0 +1,55 @@
+package fsdedupe_test
+
+import (
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"512":     512,
+		"512B":    512,
+		"64K":     64 << 10,
+		"64k":     64 << 10,
+		"1.5G":    3 << 29,
+		"10MB":    10_000_000,
+		"2 TiB":   2 << 40,
+		" 1mib ":  1 << 20,
+		"0":       0,
+		"1.5":     1,
+		"100 kb ": 100_000,
+	} {
+		actual, err := fsdedupe.ParseSize(s)
+		if err != nil {
+			t.Errorf("expected no error for %q, got: %s", s, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("expected %q to be %d, got %d", s, expected, actual)
+		}
+	}
+
+	for _, s := range []string{"", "G", "1X", "-1K", "1.5.5M", "99999999P"} {
+		if _, err := fsdedupe.ParseSize(s); err == nil {
+			t.Errorf("expected error for %q, got none", s)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for bytes, expected := range map[int64]string{
+		0:          "0 B",
+		1023:       "1023 B",
+		1 << 10:    "1 KiB",
+		3 << 29:    "1.5 GiB",
+		10_000_000: "9.5 MiB",
+		5 << 50:    "5 PiB",
+		5 << 60:    "5120 PiB",
+		-(3 << 19): "-1.5 MiB",
+	} {
+		if actual := fsdedupe.FormatSize(bytes); actual != expected {
+			t.Errorf("expected %d to be formatted as %q, got %q", bytes, expected, actual)
+		}
+	}
+}
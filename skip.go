@@ -0,0 +1,137 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// SkipReason is a machine-readable reason of a file not being linked (see WithOnSkipped).
+type SkipReason string
+
+const (
+	// SkipNotRegular is for inputs, which are not regular files (dirs, devices etc).
+	SkipNotRegular SkipReason = "not-regular"
+	// SkipTooSmall is for empty files (see EmptyPolicy) and files smaller than min size (see WithMinSize).
+	SkipTooSmall SkipReason = "too-small"
+	// SkipExcluded is for input symlinks outside allowed roots (see WithAllowedRoots),
+	// for files matching exclude patterns (see WithExcludes)
+	// and for duplicates of not approved groups (see ApplyPlan).
+	SkipExcluded SkipReason = "excluded"
+	// SkipPermission is for files, which can't be read or replaced due to permissions (see WithIgnorePermissionDenied).
+	SkipPermission SkipReason = "permission"
+	// SkipChanged is for files, which changed or vanished since listed, hashed (or planned, see ApplyPlan).
+	SkipChanged SkipReason = "changed-during-scan"
+	// SkipCrossDevice is for duplicates on another device than their canonical file (see WithSameDevice).
+	SkipCrossDevice SkipReason = "cross-device"
+	// SkipOpenForWrite is for duplicates, which are open for writing by some process (detected on Linux only).
+	SkipOpenForWrite SkipReason = "open-for-write"
+	// SkipUnsupported is for duplicates on filesystems not supporting symlinks or atomic renames (see WithNetworkSafe)
+	// or squashing root (see RootSquashed).
+	SkipUnsupported SkipReason = "unsupported"
+	// SkipForks is for duplicates having forks (see ForkSkip).
+	SkipForks SkipReason = "forks"
+	// SkipFailed is for duplicates of groups failed to be applied and rolled back (see ApplyPlan).
+	SkipFailed SkipReason = "failed"
+	// SkipDangling is for input symlinks, which don't resolve (to an existing file).
+	SkipDangling SkipReason = "dangling"
+	// SkipLoop is for dirs not walked, as already walked under another name (see WalkSkipError).
+	SkipLoop SkipReason = "loop"
+	// SkipTooDeep is for dirs not walked, as beyond max depth (see WithMaxDepth).
+	SkipTooDeep SkipReason = "too-deep"
+	// SkipCompat is for duplicates left as is by compat rules (see WithCompatRules).
+	SkipCompat SkipReason = "compat"
+)
+
+// skipError is a hashing result of a file to be skipped.
+type skipError struct {
+	reason SkipReason
+	detail string
+}
+
+func (e *skipError) Error() string {
+	return e.detail
+}
+
+// skipped accounts a file skipped for reason, detail being a human-readable explanation.
+func (o *options) skipped(filename string, reason SkipReason, detail string) error {
+	o.summary.Skipped++
+
+	if o.report != nil {
+		o.report.skip(filename, reason, detail)
+	}
+	if o.onSkipped != nil {
+		if err := o.onSkipped(filename, reason, detail); err != nil {
+			return fmt.Errorf("on skipped %q: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// statInput lstats an input file first, following it only if it is a symlink, returning skipError
+// for files vanished since listed, dangling symlinks and not regular files.
+func statInput(filename string) (os.FileInfo, error) {
+	stat, err := os.Lstat(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &skipError{reason: SkipChanged, detail: "vanished since listed"}
+	} else if err != nil {
+		return nil, fmt.Errorf("lstat %q: %w", filename, err)
+	}
+	if stat.Mode()&fs.ModeSymlink != 0 {
+		if stat, err = os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+			return nil, &skipError{reason: SkipDangling, detail: "dangling symlink"}
+		} else if errors.Is(err, syscall.ELOOP) {
+			return nil, &skipError{reason: SkipDangling, detail: "symlink loop"}
+		} else if err != nil {
+			return nil, fmt.Errorf("stat %q: %w", filename, err)
+		}
+	}
+	if !stat.Mode().IsRegular() {
+		return nil, &skipError{reason: SkipNotRegular, detail: "not a regular file"}
+	}
+	return stat, nil
+}
+
+// vanished reports if err is caused by filename having been deleted (by another process).
+func vanished(filename string, err error) bool {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	_, err = os.Lstat(filename)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// skippedVanished logs and accounts duplicate vanished right before being linked.
+func (o *options) skippedVanished(filename, canonical string) error {
+	o.logger.Printf("leaving duplicate %q of %q as is (vanished since hashed)", filename, canonical)
+	return o.skipped(filename, SkipChanged, "vanished since hashed")
+}
+
+// checkLinkable re-checks duplicate (hashed with stat) right before it is linked to canonical,
+// returning a skip reason and detail, if it should be left as is.
+func checkLinkable(filename, canonical string, hashed os.FileInfo, o *options) (SkipReason, string, error) {
+	stat, err := os.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return SkipChanged, "vanished since hashed", nil
+	} else if err != nil {
+		return "", "", fmt.Errorf("stat %q: %w", filename, err)
+	}
+	if !os.SameFile(stat, hashed) || stat.Size() != hashed.Size() || !stat.ModTime().Equal(hashed.ModTime()) {
+		return SkipChanged, "changed since hashed", nil
+	}
+
+	if o.sameDevice {
+		if same, err := SameDevice(filename, canonical); err != nil {
+			return "", "", err
+		} else if !same {
+			return SkipCrossDevice, "canonical file is on another device", nil
+		}
+	}
+
+	if openForWrite(filename) {
+		return SkipOpenForWrite, "open for writing", nil
+	}
+	return "", "", nil
+}
@@ -0,0 +1,167 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeSymlink_onSkipped(t *testing.T) {
+	tmp := t.TempDir()
+
+	canonical := filepath.Join(tmp, "canonical.txt")
+	writeFile(t, canonical, "DUPE")
+	empty := filepath.Join(tmp, "empty.txt")
+	writeFile(t, empty, "")
+	dir := filepath.Join(tmp, "dir")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	changed := filepath.Join(tmp, "changed.txt")
+	writeFile(t, changed, "DUPE")
+	linked := filepath.Join(tmp, "linked.txt")
+	writeFile(t, linked, "DUPE")
+
+	entries := []string{canonical, empty, dir, changed, linked}
+	expected := map[string]fsdedupe.SkipReason{
+		empty:   fsdedupe.SkipTooSmall,
+		dir:     fsdedupe.SkipNotRegular,
+		changed: fsdedupe.SkipChanged,
+	}
+
+	if runtime.GOOS == "linux" {
+		writing := filepath.Join(tmp, "writing.txt")
+		writeFile(t, writing, "DUPE")
+		f, err := os.OpenFile(writing, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		defer f.Close()
+
+		entries = append(entries, writing)
+		expected[writing] = fsdedupe.SkipOpenForWrite
+	}
+
+	actual := make(map[string]fsdedupe.SkipReason)
+	summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{Entries: entries},
+		fsdedupe.WithOnHashed(func(filename, _ string, _ int64) error {
+			if filename == changed {
+				writeFile(t, changed, "EDITED")
+			}
+			return nil
+		}),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+			actual[filename] = reason
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected skipped %v, got %v", expected, actual)
+	}
+	if actual, expected := summary.Skipped, len(expected); actual != expected {
+		t.Fatalf("expected %d skipped, got %d", expected, actual)
+	}
+	if actual, expected := summary.Linked, 1; actual != expected {
+		t.Fatalf("expected %d linked, got %d", expected, actual)
+	}
+	if actual, expected := readlink(t, linked), canonical; actual != expected {
+		t.Fatalf("expected %q to be linked to %q, got -> %q", linked, expected, actual)
+	}
+}
+
+func TestDedupeSymlink_vanished(t *testing.T) {
+	tmp := t.TempDir()
+
+	missing := filepath.Join(tmp, "missing.txt")
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(tmp, "file3.txt")
+	writeFile(t, file3, "DUPE")
+
+	var skipped []string
+	summary := new(fsdedupe.Summary)
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), fsdedupe.Slice([]string{missing, file1, file2, file3}),
+		fsdedupe.WithSummary(summary),
+		fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+			skipped = append(skipped, filename+": "+string(reason))
+			return nil
+		}),
+		// canonical file is deleted by another process, right after its duplicate is hashed
+		fsdedupe.WithOnHashed(func(filename, _ string, _ int64) error {
+			if filename == file2 {
+				return os.Remove(file1)
+			}
+			return nil
+		}),
+	); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if expected := []string{missing + ": " + string(fsdedupe.SkipChanged)}; !reflect.DeepEqual(skipped, expected) {
+		t.Fatalf("expected %q to be skipped, got %q", expected, skipped)
+	}
+	// duplicate takes place of the vanished canonical file
+	if !lstat(t, file2).Mode().IsRegular() {
+		t.Fatalf("expected %q to be kept as is", file2)
+	}
+	if focus, actual, expected := file3, readlink(t, file3), file2; actual != expected {
+		t.Errorf("expected %q to point to %q, but got: %q", focus, expected, actual)
+	}
+	if actual, expected := summary.Linked, 1; actual != expected {
+		t.Fatalf("expected %d linked, got %d", expected, actual)
+	}
+}
+
+func TestDedupeSymlink_danglingSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+	dangling := filepath.Join(tmp, "dangling.txt")
+	if err := os.Symlink(filepath.Join(tmp, "missing.txt"), dangling); err != nil {
+		t.Fatalf("symlink %q: %s", dangling, err)
+	}
+	loop := filepath.Join(tmp, "loop.txt")
+	if err := os.Symlink(loop, loop); err != nil {
+		t.Fatalf("symlink %q: %s", loop, err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []fsdedupe.Option
+	}{
+		{name: "input order"},
+		{name: "largest first", opts: []fsdedupe.Option{fsdedupe.WithLargestFirst()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			skipped := make(map[string]fsdedupe.SkipReason)
+			plan, err := fsdedupe.PlanSymlink(context.Background(), fsdedupe.Slice([]string{dangling, file1, loop, file2}),
+				append(tc.opts, fsdedupe.WithOnSkipped(func(filename string, reason fsdedupe.SkipReason, _ string) error {
+					skipped[filename] = reason
+					return nil
+				}))...,
+			)
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if actual, expected := len(plan.Actions), 1; actual != expected {
+				t.Fatalf("expected %d actions, got %+v", expected, plan.Actions)
+			}
+			if expected := map[string]fsdedupe.SkipReason{dangling: fsdedupe.SkipDangling, loop: fsdedupe.SkipDangling}; !reflect.DeepEqual(skipped, expected) {
+				t.Fatalf("expected skipped %v, got %v", expected, skipped)
+			}
+		})
+	}
+}
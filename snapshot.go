@@ -0,0 +1,205 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNoSnapshotDir is returned by snapshot methods if DedupeFS has no snapshot dir configured (see WithSnapshotDir).
+var ErrNoSnapshotDir = errors.New("no snapshot dir")
+
+// WithSnapshotDir sets a dir to keep link tree snapshots in (see Snapshot).
+// Snapshot links count as data file references for GC.
+func WithSnapshotDir(dir string) FSOption {
+	return func(s *DedupeFS) {
+		s.snapshotDir = dir
+	}
+}
+
+// Snapshot captures current link tree under a given name, copying links only (no data),
+// for point-in-time recovery of the namespace with RollbackTo.
+// It fails with fs.ErrExist if a snapshot with the same name already exists.
+func (s *DedupeFS) Snapshot(name string) error {
+	absSnapshotDir, err := s.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(absSnapshotDir); err == nil {
+		return fmt.Errorf("snapshot %q: %w", name, fs.ErrExist)
+	}
+
+	// data files must not be moved while being snapshotted
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return err
+	}
+	defer unlockStore()
+
+	links, err := collectLinks(s.linkDir)
+	if err != nil {
+		return err
+	}
+
+	// build in a side dir, so partial snapshots are never observed
+	if err := os.MkdirAll(filepath.Dir(absSnapshotDir), s.dirPerm); err != nil {
+		return fmt.Errorf("ensure dir for %q: %w", absSnapshotDir, err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(absSnapshotDir), filepath.Base(absSnapshotDir)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp dir for %q: %w", absSnapshotDir, err)
+	}
+	if err := os.Chmod(tmp, s.dirPerm); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("chmod %q: %w", tmp, err)
+	}
+	for rel, target := range links {
+		path := filepath.Join(tmp, rel)
+		if err := os.MkdirAll(filepath.Dir(path), s.dirPerm); err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("ensure dir for %q: %w", path, err)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("symlink %q: %w", path, err)
+		}
+	}
+	if err := os.Rename(tmp, absSnapshotDir); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("rename %q: %w", tmp, err)
+	}
+	return nil
+}
+
+// RollbackTo restores link tree to a given snapshot (see Snapshot):
+// links missing from snapshot are removed, the rest are (re-)pointed to snapshot data files.
+// Snapshot itself is kept.
+func (s *DedupeFS) RollbackTo(name string) error {
+	absSnapshotDir, err := s.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(absSnapshotDir); err != nil {
+		return fmt.Errorf("snapshot %q: %w", name, err)
+	}
+
+	want, err := collectLinks(absSnapshotDir)
+	if err != nil {
+		return err
+	}
+	have, err := collectLinks(s.linkDir)
+	if err != nil {
+		return err
+	}
+
+	for rel, target := range want {
+		if have[rel] == target {
+			continue
+		}
+		if err := s.relink(filepath.Join(s.linkDir, rel), target); err != nil {
+			return err
+		}
+	}
+	for rel := range have {
+		if _, ok := want[rel]; ok {
+			continue
+		}
+		if err := s.Remove(rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relink (re-)points a link to a data file.
+func (s *DedupeFS) relink(absLinkName, dataFile string) error {
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return err
+	}
+	defer unlockStore()
+	unlock := s.locks.links.lock(absLinkName)
+	defer unlock()
+
+	return s.inLinkDir(absLinkName, func() error {
+		return s.indexedRelink(absLinkName, dataFile, func() error {
+			if err := replaceSymlink(dataFile, absLinkName); err != nil {
+				return fmt.Errorf("replace symlink %q pointing to data file %q: %w", absLinkName, dataFile, err)
+			}
+			return nil
+		})
+	})
+}
+
+// Snapshots lists snapshot names, sorted.
+func (s *DedupeFS) Snapshots() ([]string, error) {
+	if s.snapshotDir == "" {
+		return nil, ErrNoSnapshotDir
+	}
+
+	entries, err := os.ReadDir(s.snapshotDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read snapshot dir: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RemoveSnapshot removes a snapshot (see Snapshot), data files referenced only by it are reaped by GC.
+func (s *DedupeFS) RemoveSnapshot(name string) error {
+	absSnapshotDir, err := s.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(absSnapshotDir); err != nil {
+		return fmt.Errorf("rm %q: %w", absSnapshotDir, err)
+	}
+	return nil
+}
+
+func (s *DedupeFS) snapshotPath(name string) (string, error) {
+	if s.snapshotDir == "" {
+		return "", ErrNoSnapshotDir
+	}
+	if name == "" || !filepath.IsLocal(name) || strings.ContainsRune(name, filepath.Separator) || strings.HasSuffix(name, ".tmp") {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return filepath.Join(s.snapshotDir, name), nil
+}
+
+// collectLinks returns link tree symlinks (relative paths) and their targets.
+func collectLinks(dir string) (map[string]string, error) {
+	links := make(map[string]string)
+	onLink := func(path string, entry os.DirEntry) error {
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", path, err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("link name of %q: %w", path, err)
+		}
+		links[rel] = target
+		return nil
+	}
+	if err := walk(dir, onLink); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("walk %q: %w", dir, err)
+	}
+	return links, nil
+}
@@ -0,0 +1,75 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_Snapshot(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithSnapshotDir(filepath.Join(tmp, "snapshots")),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	setupDedupeFS_Create(t, subject, "kept.txt", "KEPT")
+	setupDedupeFS_Create(t, subject, "sub/removed.txt", "REMOVED")
+	if err := subject.Snapshot("v1"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if err := subject.Snapshot("v1"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected %v, got: %v", fs.ErrExist, err)
+	}
+
+	// diverge: remove, overwrite and add files, GC must keep snapshot-referenced data
+	if err := subject.Remove("sub/removed.txt"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	subject.Remove("kept.txt")
+	setupDedupeFS_Create(t, subject, "kept.txt", "CHANGED")
+	setupDedupeFS_Create(t, subject, "added.txt", "ADDED")
+	if _, err := subject.GC(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if err := subject.RollbackTo("v1"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for name, expected := range map[string]string{
+		"kept.txt":        "KEPT",
+		"sub/removed.txt": "REMOVED",
+	} {
+		b, err := os.ReadFile(filepath.Join(tmp, "link", name))
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if actual := string(b); actual != expected {
+			t.Errorf("expected %q contents %q, got %q", name, expected, actual)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(tmp, "link", "added.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected added file to be gone, got: %v", err)
+	}
+
+	names, err := subject.Snapshots()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"v1"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %q, got %q", expected, names)
+	}
+	if err := subject.Snapshot("../escape"); err == nil {
+		t.Errorf("expected invalid snapshot name error, got none")
+	}
+}
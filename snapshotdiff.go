@@ -0,0 +1,180 @@
+package fsdedupe
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SnapshotDiff describes changes between two snapshots (see DiffSnapshots).
+type SnapshotDiff struct {
+	// Added lists link names (relative) missing in the older snapshot.
+	Added []string `json:"added"`
+	// Changed lists link names (relative) pointing to different content.
+	Changed []string `json:"changed"`
+	// Removed lists link names (relative) missing in the newer snapshot.
+	Removed []string `json:"removed"`
+	// NewHashes lists content hashes referenced by the newer snapshot only.
+	NewHashes []string `json:"new_hashes"`
+
+	targets map[string]string // added/changed link name -> data file
+	store   *DedupeFS         // resolving inline contents, see WithInlineBlobs
+}
+
+// DiffSnapshots compares two snapshots (see Snapshot), empty from snapshot name means an empty one (full export).
+// Results are sorted.
+func (s *DedupeFS) DiffSnapshots(from, to string) (SnapshotDiff, error) {
+	_, span := s.tracer.Start(context.Background(), "fsdedupe.DiffSnapshots")
+	diff, err := s.diffSnapshots(from, to)
+	endSpan(span, err,
+		attribute.Int("fsdedupe.added", len(diff.Added)),
+		attribute.Int("fsdedupe.changed", len(diff.Changed)),
+		attribute.Int("fsdedupe.removed", len(diff.Removed)),
+	)
+	return diff, err
+}
+
+func (s *DedupeFS) diffSnapshots(from, to string) (SnapshotDiff, error) {
+	var diff SnapshotDiff
+
+	var old map[string]string
+	if from != "" {
+		absFrom, err := s.snapshotPath(from)
+		if err != nil {
+			return diff, err
+		}
+		if _, err := os.Stat(absFrom); err != nil {
+			return diff, fmt.Errorf("snapshot %q: %w", from, err)
+		}
+		if old, err = collectLinks(absFrom); err != nil {
+			return diff, err
+		}
+	}
+
+	absTo, err := s.snapshotPath(to)
+	if err != nil {
+		return diff, err
+	}
+	if _, err := os.Stat(absTo); err != nil {
+		return diff, fmt.Errorf("snapshot %q: %w", to, err)
+	}
+	cur, err := collectLinks(absTo)
+	if err != nil {
+		return diff, err
+	}
+
+	oldHashes := make(map[string]struct{}, len(old))
+	for _, target := range old {
+		oldHashes[targetHash(target)] = struct{}{}
+	}
+	newHashes := make(map[string]struct{})
+
+	diff.targets = make(map[string]string)
+	diff.store = s
+	for rel, target := range cur {
+		prev, ok := old[rel]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, rel)
+		case targetHash(prev) != targetHash(target):
+			diff.Changed = append(diff.Changed, rel)
+		default:
+			continue
+		}
+		diff.targets[rel] = target
+
+		hash := targetHash(target)
+		if _, ok := oldHashes[hash]; !ok {
+			newHashes[hash] = struct{}{}
+		}
+	}
+	for rel := range old {
+		if _, ok := cur[rel]; !ok {
+			diff.Removed = append(diff.Removed, rel)
+		}
+	}
+	for hash := range newHashes {
+		diff.NewHashes = append(diff.NewHashes, hash)
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Changed)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.NewHashes)
+	return diff, nil
+}
+
+// ExportDiff writes added and changed files (contents, not links) of a diff (see DiffSnapshots) as a tarball,
+// for incremental offsite backups.
+func ExportDiff(w io.Writer, diff SnapshotDiff) error {
+	names := append(append([]string(nil), diff.Added...), diff.Changed...)
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		target, ok := diff.targets[name]
+		if !ok {
+			return fmt.Errorf("export %q: unknown target, diff must come from DiffSnapshots", name)
+		}
+		if err := exportFile(tw, name, target, diff.store); err != nil {
+			return fmt.Errorf("export %q: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close tarball: %w", err)
+	}
+	return nil
+}
+
+func exportFile(tw *tar.Writer, name, dataFile string, store *DedupeFS) error {
+	var r io.Reader
+	var size int64
+	var modTime time.Time
+	if f, err := os.Open(dataFile); err == nil {
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("stat data file: %w", err)
+		}
+		r, size, modTime = f, stat.Size(), stat.ModTime()
+	} else if contents, ok, ierr := store.inlineBlob(targetHash(dataFile)); ierr != nil {
+		return ierr
+	} else if ok {
+		// inline contents keep no times
+		r, size, modTime = bytes.NewReader(contents), int64(len(contents)), time.Unix(0, 0)
+	} else {
+		return fmt.Errorf("open data file: %w", err)
+	}
+	return writeTarFile(tw, name, r, size, modTime)
+}
+
+// writeTarFile writes a regular file entry of a tarball.
+func writeTarFile(tw *tar.Writer, name string, r io.Reader, size int64, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     filepath.ToSlash(name),
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+	}); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("write contents: %w", err)
+	}
+	return nil
+}
+
+// targetHash returns content hash of a link target (data file).
+func targetHash(target string) string {
+	hash, _ := HashFromDataName(target)
+	return hash
+}
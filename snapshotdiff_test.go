@@ -0,0 +1,80 @@
+package fsdedupe_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_DiffSnapshots(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithSnapshotDir(filepath.Join(tmp, "snapshots")),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	setupDedupeFS_Create(t, subject, "same.txt", "SAME")
+	setupDedupeFS_Create(t, subject, "changed.txt", "OLD")
+	setupDedupeFS_Create(t, subject, "removed.txt", "REMOVED")
+	if err := subject.Snapshot("v1"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	subject.Remove("changed.txt")
+	subject.Remove("removed.txt")
+	setupDedupeFS_Create(t, subject, "changed.txt", "NEW")
+	setupDedupeFS_Create(t, subject, "added.txt", "SAME")
+	if err := subject.Snapshot("v2"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	diff, err := subject.DiffSnapshots("v1", "v2")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"added.txt"}; !reflect.DeepEqual(diff.Added, expected) {
+		t.Errorf("expected added %q, got %q", expected, diff.Added)
+	}
+	if expected := []string{"changed.txt"}; !reflect.DeepEqual(diff.Changed, expected) {
+		t.Errorf("expected changed %q, got %q", expected, diff.Changed)
+	}
+	if expected := []string{"removed.txt"}; !reflect.DeepEqual(diff.Removed, expected) {
+		t.Errorf("expected removed %q, got %q", expected, diff.Removed)
+	}
+	if actual, expected := len(diff.NewHashes), 1; actual != expected { // only "NEW" content is new
+		t.Errorf("expected %d new hashes, got %q", expected, diff.NewHashes)
+	}
+
+	var buf bytes.Buffer
+	if err := fsdedupe.ExportDiff(&buf, diff); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	exported := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		exported[hdr.Name] = string(b)
+	}
+	if expected := map[string]string{"added.txt": "SAME", "changed.txt": "NEW"}; !reflect.DeepEqual(exported, expected) {
+		t.Errorf("expected %v, got %v", expected, exported)
+	}
+}
@@ -0,0 +1,142 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+// ErrInsufficientSpace is matched (see errors.Is) by InsufficientSpaceError.
+var ErrInsufficientSpace = errors.New("insufficient space")
+
+// ErrInsufficientInodes is matched (see errors.Is) by InsufficientInodesError.
+var ErrInsufficientInodes = errors.New("insufficient inodes")
+
+// InsufficientSpaceError is returned by copy-based operations (RestoreDuplicates, DedupeFS Import,
+// cross-device copy fallbacks), when destination filesystem has not enough free space for a copy,
+// which is checked (along with a free inode for it) before writing anything.
+type InsufficientSpaceError struct {
+	// Dir is a destination dir.
+	Dir string
+	// Required is a number of bytes required.
+	Required int64
+	// Available is a number of bytes available to unprivileged users.
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("insufficient space in %q: %s required, %s available", e.Dir, FormatSize(e.Required), FormatSize(e.Available))
+}
+
+func (e *InsufficientSpaceError) Is(target error) bool {
+	return target == ErrInsufficientSpace
+}
+
+// InsufficientInodesError is returned by copy-based operations (like InsufficientSpaceError)
+// and by DedupeSymlink before creating a symlink, which would consume a new inode
+// (replacing a hardlinked file, WithShadowTree, WithOriginalsDir), when destination filesystem has no free inodes left.
+type InsufficientInodesError struct {
+	// Dir is a destination dir.
+	Dir string
+	// Required is a number of inodes required.
+	Required int64
+	// Available is a number of free inodes.
+	Available int64
+}
+
+func (e *InsufficientInodesError) Error() string {
+	return fmt.Sprintf("insufficient inodes in %q: %d required, %d available", e.Dir, e.Required, e.Available)
+}
+
+func (e *InsufficientInodesError) Is(target error) bool {
+	return target == ErrInsufficientInodes
+}
+
+// CheckFreeSpace returns InsufficientSpaceError, if filesystem of dir has less than required bytes
+// available to unprivileged users.
+// It is a no-op on platforms not reporting free space (see FSStat).
+func CheckFreeSpace(dir string, required int64) error {
+	return checkFree(dir, required, 0)
+}
+
+// CheckFreeInodes returns InsufficientInodesError, if filesystem of dir has less than required free inodes.
+// It is a no-op on platforms not reporting free inodes and on filesystems allocating them dynamically (see FSStat).
+func CheckFreeInodes(dir string, required int64) error {
+	return checkFree(dir, 0, required)
+}
+
+// checkFree checks both free space and free inodes with a single statfs.
+func checkFree(dir string, bytes, inodes int64) error {
+	if !freeSpaceSupported || (bytes <= 0 && inodes <= 0) {
+		return nil
+	}
+
+	st, err := StatFS(dir)
+	if err != nil {
+		return err
+	}
+	if available := int64(min(st.FreeBytes, math.MaxInt64)); available < bytes {
+		return &InsufficientSpaceError{
+			Dir:       dir,
+			Required:  bytes,
+			Available: available,
+		}
+	}
+	if available := int64(min(st.FreeInodes, math.MaxInt64)); st.TotalInodes != 0 && available < inodes {
+		return &InsufficientInodesError{
+			Dir:       dir,
+			Required:  inodes,
+			Available: available,
+		}
+	}
+	return nil
+}
+
+// inodeLowWatermark is a number of free inodes, below which inodeBudget warns and re-checks filesystem on every use.
+const inodeLowWatermark = 10_000
+
+// inodeBudget tracks free inodes per dir, so DedupeSymlink checks them before consuming,
+// but does not statfs on every symlink created.
+type inodeBudget struct {
+	logger *log.Logger
+	free   map[string]int64 // by dir
+	warned map[string]bool  // by dir
+}
+
+func newInodeBudget(logger *log.Logger) *inodeBudget {
+	return &inodeBudget{
+		logger: logger,
+		free:   make(map[string]int64),
+		warned: make(map[string]bool),
+	}
+}
+
+// consume accounts a new inode in dir, returning InsufficientInodesError if there are no free ones left.
+func (b *inodeBudget) consume(dir string) error {
+	if !freeSpaceSupported {
+		return nil
+	}
+
+	free, ok := b.free[dir]
+	if !ok || free < inodeLowWatermark {
+		st, err := StatFS(dir)
+		if err != nil {
+			return err
+		}
+		if st.TotalInodes == 0 {
+			free = math.MaxInt64 // allocated dynamically
+		} else {
+			free = int64(min(st.FreeInodes, math.MaxInt64))
+		}
+		if free < inodeLowWatermark && !b.warned[dir] {
+			b.warned[dir] = true
+			b.logger.Printf("warning: only %d inodes free in %q, symlinks being created consume them", free, dir)
+		}
+	}
+	if free < 1 {
+		return &InsufficientInodesError{Dir: dir, Required: 1, Available: free}
+	}
+	b.free[dir] = free - 1
+	return nil
+}
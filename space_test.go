@@ -0,0 +1,64 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("free space is not reported on", runtime.GOOS)
+	}
+	tmp := t.TempDir()
+
+	if err := fsdedupe.CheckFreeSpace(tmp, 1); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	err := fsdedupe.CheckFreeSpace(tmp, math.MaxInt64)
+	if !errors.Is(err, fsdedupe.ErrInsufficientSpace) {
+		t.Fatalf("expected ErrInsufficientSpace, got: %v", err)
+	}
+	var spaceErr *fsdedupe.InsufficientSpaceError
+	if !errors.As(err, &spaceErr) {
+		t.Fatalf("expected InsufficientSpaceError, got: %T", err)
+	}
+	if actual, expected := spaceErr.Required, int64(math.MaxInt64); actual != expected {
+		t.Fatalf("expected %d bytes required, got %d", expected, actual)
+	}
+	if spaceErr.Available <= 0 || spaceErr.Available >= spaceErr.Required {
+		t.Fatalf("expected available bytes between 0 and required, got %d", spaceErr.Available)
+	}
+}
+
+func TestCheckFreeInodes(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("free inodes are not reported on", runtime.GOOS)
+	}
+	tmp := t.TempDir()
+	if st, err := fsdedupe.StatFS(tmp); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if st.TotalInodes == 0 {
+		t.Skip("inodes are allocated dynamically on", st.Type)
+	}
+
+	if err := fsdedupe.CheckFreeInodes(tmp, 1); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	err := fsdedupe.CheckFreeInodes(tmp, math.MaxInt64)
+	if !errors.Is(err, fsdedupe.ErrInsufficientInodes) {
+		t.Fatalf("expected ErrInsufficientInodes, got: %v", err)
+	}
+	var inodesErr *fsdedupe.InsufficientInodesError
+	if !errors.As(err, &inodesErr) {
+		t.Fatalf("expected InsufficientInodesError, got: %T", err)
+	}
+	if actual, expected := inodesErr.Required, int64(math.MaxInt64); actual != expected {
+		t.Fatalf("expected %d inodes required, got %d", expected, actual)
+	}
+}
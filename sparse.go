@@ -0,0 +1,21 @@
+package fsdedupe
+
+import (
+	"os"
+)
+
+// DiskUsage returns actual disk space (allocated blocks) used by a file,
+// which is less than its size for sparse files.
+// It falls back to file size where platform does not report allocated blocks.
+func DiskUsage(fi os.FileInfo) int64 {
+	if usage, ok := allocated(fi); ok {
+		return usage
+	}
+	return fi.Size()
+}
+
+// IsSparse reports if file has holes (allocates less disk space than its size).
+func IsSparse(fi os.FileInfo) bool {
+	usage, ok := allocated(fi)
+	return ok && usage < fi.Size()
+}
@@ -0,0 +1,7 @@
+package fsdedupe
+
+// https://developer.apple.com/library/archive/documentation/System/Conceptual/ManPages_iPhoneOS/man2/lseek.2.html
+const (
+	seekHole = 3
+	seekData = 4
+)
@@ -0,0 +1,7 @@
+package fsdedupe
+
+// https://man7.org/linux/man-pages/man2/lseek.2.html
+const (
+	seekData = 3
+	seekHole = 4
+)
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package fsdedupe
+
+import (
+	"context"
+	"os"
+)
+
+func allocated(fi os.FileInfo) (int64, bool) {
+	return 0, false
+}
+
+func copySparse(ctx context.Context, dst, src *os.File, limiter Limiter) error {
+	_, err := CopyContext(ctx, dst, src, limiter)
+	return err
+}
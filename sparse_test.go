@@ -0,0 +1,39 @@
+package fsdedupe_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestIsSparse(t *testing.T) {
+	tmp := t.TempDir()
+
+	name := filepath.Join(tmp, "sparse.bin")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("create %q: %s", name, err)
+	}
+	if err := f.Truncate(16 << 20); err != nil {
+		t.Fatalf("truncate %q: %s", name, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close %q: %s", name, err)
+	}
+
+	stat := lstat(t, name)
+	if !fsdedupe.IsSparse(stat) {
+		t.Skipf("filesystem of %q does not support sparse files", tmp)
+	}
+	if usage := fsdedupe.DiskUsage(stat); usage >= stat.Size() {
+		t.Errorf("expected disk usage to be less than %d, got %d", stat.Size(), usage)
+	}
+
+	dense := filepath.Join(tmp, "dense.txt")
+	writeFile(t, dense, "DUMMY")
+	if fsdedupe.IsSparse(lstat(t, dense)) {
+		t.Errorf("expected %q not to be sparse", dense)
+	}
+}
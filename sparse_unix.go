@@ -0,0 +1,62 @@
+//go:build linux || darwin
+
+package fsdedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+func allocated(fi os.FileInfo) (int64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(st.Blocks) * 512, true
+}
+
+// copySparse copies src into dst (expected to be empty) data segments only (SEEK_DATA/SEEK_HOLE),
+// so holes are preserved, throttling throughput with limiter (if not nil).
+func copySparse(ctx context.Context, dst, src *os.File, limiter Limiter) error {
+	stat, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	size := stat.Size()
+
+	var pos int64
+	for pos < size {
+		start, err := src.Seek(pos, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break // no more data, trailing hole
+		} else if err != nil {
+			return fmt.Errorf("seek data: %w", err)
+		}
+
+		end, err := src.Seek(start, seekHole)
+		if err != nil {
+			return fmt.Errorf("seek hole: %w", err)
+		}
+
+		if _, err := src.Seek(start, io.SeekStart); err != nil {
+			return fmt.Errorf("seek src: %w", err)
+		}
+		if _, err := dst.Seek(start, io.SeekStart); err != nil {
+			return fmt.Errorf("seek dst: %w", err)
+		}
+		if _, err := CopyContext(ctx, dst, io.LimitReader(src, end-start), limiter); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+		pos = end
+	}
+
+	// extend to full size, keeping trailing hole (if any)
+	if err := dst.Truncate(size); err != nil {
+		return fmt.Errorf("truncate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// sniffLen is how many leading bytes content type detection considers (see http.DetectContentType).
+const sniffLen = 512
+
+// sniffBuffer keeps the leading bytes written to it for content type detection.
+type sniffBuffer struct {
+	buf []byte
+}
+
+func (b *sniffBuffer) Write(p []byte) (int, error) {
+	if n := sniffLen - len(b.buf); n > 0 {
+		b.buf = append(b.buf, p[:min(n, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// sniffFile reads the leading bytes of a file for content type detection.
+func sniffFile(name string) (*sniffBuffer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", name, err)
+	}
+	defer f.Close()
+
+	b := &sniffBuffer{buf: make([]byte, sniffLen)}
+	n, err := io.ReadFull(f, b.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("read %q: %w", name, err)
+	}
+	b.buf = b.buf[:n]
+	return b, nil
+}
+
+// Stat describes a data file, which given link points to, without reading its contents.
+// Content type of data files stored before it was tracked is sniffed (from the first 512 bytes).
+// Inline contents (see WithInlineBlobs) are described with link times and sniffed content type.
+func (s *DedupeFS) Stat(linkName string) (BlobInfo, error) {
+	var info BlobInfo
+
+	_, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return info, err
+	}
+	target, err := os.Readlink(absLinkName)
+	if err != nil {
+		return info, fmt.Errorf("readlink %q: %w", absLinkName, err)
+	}
+	fi, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) && s.inlineDir != "" {
+		if info, ok, err := s.statInline(absLinkName, target); err != nil || ok {
+			return info, err
+		}
+	}
+	if err != nil {
+		return info, fmt.Errorf("stat %q: %w", target, err)
+	}
+	sidecar, err := readSidecar(target)
+	if err != nil {
+		return info, err
+	}
+	if sidecar.ContentType == "" {
+		sniffed, err := sniffFile(target)
+		if err != nil {
+			return info, err
+		}
+		sidecar.ContentType = http.DetectContentType(sniffed.buf)
+	}
+
+	info = BlobInfo{
+		Hash:        targetHash(target),
+		Size:        fi.Size(),
+		ModTime:     fi.ModTime(),
+		AccessTime:  accessTime(fi),
+		Hints:       sidecar.Hints,
+		ContentType: sidecar.ContentType,
+	}
+	return info, nil
+}
+
+// statInline describes inline contents (see WithInlineBlobs) of a link to a missing data file.
+func (s *DedupeFS) statInline(absLinkName, target string) (BlobInfo, bool, error) {
+	hash := targetHash(target)
+	contents, ok, err := s.inlineBlob(hash)
+	if err != nil || !ok {
+		return BlobInfo{}, false, err
+	}
+	fi, err := os.Lstat(absLinkName)
+	if err != nil {
+		return BlobInfo{}, false, fmt.Errorf("lstat %q: %w", absLinkName, err)
+	}
+	return BlobInfo{
+		Hash:        hash,
+		Size:        int64(len(contents)),
+		ModTime:     fi.ModTime(),
+		AccessTime:  fi.ModTime(),
+		ContentType: http.DetectContentType(contents),
+	}, true, nil
+}
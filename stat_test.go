@@ -0,0 +1,56 @@
+package fsdedupe_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDedupeFS_Stat(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	setupDedupeFS_Create(t, subject, "page.html", "<!DOCTYPE html><html></html>")
+	setupDedupeFS_Create(t, subject, "image.png", "\x89PNG\r\n\x1a\n"+strings.Repeat("\x00", 600))
+
+	for name, expected := range map[string]string{
+		"page.html": "text/html; charset=utf-8",
+		"image.png": "image/png",
+	} {
+		info, err := subject.Stat(name)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if info.ContentType != expected {
+			t.Errorf("expected %q content type %q, got %q", name, expected, info.ContentType)
+		}
+	}
+
+	info, err := subject.Stat("image.png")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := info.Size, int64(8+600); actual != expected {
+		t.Errorf("expected size %d, got %d", expected, actual)
+	}
+	if actual, expected := len(info.Hash), 128; actual != expected {
+		t.Errorf("expected %d chars hash, got %q", expected, info.Hash)
+	}
+
+	// data files stored before content type was tracked are sniffed
+	sidecars, err := filepath.Glob(filepath.Join(tmp, "data", "*.hints"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, sidecar := range sidecars {
+		if err := os.Remove(sidecar); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+	if info, err := subject.Stat("page.html"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if expected := "text/html; charset=utf-8"; info.ContentType != expected {
+		t.Errorf("expected sniffed content type %q, got %q", expected, info.ContentType)
+	}
+}
@@ -0,0 +1,165 @@
+package fsdedupe
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StoreStats is a point-in-time DedupeFS usage snapshot (see DedupeFS.Stats),
+// a record of a stats history file (see AppendStats).
+type StoreStats struct {
+	// Time is when the snapshot was taken.
+	Time time.Time `json:"time"`
+	// Links is a number of links.
+	Links int `json:"links"`
+	// LogicalBytes is a total size of linked files, as if stored without deduplication.
+	LogicalBytes int64 `json:"logical_bytes"`
+	// PhysicalBytes is a total size of stored contents (data files and inline ones, see WithInlineBlobs),
+	// including not yet collected unreferenced ones.
+	PhysicalBytes int64 `json:"physical_bytes"`
+	// Blobs is a number of stored contents.
+	Blobs int `json:"blobs"`
+}
+
+// DedupeRatio returns logical to physical bytes ratio (2 meaning linked files take half of their size), 0 for an empty store.
+func (st StoreStats) DedupeRatio() float64 {
+	if st.PhysicalBytes == 0 {
+		return 0
+	}
+	return float64(st.LogicalBytes) / float64(st.PhysicalBytes)
+}
+
+// Stats takes a usage snapshot of the store, accounting links as NamespaceUsage does.
+func (s *DedupeFS) Stats() (StoreStats, error) {
+	st := StoreStats{Time: time.Now()}
+
+	usages, err := s.NamespaceUsage()
+	if err != nil {
+		return st, err
+	}
+	for _, u := range usages {
+		st.Links += u.Links
+		st.LogicalBytes += u.LogicalBytes
+	}
+
+	onDataFile := func(path string, entry os.DirEntry) error {
+		if entry.IsDir() {
+			return fs.SkipDir // data dirs are flat
+		}
+		if _, ok := HashFromDataName(path); !ok || !entry.Type().IsRegular() {
+			return nil
+		}
+		fi, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // reaped meanwhile
+		} else if err != nil {
+			return fmt.Errorf("stat %q: %w", path, err)
+		}
+		st.Blobs++
+		st.PhysicalBytes += fi.Size()
+		return nil
+	}
+	for _, dataDir := range s.dataDirs() {
+		if err := walk(dataDir, onDataFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return st, fmt.Errorf("walk %q: %w", dataDir, err)
+		}
+	}
+
+	inline, err := s.inlineSizes()
+	if err != nil {
+		return st, err
+	}
+	for _, size := range inline {
+		st.Blobs++
+		st.PhysicalBytes += size
+	}
+	return st, nil
+}
+
+// AppendStats appends a snapshot to a stats history file (creating it, if missing),
+// one "<UNIXTIME> <LINKS> <LOGICAL> <PHYSICAL> <BLOBS>" line per snapshot,
+// so years of periodic snapshots take a few megabytes.
+func AppendStats(path string, st StoreStats) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open stats history %q: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%d %d %d %d %d\n", st.Time.Unix(), st.Links, st.LogicalBytes, st.PhysicalBytes, st.Blobs); err != nil {
+		return fmt.Errorf("append to stats history %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close stats history %q: %w", path, err)
+	}
+	return nil
+}
+
+// ReadStats reads a stats history file (see AppendStats), oldest snapshot first.
+// Incomplete last line (of an interrupted append) is skipped.
+func ReadStats(path string) ([]StoreStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open stats history %q: %w", path, err)
+	}
+	defer f.Close()
+
+	var history []StoreStats
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return history, nil // incomplete line is dropped as well
+		} else if err != nil {
+			return history, fmt.Errorf("read stats history %q: %w", path, err)
+		}
+		st, ok := parseStats(strings.TrimSuffix(line, "\n"))
+		if !ok {
+			return history, fmt.Errorf("read stats history %q: malformed line %d", path, n)
+		}
+		history = append(history, st)
+	}
+}
+
+// parseStats parses a stats history line.
+func parseStats(line string) (StoreStats, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		return StoreStats{}, false
+	}
+	var nums [5]int64
+	for i, field := range fields {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n < 0 {
+			return StoreStats{}, false
+		}
+		nums[i] = n
+	}
+	return StoreStats{
+		Time:          time.Unix(nums[0], 0),
+		Links:         int(nums[1]),
+		LogicalBytes:  nums[2],
+		PhysicalBytes: nums[3],
+		Blobs:         int(nums[4]),
+	}, true
+}
+
+// recordStats appends a store snapshot to a stats history file, ensuring its dir.
+func (s *DedupeFS) recordStats(path string) error {
+	st, err := s.Stats()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), s.dirPerm); err != nil {
+		return fmt.Errorf("ensure dir for %q: %w", path, err)
+	}
+	return AppendStats(path, st)
+}
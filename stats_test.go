@@ -0,0 +1,109 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_Stats(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, subject, "/a.txt", "SHARED")
+	setupDedupeFS_Create(t, subject, "/dir/b.txt", "SHARED")
+	setupDedupeFS_Create(t, subject, "/c.txt", "OWN")
+
+	st, err := subject.Stats()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := fsdedupe.StoreStats{Time: st.Time, Links: 3, LogicalBytes: 15, PhysicalBytes: 9, Blobs: 2}
+	if st != expected {
+		t.Errorf("expected %+v, got %+v", expected, st)
+	}
+	if actual, expected := st.DedupeRatio(), 15.0/9; actual != expected {
+		t.Errorf("expected ratio %f, got %f", expected, actual)
+	}
+}
+
+func TestAppendStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats")
+	snapshots := []fsdedupe.StoreStats{
+		{Time: time.Unix(1700000000, 0), Links: 3, LogicalBytes: 15, PhysicalBytes: 9, Blobs: 2},
+		{Time: time.Unix(1700086400, 0), Links: 4, LogicalBytes: 21, PhysicalBytes: 9, Blobs: 2},
+	}
+	for _, st := range snapshots {
+		if err := fsdedupe.AppendStats(path, st); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+
+	// interrupted append
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	f.WriteString("1700172800 5 2")
+	f.Close()
+
+	history, err := fsdedupe.ReadStats(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := len(history), len(snapshots); actual != expected {
+		t.Fatalf("expected %d snapshots, got %d", expected, actual)
+	}
+	for i, expected := range snapshots {
+		if actual := history[i]; !actual.Time.Equal(expected.Time) || actual.Links != expected.Links ||
+			actual.LogicalBytes != expected.LogicalBytes || actual.PhysicalBytes != expected.PhysicalBytes || actual.Blobs != expected.Blobs {
+			t.Errorf("expected snapshot %d %+v, got %+v", i, expected, actual)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("garbage\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if _, err := fsdedupe.ReadStats(path); err == nil {
+		t.Errorf("expected malformed history to fail")
+	}
+}
+
+func TestWithStatsHistory(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+	setupDedupeFS_Create(t, subject, "/a.txt", "DUMMY")
+	path := filepath.Join(tmp, "stats", "history")
+
+	runner := subject.StartGC(context.Background(), 10*time.Millisecond, fsdedupe.WithStatsHistory(path))
+	defer runner.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if run, ok := runner.Last(); ok {
+			if run.Err != nil {
+				t.Fatalf("expected no error, got: %s", run.Err)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected GC to run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	runner.Stop()
+
+	history, err := fsdedupe.ReadStats(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(history) == 0 {
+		t.Fatalf("expected snapshots, got none")
+	}
+	if actual, expected := history[0].LogicalBytes, int64(5); actual != expected {
+		t.Errorf("expected %d logical bytes, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,216 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LinkStrategy defines how DedupeSymlink and ApplyPlan replace duplicates.
+type LinkStrategy int
+
+const (
+	// LinkSymlink replaces duplicates with symlinks to canonical files (default).
+	LinkSymlink LinkStrategy = iota
+	// LinkHardlink replaces duplicates with hardlinks to canonical files (same device only).
+	LinkHardlink
+	// LinkReflink replaces duplicates with copy-on-write clones of canonical files
+	// (same device only, on filesystems supporting it, like btrfs or XFS; Linux only),
+	// which stay independent files sharing data blocks.
+	LinkReflink
+	// LinkAuto picks a strategy per duplicate by its dir filesystem (see StatFS):
+	// LinkReflink on btrfs and XFS, LinkHardlink on other filesystems of the same device,
+	// LinkSymlink across devices.
+	LinkAuto
+)
+
+func (s LinkStrategy) String() string {
+	switch s {
+	case LinkSymlink:
+		return "symlink"
+	case LinkHardlink:
+		return "hardlink"
+	case LinkReflink:
+		return "reflink"
+	case LinkAuto:
+		return "auto"
+	}
+	return fmt.Sprintf("LinkStrategy(%d)", int(s))
+}
+
+// errReflinkUnsupported is returned by reflink on platforms (or filesystems) not supporting it.
+var errReflinkUnsupported = errors.New("reflinks are not supported")
+
+// reflinkFSTypes are filesystem types (see FSStat), LinkAuto picks LinkReflink on.
+var reflinkFSTypes = map[string]bool{
+	"btrfs": true,
+	"xfs":   true,
+}
+
+// ReflinkSupported probes if reflinks (see LinkReflink) can be created in dir on this platform, kernel and filesystem,
+// cloning a temporary file.
+func ReflinkSupported(dir string) (bool, error) {
+	src, err := os.CreateTemp(dir, ".fsdedupe-reflink-*")
+	if err != nil {
+		return false, fmt.Errorf("create probe file in %q: %w", dir, err)
+	}
+	defer os.Remove(src.Name())
+	_, err = src.WriteString("probe")
+	if cerr := src.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, fmt.Errorf("write probe file %q: %w", src.Name(), err)
+	}
+
+	dst := src.Name() + ".clone"
+	err = reflink(src.Name(), dst)
+	if errors.Is(err, errReflinkUnsupported) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	os.Remove(dst)
+	return true, nil
+}
+
+// strategist picks link strategy per duplicate (see WithLinkStrategy, WithFSLinkStrategy, WithCompatRules).
+type strategist struct {
+	strategy  LinkStrategy
+	overrides map[string]LinkStrategy // by FS type
+	rules     []CompatRule
+	dirs      map[string]dirDevice // by dir
+	noReflink map[uint64]bool      // devices reflinks failed on
+}
+
+type dirDevice struct {
+	fsType string
+	device uint64
+}
+
+func newStrategist(strategy LinkStrategy, overrides map[string]LinkStrategy, rules []CompatRule) *strategist {
+	return &strategist{
+		strategy:  strategy,
+		overrides: overrides,
+		rules:     rules,
+		dirs:      make(map[string]dirDevice),
+		noReflink: make(map[uint64]bool),
+	}
+}
+
+// keeps returns a compat rule filename is to be left as is by, if any.
+func (s *strategist) keeps(filename string) (CompatRule, bool) {
+	rule, ok := matchCompatRules(s.rules, filename)
+	return rule, ok && rule.Keep
+}
+
+// pick returns a strategy for replacing filename with a link to target.
+// Compat rules take precedence over filesystem overrides.
+func (s *strategist) pick(filename, target string) (LinkStrategy, error) {
+	strategy, overrides := s.strategy, s.overrides
+	if rule, ok := matchCompatRules(s.rules, filename); ok {
+		strategy, overrides = rule.Strategy, nil
+	}
+	if strategy != LinkAuto && len(overrides) == 0 {
+		return strategy, nil
+	}
+
+	dir := filepath.Dir(filename)
+	d, ok := s.dirs[dir]
+	if !ok {
+		st, err := StatFS(dir)
+		if err != nil {
+			return 0, err
+		}
+		if d.device, err = deviceID(dir); err != nil {
+			return 0, fmt.Errorf("stat %q: %w", dir, err)
+		}
+		d.fsType = st.Type
+		s.dirs[dir] = d
+	}
+
+	if override, ok := overrides[d.fsType]; ok {
+		strategy = override
+	}
+	if strategy != LinkAuto {
+		return strategy, nil
+	}
+
+	targetDevice, err := deviceID(target)
+	if err != nil {
+		return 0, fmt.Errorf("stat %q: %w", target, err)
+	}
+	switch {
+	case targetDevice != d.device:
+		return LinkSymlink, nil
+	case reflinkFSTypes[d.fsType] && !s.noReflink[d.device]:
+		return LinkReflink, nil
+	default:
+		return LinkHardlink, nil
+	}
+}
+
+// link creates link name to target with given strategy, returning the strategy actually used:
+// with LinkAuto, unsupported reflinks fall back to hardlinks (remembered per device).
+// Name must not exist. Reflinks get duplicate (stat) permissions and times, as they are independent files.
+func (s *strategist) link(strategy LinkStrategy, target, name string, stat os.FileInfo) (LinkStrategy, error) {
+	switch strategy {
+	case LinkHardlink:
+		if err := os.Link(target, name); err != nil {
+			return 0, fmt.Errorf("hardlink %q -> %q: %w", name, target, err)
+		}
+		return LinkHardlink, nil
+	case LinkReflink:
+		err := reflink(target, name)
+		if errors.Is(err, errReflinkUnsupported) && s.strategy == LinkAuto {
+			if d, ok := s.dirs[filepath.Dir(name)]; ok {
+				s.noReflink[d.device] = true
+			}
+			return s.link(LinkHardlink, target, name, stat)
+		} else if err != nil {
+			return 0, fmt.Errorf("reflink %q -> %q: %w", name, target, err)
+		}
+		if err := os.Chmod(name, stat.Mode().Perm()); err != nil {
+			os.Remove(name)
+			return 0, fmt.Errorf("chmod %q: %w", name, err)
+		}
+		if err := os.Chtimes(name, accessTime(stat), stat.ModTime()); err != nil {
+			os.Remove(name)
+			return 0, fmt.Errorf("chtimes %q: %w", name, err)
+		}
+		return LinkReflink, nil
+	default:
+		if err := os.Symlink(target, name); err != nil {
+			return 0, fmt.Errorf("symlink %q -> %q: %w", name, target, err)
+		}
+		return LinkSymlink, nil
+	}
+}
+
+// replace atomically replaces filename (stat) with a link to target, created aside first,
+// returning the strategy actually used (see link).
+func (s *strategist) replace(strategy LinkStrategy, target, filename string, stat os.FileInfo) (LinkStrategy, error) {
+	tmp := filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".fsdedupe-link")
+	used, err := s.link(strategy, target, tmp, stat)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("rename %q -> %q: %w", tmp, filename, err)
+	}
+	return used, nil
+}
+
+// inodesUsed returns a net number of inodes consumed by replacing a file
+// (hardlinked elsewhere or not) with a link of given strategy (see Summary.InodesUsed).
+func inodesUsed(strategy LinkStrategy, hardlinked bool) int64 {
+	switch {
+	case strategy == LinkHardlink && !hardlinked:
+		return -1
+	case strategy != LinkHardlink && hardlinked:
+		return 1
+	}
+	return 0
+}
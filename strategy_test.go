@@ -0,0 +1,136 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeSymlink_linkStrategy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hardlinks need privileges on", runtime.GOOS)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []fsdedupe.Option
+	}{
+		{"hardlink", []fsdedupe.Option{fsdedupe.WithLinkStrategy(fsdedupe.LinkHardlink)}},
+		{"journaled hardlink", []fsdedupe.Option{fsdedupe.WithLinkStrategy(fsdedupe.LinkHardlink), fsdedupe.WithJournal(filepath.Join(t.TempDir(), "journal"))}},
+		{"auto", []fsdedupe.Option{fsdedupe.WithLinkStrategy(fsdedupe.LinkAuto)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			file1 := filepath.Join(tmp, "file1.txt")
+			writeFile(t, file1, "DUPE")
+			file2 := filepath.Join(tmp, "file2.txt")
+			writeFile(t, file2, "DUPE")
+			if err := os.Chmod(file2, 0600); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+
+			summary, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+				Entries: []string{file1, file2},
+			}, tc.opts...)
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			}
+			if actual, expected := summary.Linked, 1; actual != expected {
+				t.Fatalf("expected %d linked, got %d", expected, actual)
+			}
+
+			// auto picks hardlinks or reflinks on a single (local) temp filesystem
+			stat := lstat(t, file2)
+			if !stat.Mode().IsRegular() {
+				t.Fatalf("expected %q to be a regular file, got %s", file2, stat.Mode())
+			}
+			if b, err := os.ReadFile(file2); err != nil {
+				t.Fatalf("expected no error, got: %s", err)
+			} else if actual, expected := string(b), "DUPE"; actual != expected {
+				t.Fatalf("expected %q contents, got %q", expected, actual)
+			}
+			if hardlinked := os.SameFile(stat, lstat(t, file1)); hardlinked {
+				if actual, expected := summary.InodesUsed, int64(-1); actual != expected {
+					t.Fatalf("expected %d inodes used, got %d", expected, actual)
+				}
+			} else if actual, expected := stat.Mode().Perm(), os.FileMode(0600); actual != expected {
+				t.Fatalf("expected reflink to keep duplicate mode %s, got %s", expected, actual)
+			}
+		})
+	}
+}
+
+func TestDedupeSymlink_fsLinkStrategy(t *testing.T) {
+	tmp := t.TempDir()
+	st, err := fsdedupe.StatFS(tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if st.Type == "" {
+		t.Skip("filesystem type is not detected on", runtime.GOOS)
+	}
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, file2},
+	}, fsdedupe.WithLinkStrategy(fsdedupe.LinkHardlink), fsdedupe.WithFSLinkStrategy(st.Type, fsdedupe.LinkSymlink)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := readlink(t, file2), file1; actual != expected {
+		t.Fatalf("expected %q to link %q, got %q", file2, expected, actual)
+	}
+}
+
+func TestDedupeSymlink_reflinkUnsupported(t *testing.T) {
+	tmp := t.TempDir()
+	if st, err := fsdedupe.StatFS(tmp); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if runtime.GOOS == "linux" && (st.Type == "btrfs" || st.Type == "xfs") {
+		t.Skip("reflinks may be supported on", st.Type)
+	}
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	_, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, file2},
+	}, fsdedupe.WithLinkStrategy(fsdedupe.LinkReflink))
+	if err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	// duplicate is left as is
+	if stat := lstat(t, file2); !stat.Mode().IsRegular() || os.SameFile(stat, lstat(t, file1)) {
+		t.Fatalf("expected %q to be left as is", file2)
+	}
+}
+
+func TestReflinkSupported(t *testing.T) {
+	tmp := t.TempDir()
+	st, err := fsdedupe.StatFS(tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	supported, err := fsdedupe.ReflinkSupported(tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if supported && (runtime.GOOS != "linux" || (st.Type != "btrfs" && st.Type != "xfs")) {
+		t.Fatalf("expected reflinks to be unsupported on %s %q", runtime.GOOS, st.Type)
+	}
+	// probe files are cleaned up
+	if entries, err := os.ReadDir(tmp); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	} else if len(entries) != 0 {
+		t.Fatalf("expected no probe files left, got %d", len(entries))
+	}
+}
@@ -0,0 +1,30 @@
+package fsdedupe
+
+// Summary holds run statistics.
+type Summary struct {
+	// Files is a number of processed (hashed) files.
+	Files int `json:"files"`
+	// Duplicates is a number of files with the same content as some previously seen one.
+	Duplicates int `json:"duplicates"`
+	// Linked is a number of duplicates replaced by symlinks (or other links, see WithLinkStrategy).
+	Linked int `json:"linked"`
+	// BytesSaved is a total size of duplicates replaced by symlinks.
+	BytesSaved int64 `json:"bytes_saved"`
+	// DiskBytesSaved is a total disk space (allocated blocks) of duplicates replaced by symlinks,
+	// which is less than BytesSaved for sparse files.
+	DiskBytesSaved int64 `json:"disk_bytes_saved"`
+	// PermissionDenied is a number of files skipped due to permission errors (see WithIgnorePermissionDenied).
+	PermissionDenied int `json:"permission_denied"`
+	// InodesUsed is a net number of inodes consumed by the run.
+	// Symlinks (and reflinks) consume inodes just like files, so replacing a file with a symlink consumes none,
+	// unless the file is hardlinked elsewhere, while replacing it with a hardlink frees one; shadow tree (see WithShadowTree)
+	// and originals dir (see WithOriginalsDir) symlinks consume one each.
+	InodesUsed int64 `json:"inodes_used"`
+	// Skipped is a number of files not linked for some reason (see WithOnSkipped).
+	Skipped int `json:"skipped"`
+	// AlreadyDeduped is a number of input symlinks already pointing to their canonical file
+	// (deduplicated by a previous run), not counted as duplicates.
+	AlreadyDeduped int `json:"already_deduped"`
+	// AlreadyDedupedBytes is a total size of AlreadyDeduped symlink targets, saved by previous runs.
+	AlreadyDedupedBytes int64 `json:"already_deduped_bytes"`
+}
@@ -0,0 +1,241 @@
+package fsdedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// BlobInfo describes a data file (see Stat), also for tiering decisions.
+type BlobInfo struct {
+	// Hash is a content hash.
+	Hash string
+	// Size is a data file size.
+	Size int64
+	// ModTime is when data file was stored.
+	ModTime time.Time
+	// AccessTime is when data file was last read
+	// (as reported by filesystem, may be coarse or disabled with noatime mounts).
+	AccessTime time.Time
+	// Hints are storage hints given on Create (see WithHints).
+	Hints []string
+	// ContentType is a MIME type, sniffed from the first 512 bytes on Create.
+	ContentType string
+}
+
+// TierPolicy returns a tier index (0 - primary data dir, 1+ - WithTiers dirs) for a data file.
+// Out of range indexes are clamped.
+type TierPolicy func(BlobInfo) int
+
+// TierBySize places data files of at least given size into the next tier (1), smaller ones - into primary (0).
+func TierBySize(threshold int64) TierPolicy {
+	return func(b BlobInfo) int {
+		if b.Size >= threshold {
+			return 1
+		}
+		return 0
+	}
+}
+
+// TierByAge places data files not accessed for at least given duration into the next tier (1),
+// recently accessed ones - into primary (0).
+// Access time is the only access frequency signal filesystems provide.
+func TierByAge(maxAge time.Duration) TierPolicy {
+	return func(b BlobInfo) int {
+		last := b.AccessTime
+		if b.ModTime.After(last) {
+			last = b.ModTime
+		}
+		if time.Since(last) >= maxAge {
+			return 1
+		}
+		return 0
+	}
+}
+
+// TierMax combines policies, picking the coldest (highest) tier of them.
+func TierMax(policies ...TierPolicy) TierPolicy {
+	return func(b BlobInfo) int {
+		tier := 0
+		for _, policy := range policies {
+			tier = max(tier, policy(b))
+		}
+		return tier
+	}
+}
+
+// WithTiers sets extra (colder) data dirs and a policy of placing data files between them.
+// DedupeFS data dir is tier 0, tiers are 1, 2 and so on.
+// New data files are placed according to policy, Rebalance migrates existing ones.
+func WithTiers(policy TierPolicy, dataDirs ...string) FSOption {
+	return func(s *DedupeFS) {
+		s.tierPolicy = policy
+		s.tiers = dataDirs
+	}
+}
+
+// dataDirs returns all tier data dirs, primary one first.
+func (s *DedupeFS) dataDirs() []string {
+	return append([]string{s.dataDir}, s.tiers...)
+}
+
+// tierOf returns data dir index for a data file.
+func (s *DedupeFS) tierOf(b BlobInfo) int {
+	if s.tierPolicy == nil {
+		return 0
+	}
+	return min(max(s.tierPolicy(b), 0), len(s.tiers))
+}
+
+// blobPath returns data file path for a hash in given tier.
+func (s *DedupeFS) blobPath(tier int, hash string) string {
+	return filepath.Join(s.dataDirs()[tier], hash+DataFileExt)
+}
+
+// findBlob returns an existing data file path for a hash, searching all tiers.
+func (s *DedupeFS) findBlob(hash string) (string, bool) {
+	for tier := range s.dataDirs() {
+		path := s.blobPath(tier, hash)
+		if _, err := os.Lstat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// RebalanceReport describes Rebalance outcome.
+type RebalanceReport struct {
+	// Checked is a number of inspected data files.
+	Checked int `json:"checked"`
+	// Moved is a number of data files migrated between tiers.
+	Moved int `json:"moved"`
+	// MovedBytes is a total size of migrated data files.
+	MovedBytes int64 `json:"moved_bytes"`
+	// Relinked is a number of links re-pointed to migrated data files.
+	Relinked int `json:"relinked"`
+}
+
+// Rebalance migrates data files between tiers according to tiering policy (see WithTiers),
+// transparently re-pointing links to the new locations.
+// Data files are copied first, then links are re-pointed, then old copies are removed,
+// so links never dangle, even if interrupted.
+func (s *DedupeFS) Rebalance(ctx context.Context) (RebalanceReport, error) {
+	ctx, span := s.tracer.Start(ctx, "fsdedupe.Rebalance")
+	report, err := s.rebalance(ctx)
+	endSpan(span, err,
+		attribute.Int("fsdedupe.checked", report.Checked),
+		attribute.Int("fsdedupe.moved", report.Moved),
+		attribute.Int64("fsdedupe.moved_bytes", report.MovedBytes),
+	)
+	return report, err
+}
+
+func (s *DedupeFS) rebalance(ctx context.Context) (RebalanceReport, error) {
+	var report RebalanceReport
+	if s.tierPolicy == nil {
+		return report, nil
+	}
+
+	unlockStore, err := s.lockStore(true)
+	if err != nil {
+		return report, err
+	}
+	defer unlockStore()
+
+	links := make(map[string][]string) // data file -> links
+	onLink := func(path string, entry os.DirEntry) error {
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", path, err)
+		}
+		links[target] = append(links[target], path)
+		return nil
+	}
+	if err := walk(s.linkDir, onLink); err != nil {
+		return report, fmt.Errorf("walk %q: %w", s.linkDir, err)
+	}
+	if s.snapshotDir != "" {
+		if err := walk(s.snapshotDir, onLink); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return report, fmt.Errorf("walk %q: %w", s.snapshotDir, err)
+		}
+	}
+
+	type move struct {
+		from, to string
+		size     int64
+	}
+	var moves []move
+	for tier, dataDir := range s.dataDirs() {
+		collect := func(path string, entry os.DirEntry) error {
+			if entry.IsDir() {
+				return fs.SkipDir // data dirs are flat
+			}
+			hash, ok := HashFromDataName(path)
+			if !entry.Type().IsRegular() || !ok {
+				return nil
+			}
+			fi, err := entry.Info()
+			if err != nil {
+				return fmt.Errorf("stat %q: %w", path, err)
+			}
+			sidecar, err := readSidecar(path)
+			if err != nil {
+				return err
+			}
+			report.Checked++
+
+			blob := BlobInfo{
+				Hash:        hash,
+				Size:        fi.Size(),
+				ModTime:     fi.ModTime(),
+				AccessTime:  accessTime(fi),
+				Hints:       sidecar.Hints,
+				ContentType: sidecar.ContentType,
+			}
+			if want := s.tierOf(blob); want != tier {
+				moves = append(moves, move{from: path, to: s.blobPath(want, blob.Hash), size: blob.Size})
+			}
+			return nil
+		}
+		if err := walk(dataDir, collect); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return report, fmt.Errorf("walk %q: %w", dataDir, err)
+		}
+	}
+
+	for _, m := range moves {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(m.to), s.dirPerm); err != nil {
+			return report, fmt.Errorf("ensure dir for %q: %w", m.to, err)
+		}
+		if err := copyFile(ctx, m.from, m.to, s.limiter); err != nil {
+			return report, fmt.Errorf("copy %q to %q: %w", m.from, m.to, err)
+		}
+		if err := moveHints(ctx, m.from, m.to); err != nil {
+			return report, fmt.Errorf("move hints of %q: %w", m.from, err)
+		}
+		for _, link := range links[m.from] {
+			if err := replaceSymlink(m.to, link); err != nil {
+				return report, fmt.Errorf("replace symlink %q pointing to data file %q: %w", link, m.to, err)
+			}
+			report.Relinked++
+		}
+		if err := os.Remove(m.from); err != nil {
+			return report, fmt.Errorf("remove %q: %w", m.from, err)
+		}
+		report.Moved++
+		report.MovedBytes += m.size
+	}
+	return report, nil
+}
@@ -0,0 +1,111 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_tiers(t *testing.T) {
+	tmp := t.TempDir()
+	hot, cold := filepath.Join(tmp, "data"), filepath.Join(tmp, "cold")
+
+	setup := func(threshold int64) *fsdedupe.DedupeFS {
+		subject, err := fsdedupe.NewDedupeFS(
+			filepath.Join(tmp, "temp"),
+			hot,
+			filepath.Join(tmp, "link"),
+			fsdedupe.WithTiers(fsdedupe.TierBySize(threshold), cold),
+		)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		return subject
+	}
+
+	subject := setup(4)
+	setupDedupeFS_Create(t, subject, "small.txt", "ab")
+	setupDedupeFS_Create(t, subject, "large.txt", "DUMMY")
+	setupDedupeFS_Create(t, subject, "large-copy.txt", "DUMMY")
+
+	small, large, largeCopy := filepath.Join(tmp, "link", "small.txt"), filepath.Join(tmp, "link", "large.txt"), filepath.Join(tmp, "link", "large-copy.txt")
+	if actual := readlink(t, small); filepath.Dir(actual) != hot {
+		t.Errorf("expected %q to be stored in %q, got %q", small, hot, actual)
+	}
+	if actual := readlink(t, large); filepath.Dir(actual) != cold {
+		t.Errorf("expected %q to be stored in %q, got %q", large, cold, actual)
+	}
+	if actual, expected := readlink(t, largeCopy), readlink(t, large); actual != expected {
+		t.Errorf("expected %q to be deduplicated to %q, got %q", largeCopy, expected, actual)
+	}
+
+	// raise threshold: large file now belongs to hot tier
+	subject = setup(100)
+	report, err := subject.Rebalance(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := (fsdedupe.RebalanceReport{Checked: 2, Moved: 1, MovedBytes: 5, Relinked: 2}); report != expected {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+
+	for _, link := range []string{large, largeCopy} {
+		target := readlink(t, link)
+		if filepath.Dir(target) != hot {
+			t.Errorf("expected %q to be moved to %q, got %q", link, hot, target)
+		}
+		b, err := os.ReadFile(link)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if actual, expected := string(b), "DUMMY"; actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	}
+
+	entries, err := os.ReadDir(cold)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".bin") {
+			t.Errorf("expected cold tier to be empty, got %q", entry.Name())
+		}
+	}
+}
+
+func TestDedupeFS_Rebalance_limiter(t *testing.T) {
+	tmp := t.TempDir()
+	hot, cold := filepath.Join(tmp, "data"), filepath.Join(tmp, "cold")
+
+	limiter := new(countingLimiter)
+	setup := func(threshold int64) *fsdedupe.DedupeFS {
+		subject, err := fsdedupe.NewDedupeFS(
+			filepath.Join(tmp, "temp"),
+			hot,
+			filepath.Join(tmp, "link"),
+			fsdedupe.WithTiers(fsdedupe.TierBySize(threshold), cold),
+			fsdedupe.WithFSLimiter(limiter),
+		)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		return subject
+	}
+
+	setupDedupeFS_Create(t, setup(4), "large.txt", "DUMMY")
+	if actual := limiter.n.Load(); actual != 0 {
+		t.Fatalf("expected no bytes copied yet, got %d", actual)
+	}
+
+	if _, err := setup(100).Rebalance(context.Background()); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := limiter.n.Load(), int64(5); actual != expected {
+		t.Fatalf("expected %d bytes copied, got %d", expected, actual)
+	}
+}
@@ -0,0 +1,43 @@
+package fsdedupe
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is an instrumentation scope name of OpenTelemetry spans.
+const tracerName = "github.com/mxmCherry/fsdedupe"
+
+// WithTracerProvider makes DedupeSymlink (and CopyTree, Import) record OpenTelemetry spans:
+// a span per run and per hashed/linked file, children of a span in ctx, if any.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		if tp != nil {
+			o.tracer = tp.Tracer(tracerName)
+		}
+	}
+}
+
+// WithFSTracerProvider makes DedupeFS record OpenTelemetry spans of GC, Rebalance, Scrub and DiffSnapshots.
+func WithFSTracerProvider(tp trace.TracerProvider) FSOption {
+	return func(s *DedupeFS) {
+		if tp != nil {
+			s.tracer = tp.Tracer(tracerName)
+		}
+	}
+}
+
+// noopTracer is used unless tracing is requested.
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// endSpan ends span, marking it failed on error.
+func endSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	span.SetAttributes(attrs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,131 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// spanRecorder is a TracerProvider, recording names and attributes of ended spans.
+type spanRecorder struct {
+	noop.TracerProvider
+
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{r: r}
+}
+
+// names returns sorted distinct names of ended spans.
+func (r *spanRecorder) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, span := range r.spans {
+		if !slices.Contains(names, span.name) {
+			names = append(names, span.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// named returns ended spans of a given name.
+func (r *spanRecorder) named(name string) []*recordingSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []*recordingSpan
+	for _, span := range r.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	r *spanRecorder
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordingSpan{r: t.r, name: name}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordingSpan struct {
+	noop.Span
+	r     *spanRecorder
+	name  string
+	attrs []attribute.KeyValue
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) { s.attrs = append(s.attrs, kv...) }
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.spans = append(s.r.spans, s)
+}
+
+func TestWithTracerProvider(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+
+	file2 := filepath.Join(tmp, "file2.txt")
+	writeFile(t, file2, "DUPE")
+
+	tp := new(spanRecorder)
+	it := fsdedupe.Slice([]string{file1, file2})
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), it, fsdedupe.WithTracerProvider(tp)); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	expected := []string{"fsdedupe.DedupeSymlink", "fsdedupe.hash", "fsdedupe.link"}
+	if actual := tp.names(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected spans %q, got %q", expected, actual)
+	}
+	if actual, expected := len(tp.named("fsdedupe.hash")), 2; actual != expected {
+		t.Errorf("expected %d hash spans, got %d", expected, actual)
+	}
+	run := tp.named("fsdedupe.DedupeSymlink")[0]
+	if linked := attribute.Int("fsdedupe.linked", 1); !slices.Contains(run.attrs, linked) {
+		t.Errorf("expected run span to have %v attribute, got %v", linked, run.attrs)
+	}
+}
+
+func TestWithFSTracerProvider(t *testing.T) {
+	tmp := t.TempDir()
+
+	tp := new(spanRecorder)
+	subject, err := fsdedupe.NewDedupeFS(
+		filepath.Join(tmp, "temp"),
+		filepath.Join(tmp, "data"),
+		filepath.Join(tmp, "link"),
+		fsdedupe.WithFSTracerProvider(tp),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	setupDedupeFS_Create(t, subject, "file.txt", "DUMMY")
+	if _, err := subject.GC(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if actual, expected := tp.names(), []string{"fsdedupe.GC"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected spans %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,219 @@
+package fsdedupe
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrNoTrashDir is returned by SoftRemove and Undelete if DedupeFS has no trash dir configured (see WithTrash).
+var ErrNoTrashDir = errors.New("no trash dir")
+
+// WithTrash sets a dir to move softly removed files into (see SoftRemove), keeping them for retention (0 - forever).
+// Trashed links count as data file references for GC until they expire, expired ones are purged by GC.
+func WithTrash(dir string, retention time.Duration) FSOption {
+	return func(s *DedupeFS) {
+		s.trashDir = dir
+		s.trashRetention = retention
+	}
+}
+
+// SoftRemove moves the file (or a dir of files) into trash (see WithTrash), stamped with deletion time,
+// so it can be brought back with Undelete until it expires.
+func (s *DedupeFS) SoftRemove(linkName string) error {
+	if s.trashDir == "" {
+		return fmt.Errorf("soft remove %q: %w", linkName, ErrNoTrashDir)
+	}
+	cleanLinkName, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return err
+	}
+	if cleanLinkName == string(filepath.Separator) {
+		return fmt.Errorf("soft remove %q: can't remove link dir itself", linkName)
+	}
+
+	// GC must not miss the link while it is being moved
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return err
+	}
+	defer unlockStore()
+	unlock := s.locks.links.lock(absLinkName)
+	defer unlock()
+
+	if _, err := os.Lstat(absLinkName); err != nil {
+		return fmt.Errorf("soft remove %q: %w", linkName, err)
+	}
+
+	// entries of the same name removed within the same nanosecond get distinct stamps
+	deleted := time.Now().UnixNano()
+	trashed := s.trashPath(deleted, cleanLinkName)
+	for {
+		if _, err := os.Lstat(trashed); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		deleted++
+		trashed = s.trashPath(deleted, cleanLinkName)
+	}
+	if err := os.MkdirAll(filepath.Dir(trashed), s.dirPerm); err != nil {
+		return fmt.Errorf("ensure dir for %q: %w", trashed, err)
+	}
+
+	if err := s.indexedRemove(absLinkName, func() error {
+		if err := os.Rename(absLinkName, trashed); err != nil {
+			return fmt.Errorf("rename %q -> %q: %w", absLinkName, trashed, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := s.cleanTree(filepath.Dir(cleanLinkName)); err != nil {
+		return fmt.Errorf("clean tree of %q: %w", cleanLinkName, err)
+	}
+	return nil
+}
+
+// Undelete brings back the most recently softly removed file (see SoftRemove) of a given name,
+// failing with fs.ErrNotExist if there is no such one in trash
+// and with fs.ErrExist if the name was taken meanwhile.
+func (s *DedupeFS) Undelete(linkName string) error {
+	if s.trashDir == "" {
+		return fmt.Errorf("undelete %q: %w", linkName, ErrNoTrashDir)
+	}
+	cleanLinkName, absLinkName, err := s.resolve(linkName)
+	if err != nil {
+		return err
+	}
+
+	unlockStore, err := s.lockStore(false)
+	if err != nil {
+		return err
+	}
+	defer unlockStore()
+	unlock := s.locks.links.lock(absLinkName)
+	defer unlock()
+
+	stamps, err := s.trashStamps()
+	if err != nil {
+		return err
+	}
+	trashed := ""
+	var stamp int64
+	for i := len(stamps) - 1; i >= 0; i-- {
+		path := s.trashPath(stamps[i], cleanLinkName)
+		if _, err := os.Lstat(path); err == nil {
+			trashed, stamp = path, stamps[i]
+			break
+		}
+	}
+	if trashed == "" {
+		return fmt.Errorf("undelete %q: %w", linkName, fs.ErrNotExist)
+	}
+	if _, err := os.Lstat(absLinkName); err == nil {
+		return fmt.Errorf("undelete %q: %w", linkName, fs.ErrExist)
+	}
+
+	if err := s.inLinkDir(absLinkName, func() error {
+		if err := s.indexTrashed(trashed, cleanLinkName); err != nil {
+			return err
+		}
+		if err := os.Rename(trashed, absLinkName); err != nil {
+			return fmt.Errorf("rename %q -> %q: %w", trashed, absLinkName, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	stampDir := filepath.Join(string(filepath.Separator), strconv.FormatInt(stamp, 10))
+	if err := cleanTree(s.trashDir, filepath.Join(stampDir, filepath.Dir(cleanLinkName))); err != nil {
+		return fmt.Errorf("clean trash of %q: %w", cleanLinkName, err)
+	}
+	return nil
+}
+
+// trashPath returns a trash path of a (clean, rooted) link name removed at deleted (Unix nanoseconds).
+func (s *DedupeFS) trashPath(deleted int64, cleanLinkName string) string {
+	return filepath.Join(s.trashDir, strconv.FormatInt(deleted, 10), cleanLinkName)
+}
+
+// trashStamps returns deletion stamps (Unix nanoseconds) of trash dir entries, oldest first.
+func (s *DedupeFS) trashStamps() ([]int64, error) {
+	entries, err := os.ReadDir(s.trashDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read trash dir %q: %w", s.trashDir, err)
+	}
+	var stamps []int64
+	for _, entry := range entries {
+		if stamp, err := strconv.ParseInt(entry.Name(), 10, 64); err == nil && entry.IsDir() {
+			stamps = append(stamps, stamp)
+		}
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+	return stamps, nil
+}
+
+// indexTrashed adds trashed links (a link or a dir of links), being brought back as cleanLinkName, to link index.
+func (s *DedupeFS) indexTrashed(trashed, cleanLinkName string) error {
+	if s.linkIndexDir == "" {
+		return nil
+	}
+	stat, err := os.Lstat(trashed)
+	if err != nil {
+		return fmt.Errorf("lstat %q: %w", trashed, err)
+	}
+	links := make(map[string]string)
+	if stat.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(trashed)
+		if err != nil {
+			return fmt.Errorf("readlink %q: %w", trashed, err)
+		}
+		links[cleanLinkName] = target
+	} else if stat.IsDir() {
+		tree, err := collectLinks(trashed)
+		if err != nil {
+			return err
+		}
+		for rel, target := range tree {
+			links[filepath.Join(cleanLinkName, rel)] = target
+		}
+	}
+	for linkName, target := range links {
+		if err := s.indexLink(linkName, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeTrash removes trash entries expired by now, returning their number.
+// Store lock must be held exclusively.
+func (s *DedupeFS) purgeTrash(now time.Time) (int, error) {
+	if s.trashRetention <= 0 {
+		return 0, nil
+	}
+	stamps, err := s.trashStamps()
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, stamp := range stamps {
+		if now.Sub(time.Unix(0, stamp)) < s.trashRetention {
+			break
+		}
+		path := filepath.Join(s.trashDir, strconv.FormatInt(stamp, 10))
+		if err := os.RemoveAll(path); err != nil {
+			return expired, fmt.Errorf("purge trash %q: %w", path, err)
+		}
+		expired++
+	}
+	return expired, nil
+}
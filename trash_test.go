@@ -0,0 +1,112 @@
+package fsdedupe_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestDedupeFS_SoftRemove(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithTrash(filepath.Join(tmp, "trash"), time.Hour),
+		fsdedupe.WithLinkIndex(filepath.Join(tmp, "index")))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	setupDedupeFS_Create(t, subject, "/a.txt", "A")
+	setupDedupeFS_Create(t, subject, "/dir/b.txt", "B")
+
+	for _, name := range []string{"/a.txt", "/dir"} {
+		if err := subject.SoftRemove(name); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+	if _, err := subject.Stat("/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected softly removed file to be gone, got: %v", err)
+	}
+	report, err := subject.GC()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Removed, 0; actual != expected {
+		t.Fatalf("expected %d data files reclaimed while trashed, got %d", expected, actual)
+	}
+
+	for _, name := range []string{"/a.txt", "/dir"} {
+		if err := subject.Undelete(name); err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+	}
+	assertDedupeFSContents(t, subject, "/a.txt", "A")
+	assertDedupeFSContents(t, subject, "/dir/b.txt", "B")
+	info, err := subject.Stat("/dir/b.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	assertLinksFor(t, subject, info.Hash, []string{"/dir/b.txt"})
+
+	if err := subject.Undelete("/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist for nothing to undelete, got: %v", err)
+	}
+	if err := subject.SoftRemove("/a.txt"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	setupDedupeFS_Create(t, subject, "/a.txt", "NEW")
+	if err := subject.Undelete("/a.txt"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected ErrExist for a taken name, got: %v", err)
+	}
+}
+
+func TestDedupeFS_SoftRemove_expired(t *testing.T) {
+	tmp := t.TempDir()
+	subject, err := fsdedupe.NewDedupeFS(filepath.Join(tmp, "temp"), filepath.Join(tmp, "data"), filepath.Join(tmp, "link"),
+		fsdedupe.WithTrash(filepath.Join(tmp, "trash"), time.Nanosecond))
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	setupDedupeFS_Create(t, subject, "/a.txt", "A")
+	if err := subject.SoftRemove("/a.txt"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	report, err := subject.GC()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Expired, 1; actual != expected {
+		t.Errorf("expected %d expired, got %d", expected, actual)
+	}
+	if actual, expected := report.Removed, 1; actual != expected {
+		t.Errorf("expected %d removed, got %d", expected, actual)
+	}
+	if err := subject.Undelete("/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist for expired entry, got: %v", err)
+	}
+
+	if err := setupDedupeFS(t, t.TempDir()).SoftRemove("/a.txt"); !errors.Is(err, fsdedupe.ErrNoTrashDir) {
+		t.Errorf("expected ErrNoTrashDir, got: %v", err)
+	}
+}
+
+func assertDedupeFSContents(t *testing.T, subject *fsdedupe.DedupeFS, name, expected string) {
+	t.Helper()
+	f, err := subject.Open(name)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual := string(b); actual != expected {
+		t.Errorf("expected %q contents %q, got %q", name, expected, actual)
+	}
+}
@@ -0,0 +1,158 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// TreeDifferenceKind is a kind of difference between two trees (see CompareTrees).
+type TreeDifferenceKind string
+
+const (
+	// TreeOnlyA is for entries only found in the first tree (dirs are not descended into).
+	TreeOnlyA TreeDifferenceKind = "only-a"
+	// TreeOnlyB is for entries only found in the second tree (dirs are not descended into).
+	TreeOnlyB TreeDifferenceKind = "only-b"
+	// TreeType is for entries of different types in both trees (file, dir or other symlink).
+	TreeType TreeDifferenceKind = "type"
+	// TreeContent is for files of different contents (or other symlinks of different targets).
+	TreeContent TreeDifferenceKind = "content"
+)
+
+// TreeDifference is a difference between two trees.
+type TreeDifference struct {
+	// Path is a slash-separated entry path, relative to tree roots.
+	Path string
+	Kind TreeDifferenceKind
+}
+
+// CompareTrees compares (read-only) two dir trees by structure and logical content, the same as TreeHash does
+// (symlinks to regular files count as their targets' contents, modes and times are ignored),
+// returning differences in path order, none for content-identical trees.
+// Files of different sizes are not read; WithLimiter and WithHashCache options are honored.
+func CompareTrees(ctx context.Context, a, b string, opts ...Option) ([]TreeDifference, error) {
+	o := buildOptions(opts)
+	ctx, span := o.tracer.Start(ctx, "fsdedupe.CompareTrees")
+	var diffs []TreeDifference
+	err := compareTrees(ctx, sha512.New(), filepath.Clean(a), filepath.Clean(b), "", &diffs, o)
+	endSpan(span, err)
+	return diffs, err
+}
+
+// treeEntry is a dir entry, kind being f (file), d (dir) or l (other symlink), as hashed by treeHash.
+type treeEntry struct {
+	kind string
+	path string
+	size int64 // of files
+}
+
+func compareTrees(ctx context.Context, digest hash.Hash, a, b, rel string, diffs *[]TreeDifference, o *options) error {
+	entriesA, err := readTreeEntries(a)
+	if err != nil {
+		return err
+	}
+	entriesB, err := readTreeEntries(b)
+	if err != nil {
+		return err
+	}
+
+	names := treeNames(entriesA, entriesB)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entryA, okA := entriesA[name]
+		entryB, okB := entriesB[name]
+		p := path.Join(rel, name)
+		switch {
+		case !okB:
+			*diffs = append(*diffs, TreeDifference{Path: p, Kind: TreeOnlyA})
+		case !okA:
+			*diffs = append(*diffs, TreeDifference{Path: p, Kind: TreeOnlyB})
+		case entryA.kind != entryB.kind:
+			*diffs = append(*diffs, TreeDifference{Path: p, Kind: TreeType})
+		case entryA.kind == "d":
+			if err := compareTrees(ctx, digest, entryA.path, entryB.path, p, diffs, o); err != nil {
+				return err
+			}
+		case entryA.kind == "l":
+			targetA, err := os.Readlink(entryA.path)
+			if err != nil {
+				return fmt.Errorf("readlink %q: %w", entryA.path, err)
+			}
+			targetB, err := os.Readlink(entryB.path)
+			if err != nil {
+				return fmt.Errorf("readlink %q: %w", entryB.path, err)
+			}
+			if targetA != targetB {
+				*diffs = append(*diffs, TreeDifference{Path: p, Kind: TreeContent})
+			}
+		default:
+			if entryA.size != entryB.size {
+				*diffs = append(*diffs, TreeDifference{Path: p, Kind: TreeContent})
+				continue
+			}
+			hashA, err := treeFileHash(ctx, digest, entryA.path, o)
+			if err != nil {
+				return err
+			}
+			hashB, err := treeFileHash(ctx, digest, entryB.path, o)
+			if err != nil {
+				return err
+			}
+			if hashA != hashB {
+				*diffs = append(*diffs, TreeDifference{Path: p, Kind: TreeContent})
+			}
+		}
+	}
+	return nil
+}
+
+// readTreeEntries reads dir entries as classified by treeHash, skipping devices, sockets etc.
+func readTreeEntries(dir string) (map[string]treeEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %q: %w", dir, err)
+	}
+
+	byName := make(map[string]treeEntry, len(entries))
+	for _, entry := range entries {
+		p := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			byName[entry.Name()] = treeEntry{kind: "d", path: p}
+		case entry.Type().IsRegular(), entry.Type()&os.ModeSymlink != 0:
+			stat, err := os.Stat(p)
+			if err == nil && stat.Mode().IsRegular() {
+				byName[entry.Name()] = treeEntry{kind: "f", path: p, size: stat.Size()}
+			} else if entry.Type()&os.ModeSymlink != 0 {
+				byName[entry.Name()] = treeEntry{kind: "l", path: p}
+			} else if err != nil {
+				return nil, fmt.Errorf("stat %q: %w", p, err)
+			}
+		}
+	}
+	return byName, nil
+}
+
+// treeNames returns names of both a and b, sorted, each once.
+func treeNames(a, b map[string]treeEntry) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,60 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestCompareTrees(t *testing.T) {
+	tmp := t.TempDir()
+	a := filepath.Join(tmp, "a")
+	b := filepath.Join(tmp, "b")
+
+	writeFile(t, filepath.Join(a, "same.txt"), "SAME")
+	writeFile(t, filepath.Join(b, "same.txt"), "SAME")
+	writeFile(t, filepath.Join(a, "sub", "linked.txt"), "DUPE")
+	writeFile(t, filepath.Join(b, "sub", "canonical.txt"), "DUPE")
+	if err := os.Symlink(filepath.Join(b, "sub", "canonical.txt"), filepath.Join(b, "sub", "linked.txt")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	writeFile(t, filepath.Join(a, "sub", "canonical.txt"), "DUPE")
+
+	// deduplicated tree equals the original one
+	diffs, err := fsdedupe.CompareTrees(context.Background(), a, b)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("expected no differences, got %+v", diffs)
+	}
+
+	writeFile(t, filepath.Join(a, "sub", "changed.txt"), "AAAA")
+	writeFile(t, filepath.Join(b, "sub", "changed.txt"), "BBBB")
+	writeFile(t, filepath.Join(a, "resized.txt"), "A")
+	writeFile(t, filepath.Join(b, "resized.txt"), "BB")
+	writeFile(t, filepath.Join(a, "only", "file.txt"), "A")
+	writeFile(t, filepath.Join(b, "new.txt"), "B")
+	writeFile(t, filepath.Join(a, "kind"), "FILE")
+	if err := os.Mkdir(filepath.Join(b, "kind"), 0700); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	diffs, err = fsdedupe.CompareTrees(context.Background(), a, b)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []fsdedupe.TreeDifference{
+		{Path: "kind", Kind: fsdedupe.TreeType},
+		{Path: "new.txt", Kind: fsdedupe.TreeOnlyB},
+		{Path: "only", Kind: fsdedupe.TreeOnlyA},
+		{Path: "resized.txt", Kind: fsdedupe.TreeContent},
+		{Path: "sub/changed.txt", Kind: fsdedupe.TreeContent},
+	}; !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, diffs)
+	}
+}
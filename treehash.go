@@ -0,0 +1,94 @@
+package fsdedupe
+
+import (
+	"context"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+)
+
+// TreeHash computes a Merkle-style root hash (hex-encoded SHA512) of dir tree logical content:
+// entry names and content hashes, recursively.
+// Symlinks to regular files count as their targets' contents,
+// so deduplication (see DedupeSymlink) does not change it, but any content or name change does.
+// Other symlinks count as their target paths. File modes and times are not included.
+// WithLimiter and WithHashCache options are honored.
+func TreeHash(ctx context.Context, dir string, opts ...Option) (string, error) {
+	o := buildOptions(opts)
+	ctx, span := o.tracer.Start(ctx, "fsdedupe.TreeHash")
+	root, err := treeHash(ctx, sha512.New(), filepath.Clean(dir), o)
+	endSpan(span, err)
+	return root, err
+}
+
+// treeHash hashes dir entries as "<kind> <name>\x00<hash>\n" lines in name order,
+// kind being f (file), d (dir) or l (other symlink).
+func treeHash(ctx context.Context, digest hash.Hash, dir string, o *options) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("read dir %q: %w", dir, err)
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		var kind, h string
+		switch {
+		case entry.IsDir():
+			if h, err = treeHash(ctx, digest, path, o); err != nil {
+				return "", err
+			}
+			kind = "d"
+		case entry.Type().IsRegular():
+			if h, err = treeFileHash(ctx, digest, path, o); err != nil {
+				return "", err
+			}
+			kind = "f"
+		case entry.Type()&os.ModeSymlink != 0:
+			if stat, err := os.Stat(path); err == nil && stat.Mode().IsRegular() {
+				if h, err = treeFileHash(ctx, digest, path, o); err != nil {
+					return "", err
+				}
+				kind = "f"
+				break
+			}
+			if h, err = os.Readlink(path); err != nil {
+				return "", fmt.Errorf("readlink %q: %w", path, err)
+			}
+			kind = "l"
+		default:
+			continue // devices, sockets etc have no content
+		}
+		lines = append(lines, fmt.Sprintf("%s %s\x00%s\n", kind, entry.Name(), h))
+	}
+
+	digest.Reset()
+	for _, line := range lines {
+		digest.Write([]byte(line))
+	}
+	return fmt.Sprintf("%x", digest.Sum(nil)), nil
+}
+
+func treeFileHash(ctx context.Context, digest hash.Hash, filename string, o *options) (string, error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return "", fmt.Errorf("stat %q: %w", filename, err)
+	}
+	if h, ok := o.hashCache.lookup(filename, stat.Size(), stat.ModTime()); ok {
+		return h, nil
+	}
+
+	digest.Reset()
+	h, err := hashContents(ctx, digest, filename, o.limiter)
+	if err != nil {
+		return "", fmt.Errorf("hash contents of %q: %w", filename, err)
+	}
+	o.hashCache.store(filename, stat.Size(), stat.ModTime(), h)
+	return h, nil
+}
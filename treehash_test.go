@@ -0,0 +1,60 @@
+package fsdedupe_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxmCherry/fsdedupe"
+)
+
+func TestTreeHash(t *testing.T) {
+	tmp := t.TempDir()
+
+	file1 := filepath.Join(tmp, "file1.txt")
+	writeFile(t, file1, "DUPE")
+	file2 := filepath.Join(tmp, "sub", "file2.txt")
+	writeFile(t, file2, "DUPE")
+	file3 := filepath.Join(tmp, "sub", "file3.txt")
+	writeFile(t, file3, "UNIQ")
+
+	before, err := fsdedupe.TreeHash(context.Background(), tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	if _, err := fsdedupe.DedupeSymlink(context.Background(), &simpleIterator{
+		Entries: []string{file1, file2, file3},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	after, err := fsdedupe.TreeHash(context.Background(), tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if after != before {
+		t.Fatalf("expected deduplication to keep tree hash %s, got %s", before, after)
+	}
+
+	if err := os.Rename(file3, filepath.Join(tmp, "sub", "renamed.txt")); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	renamed, err := fsdedupe.TreeHash(context.Background(), tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if renamed == before {
+		t.Fatalf("expected renaming to change tree hash %s", before)
+	}
+
+	writeFile(t, file1, "CHANGED")
+	changed, err := fsdedupe.TreeHash(context.Background(), tmp)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if changed == renamed {
+		t.Fatalf("expected content change to change tree hash %s", renamed)
+	}
+}
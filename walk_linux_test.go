@@ -0,0 +1,48 @@
+package fsdedupe_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// bindMount bind-mounts src onto dst (till the test end), skipping the test if not permitted (not root).
+func bindMount(t *testing.T, src, dst string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		t.Fatalf("mkdir %q: %s", dst, err)
+	}
+	if err := syscall.Mount(src, dst, "", syscall.MS_BIND, ""); err != nil {
+		t.Skipf("bind mount %q: %s", dst, err)
+	}
+	t.Cleanup(func() {
+		if err := syscall.Unmount(dst, syscall.MNT_DETACH); err != nil {
+			t.Errorf("unmount %q: %s", dst, err)
+		}
+	})
+}
+
+func TestDedupeFS_GC_bindMounts(t *testing.T) {
+	tmp := t.TempDir()
+	subject := setupDedupeFS(t, tmp)
+
+	const contentsHash = "0a8649de6b948fac1722c82ee07f4e3e8386a071750daf23c56fbba31acc922323b362fe10327e7e3322bc9354df59e02ded56f7f6f0ebfd6e99702154299d51" // echo -n DUMMY | sha512sum
+	setupDedupeFS_Create(t, subject, "sub/file.txt", "DUMMY")
+
+	linkDir := filepath.Join(tmp, "link")
+	bindMount(t, filepath.Join(linkDir, "sub"), filepath.Join(linkDir, "other")) // the same dir under two names
+	bindMount(t, linkDir, filepath.Join(linkDir, "sub", "loop"))                 // an ancestor
+
+	report, err := subject.GC()
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if actual, expected := report.Removed, 0; actual != expected {
+		t.Fatalf("expected %d removed, got %d", expected, actual)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "data", contentsHash+".bin")); err != nil {
+		t.Fatalf("expected data file to still exist, but got: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package fsdedupe
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+func readXattrs(filename string) (map[string][]byte, error) {
+	names, err := xattrCall(func(dest []byte) (int, error) {
+		return syscall.Listxattr(filename, dest)
+	})
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := xattrCall(func(dest []byte) (int, error) {
+			return syscall.Getxattr(filename, string(name), dest)
+		})
+		if errors.Is(err, syscall.ENODATA) {
+			continue // removed meanwhile
+		} else if err != nil {
+			return nil, err
+		}
+		xattrs[string(name)] = value
+	}
+	return xattrs, nil
+}
+
+// xattrCall calls fn with a large enough buffer (querying its size first).
+func xattrCall(fn func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := fn(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		n, err := fn(buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // grown meanwhile
+		} else if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package fsdedupe
+
+func readXattrs(filename string) (map[string][]byte, error) {
+	// unsupported
+	return nil, nil
+}